@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/teomyth/iniq/internal/cloudinit"
+)
+
+var (
+	importCloudInitUser     string
+	importCloudInitOutput   string
+	importCloudInitKeysFile string
+)
+
+// importCloudInitCmd translates cloud-init user data into an INIQ config file
+var importCloudInitCmd = &cobra.Command{
+	Use:   "import-cloud-init <user-data>",
+	Short: "Translate cloud-init user data into an INIQ config file",
+	Long: `Read #cloud-config user data (or - for standard input) and print an INIQ
+config file for one of its users.
+
+The user's name, ssh_authorized_keys, GitHub ssh_import_id entries, sudo
+rules and admin groups are translated, as are the top-level ssh_pwauth and
+disable_root settings. Literal public keys are written to a keys file that
+the config file references as a file: key source. Settings that cannot be
+translated, such as passwords, are reported on standard error.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var content []byte
+		var err error
+		if args[0] == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read user data: %w", err)
+		}
+
+		userData, err := cloudinit.ParseUserData(content)
+		if err != nil {
+			return err
+		}
+		result, err := userData.Import(importCloudInitUser)
+		if err != nil {
+			return err
+		}
+
+		// Literal keys go to a file next to the config file
+		if len(result.AuthorizedKeys) > 0 {
+			keysFile := importCloudInitKeysFile
+			if keysFile == "" {
+				keysFile = filepath.Join(filepath.Dir(importCloudInitOutput), result.Manifest.User+".keys")
+			}
+			if keysFile, err = filepath.Abs(keysFile); err != nil {
+				return fmt.Errorf("failed to resolve keys file path: %w", err)
+			}
+			if err := os.WriteFile(keysFile, []byte(strings.Join(result.AuthorizedKeys, "\n")+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write keys file: %w", err)
+			}
+			result.Manifest.Keys = append([]string{"file:" + keysFile}, result.Manifest.Keys...)
+			fmt.Fprintf(os.Stderr, "Wrote public keys to %s\n", keysFile)
+		}
+
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		manifest, err := result.Manifest.Marshal()
+		if err != nil {
+			return err
+		}
+		if importCloudInitOutput == "" {
+			_, err = os.Stdout.Write(manifest)
+			return err
+		}
+		if err := os.WriteFile(importCloudInitOutput, manifest, 0644); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s, apply it with: iniq --config %s\n", importCloudInitOutput, importCloudInitOutput)
+		return nil
+	},
+}
+
+func init() {
+	importCloudInitCmd.Flags().StringVar(&importCloudInitUser, "user", "", "user to import (default: the first user in the user data)")
+	importCloudInitCmd.Flags().StringVarP(&importCloudInitOutput, "output", "o", "", "write the config file here instead of standard output")
+	importCloudInitCmd.Flags().StringVar(&importCloudInitKeysFile, "keys-file", "", "where to write literal public keys (default: <user>.keys next to the config file)")
+	rootCmd.AddCommand(importCloudInitCmd)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestImportCloudInitOptions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-cloudinit-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	userDataPath := filepath.Join(tempDir, "user-data")
+	userData := `#cloud-config
+ssh_pwauth: false
+disable_root: true
+users:
+  - name: deploy
+    groups: [sudo]
+    sudo: ALL=(ALL) ALL
+    ssh_import_id: [gh:deploy]
+    ssh_authorized_keys:
+      - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample deploy@laptop
+`
+	if err := os.WriteFile(userDataPath, []byte(userData), 0644); err != nil {
+		t.Fatalf("Failed to write user data: %v", err)
+	}
+
+	configPath := filepath.Join(tempDir, "iniq.yaml")
+	importCloudInitOutput = configPath
+	defer func() { importCloudInitOutput = "" }()
+	if err := importCloudInitCmd.RunE(importCloudInitCmd, []string{userDataPath}); err != nil {
+		t.Fatalf("import-cloud-init failed: %v", err)
+	}
+
+	// Load the generated file the way --config does, without any of the flags set
+	viper.SetConfigFile(configPath)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to read generated config: %v", err)
+	}
+	defer viper.SetConfigFile("")
+	options := buildOptions()
+
+	expected := map[string]any{
+		"user":              "deploy",
+		"keys":              []string{"file:" + filepath.Join(tempDir, "deploy.keys"), "github:deploy"},
+		"sudo-nopasswd":     false,
+		"ssh-password-auth": "disable",
+		"ssh-root-login":    "disable",
+	}
+	for key, value := range expected {
+		if !reflect.DeepEqual(options[key], value) {
+			t.Errorf("Expected %s to be %v, got %v", key, value, options[key])
+		}
+	}
+	if username != "deploy" || sudoNoPass {
+		t.Errorf("Expected flag variables to follow the config file, got user %q and sudo-nopasswd %v", username, sudoNoPass)
+	}
+
+	// A flag given on the command line still wins
+	if err := rootCmd.Flags().Set("user", "ops"); err != nil {
+		t.Fatalf("Failed to set --user: %v", err)
+	}
+	defer func() { _ = rootCmd.Flags().Set("user", "") }()
+	if options := buildOptions(); options["user"] != "ops" {
+		t.Errorf("Expected --user to override the config file, got %v", options["user"])
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/teomyth/iniq/internal/features/ssh"
+	"github.com/teomyth/iniq/pkg/sshkeys"
+)
+
+// keysCmd groups the SSH key helper commands
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "SSH key source helpers",
+	Long:  `Helpers for working with SSH key sources such as gh:user or url:https://...`,
+}
+
+// keysPinCmd prints a fingerprint pin list for key sources
+var keysPinCmd = &cobra.Command{
+	Use:   "pin <source>...",
+	Short: "Print fingerprint pins for SSH key sources",
+	Long: `Fetch the keys of one or more SSH key sources and print their fingerprints
+as a key-pins list for the INIQ config file.
+
+Run this from a trusted network and review the output. Once the pins are in
+the config file (or appended to a source as gh:user#SHA256:...), only keys
+matching them are installed and any other key offered by the source is
+reported as unexpected.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Use the token, proxy and TLS settings from the config file
+		options := make(map[string]any)
+		for _, key := range viper.AllKeys() {
+			options[key] = viper.Get(key)
+		}
+
+		fmt.Println("key-pins:")
+		for _, keySource := range args {
+			keys, err := ssh.FetchKeySource(options, keySource)
+			if err != nil {
+				return fmt.Errorf("failed to fetch keys from %s: %w", keySource, err)
+			}
+
+			spec, _ := sshkeys.SplitPins(keySource)
+			for _, key := range keys {
+				fmt.Printf("  - %q # %s %s\n", spec+"#"+key.Fingerprint, key.Type, key.Comment)
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	keysCmd.AddCommand(keysPinCmd)
+	rootCmd.AddCommand(keysCmd)
+}
@@ -2,10 +2,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
 	"os/user"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,14 +18,23 @@ import (
 	"github.com/spf13/viper"
 	"github.com/teomyth/iniq/internal/config"
 	"github.com/teomyth/iniq/internal/features"
+	_ "github.com/teomyth/iniq/internal/features/fail2ban" // Register fail2ban feature
+	"github.com/teomyth/iniq/internal/features/firewall"   // Register firewall feature
+	"github.com/teomyth/iniq/internal/features/hostkeys"   // Register host keys feature
+	_ "github.com/teomyth/iniq/internal/features/packages" // Register packages feature
 	_ "github.com/teomyth/iniq/internal/features/security" // Register security feature
 	_ "github.com/teomyth/iniq/internal/features/ssh"      // Register SSH feature
-	_ "github.com/teomyth/iniq/internal/features/sudo"     // Register sudo feature
+	"github.com/teomyth/iniq/internal/features/sudo"       // Register sudo feature
+	_ "github.com/teomyth/iniq/internal/features/sysctl"   // Register kernel parameter hardening feature
+	_ "github.com/teomyth/iniq/internal/features/system"   // Register system settings feature
+	_ "github.com/teomyth/iniq/internal/features/updates"  // Register automatic updates feature
 	_ "github.com/teomyth/iniq/internal/features/user"     // Register user feature
 	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/internal/sudoers"
 	"github.com/teomyth/iniq/internal/utils"
 	"github.com/teomyth/iniq/internal/version"
 	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/sshkeys"
 )
 
 // These variables are kept for backward compatibility
@@ -42,11 +55,34 @@ var (
 	skipSudo        bool
 	username        string
 	keys            []string
+	keysExclusive   bool
+	generateKey     string
+	insecureURLKeys bool
 	sshRootLogin    string
 	sshPasswordAuth string
+	sshUserCA       string
+	hostKeys        bool
+	regenHostKeys   bool
 	sshNoRoot       bool
 	sshNoPass       bool
 	sudoNoPass      bool
+	sudoDefaults    bool
+	sudoIOLog       bool
+	cloudInitConfig bool
+	firewallEnable  bool
+	firewallAllow   []string
+	firewallPolicy  string
+	fail2banEnable  bool
+	autoUpdates     bool
+	packageList     []string
+	hostname        string
+	timezone        string
+	locale          string
+	ntpEnable       bool
+	ntpServers      []string
+	sysctlEnable    bool
+	sysctlProfile   string
+	sysctlNoIPv6    bool
 	showStatus      bool
 	backupFiles     bool
 	allSecurity     bool
@@ -230,29 +266,7 @@ SSH access, security configurations, password policy enforcement, and system har
 		isRoot := os.Geteuid() == 0
 
 		// Create options map from viper
-		options := make(map[string]any)
-		for _, key := range viper.AllKeys() {
-			options[key] = viper.Get(key)
-		}
-
-		// Add command line flags that might not be in viper
-		options["user"] = username
-		options["keys"] = keys
-		options["ssh-root-login"] = sshRootLogin
-		options["ssh-password-auth"] = sshPasswordAuth
-		options["ssh-no-root"] = sshNoRoot
-		options["ssh-no-password"] = sshNoPass
-		options["sudo-nopasswd"] = sudoNoPass
-		options["skip-sudo"] = skipSudo
-		options["yes"] = yes
-		options["verbose"] = verbose
-		options["quiet"] = quiet
-		options["dry-run"] = dryRun
-		options["status"] = showStatus
-		options["backup"] = backupFiles
-		options["all"] = allSecurity
-		options["password"] = setPassword
-		options["no-password"] = noPassword
+		options := buildOptions()
 
 		// Handle --status flag
 		if showStatus {
@@ -355,9 +369,181 @@ SSH access, security configurations, password policy enforcement, and system har
 			}
 			fmt.Println()
 
-			// 4. System Privileges (fourth most important - privilege status)
+			// 4. Host Keys (server identity)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "hostkeys" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Host Keys\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					sshDir, _ := state["ssh_dir"].(string)
+					fmt.Printf("\033[1;36m● Host Keys\033[0m \033[90m(%s)\033[0m\n", sshDir)
+
+					// Display simplified host keys status
+					displaySimplifiedHostKeysStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 5. Sudo Defaults (policy applied to every sudo session), or doas rules on doas hosts
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "sudo" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Sudo Defaults\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					if doasConfig, ok := state["doas_config"].(string); ok {
+						fmt.Printf("\033[1;36m● Doas\033[0m \033[90m(%s)\033[0m\n", doasConfig)
+						displaySimplifiedDoasStatus(state)
+					} else {
+						fmt.Println("\033[1;36m● Sudo Defaults\033[0m")
+						displaySimplifiedSudoDefaultsStatus(state)
+					}
+					fmt.Println()
+				}
+			}
+
+			// 6. Firewall (inbound traffic)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "firewall" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Firewall\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					if backendName, ok := state["firewall_backend"].(string); ok {
+						fmt.Printf("\033[1;36m● Firewall\033[0m \033[90m(%s)\033[0m\n", backendName)
+					} else {
+						fmt.Println("\033[1;36m● Firewall\033[0m")
+					}
+
+					// Display simplified firewall status
+					displaySimplifiedFirewallStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 7. Brute-force Protection (fail2ban sshd jail)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "fail2ban" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Brute-force Protection\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					jailFile, _ := state["jail_file"].(string)
+					fmt.Printf("\033[1;36m● Brute-force Protection\033[0m \033[90m(%s)\033[0m\n", jailFile)
+
+					// Display simplified fail2ban status
+					displaySimplifiedFail2banStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 8. Automatic Updates (unattended security updates)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "updates" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Automatic Updates\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					configFile, _ := state["config_file"].(string)
+					if configFile != "" {
+						fmt.Printf("\033[1;36m● Automatic Updates\033[0m \033[90m(%s)\033[0m\n", configFile)
+					} else {
+						fmt.Println("\033[1;36m● Automatic Updates\033[0m")
+					}
+
+					// Display simplified automatic updates status
+					displaySimplifiedUpdatesStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 9. Packages (only when baseline packages are configured)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "packages" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Packages\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+					if configured, _ := state["packages_configured"].(bool); !configured {
+						continue
+					}
+
+					packageManager, _ := state["package_manager"].(string)
+					fmt.Printf("\033[1;36m● Packages\033[0m \033[90m(%s)\033[0m\n", packageManager)
+
+					// Display simplified packages status
+					displaySimplifiedPackagesStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 10. System Settings (hostname, timezone, locale and time sync)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "system" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● System Settings\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					fmt.Printf("\033[1;36m● System Settings\033[0m \033[90m(%s)\033[0m\n", "/etc/hostname")
+
+					// Display simplified system settings status
+					displaySimplifiedSystemStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 11. Kernel Parameters (sysctl hardening, live vs configured)
+			for _, feature := range sortedFeatures {
+				if feature.Name() == "sysctl" {
+					// Detect current state
+					state, err := feature.DetectCurrentState(ctx)
+					if err != nil {
+						fmt.Println("\033[1;36m● Kernel Parameters\033[0m")
+						fmt.Printf("  \033[1;31m✗ Error: %v\033[0m\n", err)
+						continue
+					}
+
+					configFile, _ := state["config_file"].(string)
+					fmt.Printf("\033[1;36m● Kernel Parameters\033[0m \033[90m(%s)\033[0m\n", configFile)
+
+					// Display simplified kernel parameters status
+					displaySimplifiedSysctlStatus(state)
+					fmt.Println()
+				}
+			}
+
+			// 12. System Privileges (privilege status)
 			fmt.Println("\033[1;36m● System Privileges\033[0m")
 			displaySystemPrivileges(isRoot, hasPrivileges)
+			displayEnvironment(osInfo.Environment)
 
 			return
 		}
@@ -436,6 +622,7 @@ SSH access, security configurations, password policy enforcement, and system har
 				log.Warning("Some features will not be available")
 				skipSudo = true
 				options["skip-sudo"] = true
+				options["skip-privileged"] = true
 			}
 		}
 
@@ -459,6 +646,7 @@ SSH access, security configurations, password policy enforcement, and system har
 
 		// Get active features
 		activeFeatures := registry.GetActiveFeatures(options)
+		warnSkippedFeatures(log, registry, options)
 
 		// If no features are active and not in non-interactive mode (no -y/--yes flag), enter interactive mode
 		if len(activeFeatures) == 0 && !yes {
@@ -494,7 +682,7 @@ SSH access, security configurations, password policy enforcement, and system har
 					defaultUsername := currentUser.Username
 
 					// Prompt user to enter username, default is current user
-					fmt.Printf("\n\033[0;34m[1/4]\033[0m \033[1mUser Management\033[0m\n")
+					fmt.Printf("\n\033[0;34m[1/5]\033[0m \033[1mUser Management\033[0m\n")
 					fmt.Printf("────────────────────────────────────────\n")
 
 					// Detect and display current user state
@@ -549,7 +737,7 @@ SSH access, security configurations, password policy enforcement, and system har
 				}
 			} else {
 				// If username is already specified, show information
-				fmt.Printf("\n\033[0;34m[1/4]\033[0m \033[1mUser Management\033[0m\n")
+				fmt.Printf("\n\033[0;34m[1/5]\033[0m \033[1mUser Management\033[0m\n")
 				fmt.Printf("────────────────────────────────────────\n")
 
 				// Detect and display current user state
@@ -569,7 +757,7 @@ SSH access, security configurations, password policy enforcement, and system har
 
 			// Prompt user to enter SSH keys
 			if len(keys) == 0 {
-				fmt.Printf("\n\033[0;34m[2/4]\033[0m \033[1mSSH Key Management\033[0m\n")
+				fmt.Printf("\n\033[0;34m[2/5]\033[0m \033[1mSSH Key Management\033[0m\n")
 				fmt.Printf("────────────────────────────────────────\n")
 
 				// Detect and display current SSH key state
@@ -593,6 +781,7 @@ SSH access, security configurations, password policy enforcement, and system har
 				// Only prompt if we still need to
 				fmt.Println("Enter SSH key sources:")
 				fmt.Println("  • github:username     - Import keys from GitHub user")
+				fmt.Println("  • gh-team:org/team    - Import keys from GitHub team members")
 				fmt.Println("  • gitlab:username     - Import keys from GitLab user")
 				fmt.Println("  • url:https://...     - Import keys from URL")
 				fmt.Println("  • file:/path/to/key   - Import keys from local file")
@@ -615,7 +804,7 @@ SSH access, security configurations, password policy enforcement, and system har
 
 			// Only prompt for sudo configuration if username is provided
 			if username != "" {
-				fmt.Printf("\n\033[0;34m[3/4]\033[0m \033[1mSudo Configuration\033[0m\n")
+				fmt.Printf("\n\033[0;34m[3/5]\033[0m \033[1mSudo Configuration\033[0m\n")
 				fmt.Printf("────────────────────────────────────────\n")
 
 				// Detect and display current sudo state
@@ -767,7 +956,7 @@ SSH access, security configurations, password policy enforcement, and system har
 
 			// Only prompt for SSH security settings if sudo is not skipped
 			if !skipSudo {
-				fmt.Printf("\n\033[0;34m[4/4]\033[0m \033[1mSSH Security Configuration\033[0m\n")
+				fmt.Printf("\n\033[0;34m[4/5]\033[0m \033[1mSSH Security Configuration\033[0m\n")
 				fmt.Printf("────────────────────────────────────────\n")
 
 				// Detect and display current SSH security state
@@ -838,15 +1027,69 @@ SSH access, security configurations, password policy enforcement, and system har
 					// Mark that we have SSH security changes
 					options["ssh-security-has-changes"] = true
 				} else {
-					// Mark that we don't have SSH security changes
-					options["ssh-security-has-changes"] = false
+					// Without SSH setting changes the feature only runs to align cloud-init
+					alignCloudInit, _ := options["cloud-init-config"].(bool)
+					options["ssh-security-has-changes"] = alignCloudInit
 				}
 			} else {
-				fmt.Printf("\n\033[0;34m[4/4]\033[0m \033[1mSSH Security Configuration\033[0m\n")
+				fmt.Printf("\n\033[0;34m[4/5]\033[0m \033[1mSSH Security Configuration\033[0m\n")
 				fmt.Printf("────────────────────────────────────────\n")
 				fmt.Printf("\n\033[90mSkipping SSH security configuration (requires sudo)\033[0m\n")
 			}
 
+			fmt.Printf("\n\033[0;34m[5/5]\033[0m \033[1mSystem Settings\033[0m\n")
+			fmt.Printf("────────────────────────────────────────\n")
+			options["system-has-changes"] = false
+
+			// Only prompt for system settings if sudo is not skipped
+			if !skipSudo {
+				for _, feature := range sortedFeatures {
+					if feature.Name() != "system" {
+						continue
+					}
+					state, err := feature.DetectCurrentState(stateCtx)
+					if err != nil {
+						log.Warning("Failed to detect system settings: %v", err)
+						break
+					}
+					feature.DisplayCurrentState(stateCtx, state)
+					if !feature.ShouldPromptUser(stateCtx, state) {
+						break
+					}
+
+					// Each answer is validated on its own, so a typo keeps the current value
+					hasSystemChanges := false
+					for _, setting := range []struct{ key, question string }{
+						{"hostname", "Hostname"},
+						{"timezone", "Timezone"},
+						{"locale", "Locale"},
+					} {
+						current, _ := state[setting.key].(string)
+						value := strings.TrimSpace(utils.PromptWithDefault(setting.question, current))
+						if value == "" || value == current {
+							continue
+						}
+						if err := feature.ValidateOptions(map[string]any{setting.key: value}); err != nil {
+							log.Warning("Keeping the current %s: %v", setting.key, err)
+							continue
+						}
+						options[setting.key] = value
+						hasSystemChanges = true
+					}
+
+					if active, _ := state["time_sync_active"].(bool); !active {
+						if utils.PromptYesNo("Enable time synchronization?", true) {
+							options["ntp"] = true
+							hasSystemChanges = true
+						}
+					}
+					options["system-has-changes"] = hasSystemChanges
+					break
+				}
+			} else {
+				fmt.Printf("\n\033[90mSkipping system settings (requires sudo)\033[0m\n")
+			}
+
 			// Get active features again
 			activeFeatures = registry.GetActiveFeatures(options)
 
@@ -886,6 +1129,10 @@ SSH access, security configurations, password policy enforcement, and system har
 			if sshSecurityHasChanges {
 				operationCount++
 			}
+			systemHasChanges, _ := options["system-has-changes"].(bool)
+			if systemHasChanges {
+				operationCount++
+			}
 
 			// Check if we have any operations to perform
 			if operationCount == 0 {
@@ -916,10 +1163,16 @@ SSH access, security configurations, password policy enforcement, and system har
 				fmt.Printf("[%d/%d] SSH Key Management\n", operationIndex, operationCount)
 				fmt.Printf("  - Import SSH keys from:\n")
 				for _, key := range keys {
-					source, value, _ := parseKeySource(key)
+					spec, pins := sshkeys.SplitPins(key)
+					source, value, _ := parseKeySource(spec)
+					if len(pins) > 0 {
+						value = fmt.Sprintf("%s (%d pinned)", value, len(pins))
+					}
 					switch source {
 					case "github":
 						fmt.Printf("    * GitHub user: %s\n", value)
+					case "github-team":
+						fmt.Printf("    * GitHub team: %s\n", value)
 					case "gitlab":
 						fmt.Printf("    * GitLab user: %s\n", value)
 					case "url":
@@ -971,6 +1224,29 @@ SSH access, security configurations, password policy enforcement, and system har
 					}
 				}
 
+				if alignCloudInit, _ := options["cloud-init-config"].(bool); alignCloudInit {
+					fmt.Printf("  - Make cloud-init keep the SSH settings\n")
+				}
+
+				operationIndex++
+				fmt.Println()
+			}
+
+			// Only show system settings if there are actual changes
+			if systemHasChanges {
+				fmt.Printf("[%d/%d] System Settings\n", operationIndex, operationCount)
+				if value, ok := options["hostname"].(string); ok && value != "" {
+					fmt.Printf("  - Set hostname to %s\n", value)
+				}
+				if value, ok := options["timezone"].(string); ok && value != "" {
+					fmt.Printf("  - Set timezone to %s\n", value)
+				}
+				if value, ok := options["locale"].(string); ok && value != "" {
+					fmt.Printf("  - Set locale to %s\n", value)
+				}
+				if ntp, _ := options["ntp"].(bool); ntp {
+					fmt.Printf("  - Enable time synchronization\n")
+				}
 				_ = operationIndex // Increment not needed here
 				fmt.Println()
 			}
@@ -1026,19 +1302,26 @@ SSH access, security configurations, password policy enforcement, and system har
 			case "ssh":
 				// Check if SSH keys are specified
 				keys, ok := options["keys"].([]string)
-				if !ok || len(keys) == 0 {
+				generate, _ := options["generate-key"].(string)
+				if ok && len(keys) > 0 {
+					title = "Configure SSH keys"
+				} else if generate != "" {
+					title = "Generate SSH key pair"
+				} else {
 					// No SSH keys specified, skip this operation
 					shouldAdd = false
-				} else {
-					title = "Configure SSH keys"
 				}
 			case "sudo":
 				// Check if sudo configuration is needed
 				skipSudo, _ := options["skip-sudo"].(bool)
 				sudoAlreadyConfigured, _ := options["sudo-already-configured"].(bool)
-				if skipSudo || sudoAlreadyConfigured {
+				applyDefaults, _ := options["sudo-defaults"].(bool)
+				targetUser, _ := options["user"].(string)
+				if skipSudo || (sudoAlreadyConfigured && !applyDefaults) {
 					// Sudo operations are skipped or already configured
 					shouldAdd = false
+				} else if sudoAlreadyConfigured || targetUser == "" {
+					title = "Apply sudo hardening defaults"
 				} else {
 					title = "Set up sudo permissions"
 				}
@@ -1085,19 +1368,26 @@ SSH access, security configurations, password policy enforcement, and system har
 			case "ssh":
 				// Check if SSH keys are specified
 				keys, ok := options["keys"].([]string)
-				if !ok || len(keys) == 0 {
+				generate, _ := options["generate-key"].(string)
+				if ok && len(keys) > 0 {
+					title = "Configuring SSH keys"
+				} else if generate != "" {
+					title = "Generating SSH key pair"
+				} else {
 					// No SSH keys specified, skip this operation
 					shouldExecute = false
-				} else {
-					title = "Configuring SSH keys"
 				}
 			case "sudo":
 				// Check if sudo configuration is needed
 				skipSudo, _ := options["skip-sudo"].(bool)
 				sudoAlreadyConfigured, _ := options["sudo-already-configured"].(bool)
-				if skipSudo || sudoAlreadyConfigured {
+				applyDefaults, _ := options["sudo-defaults"].(bool)
+				targetUser, _ := options["user"].(string)
+				if skipSudo || (sudoAlreadyConfigured && !applyDefaults) {
 					// Sudo operations are skipped or already configured
 					shouldExecute = false
+				} else if sudoAlreadyConfigured || targetUser == "" {
+					title = "Applying sudo hardening defaults"
 				} else {
 					title = "Setting up sudo permissions"
 				}
@@ -1243,18 +1533,10 @@ SSH access, security configurations, password policy enforcement, and system har
 							}
 						}
 					}
-				} else if strings.Contains(err.Error(), "network") ||
-					strings.Contains(err.Error(), "connection") ||
-					strings.Contains(err.Error(), "timeout") {
-					// Network error
-					if attempt < maxRetries {
-						log.Warning("Network error: %v. Retrying (%d/%d)...", err, attempt, maxRetries)
-						time.Sleep(2 * time.Second) // Wait before retry
-						continue
-					}
 				}
 
-				// For other errors or if we've exhausted retries
+				// Key fetches retry with backoff themselves and mark their failures as not
+				// retryable above, so they are not fetched again here
 				if attempt < maxRetries {
 					log.Warning("Error: %v. Retrying (%d/%d)...", err, attempt, maxRetries)
 					time.Sleep(1 * time.Second) // Wait before retry
@@ -1295,6 +1577,8 @@ SSH access, security configurations, password policy enforcement, and system har
 						securityMeasures = append(securityMeasures, "no password auth")
 					}
 					summaryText = fmt.Sprintf("SSH security: %s", strings.Join(securityMeasures, ", "))
+				} else if strings.Contains(title, "hardening defaults") {
+					summaryText = "Sudo hardening defaults installed"
 				} else if strings.Contains(title, "sudo") {
 					// For sudo operations
 					username, _ := options["user"].(string)
@@ -1391,6 +1675,16 @@ SSH access, security configurations, password policy enforcement, and system har
 				log.PrintSystemConfig(configs)
 			}
 
+			// Show the generated key last, so it is easy to copy as a deploy key
+			if keyPath, ok := options["generated-key-path"].(string); ok {
+				fingerprint, _ := options["generated-key-fingerprint"].(string)
+				publicKey, _ := options["generated-key-public"].(string)
+				log.MultiLine("info", "SSH key pair "+keyPath+":", []string{
+					"Fingerprint: " + fingerprint,
+					strings.TrimSpace(publicKey),
+				})
+			}
+
 			// Print success message based on overall success
 			if allSuccess {
 				log.Success("INIQ completed successfully")
@@ -1440,17 +1734,42 @@ func coloredHelpFunction(cmd *cobra.Command, args []string) {
 	// Display flag groups
 	fmt.Printf("\n\033[1;36mCore Feature Flags:\033[0m\n")
 	fmt.Printf("  -u, --user string           Username to create or configure\n")
-	fmt.Printf("  -k, --key strings           SSH key sources (github:user, gitlab:user, url:URL, file:path)\n")
+	fmt.Printf("  -k, --key strings           SSH key sources (github:user, gh-team:org/team, gitlab:user, url:URL, file:path)\n")
+	fmt.Printf("  --keys-exclusive            Replace authorized_keys with exactly the keys from the given sources\n")
+	fmt.Printf("  --generate-key TYPE         Generate an SSH key pair for the user (ed25519 or rsa)\n")
+	fmt.Printf("  --insecure-url-keys         Skip TLS certificate verification for url: key sources\n")
 	fmt.Printf("  -p, --password              Set password for the user (interactive prompt)\n")
 	fmt.Printf("  --no-pass                   Create user without password (skip password setup)\n")
 	fmt.Printf("  --ssh-root-login string     Configure SSH root login (yes|enable|true|1|y|t|on or no|disable|false|0|n|f|off)\n")
 	fmt.Printf("  --ssh-password-auth string  Configure SSH password authentication (yes|enable|true|1|y|t|on or no|disable|false|0|n|f|off)\n")
+	fmt.Printf("  --ssh-user-ca string        Trust SSH user certificates signed by the CA key from a key source\n")
 	fmt.Printf("  --ssh-no-root               Disable SSH root login (deprecated, use --ssh-root-login=disable)\n")
 	fmt.Printf("  --ssh-no-password           Disable SSH password authentication (deprecated, use --ssh-password-auth=disable)\n")
 	fmt.Printf("  --sudo-nopasswd             Configure sudo without password (default true)\n")
 
 	fmt.Printf("\n\033[1;36mSecurity Enhancement Flags:\033[0m\n")
 	fmt.Printf("  -a, --all                   Apply all security hardening options\n")
+	fmt.Printf("  --host-keys                 Remove weak SSH host keys and generate missing ed25519/RSA-4096 keys\n")
+	fmt.Printf("  --regenerate-host-keys      Regenerate all SSH host keys (for machines cloned from an image)\n")
+	fmt.Printf("  --sudo-defaults             Install hardened sudo Defaults (use_pty, logfile, timeouts)\n")
+	fmt.Printf("  --sudo-io-log               Also log sudo session input and output\n")
+	fmt.Printf("  --cloud-init-config         Make cloud-init keep the SSH settings applied by iniq\n")
+	fmt.Printf("  --firewall                  Enable the firewall, allowing SSH and denying other inbound traffic\n")
+	fmt.Printf("  --firewall-allow strings    Also allow PORT[/PROTO][@CIDR] or CIDR (e.g. 443, 53/udp, 5432@10.0.0.0/8)\n")
+	fmt.Printf("  --firewall-policy string    Default policy for other inbound traffic (deny or reject)\n")
+	fmt.Printf("  --fail2ban                  Install fail2ban and ban hosts that repeatedly fail SSH logins\n")
+	fmt.Printf("  --auto-updates              Install security updates automatically\n")
+	fmt.Printf("  --sysctl                    Harden kernel and network parameters in /etc/sysctl.d\n")
+	fmt.Printf("  --sysctl-profile string     Kernel parameter profile (baseline or strict)\n")
+	fmt.Printf("  --sysctl-disable-ipv6       Also disable IPv6 on all interfaces (with --sysctl)\n")
+
+	fmt.Printf("\n\033[1;36mSystem Setup Flags:\033[0m\n")
+	fmt.Printf("  --packages strings          Packages to install, by their Debian names (e.g. curl,vim,htop)\n")
+	fmt.Printf("  --hostname string           Set the hostname and map it in /etc/hosts\n")
+	fmt.Printf("  --timezone string           Set the timezone (e.g. Europe/Berlin, UTC)\n")
+	fmt.Printf("  --locale string             Generate a locale and make it the default (e.g. en_US.UTF-8)\n")
+	fmt.Printf("  --ntp                       Enable time sync with systemd-timesyncd or chrony\n")
+	fmt.Printf("  --ntp-servers strings       NTP servers to sync time with, implies --ntp\n")
 
 	fmt.Printf("\n\033[1;36mOperation Helper Flags:\033[0m\n")
 	fmt.Printf("  -b, --backup                Backup original configuration files\n")
@@ -1520,9 +1839,13 @@ func init() {
 
 	// Core Feature Flags - directly modify system functionality
 	rootCmd.Flags().StringVarP(&username, "user", "u", "", "username to create or configure")
-	rootCmd.Flags().StringSliceVarP(&keys, "key", "k", []string{}, "SSH key sources (github:user, gitlab:user, url:URL, file:path)")
+	rootCmd.Flags().StringSliceVarP(&keys, "key", "k", []string{}, "SSH key sources (github:user, gh-team:org/team, gitlab:user, url:URL, file:path)")
+	rootCmd.Flags().BoolVar(&keysExclusive, "keys-exclusive", false, "replace authorized_keys with exactly the keys from the given sources")
+	rootCmd.Flags().StringVar(&generateKey, "generate-key", "", "generate an SSH key pair for the user (ed25519 or rsa)")
+	rootCmd.Flags().BoolVar(&insecureURLKeys, "insecure-url-keys", false, "skip TLS certificate verification for url: key sources")
 	rootCmd.Flags().StringVar(&sshRootLogin, "ssh-root-login", "", "configure SSH root login (yes|enable|true|1|y|t|on or no|disable|false|0|n|f|off)")
 	rootCmd.Flags().StringVar(&sshPasswordAuth, "ssh-password-auth", "", "configure SSH password authentication (yes|enable|true|1|y|t|on or no|disable|false|0|n|f|off)")
+	rootCmd.Flags().StringVar(&sshUserCA, "ssh-user-ca", "", "trust SSH user certificates signed by the CA key from this source (e.g. url:https://ca/user_ca.pub)")
 	rootCmd.Flags().BoolVar(&sshNoRoot, "ssh-no-root", false, "disable SSH root login (deprecated, use --ssh-root-login=disable)")
 	rootCmd.Flags().BoolVar(&sshNoPass, "ssh-no-password", false, "disable SSH password authentication (deprecated, use --ssh-password-auth=disable)")
 	rootCmd.Flags().BoolVar(&sudoNoPass, "sudo-nopasswd", true, "configure sudo without password")
@@ -1531,6 +1854,25 @@ func init() {
 
 	// Security Enhancement Flags - security related combination options
 	rootCmd.Flags().BoolVarP(&allSecurity, "all", "a", false, "apply all security hardening options")
+	rootCmd.Flags().BoolVar(&hostKeys, "host-keys", false, "remove weak SSH host keys and generate missing ed25519/RSA-4096 keys")
+	rootCmd.Flags().BoolVar(&regenHostKeys, "regenerate-host-keys", false, "regenerate all SSH host keys (for machines cloned from an image)")
+	rootCmd.Flags().BoolVar(&sudoDefaults, "sudo-defaults", false, "install hardened sudo Defaults (use_pty, logfile, timeouts)")
+	rootCmd.Flags().BoolVar(&sudoIOLog, "sudo-io-log", false, "also log sudo session input and output")
+	rootCmd.Flags().BoolVar(&cloudInitConfig, "cloud-init-config", false, "make cloud-init keep the SSH settings applied by iniq")
+	rootCmd.Flags().BoolVar(&firewallEnable, "firewall", false, "enable the firewall, allowing SSH and denying other inbound traffic")
+	rootCmd.Flags().StringSliceVar(&firewallAllow, "firewall-allow", []string{}, "also allow PORT[/PROTO][@CIDR] or CIDR (e.g. 443, 53/udp, 5432@10.0.0.0/8)")
+	rootCmd.Flags().StringVar(&firewallPolicy, "firewall-policy", "deny", "default policy for other inbound traffic (deny or reject)")
+	rootCmd.Flags().BoolVar(&fail2banEnable, "fail2ban", false, "install fail2ban and ban hosts that repeatedly fail SSH logins")
+	rootCmd.Flags().BoolVar(&autoUpdates, "auto-updates", false, "install security updates automatically")
+	rootCmd.Flags().BoolVar(&sysctlEnable, "sysctl", false, "harden kernel and network parameters in /etc/sysctl.d")
+	rootCmd.Flags().StringVar(&sysctlProfile, "sysctl-profile", "baseline", "kernel parameter profile (baseline or strict)")
+	rootCmd.Flags().BoolVar(&sysctlNoIPv6, "sysctl-disable-ipv6", false, "also disable IPv6 on all interfaces (with --sysctl)")
+	rootCmd.Flags().StringSliceVar(&packageList, "packages", []string{}, "packages to install, by their Debian names (e.g. curl,vim,htop)")
+	rootCmd.Flags().StringVar(&hostname, "hostname", "", "set the hostname and map it in /etc/hosts")
+	rootCmd.Flags().StringVar(&timezone, "timezone", "", "set the timezone (e.g. Europe/Berlin, UTC)")
+	rootCmd.Flags().StringVar(&locale, "locale", "", "generate a locale and make it the default (e.g. en_US.UTF-8)")
+	rootCmd.Flags().BoolVar(&ntpEnable, "ntp", false, "enable time sync with systemd-timesyncd or chrony")
+	rootCmd.Flags().StringSliceVar(&ntpServers, "ntp-servers", []string{}, "NTP servers to sync time with, implies --ntp")
 
 	// Operation Helper Flags - affect operation behavior but don't directly modify system
 	rootCmd.Flags().BoolVarP(&backupFiles, "backup", "b", false, "backup original configuration files")
@@ -1549,13 +1891,35 @@ func init() {
 	// Bind flags to viper
 	_ = viper.BindPFlag("user", rootCmd.Flags().Lookup("user"))
 	_ = viper.BindPFlag("keys", rootCmd.Flags().Lookup("key"))
+	_ = viper.BindPFlag("keys-exclusive", rootCmd.Flags().Lookup("keys-exclusive"))
+	_ = viper.BindPFlag("generate-key", rootCmd.Flags().Lookup("generate-key"))
+	_ = viper.BindPFlag("insecure-url-keys", rootCmd.Flags().Lookup("insecure-url-keys"))
 	_ = viper.BindPFlag("ssh-root-login", rootCmd.Flags().Lookup("ssh-root-login"))
 	_ = viper.BindPFlag("ssh-password-auth", rootCmd.Flags().Lookup("ssh-password-auth"))
+	_ = viper.BindPFlag("ssh-user-ca", rootCmd.Flags().Lookup("ssh-user-ca"))
 	_ = viper.BindPFlag("ssh-no-root", rootCmd.Flags().Lookup("ssh-no-root"))
 	_ = viper.BindPFlag("ssh-no-password", rootCmd.Flags().Lookup("ssh-no-password"))
 	_ = viper.BindPFlag("sudo-nopasswd", rootCmd.Flags().Lookup("sudo-nopasswd"))
 	_ = viper.BindPFlag("backup", rootCmd.Flags().Lookup("backup"))
 	_ = viper.BindPFlag("all", rootCmd.Flags().Lookup("all"))
+	_ = viper.BindPFlag("host-keys", rootCmd.Flags().Lookup("host-keys"))
+	_ = viper.BindPFlag("sudo-defaults", rootCmd.Flags().Lookup("sudo-defaults"))
+	_ = viper.BindPFlag("sudo-io-log", rootCmd.Flags().Lookup("sudo-io-log"))
+	_ = viper.BindPFlag("cloud-init-config", rootCmd.Flags().Lookup("cloud-init-config"))
+	_ = viper.BindPFlag("firewall", rootCmd.Flags().Lookup("firewall"))
+	_ = viper.BindPFlag("firewall-allow", rootCmd.Flags().Lookup("firewall-allow"))
+	_ = viper.BindPFlag("firewall-policy", rootCmd.Flags().Lookup("firewall-policy"))
+	_ = viper.BindPFlag("fail2ban", rootCmd.Flags().Lookup("fail2ban"))
+	_ = viper.BindPFlag("auto-updates", rootCmd.Flags().Lookup("auto-updates"))
+	_ = viper.BindPFlag("sysctl", rootCmd.Flags().Lookup("sysctl"))
+	_ = viper.BindPFlag("sysctl-profile", rootCmd.Flags().Lookup("sysctl-profile"))
+	_ = viper.BindPFlag("sysctl-disable-ipv6", rootCmd.Flags().Lookup("sysctl-disable-ipv6"))
+	_ = viper.BindPFlag("packages", rootCmd.Flags().Lookup("packages"))
+	_ = viper.BindPFlag("hostname", rootCmd.Flags().Lookup("hostname"))
+	_ = viper.BindPFlag("timezone", rootCmd.Flags().Lookup("timezone"))
+	_ = viper.BindPFlag("locale", rootCmd.Flags().Lookup("locale"))
+	_ = viper.BindPFlag("ntp", rootCmd.Flags().Lookup("ntp"))
+	_ = viper.BindPFlag("ntp-servers", rootCmd.Flags().Lookup("ntp-servers"))
 	_ = viper.BindPFlag("password", rootCmd.Flags().Lookup("password"))
 	_ = viper.BindPFlag("no-password", rootCmd.Flags().Lookup("no-pass"))
 	_ = viper.BindPFlag("skip-sudo", rootCmd.PersistentFlags().Lookup("skip-sudo"))
@@ -1573,6 +1937,11 @@ func isNonRetryableError(err error) bool {
 		return false
 	}
 
+	// Features mark errors that a retry cannot fix
+	if errors.Is(err, features.ErrNotRetryable) {
+		return true
+	}
+
 	errorMsg := err.Error()
 
 	// Configuration and parameter errors that should not be retried
@@ -1616,7 +1985,7 @@ func isNonRetryableError(err error) bool {
 	return false
 }
 
-// userInSudoGroup checks if the current user is in the sudo/wheel group
+// userInSudoGroup checks if the current user is in the admin group
 // and verifies if sudo privileges are actually working
 func userInSudoGroup() bool {
 	// Get current user, considering SUDO_USER environment variable
@@ -1632,6 +2001,7 @@ func userInSudoGroup() bool {
 	}
 
 	// Check each group
+	adminGroup := adminGroupName()
 	inSudoGroup := false
 	for _, gid := range groupIds {
 		group, err := user.LookupGroupId(gid)
@@ -1639,9 +2009,7 @@ func userInSudoGroup() bool {
 			continue
 		}
 
-		// Check if group name is sudo, wheel, or admin (common sudo group names)
-		groupName := strings.ToLower(group.Name)
-		if groupName == "sudo" || groupName == "wheel" || groupName == "admin" {
+		if group.Name == adminGroup {
 			inSudoGroup = true
 			break
 		}
@@ -1683,13 +2051,19 @@ func userInSudoGroup() bool {
 	return false
 }
 
-// addUserToSudoGroup adds the specified user to the sudo group
+// adminGroupName returns the admin group of this system, honoring the admin-group setting
+func adminGroupName() string {
+	osInfo, err := osdetect.Detect()
+	if err != nil {
+		return sudoers.DefaultAdminGroup(osdetect.UnknownDistro)
+	}
+	return sudoers.AdminGroupName(osInfo, viper.GetString("admin-group"))
+}
+
+// addUserToSudoGroup adds the specified user to the admin group
 func addUserToSudoGroup(log *logger.Logger, username string) error {
 	// Check if we're running as root
 	if os.Geteuid() == 0 {
-		// We're root, so we can directly add the user to sudo group
-		log.Info("Adding user '%s' to sudo group...", username)
-
 		// Detect OS
 		osInfo, err := osdetect.Detect()
 		if err != nil {
@@ -1699,10 +2073,19 @@ func addUserToSudoGroup(log *logger.Logger, username string) error {
 		var cmd *exec.Cmd
 		switch osInfo.Type {
 		case osdetect.Linux:
-			// On Linux, use usermod to add user to sudo group
-			cmd = exec.Command("usermod", "-aG", "sudo", username)
+			// Create the admin group and its sudoers rule if the distribution has neither
+			group, err := sudo.EnsureAdminGroup(log, osInfo, viper.GetString("admin-group"))
+			if err != nil {
+				return err
+			}
+
+			// On Linux, use usermod (or busybox adduser) to add user to the admin group
+			log.Info("Adding user '%s' to %s group...", username, group.Name)
+			args := sudo.GroupMemberCommand(username, group.Name)
+			cmd = exec.Command(args[0], args[1:]...)
 		case osdetect.Darwin:
 			// On macOS, use dseditgroup to add user to admin group
+			log.Info("Adding user '%s' to admin group...", username)
 			cmd = exec.Command("dseditgroup", "-o", "edit", "-a", username, "-t", "user", "admin")
 		default:
 			return fmt.Errorf("unsupported OS: %s", osInfo.Type)
@@ -1736,10 +2119,20 @@ func addUserToSudoGroup(log *logger.Logger, username string) error {
 		var cmd *exec.Cmd
 		switch osInfo.Type {
 		case osdetect.Linux:
-			// On Linux, always use su with full path to usermod
+			// The sudoers policy is not readable yet, so only the group is created here
+			group, err := sudoers.LocalAdminGroup(osInfo, viper.GetString("admin-group"))
+			if err != nil {
+				return fmt.Errorf("failed to resolve admin group: %w", err)
+			}
+
+			// On Linux, always use su with full paths to the group tools
 			// We can't use sudo here because the user doesn't have sudo privileges yet
-			log.Info("Running: su -c \"/usr/sbin/usermod -aG sudo %s\"", username)
-			cmd = exec.Command("su", "-c", fmt.Sprintf("/usr/sbin/usermod -aG sudo %s", username))
+			script := "/usr/sbin/" + strings.Join(sudo.GroupMemberCommand(username, group.Name), " ")
+			if !group.Exists() {
+				script = "/usr/sbin/" + strings.Join(sudo.GroupAddCommand(group.Name), " ") + " && " + script
+			}
+			log.Info("Running: su -c \"%s\"", script)
+			cmd = exec.Command("su", "-c", script)
 		case osdetect.Darwin:
 			// On macOS, use sudo to run dseditgroup
 			log.Info("Running: sudo dseditgroup -o edit -a %s -t user admin", username)
@@ -1770,7 +2163,7 @@ func addUserToSudoGroup(log *logger.Logger, username string) error {
 	}
 }
 
-// verifyUserInSudoGroup checks if the specified user is in the sudo/wheel/admin group
+// verifyUserInSudoGroup checks if the specified user is in the admin group
 func verifyUserInSudoGroup(username string) bool {
 	// Get user information
 	u, err := user.Lookup(username)
@@ -1785,15 +2178,14 @@ func verifyUserInSudoGroup(username string) bool {
 	}
 
 	// Check each group
+	adminGroup := adminGroupName()
 	for _, gid := range groupIds {
 		group, err := user.LookupGroupId(gid)
 		if err != nil {
 			continue
 		}
 
-		// Check if group name is sudo, wheel, or admin (common sudo group names)
-		groupName := strings.ToLower(group.Name)
-		if groupName == "sudo" || groupName == "wheel" || groupName == "admin" {
+		if group.Name == adminGroup {
 			return true
 		}
 	}
@@ -1818,7 +2210,7 @@ func activateSudoGroup(log *logger.Logger) error {
 
 		// Method 1: Use sg command to run a command as sudo group
 		log.Info("Trying sg method...")
-		sgCmd := exec.Command("sg", "sudo", "-c", "id")
+		sgCmd := exec.Command("sg", adminGroupName(), "-c", "id")
 		sgOutput, err := sgCmd.CombinedOutput()
 		if err == nil {
 			log.Info("sg command successful: %s", string(sgOutput))
@@ -1879,10 +2271,12 @@ func parseKeySource(keySource string) (string, string, error) {
 
 		// Validate source
 		switch source {
-		case "github", "gh", "gitlab", "gl", "url", "file", "f":
+		case "github", "gh", "github-team", "gh-team", "gitlab", "gl", "url", "file", "f":
 			// Map short forms to full forms
 			if source == "gh" {
 				source = "github"
+			} else if source == "gh-team" {
+				source = "github-team"
 			} else if source == "gl" {
 				source = "gitlab"
 			} else if source == "f" {
@@ -1935,6 +2329,88 @@ func getRealUser() (*user.User, error) {
 	return user.Current()
 }
 
+// buildOptions returns the feature options. Flags bound to viper are read through it, so values
+// from a config file apply unless the flag is given on the command line, and the flag variables
+// the interactive flow reads are updated to match.
+func buildOptions() map[string]any {
+	username = viper.GetString("user")
+	keys = viper.GetStringSlice("keys")
+	sshRootLogin = viper.GetString("ssh-root-login")
+	sshPasswordAuth = viper.GetString("ssh-password-auth")
+	sshNoRoot = viper.GetBool("ssh-no-root")
+	sshNoPass = viper.GetBool("ssh-no-password")
+	sudoNoPass = viper.GetBool("sudo-nopasswd")
+	backupFiles = viper.GetBool("backup")
+	allSecurity = viper.GetBool("all")
+
+	options := make(map[string]any)
+	for _, key := range viper.AllKeys() {
+		options[key] = viper.Get(key)
+	}
+
+	// Add command line flags that might not be in viper
+	options["user"] = username
+	options["keys"] = keys
+	options["keys-exclusive"] = viper.GetBool("keys-exclusive")
+	options["generate-key"] = viper.GetString("generate-key")
+	options["insecure-url-keys"] = viper.GetBool("insecure-url-keys")
+	options["ssh-root-login"] = sshRootLogin
+	options["ssh-password-auth"] = sshPasswordAuth
+	options["ssh-user-ca"] = viper.GetString("ssh-user-ca")
+	options["host-keys"] = viper.GetBool("host-keys")
+	options["regenerate-host-keys"] = regenHostKeys
+	options["ssh-no-root"] = sshNoRoot
+	options["ssh-no-password"] = sshNoPass
+	options["sudo-nopasswd"] = sudoNoPass
+	options["sudo-defaults"] = viper.GetBool("sudo-defaults")
+	options["sudo-io-log"] = viper.GetBool("sudo-io-log")
+	options["cloud-init-config"] = viper.GetBool("cloud-init-config")
+	options["firewall"] = viper.GetBool("firewall")
+	options["firewall-allow"] = viper.GetStringSlice("firewall-allow")
+	options["firewall-policy"] = viper.GetString("firewall-policy")
+	options["fail2ban"] = viper.GetBool("fail2ban")
+	options["auto-updates"] = viper.GetBool("auto-updates")
+	options["packages"] = viper.GetStringSlice("packages")
+	// AllKeys flattens nested maps, so the name map is read whole
+	options["package-names"] = viper.GetStringMap("package-names")
+	options["hostname"] = viper.GetString("hostname")
+	options["timezone"] = viper.GetString("timezone")
+	options["locale"] = viper.GetString("locale")
+	options["ntp"] = viper.GetBool("ntp")
+	options["ntp-servers"] = viper.GetStringSlice("ntp-servers")
+	options["sysctl"] = viper.GetBool("sysctl")
+	options["sysctl-profile"] = viper.GetString("sysctl-profile")
+	options["sysctl-disable-ipv6"] = viper.GetBool("sysctl-disable-ipv6")
+	options["skip-sudo"] = skipSudo
+	options["skip-privileged"] = skipSudo
+	options["yes"] = yes
+	options["verbose"] = verbose
+	options["quiet"] = quiet
+	options["dry-run"] = dryRun
+	options["status"] = showStatus
+	options["backup"] = backupFiles
+	options["all"] = allSecurity
+	options["password"] = setPassword
+	options["no-password"] = noPassword
+
+	return options
+}
+
+// warnSkippedFeatures logs the requested features that do not run because operations
+// needing root are skipped
+func warnSkippedFeatures(log *logger.Logger, registry *features.Registry, options map[string]any) {
+	if !features.PrivilegedSkipped(options) {
+		return
+	}
+	privileged := maps.Clone(options)
+	delete(privileged, "skip-privileged")
+	for _, feature := range registry.GetFeatures() {
+		if !feature.ShouldActivate(options) && feature.ShouldActivate(privileged) {
+			log.Warning("Skipping %s: it requires root privileges and operations requiring sudo are skipped", feature.Name())
+		}
+	}
+}
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	// Use the config package to initialize configuration
@@ -1981,6 +2457,17 @@ func displaySystemPrivileges(isRoot bool, hasPrivileges bool) {
 	}
 }
 
+// displayEnvironment shows where the system runs when it is not bare metal
+func displayEnvironment(env osdetect.Environment) {
+	if env == (osdetect.Environment{}) {
+		return
+	}
+	fmt.Printf("  \033[1;34m%s\033[0m: %s\n", "Environment", env)
+	if env.InContainer() || env.WSL {
+		fmt.Printf("    \033[90mSSH service reloads are skipped when sshd is not running\033[0m\n")
+	}
+}
+
 // displaySimplifiedSecurityStatus shows simplified SSH security status
 func displaySimplifiedSecurityStatus(state map[string]any, _ bool) {
 	sshConfigExists, _ := state["ssh_config_exists"].(bool)
@@ -2028,6 +2515,446 @@ func displaySimplifiedSecurityStatus(state map[string]any, _ bool) {
 		fmt.Printf(" \033[90m(default)\033[0m")
 	}
 	fmt.Println()
+
+	// Cloud-init settings that win over sshd_config or reset it on boot
+	if conflicts, _ := state["cloud_init_conflicts"].([]string); len(conflicts) > 0 {
+		for i, conflict := range conflicts {
+			label := ""
+			if i == 0 {
+				label = "Cloud-init"
+			}
+			fmt.Printf("  %-15s: \033[1;33m⚠ %s\033[0m\n", label, conflict)
+		}
+		fmt.Printf("    \033[90mRun with --cloud-init-config to make cloud-init keep iniq's settings\033[0m\n")
+	} else if configFile, _ := state["cloud_init_config"].(string); configFile != "" {
+		fmt.Printf("  %-15s: \033[1;32m✓ Aligned\033[0m \033[90m(%s)\033[0m\n", "Cloud-init", configFile)
+	}
+
+	// User certificate authority
+	userCAFile, _ := state["user_ca_file"].(string)
+	userCAFingerprints, _ := state["user_ca_fingerprints"].([]string)
+	principalsFile, _ := state["principals_file"].(string)
+	userPrincipals, _ := state["user_principals"].(map[string][]string)
+
+	fmt.Printf("  %-15s: ", "User CA")
+	switch {
+	case userCAFile == "":
+		fmt.Printf("\033[90mNot configured\033[0m\n")
+		return
+	case len(userCAFingerprints) == 0:
+		fmt.Printf("\033[1;31m✗ No valid keys\033[0m \033[90m(%s)\033[0m\n", userCAFile)
+		return
+	default:
+		fmt.Printf("\033[1;32m✓ %s\033[0m", userCAFingerprints[0])
+		if len(userCAFingerprints) > 1 {
+			fmt.Printf(" \033[90m(+%d more)\033[0m", len(userCAFingerprints)-1)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("  %-15s: ", "Principals")
+	if principalsFile == "" {
+		fmt.Printf("\033[90mUsername only\033[0m\n")
+		return
+	}
+	if len(userPrincipals) == 0 {
+		fmt.Printf("\033[1;33m⚠ None configured\033[0m \033[90m(%s)\033[0m\n", principalsFile)
+		return
+	}
+	users := make([]string, 0, len(userPrincipals))
+	for user := range userPrincipals {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for i, user := range users {
+		if i > 0 {
+			fmt.Printf("  %-15s  ", "")
+		}
+		fmt.Printf("%s \033[90m→ %s\033[0m\n", user, strings.Join(userPrincipals[user], ", "))
+	}
+}
+
+// displaySimplifiedHostKeysStatus shows simplified SSH host keys status
+func displaySimplifiedHostKeysStatus(state map[string]any) {
+	keys, _ := state["host_keys"].([]hostkeys.HostKey)
+	weak, _ := state["weak_host_keys"].([]hostkeys.HostKey)
+	missing, _ := state["missing_host_key_types"].([]string)
+
+	if len(keys) == 0 {
+		fmt.Printf("  \033[1;31m✗ No host keys found\033[0m\n")
+		return
+	}
+
+	isWeak := make(map[string]bool)
+	for _, key := range weak {
+		isWeak[key.Path] = true
+	}
+
+	for _, key := range keys {
+		fmt.Printf("  %-15s: ", key.Type)
+		switch {
+		case isWeak[key.Path]:
+			fmt.Printf("\033[1;31m✗ %s\033[0m \033[90m(disabled type)\033[0m", key.Fingerprint)
+		case key.Fingerprint == "":
+			fmt.Printf("\033[1;33m⚠ Unreadable\033[0m")
+		default:
+			fmt.Printf("\033[1;32m✓ %s\033[0m", key.Fingerprint)
+		}
+		if key.Bits > 0 {
+			fmt.Printf(" \033[90m(%d bits)\033[0m", key.Bits)
+		}
+		fmt.Println()
+	}
+
+	if len(weak) > 0 || len(missing) > 0 {
+		fmt.Printf("  \033[90mRun with --host-keys to remove disabled types and generate missing keys\033[0m\n")
+	}
+}
+
+// displaySimplifiedFirewallStatus shows simplified firewall status
+func displaySimplifiedFirewallStatus(state map[string]any) {
+	if message, ok := state["firewall_error"].(string); ok {
+		if _, found := state["firewall_backend"]; !found {
+			fmt.Printf("  %-15s: \033[1;31m✗ Not available\033[0m\n", "Status")
+			fmt.Printf("  \033[90m%s\033[0m\n", message)
+			return
+		}
+		fmt.Printf("  \033[1;33m⚠ %s\033[0m\n", message)
+		return
+	}
+
+	status, _ := state["firewall_status"].(firewall.Status)
+	sshPorts, _ := state["ssh_ports"].([]int)
+	sshAllowed, _ := state["ssh_allowed"].(bool)
+
+	fmt.Printf("  %-15s: ", "Status")
+	if !status.Active {
+		fmt.Printf("\033[1;33m⚠ Inactive\033[0m\n")
+		fmt.Printf("  \033[90mRun with --firewall to allow SSH and deny other inbound traffic\033[0m\n")
+		return
+	}
+	fmt.Printf("\033[1;32m✓ Active\033[0m\n")
+
+	fmt.Printf("  %-15s: ", "Default Policy")
+	if status.Policy == "allow" {
+		fmt.Printf("\033[1;33m⚠ allow\033[0m\n")
+	} else {
+		fmt.Printf("\033[1;32m✓ %s\033[0m\n", status.Policy)
+	}
+
+	ports := make([]string, 0, len(sshPorts))
+	for _, port := range sshPorts {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	fmt.Printf("  %-15s: ", "SSH")
+	if sshAllowed {
+		fmt.Printf("\033[1;32m✓ Allowed\033[0m \033[90m(port %s)\033[0m\n", strings.Join(ports, ", "))
+	} else {
+		fmt.Printf("\033[1;31m✗ Not allowed\033[0m \033[90m(port %s)\033[0m\n", strings.Join(ports, ", "))
+	}
+
+	allowed := make([]string, 0, len(status.Rules))
+	for _, rule := range status.Rules {
+		allowed = append(allowed, rule.String())
+	}
+	if len(allowed) > 0 {
+		fmt.Printf("  %-15s: %s\n", "Allowed", strings.Join(allowed, ", "))
+	}
+	for _, other := range status.Other {
+		fmt.Printf("  %-15s: \033[1;33m⚠ %s\033[0m \033[90m(not managed by iniq)\033[0m\n", "Other", other)
+	}
+}
+
+// displaySimplifiedFail2banStatus shows simplified fail2ban status
+func displaySimplifiedFail2banStatus(state map[string]any) {
+	installed, _ := state["fail2ban_installed"].(bool)
+	active, _ := state["fail2ban_active"].(bool)
+	sshguardActive, _ := state["sshguard_active"].(bool)
+
+	fmt.Printf("  %-15s: ", "fail2ban")
+	switch {
+	case active:
+		fmt.Printf("\033[1;32m✓ Running\033[0m\n")
+	case installed:
+		fmt.Printf("\033[1;33m⚠ Not running\033[0m\n")
+	default:
+		fmt.Printf("\033[1;33m⚠ Not installed\033[0m\n")
+	}
+	if sshguardActive {
+		fmt.Printf("  %-15s: \033[1;32m✓ Running\033[0m\n", "sshguard")
+	}
+
+	jail, ok := state["jail_settings"].(map[string]string)
+	fmt.Printf("  %-15s: ", "SSH Jail")
+	if !ok {
+		fmt.Printf("\033[1;33m⚠ Not configured\033[0m\n")
+		fmt.Printf("  \033[90mRun with --fail2ban to ban hosts that repeatedly fail SSH logins\033[0m\n")
+		return
+	}
+	if jail["enabled"] == "true" {
+		fmt.Printf("\033[1;32m✓ Enabled\033[0m \033[90m(port %s)\033[0m\n", jail["port"])
+	} else {
+		fmt.Printf("\033[1;33m⚠ Disabled\033[0m\n")
+	}
+	if matches, _ := state["jail_port_matches"].(bool); !matches {
+		sshPorts, _ := state["ssh_ports"].([]int)
+		ports := make([]string, 0, len(sshPorts))
+		for _, port := range sshPorts {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		fmt.Printf("  %-15s: \033[1;33m⚠ sshd listens on %s\033[0m \033[90m(run with --fail2ban to update)\033[0m\n", "Port", strings.Join(ports, ", "))
+	}
+	fmt.Printf("  %-15s: \033[0;37mban %s after %s failures in %s\033[0m\n", "Settings", jail["bantime"], jail["maxretry"], jail["findtime"])
+
+	if banned, ok := state["currently_banned"].(int); ok {
+		total, _ := state["total_banned"].(int)
+		fmt.Printf("  %-15s: \033[0;37m%d\033[0m \033[90m(%d total)\033[0m\n", "Banned", banned, total)
+	}
+}
+
+// displaySimplifiedUpdatesStatus shows simplified automatic updates status
+func displaySimplifiedUpdatesStatus(state map[string]any) {
+	if message, ok := state["updates_error"].(string); ok {
+		fmt.Printf("  %-15s: \033[1;31m✗ Not available\033[0m\n", "Status")
+		fmt.Printf("  \033[90m%s\033[0m\n", message)
+		return
+	}
+
+	tool, _ := state["updates_tool"].(string)
+	installed, _ := state["updates_installed"].(bool)
+	enabled, _ := state["updates_enabled"].(bool)
+	configured, _ := state["updates_configured"].(bool)
+
+	fmt.Printf("  %-15s: ", "Status")
+	switch {
+	case !installed:
+		fmt.Printf("\033[1;33m⚠ %s not installed\033[0m\n", tool)
+	case !enabled:
+		fmt.Printf("\033[1;33m⚠ %s disabled\033[0m\n", tool)
+	default:
+		fmt.Printf("\033[1;32m✓ %s enabled\033[0m\n", tool)
+	}
+
+	fmt.Printf("  %-15s: ", "Settings")
+	if configured {
+		fmt.Printf("\033[1;32m✓ Match configuration\033[0m\n")
+	} else {
+		fmt.Printf("\033[1;33m⚠ Differ from configuration\033[0m\n")
+		fmt.Printf("  \033[90mRun with --auto-updates to install security updates automatically\033[0m\n")
+	}
+}
+
+// displaySimplifiedPackagesStatus shows simplified baseline packages status
+func displaySimplifiedPackagesStatus(state map[string]any) {
+	if message, ok := state["packages_error"].(string); ok {
+		fmt.Printf("  %-15s: \033[1;31m✗ Not available\033[0m\n", "Status")
+		fmt.Printf("  \033[90m%s\033[0m\n", message)
+		return
+	}
+
+	wanted, _ := state["packages_wanted"].(int)
+	missing, _ := state["packages_missing"].([]string)
+	unwanted, _ := state["packages_unwanted"].([]string)
+	unavailable, _ := state["packages_unavailable"].([]string)
+
+	fmt.Printf("  %-15s: ", "Installed")
+	if len(missing) == 0 {
+		fmt.Printf("\033[1;32m✓ %d of %d\033[0m\n", wanted, wanted)
+	} else {
+		fmt.Printf("\033[1;33m⚠ %d of %d\033[0m \033[90m(missing: %s)\033[0m\n", wanted-len(missing), wanted, strings.Join(missing, ", "))
+	}
+	if len(unwanted) > 0 {
+		fmt.Printf("  %-15s: \033[1;33m⚠ %s\033[0m\n", "To remove", strings.Join(unwanted, ", "))
+	}
+	if len(unavailable) > 0 {
+		fmt.Printf("  %-15s: \033[90m%s\033[0m\n", "Unavailable", strings.Join(unavailable, ", "))
+	}
+}
+
+// displaySimplifiedSystemStatus shows simplified hostname, timezone, locale and time sync status
+func displaySimplifiedSystemStatus(state map[string]any) {
+	hostname, _ := state["hostname"].(string)
+	hostnameResolves, _ := state["hostname_resolves"].(bool)
+	timezone, _ := state["timezone"].(string)
+	locale, _ := state["locale"].(string)
+	localeAvailable, _ := state["locale_available"].(bool)
+	timeSync, _ := state["time_sync"].(string)
+	timeSyncActive, _ := state["time_sync_active"].(bool)
+	servers, _ := state["ntp_servers"].([]string)
+
+	fmt.Printf("  %-15s: \033[0;37m%s\033[0m", "Hostname", hostname)
+	if !hostnameResolves {
+		fmt.Printf(" \033[1;33m⚠ not in /etc/hosts\033[0m")
+	}
+	fmt.Println()
+
+	fmt.Printf("  %-15s: ", "Timezone")
+	if timezone != "" {
+		fmt.Printf("\033[0;37m%s\033[0m\n", timezone)
+	} else {
+		fmt.Printf("\033[1;33m⚠ Unknown\033[0m\n")
+	}
+
+	fmt.Printf("  %-15s: ", "Locale")
+	switch {
+	case locale == "":
+		fmt.Printf("\033[1;33m⚠ Not set\033[0m\n")
+	case !localeAvailable:
+		fmt.Printf("\033[0;37m%s\033[0m \033[1;33m⚠ not generated\033[0m\n", locale)
+	default:
+		fmt.Printf("\033[0;37m%s\033[0m\n", locale)
+	}
+
+	fmt.Printf("  %-15s: ", "Time Sync")
+	switch {
+	case timeSyncActive:
+		fmt.Printf("\033[1;32m✓ %s active\033[0m", timeSync)
+		if synchronized, ok := state["time_synchronized"].(bool); ok {
+			if synchronized {
+				fmt.Printf(" \033[90m(synchronized)\033[0m")
+			} else {
+				fmt.Printf(" \033[1;33m⚠ not synchronized yet\033[0m")
+			}
+		}
+		fmt.Println()
+	case timeSync != "":
+		fmt.Printf("\033[1;33m⚠ %s not running\033[0m\n", timeSync)
+		fmt.Printf("  \033[90mRun with --ntp to enable time sync\033[0m\n")
+	default:
+		fmt.Printf("\033[1;31m✗ Not installed\033[0m\n")
+		fmt.Printf("  \033[90mRun with --ntp to install chrony and enable time sync\033[0m\n")
+	}
+	if len(servers) > 0 {
+		fmt.Printf("  %-15s: \033[90m%s\033[0m\n", "NTP servers", strings.Join(servers, ", "))
+	}
+}
+
+// displaySimplifiedSysctlStatus shows simplified kernel parameter status, comparing
+// live values with the configured ones
+func displaySimplifiedSysctlStatus(state map[string]any) {
+	configured, _ := state["sysctl_configured"].(bool)
+	profile, _ := state["sysctl_profile"].(string)
+	total, _ := state["sysctl_parameters"].(int)
+	differences, _ := state["sysctl_differences"].([]string)
+	unsupported, _ := state["sysctl_unsupported"].([]string)
+
+	fmt.Printf("  %-15s: ", "Configuration")
+	switch {
+	case !configured:
+		fmt.Printf("\033[1;33m⚠ Not hardened\033[0m\n")
+	case profile != "":
+		fmt.Printf("\033[1;32m✓ %s profile\033[0m\n", profile)
+	default:
+		fmt.Printf("\033[1;32m✓ Present\033[0m\n")
+	}
+
+	fmt.Printf("  %-15s: ", "Live values")
+	switch {
+	case len(differences) == 0 && configured:
+		fmt.Printf("\033[1;32m✓ %d of %d match\033[0m\n", total, total)
+	case len(differences) == 0:
+		fmt.Printf("\033[1;32m✓ Already match the baseline profile\033[0m\n")
+	case configured:
+		fmt.Printf("\033[1;33m⚠ %d of %d match\033[0m\n", total-len(differences), total)
+	default:
+		fmt.Printf("\033[1;33m⚠ %d of %d differ from the baseline profile\033[0m\n", len(differences), total)
+	}
+	for _, difference := range differences {
+		fmt.Printf("  \033[90m%s\033[0m\n", difference)
+	}
+	if len(unsupported) > 0 {
+		fmt.Printf("  %-15s: \033[90m%s\033[0m\n", "Unsupported", strings.Join(unsupported, ", "))
+	}
+	if !configured {
+		fmt.Printf("  \033[90mRun with --sysctl to harden kernel and network parameters\033[0m\n")
+	}
+}
+
+// displaySimplifiedSudoDefaultsStatus shows the effective global sudo Defaults
+func displaySimplifiedSudoDefaultsStatus(state map[string]any) {
+	installed, ok := state["sudo_defaults_installed"].(bool)
+	if !ok {
+		fmt.Printf("  \033[1;33m⚠ Requires root to read sudoers\033[0m\n")
+		return
+	}
+
+	defaultsFile, _ := state["sudo_defaults_file"].(string)
+	fmt.Printf("  %-15s: ", "Managed File")
+	if installed {
+		fmt.Printf("\033[1;32m✓ %s\033[0m\n", defaultsFile)
+	} else {
+		fmt.Printf("\033[1;33m⚠ Not installed\033[0m\n")
+	}
+
+	settings, _ := state["sudo_defaults"].(map[string]string)
+	value := func(name, unset string) string {
+		if v := settings[name]; v != "" {
+			return v
+		}
+		return unset
+	}
+
+	fmt.Printf("  %-15s: ", "use_pty")
+	if settings["use_pty"] == "true" {
+		fmt.Printf("\033[1;32m✓ Enabled\033[0m\n")
+	} else {
+		fmt.Printf("\033[1;33m⚠ Disabled\033[0m\n")
+	}
+
+	fmt.Printf("  %-15s: ", "Log File")
+	if logfile := settings["logfile"]; logfile != "" && logfile != "false" {
+		fmt.Printf("\033[1;32m✓ %s\033[0m\n", logfile)
+	} else {
+		fmt.Printf("\033[1;33m⚠ Not set\033[0m \033[90m(syslog only)\033[0m\n")
+	}
+
+	fmt.Printf("  %-15s: \033[0;37m%s\033[0m\n", "Timeout", value("timestamp_timeout", "default"))
+	fmt.Printf("  %-15s: \033[0;37m%s\033[0m\n", "Password Tries", value("passwd_tries", "default"))
+	fmt.Printf("  %-15s: \033[0;37m%s\033[0m\n", "Lecture", value("lecture", "default"))
+
+	fmt.Printf("  %-15s: ", "I/O Logging")
+	if settings["log_input"] == "true" && settings["log_output"] == "true" {
+		fmt.Printf("\033[1;32m✓ Enabled\033[0m\n")
+	} else {
+		fmt.Printf("\033[90mDisabled\033[0m\n")
+	}
+
+	if !installed {
+		fmt.Printf("  \033[90mRun with --sudo-defaults to install hardened Defaults\033[0m\n")
+	}
+}
+
+// displaySimplifiedDoasStatus shows the user's doas privileges
+func displaySimplifiedDoasStatus(state map[string]any) {
+	if requiresPrivileges, _ := state["passwordless_sudo_requires_privileges"].(bool); requiresPrivileges {
+		fmt.Printf("  \033[1;33m⚠ Requires root to read doas.conf\033[0m\n")
+		return
+	}
+
+	username, _ := state["username"].(string)
+	fmt.Printf("  %-15s: \033[0;37m%s\033[0m\n", "User", username)
+
+	hasAccess, _ := state["has_sudo"].(bool)
+	nopass, _ := state["has_passwordless_sudo"].(bool)
+	source, _ := state["sudo_source"].(string)
+	fmt.Printf("  %-15s: ", "Root Access")
+	if hasAccess {
+		if nopass {
+			fmt.Printf("\033[1;32m✓ Passwordless\033[0m")
+		} else {
+			fmt.Printf("\033[1;32m✓ With Password\033[0m")
+		}
+		if source != "" {
+			fmt.Printf(" \033[90m(%s)\033[0m", source)
+		}
+		fmt.Println()
+	} else {
+		fmt.Printf("\033[1;31m✗ None\033[0m\n")
+	}
+
+	if restricted, _ := state["doas_restricted_rules"].(int); restricted > 0 {
+		fmt.Printf("  %-15s: \033[0;37m%d rule(s)\033[0m\n", "Command Rules", restricted)
+	}
 }
 
 // displaySimplifiedUserStatus shows simplified user account status
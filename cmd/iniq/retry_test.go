@@ -2,7 +2,10 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"testing"
+
+	"github.com/teomyth/iniq/internal/features"
 )
 
 func TestIsNonRetryableError(t *testing.T) {
@@ -86,6 +89,11 @@ func TestIsNonRetryableError(t *testing.T) {
 			err:      errors.New("exec: command not found"),
 			expected: true,
 		},
+		{
+			name:     "error marked by a feature should not be retryable",
+			err:      fmt.Errorf("ssh: %w", features.NotRetryable(errors.New("refusing to replace authorized_keys"))),
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,158 @@
+// Package cloudinit detects settings managed by cloud-init and translates cloud-init user data
+package cloudinit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigFile is the cloud-init configuration INIQ writes so cloud-init agrees with its SSH settings
+	ConfigFile = "/etc/cloud/cloud.cfg.d/99-iniq.cfg"
+
+	// SudoersFile is the sudoers drop-in cloud-init writes for the users it creates
+	SudoersFile = "/etc/sudoers.d/90-cloud-init-users"
+)
+
+// sshDirectives are the sshd settings that INIQ manages and cloud-init may also set
+var sshDirectives = []string{"PasswordAuthentication", "PermitRootLogin"}
+
+// Setting is a value and the file that sets it
+type Setting struct {
+	Value string
+	File  string
+}
+
+// State holds the settings cloud-init manages on a system
+type State struct {
+	// Installed reports whether cloud-init is configured on the system
+	Installed bool
+
+	// SSHPwAuth is the effective ssh_pwauth setting: true, false or unchanged.
+	// cloud-init applies it to sshd when an instance first boots, and on some images on every boot.
+	SSHPwAuth Setting
+
+	// SSHDirectives holds the sshd settings from drop-ins cloud-init wrote to sshd_config.d
+	SSHDirectives map[string]Setting
+
+	// SudoersFile is the sudoers drop-in cloud-init wrote, empty if there is none
+	SudoersFile string
+}
+
+// Detect reads the cloud-init configuration of the file system mounted at root
+func Detect(root string) (*State, error) {
+	state := &State{SSHDirectives: make(map[string]Setting)}
+
+	cloudCfg := filepath.Join(root, "etc/cloud/cloud.cfg")
+	if _, err := os.Stat(cloudCfg); err == nil {
+		state.Installed = true
+	}
+
+	// cloud.cfg.d files are merged in lexical order after cloud.cfg, later files win
+	dropIns, _ := filepath.Glob(filepath.Join(root, "etc/cloud/cloud.cfg.d", "*.cfg"))
+	sort.Strings(dropIns)
+	for _, path := range append([]string{cloudCfg}, dropIns...) {
+		value, found, err := readSSHPwAuth(path)
+		if err != nil {
+			return state, err
+		}
+		if found {
+			state.SSHPwAuth = Setting{Value: value, File: path}
+		}
+	}
+
+	for _, path := range sshdconfig.CloudInitDropIns(filepath.Join(root, "etc/ssh/sshd_config")) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return state, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for _, directive := range sshDirectives {
+			if _, seen := state.SSHDirectives[directive]; seen {
+				continue
+			}
+			if value, ok := sshdconfig.Get(string(content), directive); ok {
+				state.SSHDirectives[directive] = Setting{Value: value, File: path}
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, SudoersFile)); err == nil {
+		state.SudoersFile = SudoersFile
+	}
+
+	return state, nil
+}
+
+// readSSHPwAuth returns the ssh_pwauth value of a cloud-init configuration file
+func readSSHPwAuth(path string) (string, bool, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var config map[string]any
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return "", false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	value, ok := config["ssh_pwauth"]
+	if !ok || value == nil {
+		return "", false, nil
+	}
+	return normalizePwAuth(value), true, nil
+}
+
+// normalizePwAuth converts the YAML booleans and strings cloud-init accepts for ssh_pwauth
+// to true, false or unchanged
+func normalizePwAuth(value any) string {
+	switch v := value.(type) {
+	case bool:
+		return fmt.Sprint(v)
+	case string:
+		switch strings.ToLower(v) {
+		case "yes", "true", "on", "1":
+			return "true"
+		case "no", "false", "off", "0":
+			return "false"
+		}
+	}
+	return "unchanged"
+}
+
+// Conflicts returns a warning for each cloud-init setting that overrides or may later
+// override the given effective sshd values, which are keyed by directive name
+func (s *State) Conflicts(effective map[string]string) []string {
+	var conflicts []string
+	for _, directive := range sshDirectives {
+		setting, ok := s.SSHDirectives[directive]
+		want, known := effective[directive]
+		if ok && known && !strings.EqualFold(setting.Value, want) {
+			conflicts = append(conflicts, fmt.Sprintf("%s %s in %s overrides %s %s",
+				directive, setting.Value, setting.File, directive, want))
+		}
+	}
+
+	if want, known := effective["PasswordAuthentication"]; known && s.SSHPwAuth.Value != "" && s.SSHPwAuth.Value != "unchanged" {
+		enabled := strings.EqualFold(want, "yes")
+		if (s.SSHPwAuth.Value == "true") != enabled {
+			conflicts = append(conflicts, fmt.Sprintf("ssh_pwauth: %s in %s may reset PasswordAuthentication on boot",
+				s.SSHPwAuth.Value, s.SSHPwAuth.File))
+		}
+	}
+
+	return conflicts
+}
+
+// RenderConfig returns the cloud-init configuration that keeps password authentication
+// as INIQ configured it
+func RenderConfig(passwordAuth bool) string {
+	return fmt.Sprintf("# Managed by INIQ: keep cloud-init from changing the SSH settings applied by iniq\nssh_pwauth: %t\n", passwordAuth)
+}
@@ -0,0 +1,169 @@
+package cloudinit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files under root
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	root, err := os.MkdirTemp("", "iniq-cloudinit-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFiles(t, root, map[string]string{
+		"etc/cloud/cloud.cfg":                        "ssh_pwauth: false\ndisable_root: true\n",
+		"etc/cloud/cloud.cfg.d/50-curtin.cfg":        "ssh_pwauth: yes\n",
+		"etc/cloud/cloud.cfg.d/90-datasource.cfg":    "datasource_list: [Ec2]\n",
+		"etc/cloud/cloud.cfg.d/README":               "ssh_pwauth: false\n",
+		"etc/ssh/sshd_config.d/50-cloud-init.conf":   "PasswordAuthentication yes\n",
+		"etc/ssh/sshd_config.d/60-cloudimg.conf":     "PermitRootLogin yes\n",
+		"etc/sudoers.d/90-cloud-init-users":          "ubuntu ALL=(ALL) NOPASSWD:ALL\n",
+		"etc/ssh/sshd_config.d/40-other-cloud.conf~": "PermitRootLogin yes\n",
+	})
+
+	state, err := Detect(root)
+	if err != nil {
+		t.Fatalf("Detect() failed: %v", err)
+	}
+	if !state.Installed {
+		t.Error("Expected cloud-init to be installed")
+	}
+	// Later cloud.cfg.d files win, files without the .cfg suffix are ignored
+	if state.SSHPwAuth.Value != "true" || filepath.Base(state.SSHPwAuth.File) != "50-curtin.cfg" {
+		t.Errorf("Unexpected ssh_pwauth %+v", state.SSHPwAuth)
+	}
+	expected := map[string]Setting{
+		"PasswordAuthentication": {Value: "yes", File: filepath.Join(root, "etc/ssh/sshd_config.d/50-cloud-init.conf")},
+	}
+	if !reflect.DeepEqual(state.SSHDirectives, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, state.SSHDirectives)
+	}
+	if state.SudoersFile != SudoersFile {
+		t.Errorf("Expected sudoers file %s, got %q", SudoersFile, state.SudoersFile)
+	}
+
+	// A system without cloud-init
+	empty, err := os.MkdirTemp("", "iniq-cloudinit-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(empty)
+	state, err = Detect(empty)
+	if err != nil {
+		t.Fatalf("Detect() failed: %v", err)
+	}
+	if state.Installed || state.SSHPwAuth.Value != "" || len(state.SSHDirectives) != 0 || state.SudoersFile != "" {
+		t.Errorf("Expected no cloud-init settings, got %+v", state)
+	}
+}
+
+func TestNormalizePwAuth(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{true, "true"},
+		{false, "false"},
+		{"yes", "true"},
+		{"No", "false"},
+		{"unchanged", "unchanged"},
+		{1, "unchanged"},
+	}
+
+	for _, tt := range tests {
+		if value := normalizePwAuth(tt.value); value != tt.expected {
+			t.Errorf("normalizePwAuth(%v): expected %s, got %s", tt.value, tt.expected, value)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	dropIn := "/etc/ssh/sshd_config.d/50-cloud-init.conf"
+	tests := []struct {
+		name      string
+		state     State
+		effective map[string]string
+		expected  []string
+	}{
+		{
+			name:      "Agreeing drop-in",
+			state:     State{SSHDirectives: map[string]Setting{"PasswordAuthentication": {Value: "no", File: dropIn}}},
+			effective: map[string]string{"PasswordAuthentication": "no"},
+		},
+		{
+			name:      "Overriding drop-in",
+			state:     State{SSHDirectives: map[string]Setting{"PasswordAuthentication": {Value: "yes", File: dropIn}}},
+			effective: map[string]string{"PasswordAuthentication": "no", "PermitRootLogin": "no"},
+			expected:  []string{"PasswordAuthentication yes in " + dropIn + " overrides PasswordAuthentication no"},
+		},
+		{
+			name:      "ssh_pwauth",
+			state:     State{SSHPwAuth: Setting{Value: "true", File: "/etc/cloud/cloud.cfg"}},
+			effective: map[string]string{"PasswordAuthentication": "no"},
+			expected:  []string{"ssh_pwauth: true in /etc/cloud/cloud.cfg may reset PasswordAuthentication on boot"},
+		},
+		{
+			name:      "ssh_pwauth unchanged",
+			state:     State{SSHPwAuth: Setting{Value: "unchanged", File: "/etc/cloud/cloud.cfg"}},
+			effective: map[string]string{"PasswordAuthentication": "no"},
+		},
+		{
+			name:      "ssh_pwauth agrees",
+			state:     State{SSHPwAuth: Setting{Value: "false", File: ConfigFile}},
+			effective: map[string]string{"PasswordAuthentication": "no"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts := tt.state.Conflicts(tt.effective)
+			if !reflect.DeepEqual(conflicts, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, conflicts)
+			}
+		})
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-cloudinit-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, passwordAuth := range []bool{true, false} {
+		content := RenderConfig(passwordAuth)
+		if !strings.HasPrefix(content, "# Managed by INIQ") {
+			t.Errorf("Expected a managed-by header, got %q", content)
+		}
+
+		// The rendered file must be read back by Detect
+		path := filepath.Join(tempDir, "99-iniq.cfg")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		value, found, err := readSSHPwAuth(path)
+		if err != nil || !found || value != map[bool]string{true: "true", false: "false"}[passwordAuth] {
+			t.Errorf("Unexpected ssh_pwauth %q (found %v, err %v)", value, found, err)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package cloudinit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// adminGroups are the groups that give cloud-init users full sudo access on common images
+var adminGroups = map[string]bool{"sudo": true, "wheel": true, "admin": true}
+
+// UserData holds the parts of cloud-config user data that INIQ can import
+type UserData struct {
+	// Users are the users entries, "default" stands for the image's default user
+	Users []User
+	// DefaultUser is the default user name set with the top-level user key, if any
+	DefaultUser string
+	// SSHAuthorizedKeys are the top-level keys, installed for the default user
+	SSHAuthorizedKeys []string
+	// SSHPwAuth is the ssh_pwauth setting: true, false or unchanged, empty if unset
+	SSHPwAuth string
+	// DisableRoot is the disable_root setting, nil if unset
+	DisableRoot *bool
+}
+
+// User is an entry of the users list
+type User struct {
+	Name              string
+	Default           bool
+	SSHAuthorizedKeys []string
+	SSHImportID       []string
+	Sudo              []string
+	Groups            []string
+	HasPassword       bool
+}
+
+// Manifest is an INIQ configuration file translated from user data
+type Manifest struct {
+	User            string             `yaml:"user"`
+	Keys            []string           `yaml:"keys,omitempty"`
+	SudoNoPasswd    *bool              `yaml:"sudo-nopasswd,omitempty"`
+	SudoRules       []ManifestSudoRule `yaml:"sudo-rules,omitempty"`
+	SSHPasswordAuth string             `yaml:"ssh-password-auth,omitempty"`
+	SSHRootLogin    string             `yaml:"ssh-root-login,omitempty"`
+}
+
+// ManifestSudoRule is an entry of the sudo-rules setting
+type ManifestSudoRule struct {
+	Commands []string `yaml:"commands"`
+	RunAs    []string `yaml:"runas,omitempty"`
+	NoPasswd bool     `yaml:"nopasswd,omitempty"`
+}
+
+// Import is the result of translating user data for one user
+type Import struct {
+	Manifest Manifest
+	// AuthorizedKeys are literal public keys, which INIQ reads from a file key source
+	AuthorizedKeys []string
+	// Warnings describe user data settings that could not be translated
+	Warnings []string
+}
+
+// Marshal returns the manifest as YAML
+func (m *Manifest) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(m); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseUserData parses cloud-config user data
+func ParseUserData(content []byte) (*UserData, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("#cloud-config")) {
+		return nil, fmt.Errorf("user data is not a #cloud-config document")
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse user data: %w", err)
+	}
+
+	data := &UserData{SSHAuthorizedKeys: stringList(raw["ssh_authorized_keys"])}
+	if value, ok := raw["ssh_pwauth"]; ok && value != nil {
+		data.SSHPwAuth = normalizePwAuth(value)
+	}
+	if disableRoot, ok := raw["disable_root"].(bool); ok {
+		data.DisableRoot = &disableRoot
+	}
+
+	// The top-level user key renames or replaces the default user
+	switch user := raw["user"].(type) {
+	case string:
+		data.DefaultUser = user
+	case map[string]any:
+		u, err := parseUser(user)
+		if err != nil {
+			return nil, err
+		}
+		u.Default = true
+		data.DefaultUser = u.Name
+		data.Users = append(data.Users, u)
+	}
+	hasDefault := len(data.Users) > 0
+
+	users, ok := raw["users"]
+	if !ok {
+		// Without a users list cloud-init only creates the default user
+		if !hasDefault {
+			data.Users = append(data.Users, User{Default: true})
+		}
+		return data, nil
+	}
+	list, ok := users.([]any)
+	if !ok {
+		return nil, fmt.Errorf("users must be a list")
+	}
+	for _, entry := range list {
+		switch entry := entry.(type) {
+		case string:
+			if entry == "default" {
+				if !hasDefault {
+					data.Users = append(data.Users, User{Default: true})
+				}
+			} else {
+				data.Users = append(data.Users, User{Name: entry})
+			}
+		case map[string]any:
+			u, err := parseUser(entry)
+			if err != nil {
+				return nil, err
+			}
+			data.Users = append(data.Users, u)
+		default:
+			return nil, fmt.Errorf("unsupported users entry: %v", entry)
+		}
+	}
+	return data, nil
+}
+
+// parseUser parses an entry of the users list
+func parseUser(entry map[string]any) (User, error) {
+	name, _ := entry["name"].(string)
+	if name == "" {
+		return User{}, fmt.Errorf("users entry without a name")
+	}
+
+	u := User{
+		Name:              name,
+		SSHAuthorizedKeys: stringList(entry["ssh_authorized_keys"]),
+		SSHImportID:       stringList(entry["ssh_import_id"]),
+		Groups:            stringList(entry["groups"]),
+	}
+	// sudo is a rule, a list of rules, or false for none
+	if sudo, ok := entry["sudo"].(string); ok {
+		u.Sudo = []string{sudo}
+	} else if _, ok := entry["sudo"].([]any); ok {
+		u.Sudo = stringList(entry["sudo"])
+	}
+	for _, key := range []string{"passwd", "hashed_passwd", "plain_text_passwd"} {
+		if value, ok := entry[key].(string); ok && value != "" {
+			u.HasPassword = true
+		}
+	}
+	return u, nil
+}
+
+// stringList converts a YAML list of strings, or a comma separated string, to a slice
+func stringList(value any) []string {
+	var list []string
+	switch v := value.(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				list = append(list, strings.TrimSpace(s))
+			}
+		}
+	}
+	return list
+}
+
+// Import translates the settings of a user into a manifest. An empty username selects the
+// first user of the users list, falling back to the default user.
+func (d *UserData) Import(username string) (*Import, error) {
+	user, err := d.selectUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Import{Manifest: Manifest{User: user.Name}}
+	for _, other := range d.Users {
+		if other.Default == user.Default && (other.Default || other.Name == user.Name) {
+			continue
+		}
+		result.warn("%s was not imported, INIQ manages one user per manifest", d.displayName(other))
+	}
+
+	// Keys
+	result.AuthorizedKeys = append(result.AuthorizedKeys, user.SSHAuthorizedKeys...)
+	if user.Default {
+		result.AuthorizedKeys = append(result.AuthorizedKeys, d.SSHAuthorizedKeys...)
+	} else if len(d.SSHAuthorizedKeys) > 0 {
+		result.warn("top-level ssh_authorized_keys belong to the default user and were not imported")
+	}
+	for _, id := range user.SSHImportID {
+		source, err := importIDSource(id)
+		if err != nil {
+			result.warn("%v", err)
+			continue
+		}
+		result.Manifest.Keys = append(result.Manifest.Keys, source)
+	}
+
+	// Sudo
+	result.importSudo(user)
+
+	if user.HasPassword {
+		result.warn("the password of %s was not imported, set it with iniq's password prompt", user.Name)
+	}
+
+	// SSH settings
+	switch d.SSHPwAuth {
+	case "true":
+		result.Manifest.SSHPasswordAuth = "enable"
+	case "false":
+		result.Manifest.SSHPasswordAuth = "disable"
+	}
+	if d.DisableRoot != nil && *d.DisableRoot {
+		result.Manifest.SSHRootLogin = "disable"
+	}
+
+	return result, nil
+}
+
+// selectUser returns the user to import, with the default user's name filled in
+func (d *UserData) selectUser(username string) (User, error) {
+	var defaultUser *User
+	for i, u := range d.Users {
+		if u.Default {
+			defaultUser = &d.Users[i]
+			continue
+		}
+		if username == "" || u.Name == username {
+			return u, nil
+		}
+	}
+
+	if defaultUser == nil {
+		if username != "" {
+			return User{}, fmt.Errorf("user %s not found in user data", username)
+		}
+		return User{}, fmt.Errorf("user data defines no users")
+	}
+
+	// The default user's name comes from the image unless the user data sets it
+	user := *defaultUser
+	user.Name = username
+	if user.Name == "" {
+		user.Name = d.DefaultUser
+	}
+	if user.Name == "" {
+		return User{}, fmt.Errorf("user data only configures the image's default user, choose its name with --user")
+	}
+	if d.DefaultUser != "" && username != "" && username != d.DefaultUser {
+		return User{}, fmt.Errorf("user %s not found in user data", username)
+	}
+	// cloud-init gives the default user passwordless sudo on common images
+	if len(user.Sudo) == 0 {
+		user.Sudo = []string{"ALL=(ALL) NOPASSWD:ALL"}
+	}
+	return user, nil
+}
+
+// displayName returns a user's name for messages
+func (d *UserData) displayName(u User) string {
+	if u.Default {
+		return "the default user"
+	}
+	return "user " + u.Name
+}
+
+// importIDSource converts an ssh_import_id entry to an INIQ key source
+func importIDSource(id string) (string, error) {
+	provider, name, found := strings.Cut(id, ":")
+	if found && (provider == "gh" || provider == "github") {
+		return "github:" + name, nil
+	}
+	return "", fmt.Errorf("ssh_import_id %s was not imported, only GitHub (gh:) IDs are supported", id)
+}
+
+// importSudo translates the sudo rules and admin groups of a user
+func (r *Import) importSudo(user User) {
+	full := false
+	nopasswd := false
+	for _, spec := range user.Sudo {
+		rule, err := parseSudoSpec(spec)
+		if err != nil {
+			r.warn("%v", err)
+			continue
+		}
+		if len(rule.Commands) == 1 && rule.Commands[0] == "ALL" && allRunAs(rule.RunAs) {
+			full = true
+			nopasswd = nopasswd || rule.NoPasswd
+			continue
+		}
+		r.Manifest.SudoRules = append(r.Manifest.SudoRules, rule)
+	}
+	for _, group := range user.Groups {
+		if adminGroups[group] {
+			full = true
+		}
+	}
+
+	switch {
+	case full:
+		r.Manifest.SudoNoPasswd = &nopasswd
+		if len(r.Manifest.SudoRules) > 0 {
+			r.warn("restricted sudo rules of %s are covered by its full sudo access and were not imported", user.Name)
+			r.Manifest.SudoRules = nil
+		}
+	case len(r.Manifest.SudoRules) == 0:
+		r.warn("%s has no sudo access in the user data, but INIQ grants the admin group by default", user.Name)
+	}
+}
+
+// parseSudoSpec parses a cloud-init sudo rule such as ALL=(ALL) NOPASSWD:ALL, which is a
+// sudoers rule without the user
+func parseSudoSpec(spec string) (ManifestSudoRule, error) {
+	var rule ManifestSudoRule
+
+	_, rest, found := strings.Cut(spec, "=")
+	if !found {
+		return rule, fmt.Errorf("sudo rule %q was not imported, expected HOSTS=(RUNAS) COMMANDS", spec)
+	}
+	rest = strings.TrimSpace(rest)
+
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return rule, fmt.Errorf("sudo rule %q was not imported, unterminated run-as list", spec)
+		}
+		// Only run-as users are supported, a :group part is dropped
+		users, _, _ := strings.Cut(rest[1:end], ":")
+		rule.RunAs = stringList(users)
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	for {
+		tag, after, found := strings.Cut(rest, ":")
+		if !found || strings.ContainsAny(tag, " /,") {
+			break
+		}
+		switch tag {
+		case "NOPASSWD":
+			rule.NoPasswd = true
+		case "PASSWD":
+			rule.NoPasswd = false
+		default:
+			return rule, fmt.Errorf("sudo rule %q was not imported, tag %s is not supported", spec, tag)
+		}
+		rest = strings.TrimSpace(after)
+	}
+
+	rule.Commands = stringList(rest)
+	if len(rule.Commands) == 0 {
+		return rule, fmt.Errorf("sudo rule %q was not imported, it has no commands", spec)
+	}
+	return rule, nil
+}
+
+// allRunAs reports whether a run-as list allows any user
+func allRunAs(runAs []string) bool {
+	return len(runAs) == 0 || (len(runAs) == 1 && runAs[0] == "ALL")
+}
+
+// warn records a setting that could not be translated
+func (r *Import) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
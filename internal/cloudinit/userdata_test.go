@@ -0,0 +1,212 @@
+package cloudinit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const userData = `#cloud-config
+ssh_pwauth: false
+disable_root: true
+ssh_authorized_keys:
+  - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDefaultUserKey default@host
+users:
+  - default
+  - name: deploy
+    groups: docker, sudo
+    sudo: ALL=(ALL) NOPASSWD:ALL
+    ssh_import_id: [gh:octocat, lp:someone]
+    ssh_authorized_keys:
+      - ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDeployKey deploy@laptop
+  - name: ci
+    sudo:
+      - "ALL=(root) NOPASSWD:/usr/bin/systemctl restart app, /usr/bin/journalctl"
+    hashed_passwd: $6$rounds=4096$salt$hash
+  - name: guest
+    sudo: false
+`
+
+func TestParseUserData(t *testing.T) {
+	data, err := ParseUserData([]byte(userData))
+	if err != nil {
+		t.Fatalf("ParseUserData() failed: %v", err)
+	}
+
+	if len(data.Users) != 4 || !data.Users[0].Default {
+		t.Fatalf("Unexpected users: %+v", data.Users)
+	}
+	deploy := data.Users[1]
+	if deploy.Name != "deploy" || !reflect.DeepEqual(deploy.Groups, []string{"docker", "sudo"}) ||
+		!reflect.DeepEqual(deploy.Sudo, []string{"ALL=(ALL) NOPASSWD:ALL"}) || len(deploy.SSHImportID) != 2 {
+		t.Errorf("Unexpected deploy user: %+v", deploy)
+	}
+	if ci := data.Users[2]; !ci.HasPassword || len(ci.Sudo) != 1 {
+		t.Errorf("Unexpected ci user: %+v", ci)
+	}
+	if guest := data.Users[3]; guest.Sudo != nil {
+		t.Errorf("Expected no sudo rules for guest, got %v", guest.Sudo)
+	}
+	if data.SSHPwAuth != "false" || data.DisableRoot == nil || !*data.DisableRoot || len(data.SSHAuthorizedKeys) != 1 {
+		t.Errorf("Unexpected top-level settings: %+v", data)
+	}
+
+	for _, invalid := range []string{"users: []", "#cloud-config\nusers: deploy", "#cloud-config\nusers:\n  - groups: sudo", "#cloud-config\n: ["} {
+		if _, err := ParseUserData([]byte(invalid)); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	data, err := ParseUserData([]byte(userData))
+	if err != nil {
+		t.Fatalf("ParseUserData() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		manifest Manifest
+		keys     int
+		warnings []string
+	}{
+		{
+			name: "First user",
+			manifest: Manifest{
+				User:            "deploy",
+				Keys:            []string{"github:octocat"},
+				SudoNoPasswd:    boolPtr(true),
+				SSHPasswordAuth: "disable",
+				SSHRootLogin:    "disable",
+			},
+			keys:     1,
+			warnings: []string{"the default user was not imported", "user ci was not imported", "user guest was not imported", "top-level ssh_authorized_keys", "lp:someone"},
+		},
+		{
+			name:     "Restricted sudo",
+			username: "ci",
+			manifest: Manifest{
+				User: "ci",
+				SudoRules: []ManifestSudoRule{
+					{Commands: []string{"/usr/bin/systemctl restart app", "/usr/bin/journalctl"}, RunAs: []string{"root"}, NoPasswd: true},
+				},
+				SSHPasswordAuth: "disable",
+				SSHRootLogin:    "disable",
+			},
+			warnings: []string{"the default user", "user deploy", "user guest", "top-level", "password of ci"},
+		},
+		{
+			name:     "No sudo",
+			username: "guest",
+			manifest: Manifest{User: "guest", SSHPasswordAuth: "disable", SSHRootLogin: "disable"},
+			warnings: []string{"the default user", "user deploy", "user ci", "top-level", "guest has no sudo access"},
+		},
+		{
+			name:     "Default user",
+			username: "ubuntu",
+			manifest: Manifest{User: "ubuntu", SudoNoPasswd: boolPtr(true), SSHPasswordAuth: "disable", SSHRootLogin: "disable"},
+			keys:     1,
+			warnings: []string{"user deploy", "user ci", "user guest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := data.Import(tt.username)
+			if err != nil {
+				t.Fatalf("Import() failed: %v", err)
+			}
+			if !reflect.DeepEqual(result.Manifest, tt.manifest) {
+				t.Errorf("Expected manifest %+v, got %+v", tt.manifest, result.Manifest)
+			}
+			if len(result.AuthorizedKeys) != tt.keys {
+				t.Errorf("Expected %d keys, got %v", tt.keys, result.AuthorizedKeys)
+			}
+			if len(result.Warnings) != len(tt.warnings) {
+				t.Fatalf("Expected %d warnings, got %v", len(tt.warnings), result.Warnings)
+			}
+			for i, warning := range tt.warnings {
+				if !strings.Contains(result.Warnings[i], warning) {
+					t.Errorf("Expected warning containing %q, got %q", warning, result.Warnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestImportDefaultUser(t *testing.T) {
+	// Without a users list only the default user exists, and its name must be known
+	data, err := ParseUserData([]byte("#cloud-config\nssh_authorized_keys: [ssh-ed25519 AAAA a@b]\n"))
+	if err != nil {
+		t.Fatalf("ParseUserData() failed: %v", err)
+	}
+	if _, err := data.Import(""); err == nil {
+		t.Error("Expected error when the default user has no name")
+	}
+
+	data, err = ParseUserData([]byte("#cloud-config\nuser:\n  name: admin\n  sudo: ALL=(ALL) ALL\nusers: [default]\n"))
+	if err != nil {
+		t.Fatalf("ParseUserData() failed: %v", err)
+	}
+	result, err := data.Import("")
+	if err != nil {
+		t.Fatalf("Import() failed: %v", err)
+	}
+	if result.Manifest.User != "admin" || result.Manifest.SudoNoPasswd == nil || *result.Manifest.SudoNoPasswd {
+		t.Errorf("Unexpected manifest %+v", result.Manifest)
+	}
+	if _, err := data.Import("other"); err == nil {
+		t.Error("Expected error for unknown user")
+	}
+}
+
+func TestParseSudoSpec(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expected    ManifestSudoRule
+		expectError bool
+	}{
+		{spec: "ALL=(ALL) NOPASSWD:ALL", expected: ManifestSudoRule{Commands: []string{"ALL"}, RunAs: []string{"ALL"}, NoPasswd: true}},
+		{spec: "ALL=(ALL:ALL) ALL", expected: ManifestSudoRule{Commands: []string{"ALL"}, RunAs: []string{"ALL"}}},
+		{spec: "ALL=/usr/bin/apt", expected: ManifestSudoRule{Commands: []string{"/usr/bin/apt"}}},
+		{spec: "ALL=(postgres, root) SETENV:/usr/bin/psql", expectError: true},
+		{spec: "ALL=(ALL NOPASSWD:ALL", expectError: true},
+		{spec: "NOPASSWD:ALL", expectError: true},
+		{spec: "ALL=(ALL) NOPASSWD:", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := parseSudoSpec(tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rule, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, rule)
+			}
+		})
+	}
+}
+
+func TestManifestMarshal(t *testing.T) {
+	manifest := Manifest{User: "deploy", Keys: []string{"github:octocat"}, SudoNoPasswd: boolPtr(false), SSHPasswordAuth: "disable"}
+	content, err := manifest.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	expected := "user: deploy\nkeys:\n  - github:octocat\nsudo-nopasswd: false\nssh-password-auth: disable\n"
+	if string(content) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, content)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -15,11 +15,45 @@ type Config struct {
 	Password bool   `mapstructure:"password"`
 
 	// SSH key management
-	Keys []string `mapstructure:"keys"`
+	Keys          []string `mapstructure:"keys"`
+	KeysExclusive bool     `mapstructure:"keys-exclusive"`
+	GitHubToken   string   `mapstructure:"github-token"`
+	KeyPins       []string `mapstructure:"key-pins"`
+	KeyCacheDir   string   `mapstructure:"key-cache-dir"`
+	NoKeyCache    bool     `mapstructure:"no-key-cache"`
+
+	// SSH key pair generation
+	GenerateKey               string `mapstructure:"generate-key"`
+	GenerateKeyPassphraseFile string `mapstructure:"generate-key-passphrase-file"`
+
+	// Network settings for remote key sources
+	KeyProxy        string   `mapstructure:"key-proxy"`
+	KeyNoProxy      string   `mapstructure:"key-no-proxy"`
+	KeyCAFiles      []string `mapstructure:"key-ca-files"`
+	KeyClientCert   string   `mapstructure:"key-client-cert"`
+	KeyClientKey    string   `mapstructure:"key-client-key"`
+	InsecureURLKeys bool     `mapstructure:"insecure-url-keys"`
+
+	// Signature verification for url: key sources
+	URLKeysAllowedSigners     string `mapstructure:"url-keys-allowed-signers"`
+	URLKeysSignatureNamespace string `mapstructure:"url-keys-signature-namespace"`
 
 	// Sudo configuration
-	SudoNoPasswd bool `mapstructure:"sudo-nopasswd"`
-	SkipSudo     bool `mapstructure:"skip-sudo"`
+	SudoNoPasswd bool       `mapstructure:"sudo-nopasswd"`
+	SkipSudo     bool       `mapstructure:"skip-sudo"`
+	SudoRules    []SudoRule `mapstructure:"sudo-rules"`
+	AdminGroup   string     `mapstructure:"admin-group"`
+
+	// Privilege backend: auto, sudo or doas
+	PrivilegeBackend string `mapstructure:"privilege-backend"`
+
+	// Sudo hardening defaults
+	SudoDefaults         bool   `mapstructure:"sudo-defaults"`
+	SudoLogfile          string `mapstructure:"sudo-logfile"`
+	SudoTimestampTimeout int    `mapstructure:"sudo-timestamp-timeout"`
+	SudoPasswdTries      int    `mapstructure:"sudo-passwd-tries"`
+	SudoLecture          string `mapstructure:"sudo-lecture"`
+	SudoIOLog            bool   `mapstructure:"sudo-io-log"`
 
 	// SSH security
 	SSHNoRoot     bool `mapstructure:"ssh-no-root"`
@@ -27,6 +61,54 @@ type Config struct {
 	All           bool `mapstructure:"all"`
 	Backup        bool `mapstructure:"backup"`
 
+	// Make cloud-init keep the SSH settings
+	CloudInitConfig bool `mapstructure:"cloud-init-config"`
+
+	// SSH host keys
+	HostKeys     bool     `mapstructure:"host-keys"`
+	HostKeyTypes []string `mapstructure:"host-key-types"`
+
+	// SSH user certificate authority
+	SSHUserCA           string              `mapstructure:"ssh-user-ca"`
+	SSHUserCAPrincipals map[string][]string `mapstructure:"ssh-user-ca-principals"`
+
+	// Firewall: backend is auto, ufw, firewalld or nftables
+	Firewall        bool     `mapstructure:"firewall"`
+	FirewallAllow   []string `mapstructure:"firewall-allow"`
+	FirewallPolicy  string   `mapstructure:"firewall-policy"`
+	FirewallBackend string   `mapstructure:"firewall-backend"`
+
+	// fail2ban sshd jail
+	Fail2ban         bool     `mapstructure:"fail2ban"`
+	Fail2banBanTime  string   `mapstructure:"fail2ban-bantime"`
+	Fail2banFindTime string   `mapstructure:"fail2ban-findtime"`
+	Fail2banMaxRetry int      `mapstructure:"fail2ban-maxretry"`
+	Fail2banIgnoreIP []string `mapstructure:"fail2ban-ignoreip"`
+
+	// Automatic security updates
+	AutoUpdates           bool   `mapstructure:"auto-updates"`
+	AutoUpdatesReboot     bool   `mapstructure:"auto-updates-reboot"`
+	AutoUpdatesRebootTime string `mapstructure:"auto-updates-reboot-time"`
+	AutoUpdatesMail       string `mapstructure:"auto-updates-mail"`
+	AutoUpdatesSyslog     bool   `mapstructure:"auto-updates-syslog"`
+
+	// Baseline packages, by their Debian names
+	Packages       []string                     `mapstructure:"packages"`
+	PackagesRemove []string                     `mapstructure:"packages-remove"`
+	PackageNames   map[string]map[string]string `mapstructure:"package-names"`
+
+	// System identity and time
+	Hostname   string   `mapstructure:"hostname"`
+	Timezone   string   `mapstructure:"timezone"`
+	Locale     string   `mapstructure:"locale"`
+	NTP        bool     `mapstructure:"ntp"`
+	NTPServers []string `mapstructure:"ntp-servers"`
+
+	// Kernel parameter hardening
+	Sysctl            bool   `mapstructure:"sysctl"`
+	SysctlProfile     string `mapstructure:"sysctl-profile"`
+	SysctlDisableIPv6 bool   `mapstructure:"sysctl-disable-ipv6"`
+
 	// General options
 	Verbose bool `mapstructure:"verbose"`
 	Quiet   bool `mapstructure:"quiet"`
@@ -35,6 +117,16 @@ type Config struct {
 	Status  bool `mapstructure:"status"`
 }
 
+// SudoRule restricts the user's sudo access to a list of commands
+type SudoRule struct {
+	Alias    string   `mapstructure:"alias"`
+	Commands []string `mapstructure:"commands"`
+	RunAs    []string `mapstructure:"runas"`
+	NoPasswd bool     `mapstructure:"nopasswd"`
+	SetEnv   bool     `mapstructure:"setenv"`
+	NoExec   bool     `mapstructure:"noexec"`
+}
+
 // InitConfig initializes the configuration system
 func InitConfig(cfgFile string) error {
 	if cfgFile != "" {
@@ -95,12 +187,66 @@ func SaveConfig(config *Config, filePath string) error {
 	viper.Set("user", config.User)
 	viper.Set("password", config.Password)
 	viper.Set("keys", config.Keys)
+	viper.Set("keys-exclusive", config.KeysExclusive)
+	viper.Set("generate-key", config.GenerateKey)
+	viper.Set("generate-key-passphrase-file", config.GenerateKeyPassphraseFile)
+	viper.Set("github-token", config.GitHubToken)
+	viper.Set("key-pins", config.KeyPins)
+	viper.Set("key-cache-dir", config.KeyCacheDir)
+	viper.Set("no-key-cache", config.NoKeyCache)
+	viper.Set("key-proxy", config.KeyProxy)
+	viper.Set("key-no-proxy", config.KeyNoProxy)
+	viper.Set("key-ca-files", config.KeyCAFiles)
+	viper.Set("key-client-cert", config.KeyClientCert)
+	viper.Set("key-client-key", config.KeyClientKey)
+	viper.Set("insecure-url-keys", config.InsecureURLKeys)
+	viper.Set("url-keys-allowed-signers", config.URLKeysAllowedSigners)
+	viper.Set("url-keys-signature-namespace", config.URLKeysSignatureNamespace)
 	viper.Set("sudo-nopasswd", config.SudoNoPasswd)
 	viper.Set("skip-sudo", config.SkipSudo)
+	viper.Set("sudo-rules", config.SudoRules)
+	viper.Set("admin-group", config.AdminGroup)
+	viper.Set("privilege-backend", config.PrivilegeBackend)
+	viper.Set("sudo-defaults", config.SudoDefaults)
+	viper.Set("sudo-logfile", config.SudoLogfile)
+	viper.Set("sudo-timestamp-timeout", config.SudoTimestampTimeout)
+	viper.Set("sudo-passwd-tries", config.SudoPasswdTries)
+	viper.Set("sudo-lecture", config.SudoLecture)
+	viper.Set("sudo-io-log", config.SudoIOLog)
 	viper.Set("ssh-no-root", config.SSHNoRoot)
 	viper.Set("ssh-no-password", config.SSHNoPassword)
 	viper.Set("all", config.All)
 	viper.Set("backup", config.Backup)
+	viper.Set("cloud-init-config", config.CloudInitConfig)
+	viper.Set("host-keys", config.HostKeys)
+	viper.Set("host-key-types", config.HostKeyTypes)
+	viper.Set("ssh-user-ca", config.SSHUserCA)
+	viper.Set("ssh-user-ca-principals", config.SSHUserCAPrincipals)
+	viper.Set("firewall", config.Firewall)
+	viper.Set("firewall-allow", config.FirewallAllow)
+	viper.Set("firewall-policy", config.FirewallPolicy)
+	viper.Set("firewall-backend", config.FirewallBackend)
+	viper.Set("fail2ban", config.Fail2ban)
+	viper.Set("fail2ban-bantime", config.Fail2banBanTime)
+	viper.Set("fail2ban-findtime", config.Fail2banFindTime)
+	viper.Set("fail2ban-maxretry", config.Fail2banMaxRetry)
+	viper.Set("fail2ban-ignoreip", config.Fail2banIgnoreIP)
+	viper.Set("auto-updates", config.AutoUpdates)
+	viper.Set("auto-updates-reboot", config.AutoUpdatesReboot)
+	viper.Set("auto-updates-reboot-time", config.AutoUpdatesRebootTime)
+	viper.Set("auto-updates-mail", config.AutoUpdatesMail)
+	viper.Set("auto-updates-syslog", config.AutoUpdatesSyslog)
+	viper.Set("packages", config.Packages)
+	viper.Set("packages-remove", config.PackagesRemove)
+	viper.Set("package-names", config.PackageNames)
+	viper.Set("hostname", config.Hostname)
+	viper.Set("timezone", config.Timezone)
+	viper.Set("locale", config.Locale)
+	viper.Set("ntp", config.NTP)
+	viper.Set("ntp-servers", config.NTPServers)
+	viper.Set("sysctl", config.Sysctl)
+	viper.Set("sysctl-profile", config.SysctlProfile)
+	viper.Set("sysctl-disable-ipv6", config.SysctlDisableIPv6)
 	viper.Set("verbose", config.Verbose)
 	viper.Set("quiet", config.Quiet)
 	viper.Set("yes", config.Yes)
@@ -118,20 +264,72 @@ func SaveConfig(config *Config, filePath string) error {
 // GetDefaultConfig returns a configuration with default values
 func GetDefaultConfig() *Config {
 	return &Config{
-		User:          "",
-		Password:      false,
-		Keys:          []string{},
-		SudoNoPasswd:  true,
-		SkipSudo:      false,
-		SSHNoRoot:     true,
-		SSHNoPassword: true,
-		All:           false,
-		Backup:        false,
-		Verbose:       false,
-		Quiet:         false,
-		Yes:           false,
-		DryRun:        false,
-		Status:        false,
+		User:                      "",
+		Password:                  false,
+		Keys:                      []string{},
+		KeysExclusive:             false,
+		GitHubToken:               "",
+		KeyPins:                   []string{},
+		KeyCacheDir:               "",
+		NoKeyCache:                false,
+		GenerateKey:               "",
+		GenerateKeyPassphraseFile: "",
+		KeyProxy:                  "",
+		KeyNoProxy:                "",
+		KeyCAFiles:                []string{},
+		KeyClientCert:             "",
+		KeyClientKey:              "",
+		InsecureURLKeys:           false,
+		URLKeysAllowedSigners:     "",
+		URLKeysSignatureNamespace: "file",
+		SudoNoPasswd:              true,
+		SkipSudo:                  false,
+		SudoRules:                 []SudoRule{},
+		AdminGroup:                "",
+		PrivilegeBackend:          "auto",
+		SudoDefaults:              false,
+		SudoLogfile:               "/var/log/sudo.log",
+		SudoTimestampTimeout:      5,
+		SudoPasswdTries:           3,
+		SudoLecture:               "once",
+		SudoIOLog:                 false,
+		SSHNoRoot:                 true,
+		SSHNoPassword:             true,
+		All:                       false,
+		Backup:                    false,
+		CloudInitConfig:           false,
+		HostKeys:                  false,
+		HostKeyTypes:              []string{"ed25519", "rsa"},
+		Firewall:                  false,
+		FirewallAllow:             []string{},
+		FirewallPolicy:            "deny",
+		FirewallBackend:           "auto",
+		Fail2ban:                  false,
+		Fail2banBanTime:           "1h",
+		Fail2banFindTime:          "10m",
+		Fail2banMaxRetry:          5,
+		Fail2banIgnoreIP:          []string{},
+		AutoUpdates:               false,
+		AutoUpdatesReboot:         false,
+		AutoUpdatesRebootTime:     "03:00",
+		AutoUpdatesMail:           "",
+		AutoUpdatesSyslog:         false,
+		Packages:                  []string{},
+		PackagesRemove:            []string{},
+		PackageNames:              map[string]map[string]string{},
+		Hostname:                  "",
+		Timezone:                  "",
+		Locale:                    "",
+		NTP:                       false,
+		NTPServers:                []string{},
+		Sysctl:                    false,
+		SysctlProfile:             "baseline",
+		SysctlDisableIPv6:         false,
+		Verbose:                   false,
+		Quiet:                     false,
+		Yes:                       false,
+		DryRun:                    false,
+		Status:                    false,
 	}
 }
 
@@ -208,6 +208,11 @@ keys:
   - gitlab:testuser
 sudo-nopasswd: true
 skip-sudo: false
+sudo-rules:
+  - commands:
+      - /usr/bin/systemctl restart app
+    runas: [app]
+    nopasswd: true
 ssh-no-root: true
 ssh-no-password: true
 verbose: true
@@ -238,6 +243,7 @@ status: true
 	assert.Equal(t, []string{"github:testuser", "gitlab:testuser"}, config.Keys, "Keys should match")
 	assert.Equal(t, true, config.SudoNoPasswd, "SudoNoPasswd should match")
 	assert.Equal(t, false, config.SkipSudo, "SkipSudo should match")
+	assert.Equal(t, []SudoRule{{Commands: []string{"/usr/bin/systemctl restart app"}, RunAs: []string{"app"}, NoPasswd: true}}, config.SudoRules, "SudoRules should match")
 	assert.Equal(t, true, config.SSHNoRoot, "SSHNoRoot should match")
 	assert.Equal(t, true, config.SSHNoPassword, "SSHNoPassword should match")
 	assert.Equal(t, true, config.Verbose, "Verbose should match")
@@ -0,0 +1,275 @@
+// Package fail2ban implements the SSH brute-force protection feature
+package fail2ban
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/pkgmanager"
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+// Feature implements the SSH brute-force protection feature
+type Feature struct {
+	osInfo *osdetect.Info
+}
+
+// New creates a new SSH brute-force protection feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+	}
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "fail2ban"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Ban hosts that repeatedly fail to log in over SSH"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "fail2ban",
+			Shorthand: "",
+			Usage:     "install fail2ban and enable an sshd jail for the configured SSH ports",
+			Default:   false,
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	enabled, _ := options["fail2ban"].(bool)
+	return enabled
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	_, err := settingsFromOptions(options, []int{sshdconfig.DefaultPort})
+	return err
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	settings, err := settingsFromOptions(ctx.Options, f.sshPorts())
+	if err != nil {
+		return err
+	}
+	settings.Backend = detectLogBackend("/")
+	content := renderJail(settings)
+
+	installed := isInstalled("fail2ban-client")
+	current, _ := os.ReadFile(jailFile)
+	manager, managerErr := service.Detect()
+	active := false
+	if managerErr == nil {
+		active, _ = manager.IsActive("fail2ban")
+	}
+
+	if installed && active && string(current) == content {
+		ctx.Logger.Success("✓ fail2ban already protects SSH")
+		return nil
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		if !installed {
+			ctx.Logger.Info("Would install fail2ban with %s", f.osInfo.PackageManager)
+			if pkgmanager.UpgradesSystem(f.osInfo.PackageManager) {
+				ctx.Logger.Info("Would upgrade all installed packages first, as %s only installs with a full system upgrade", f.osInfo.PackageManager)
+			}
+		}
+		if string(current) != content {
+			ctx.Logger.Info("Would write sshd jail %s", jailFile)
+			if ctx.Verbose {
+				ctx.Logger.MultiLine("info", "Jail configuration:", strings.Split(strings.TrimRight(content, "\n"), "\n"))
+			}
+		}
+		ctx.Logger.Info("Would enable and start the fail2ban service")
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("configuring fail2ban requires root privileges")
+	}
+	if managerErr != nil {
+		return managerErr
+	}
+
+	if !installed {
+		if err := f.install(ctx); err != nil {
+			return err
+		}
+	}
+
+	if string(current) != content {
+		if err := writeJail(ctx, content, current); err != nil {
+			return err
+		}
+	}
+
+	// Start fail2ban, or reload it to pick up the new jail
+	if err := manager.Enable("fail2ban"); err != nil {
+		ctx.Logger.Warning("Failed to enable the fail2ban service: %v", err)
+	}
+	if active, _ = manager.IsActive("fail2ban"); active {
+		err = service.ReloadOrRestart(manager, "fail2ban")
+	} else {
+		err = manager.Restart("fail2ban")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start fail2ban: %w", err)
+	}
+
+	ctx.Logger.Success("fail2ban protects SSH on port %s", joinPorts(settings.Ports))
+	return nil
+}
+
+// install installs fail2ban with the system package manager
+func (f *Feature) install(ctx *features.ExecutionContext) error {
+	manager, err := pkgmanager.New(f.osInfo.PackageManager)
+	if err != nil {
+		return fmt.Errorf("failed to install fail2ban: %w", err)
+	}
+
+	if pkgmanager.UpgradesSystem(manager.Kind()) {
+		ctx.Logger.Warning("Upgrading all installed packages first, as %s only installs with a full system upgrade", manager.Kind())
+	}
+	ctx.Logger.Step("Installing fail2ban...")
+	warn := func(err error) { ctx.Logger.Warning("Failed to update package metadata: %v", err) }
+	if err := pkgmanager.UpdateAndInstall(manager, warn, "fail2ban"); err != nil {
+		if f.osInfo.PackageManager == osdetect.DNF || f.osInfo.PackageManager == osdetect.YUM {
+			return fmt.Errorf("failed to install fail2ban (on Red Hat systems fail2ban is in EPEL): %w", err)
+		}
+		return fmt.Errorf("failed to install fail2ban: %w", err)
+	}
+	return nil
+}
+
+// writeJail installs the jail drop-in and checks the configuration with fail2ban-client.
+// The previous file is restored if the check fails, so fail2ban keeps starting.
+func writeJail(ctx *features.ExecutionContext, content string, previous []byte) error {
+	ctx.Logger.Step("Writing sshd jail %s", jailFile)
+	if err := os.MkdirAll(filepath.Dir(jailFile), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(jailFile), err)
+	}
+	if err := safefile.WriteFile(jailFile, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write jail file: %w", err)
+	}
+
+	output, err := exec.Command("fail2ban-client", "-t").CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if previous != nil {
+		_ = safefile.WriteFile(jailFile, previous, 0644)
+	} else {
+		os.Remove(jailFile)
+	}
+	return fmt.Errorf("invalid fail2ban configuration: %s: %w", lastLine(string(output)), err)
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 55 // The jail follows the final SSH port, after the firewall is configured
+}
+
+// DetectCurrentState detects and returns the current state of the fail2ban feature
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+
+	sshPorts := f.sshPorts()
+	state["ssh_ports"] = sshPorts
+	state["jail_file"] = jailFile
+	state["fail2ban_installed"] = isInstalled("fail2ban-client")
+
+	if content, err := os.ReadFile(jailFile); err == nil {
+		jail := parseJail(string(content), "sshd")
+		state["jail_settings"] = jail
+		state["jail_port_matches"] = jail["port"] == joinPorts(sshPorts)
+	}
+
+	manager, err := service.Detect()
+	if err != nil {
+		return state, nil
+	}
+	active, _ := manager.IsActive("fail2ban")
+	state["fail2ban_active"] = active
+	if isInstalled("sshguard") {
+		state["sshguard_active"], _ = manager.IsActive("sshguard")
+	}
+
+	// Reading jail status needs access to the fail2ban socket, which requires root
+	if active {
+		if output, err := exec.Command("fail2ban-client", "status", "sshd").CombinedOutput(); err == nil {
+			status := parseJailStatus(string(output))
+			state["currently_banned"] = status.CurrentlyBanned
+			state["total_banned"] = status.TotalBanned
+			state["currently_failed"] = status.CurrentlyFailed
+		}
+	}
+
+	return state, nil
+}
+
+// DisplayCurrentState displays the current state of the fail2ban feature
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	installed, _ := state["fail2ban_installed"].(bool)
+	active, _ := state["fail2ban_active"].(bool)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "fail2ban")
+	switch {
+	case !installed:
+		fmt.Printf("\033[1;33m⚠ Not installed\033[0m\n")
+	case !active:
+		fmt.Printf("\033[1;33m⚠ Not running\033[0m\n")
+	default:
+		fmt.Printf("\033[1;32m✓ Running\033[0m\n")
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// Brute-force protection is only configured on request
+	return false
+}
+
+// sshPorts returns the ports sshd listens on, including those set in drop-ins
+func (f *Feature) sshPorts() []int {
+	return sshdconfig.ResolvePorts(osdetect.GetSSHConfigPath(f.osInfo))
+}
+
+// lastLine returns the last non-empty line of command output, which usually holds the error
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// isInstalled reports whether a program is in the PATH
+func isInstalled(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
@@ -0,0 +1,180 @@
+package fail2ban
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSettingsFromOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]any
+		want      jailSettings
+		expectErr bool
+	}{
+		{
+			name:    "defaults",
+			options: map[string]any{},
+			want:    jailSettings{Ports: []int{22}, BanTime: "1h", FindTime: "10m", MaxRetry: 5},
+		},
+		{
+			name: "configured values",
+			options: map[string]any{
+				"fail2ban-bantime":  "1d",
+				"fail2ban-findtime": 600,
+				"fail2ban-maxretry": "3",
+				"fail2ban-ignoreip": []any{"203.0.113.10", "10.0.0.0/8"},
+			},
+			want: jailSettings{Ports: []int{22}, BanTime: "1d", FindTime: "600", MaxRetry: 3, IgnoreIP: []string{"203.0.113.10", "10.0.0.0/8"}},
+		},
+		{
+			name:    "ban forever",
+			options: map[string]any{"fail2ban-bantime": "-1"},
+			want:    jailSettings{Ports: []int{22}, BanTime: "-1", FindTime: "10m", MaxRetry: 5},
+		},
+		{
+			name:    "ignore IPs as comma-separated string",
+			options: map[string]any{"fail2ban-ignoreip": "192.0.2.1, 2001:db8::/32"},
+			want:    jailSettings{Ports: []int{22}, BanTime: "1h", FindTime: "10m", MaxRetry: 5, IgnoreIP: []string{"192.0.2.1", "2001:db8::/32"}},
+		},
+		{name: "invalid bantime", options: map[string]any{"fail2ban-bantime": "1 hour"}, expectErr: true},
+		{name: "findtime forever", options: map[string]any{"fail2ban-findtime": "-1"}, expectErr: true},
+		{name: "zero maxretry", options: map[string]any{"fail2ban-maxretry": 0}, expectErr: true},
+		{name: "non-numeric maxretry", options: map[string]any{"fail2ban-maxretry": "five"}, expectErr: true},
+		{name: "invalid ignore IP", options: map[string]any{"fail2ban-ignoreip": []string{"example.com"}}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := settingsFromOptions(tt.options, []int{22})
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderJail(t *testing.T) {
+	settings := jailSettings{
+		Ports:    []int{22, 2222},
+		BanTime:  "1h",
+		FindTime: "10m",
+		MaxRetry: 5,
+		IgnoreIP: []string{"10.0.0.0/8"},
+		Backend:  "systemd",
+	}
+	content := renderJail(settings)
+
+	want := map[string]string{
+		"enabled":  "true",
+		"port":     "22,2222",
+		"bantime":  "1h",
+		"findtime": "10m",
+		"maxretry": "5",
+		"ignoreip": "127.0.0.1/8 ::1 10.0.0.0/8",
+		"backend":  "systemd",
+	}
+	if got := parseJail(content, "sshd"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	settings.Backend = ""
+	if strings.Contains(renderJail(settings), "backend") {
+		t.Errorf("Expected no backend setting when the backend is empty")
+	}
+}
+
+func TestParseJail(t *testing.T) {
+	content := `[DEFAULT]
+bantime = 10m
+
+# SSH jail
+[sshd]
+enabled = true
+port    = ssh
+; comment
+maxretry=3
+
+[nginx-http-auth]
+enabled = false
+`
+	want := map[string]string{"enabled": "true", "port": "ssh", "maxretry": "3"}
+	if got := parseJail(content, "sshd"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := parseJail(content, "recidive"); len(got) != 0 {
+		t.Errorf("Expected no settings for a missing section, got %v", got)
+	}
+}
+
+func TestParseJailStatus(t *testing.T) {
+	output := "Status for the jail: sshd\n" +
+		"|- Filter\n" +
+		"|  |- Currently failed:\t2\n" +
+		"|  |- Total failed:\t57\n" +
+		"|  `- Journal matches:\t_SYSTEMD_UNIT=sshd.service + _COMM=sshd\n" +
+		"`- Actions\n" +
+		"   |- Currently banned:\t2\n" +
+		"   |- Total banned:\t9\n" +
+		"   `- Banned IP list:\t198.51.100.7 203.0.113.99\n"
+
+	want := jailStatus{
+		CurrentlyFailed: 2,
+		CurrentlyBanned: 2,
+		TotalBanned:     9,
+		BannedIPs:       []string{"198.51.100.7", "203.0.113.99"},
+	}
+	if got := parseJailStatus(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDetectLogBackend(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{name: "auth log", paths: []string{"var/log/auth.log", "run/systemd/journal"}, want: ""},
+		{name: "secure log", paths: []string{"var/log/secure"}, want: ""},
+		{name: "journal only", paths: []string{"run/systemd/journal"}, want: "systemd"},
+		{name: "persistent journal only", paths: []string{"var/log/journal"}, want: "systemd"},
+		{name: "no logs", paths: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := os.MkdirTemp("", "iniq-fail2ban-test")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+
+			for _, path := range tt.paths {
+				full := filepath.Join(root, path)
+				if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(full, nil, 0644); err != nil {
+					t.Fatalf("Failed to create file: %v", err)
+				}
+			}
+
+			if got := detectLogBackend(root); got != tt.want {
+				t.Errorf("Expected backend %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
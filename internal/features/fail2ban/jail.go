@@ -0,0 +1,232 @@
+package fail2ban
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jailFile is the jail.d drop-in holding the managed sshd jail. The .local suffix makes
+// fail2ban read it after the packaged .conf files, so its settings win.
+const jailFile = "/etc/fail2ban/jail.d/iniq.local"
+
+// localhostIgnoreIPs are never banned, so a misconfigured local client cannot lock out the host
+var localhostIgnoreIPs = []string{"127.0.0.1/8", "::1"}
+
+// durationPattern matches fail2ban time values such as 600, 10m or 1h30m, and -1 for forever
+var durationPattern = regexp.MustCompile(`^(-1|\d+|(\d+[smhdw])+)$`)
+
+// jailSettings are the settings of the managed sshd jail
+type jailSettings struct {
+	Ports    []int
+	BanTime  string
+	FindTime string
+	MaxRetry int
+	IgnoreIP []string
+
+	// Backend is systemd on hosts that only log to the journal, empty to let fail2ban decide
+	Backend string
+}
+
+// jailStatus is the state of a running jail
+type jailStatus struct {
+	CurrentlyFailed int
+	CurrentlyBanned int
+	TotalBanned     int
+	BannedIPs       []string
+}
+
+// settingsFromOptions returns the jail settings from the options, using the built-in values for unset options
+func settingsFromOptions(options map[string]any, ports []int) (jailSettings, error) {
+	settings := jailSettings{
+		Ports:    ports,
+		BanTime:  "1h",
+		FindTime: "10m",
+		MaxRetry: 5,
+	}
+
+	if banTime := stringOption(options, "fail2ban-bantime"); banTime != "" {
+		settings.BanTime = banTime
+	}
+	if findTime := stringOption(options, "fail2ban-findtime"); findTime != "" {
+		settings.FindTime = findTime
+	}
+	var err error
+	if settings.MaxRetry, err = intOption(options, "fail2ban-maxretry", settings.MaxRetry); err != nil {
+		return settings, err
+	}
+	if settings.IgnoreIP, err = ignoreIPOption(options); err != nil {
+		return settings, err
+	}
+
+	if !durationPattern.MatchString(settings.BanTime) {
+		return settings, fmt.Errorf("invalid fail2ban-bantime %q: must be seconds or a duration such as 10m, 1h or 1d, or -1", settings.BanTime)
+	}
+	if settings.FindTime == "-1" || !durationPattern.MatchString(settings.FindTime) {
+		return settings, fmt.Errorf("invalid fail2ban-findtime %q: must be seconds or a duration such as 10m, 1h or 1d", settings.FindTime)
+	}
+	if settings.MaxRetry < 1 {
+		return settings, fmt.Errorf("invalid fail2ban-maxretry %d: must be at least 1", settings.MaxRetry)
+	}
+	return settings, nil
+}
+
+// ignoreIPOption returns the addresses and networks from the fail2ban-ignoreip option
+func ignoreIPOption(options map[string]any) ([]string, error) {
+	var values []string
+	switch v := options["fail2ban-ignoreip"].(type) {
+	case []string:
+		values = v
+	case []any:
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		if _, err := netip.ParsePrefix(value); err != nil {
+			if _, err := netip.ParseAddr(value); err != nil {
+				return nil, fmt.Errorf("invalid fail2ban-ignoreip %q: must be an IP address or network", value)
+			}
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// renderJail returns the content of the managed jail drop-in
+func renderJail(settings jailSettings) string {
+	var content strings.Builder
+	content.WriteString("# Managed by INIQ, changes will be overwritten\n")
+	content.WriteString("[sshd]\n")
+	content.WriteString("enabled = true\n")
+	fmt.Fprintf(&content, "port = %s\n", joinPorts(settings.Ports))
+	fmt.Fprintf(&content, "bantime = %s\n", settings.BanTime)
+	fmt.Fprintf(&content, "findtime = %s\n", settings.FindTime)
+	fmt.Fprintf(&content, "maxretry = %d\n", settings.MaxRetry)
+	fmt.Fprintf(&content, "ignoreip = %s\n", strings.Join(append(append([]string{}, localhostIgnoreIPs...), settings.IgnoreIP...), " "))
+	if settings.Backend != "" {
+		fmt.Fprintf(&content, "backend = %s\n", settings.Backend)
+	}
+	return content.String()
+}
+
+// joinPorts formats ports the way the jail's port setting lists them
+func joinPorts(ports []int) string {
+	values := make([]string, 0, len(ports))
+	for _, port := range ports {
+		values = append(values, strconv.Itoa(port))
+	}
+	return strings.Join(values, ",")
+}
+
+// parseJail returns the settings of a section in a fail2ban configuration file
+func parseJail(content, section string) map[string]string {
+	settings := make(map[string]string)
+	current := ""
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if key, value, found := strings.Cut(line, "="); found {
+			settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return settings
+}
+
+// parseJailStatus parses fail2ban-client status <jail> output
+func parseJailStatus(output string) jailStatus {
+	var status jailStatus
+	for _, line := range strings.Split(output, "\n") {
+		// Lines look like "|  |- Currently failed:\t0"
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimLeft(key, "|`- \t")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Currently failed":
+			status.CurrentlyFailed, _ = strconv.Atoi(value)
+		case "Currently banned":
+			status.CurrentlyBanned, _ = strconv.Atoi(value)
+		case "Total banned":
+			status.TotalBanned, _ = strconv.Atoi(value)
+		case "Banned IP list":
+			status.BannedIPs = strings.Fields(value)
+		}
+	}
+	return status
+}
+
+// detectLogBackend returns systemd when sshd logs only to the journal. fail2ban's default
+// backend reads log files and fails to start the sshd jail when there are none.
+func detectLogBackend(root string) string {
+	for _, logFile := range []string{"var/log/auth.log", "var/log/secure", "var/log/messages"} {
+		if _, err := os.Stat(filepath.Join(root, logFile)); err == nil {
+			return ""
+		}
+	}
+	for _, journal := range []string{"run/systemd/journal", "var/log/journal"} {
+		if _, err := os.Stat(filepath.Join(root, journal)); err == nil {
+			return "systemd"
+		}
+	}
+	return ""
+}
+
+// stringOption returns a string option, which config files may give as a number
+func stringOption(options map[string]any, name string) string {
+	switch v := options[name].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case int, int64, float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// intOption returns an integer option, which config files and environment variables may give as a string
+func intOption(options map[string]any, name string, fallback int) (int, error) {
+	switch v := options[name].(type) {
+	case nil:
+		return fallback, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		if v == "" {
+			return fallback, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: must be a number", name, v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid %s: must be a number", name)
+}
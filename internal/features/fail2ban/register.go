@@ -0,0 +1,13 @@
+package fail2ban
+
+import (
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// init registers the fail2ban feature
+func init() {
+	features.RegisterFail2banFeature = func(registry *features.Registry, osInfo *osdetect.Info) {
+		registry.Register(New(osInfo))
+	}
+}
@@ -2,6 +2,8 @@
 package features
 
 import (
+	"errors"
+
 	"github.com/teomyth/iniq/internal/logger"
 	"github.com/teomyth/iniq/pkg/osdetect"
 )
@@ -12,8 +14,44 @@ var (
 	RegisterSSHFeature      func(*Registry, *osdetect.Info)
 	RegisterSudoFeature     func(*Registry, *osdetect.Info)
 	RegisterSecurityFeature func(*Registry, *osdetect.Info)
+	RegisterHostKeysFeature func(*Registry, *osdetect.Info)
+	RegisterFirewallFeature func(*Registry, *osdetect.Info)
+	RegisterFail2banFeature func(*Registry, *osdetect.Info)
+	RegisterUpdatesFeature  func(*Registry, *osdetect.Info)
+	RegisterPackagesFeature func(*Registry, *osdetect.Info)
+	RegisterSystemFeature   func(*Registry, *osdetect.Info)
+	RegisterSysctlFeature   func(*Registry, *osdetect.Info)
 )
 
+// ErrNotRetryable matches errors that running a feature again cannot fix
+var ErrNotRetryable = errors.New("not retryable")
+
+// notRetryableError marks an error as not retryable without changing its message
+type notRetryableError struct {
+	err error
+}
+
+func (e notRetryableError) Error() string        { return e.err.Error() }
+func (e notRetryableError) Unwrap() error        { return e.err }
+func (e notRetryableError) Is(target error) bool { return target == ErrNotRetryable }
+
+// NotRetryable marks err so that errors.Is(err, ErrNotRetryable) reports true
+func NotRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return notRetryableError{err: err}
+}
+
+// PrivilegedSkipped reports whether operations needing root are skipped for the whole run,
+// because --skip-sudo was given or the operator chose to continue without sudo access.
+// Declining sudo access for the configured user in the interactive flow only sets skip-sudo,
+// which does not stop features requested with their own options.
+func PrivilegedSkipped(options map[string]any) bool {
+	skip, _ := options["skip-privileged"].(bool)
+	return skip
+}
+
 // Flag represents a command-line flag for a feature
 type Flag struct {
 	// Name is the long name of the flag (e.g., "user")
@@ -2,6 +2,7 @@ package features
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 )
 
@@ -241,3 +242,44 @@ func TestValidateAndExecuteFeatures(t *testing.T) {
 		t.Errorf("executeFeatures should not return error: %v", err)
 	}
 }
+
+func TestNotRetryable(t *testing.T) {
+	if NotRetryable(nil) != nil {
+		t.Errorf("Expected nil error to stay nil")
+	}
+
+	cause := errors.New("refusing to replace authorized_keys")
+	err := fmt.Errorf("ssh: %w", NotRetryable(cause))
+	if !errors.Is(err, ErrNotRetryable) {
+		t.Errorf("Expected wrapped error to match ErrNotRetryable")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("Expected wrapped error to match its cause")
+	}
+	if err.Error() != "ssh: refusing to replace authorized_keys" {
+		t.Errorf("Expected message to be unchanged, got %q", err.Error())
+	}
+	if errors.Is(cause, ErrNotRetryable) {
+		t.Errorf("Expected unmarked error not to match ErrNotRetryable")
+	}
+}
+
+func TestPrivilegedSkipped(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  map[string]any
+		expected bool
+	}{
+		{"no options", map[string]any{}, false},
+		{"skip-sudo only", map[string]any{"skip-sudo": true}, false},
+		{"skip-privileged", map[string]any{"skip-sudo": true, "skip-privileged": true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := PrivilegedSkipped(tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
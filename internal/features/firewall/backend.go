@@ -0,0 +1,104 @@
+package firewall
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+)
+
+// Status describes the inbound rules a firewall enforces
+type Status struct {
+	// Active reports whether the firewall filters inbound traffic
+	Active bool
+
+	// Policy is the default inbound policy: deny, reject or allow
+	Policy string
+
+	// Rules are the allow rules the firewall enforces
+	Rules []Rule
+
+	// Other lists entries that cannot be expressed as rules, such as application profiles
+	Other []string
+}
+
+// backend manages inbound rules through a firewall tool
+type backend interface {
+	// Name returns the name of the firewall tool
+	Name() string
+
+	// Status reports the current inbound rules
+	Status() (Status, error)
+
+	// Snapshot saves the current firewall state under dir and returns a shell script that restores it
+	Snapshot(dir string) (string, error)
+
+	// Apply replaces the running rule set. Rules are added before the default policy changes
+	// so existing SSH access is never blocked while the rule set is being changed.
+	Apply(ctx *features.ExecutionContext, policy string, rules []Rule) error
+
+	// Persist makes the applied rule set survive reboots
+	Persist(ctx *features.ExecutionContext, policy string, rules []Rule) error
+}
+
+// runner runs a command and returns its combined output
+type runner func(name string, args ...string) ([]byte, error)
+
+// runCommand runs a command on the host
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// run runs a command and includes its output in the error
+func run(r runner, name string, args ...string) error {
+	if output, err := r(name, args...); err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%s %s: %s: %w", name, strings.Join(args, " "), message, err)
+		}
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// selectBackend returns the name of the firewall backend to use. An empty or "auto" choice
+// prefers the distribution's firewall frontend, ufw or firewalld, over plain nftables.
+func selectBackend(choice string, installed func(string) bool) (string, error) {
+	switch choice {
+	case "ufw", "firewalld", "nftables":
+		return choice, nil
+	case "", "auto":
+		switch {
+		case installed("ufw"):
+			return "ufw", nil
+		case installed("firewall-cmd"):
+			return "firewalld", nil
+		case installed("nft"):
+			return "nftables", nil
+		}
+		return "", fmt.Errorf("no supported firewall found: install ufw, firewalld or nftables")
+	}
+	return "", fmt.Errorf("invalid firewall-backend %q: must be auto, ufw, firewalld or nftables", choice)
+}
+
+// newBackend returns the backend with the given name
+func newBackend(name string) backend {
+	switch name {
+	case "ufw":
+		return &ufwBackend{run: runCommand, files: ufwFiles}
+	case "firewalld":
+		return &firewalldBackend{run: runCommand}
+	}
+	return &nftBackend{run: runCommand, file: nftRulesetFile, configs: nftConfigFiles}
+}
+
+// isInstalled reports whether a program is in the PATH
+func isInstalled(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
+
+// shellQuote quotes a string for use in a POSIX shell script
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,279 @@
+// Package firewall implements the inbound firewall feature
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"github.com/teomyth/iniq/internal/utils"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// Feature implements the inbound firewall feature
+type Feature struct {
+	osInfo *osdetect.Info
+}
+
+// New creates a new firewall feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+	}
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "firewall"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Allow SSH and the configured ports, deny all other inbound traffic"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "firewall",
+			Shorthand: "",
+			Usage:     "enable the firewall, allowing SSH and --firewall-allow rules and denying other inbound traffic",
+			Default:   false,
+			Required:  false,
+		},
+		{
+			Name:      "firewall-allow",
+			Shorthand: "",
+			Usage:     "allow inbound traffic: PORT[/PROTO][@CIDR] or CIDR (e.g. 443, 53/udp, 5432@10.0.0.0/8)",
+			Default:   []string{},
+			Required:  false,
+		},
+		{
+			Name:      "firewall-policy",
+			Shorthand: "",
+			Usage:     "default policy for other inbound traffic (deny or reject)",
+			Default:   "deny",
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	enabled, _ := options["firewall"].(bool)
+	return enabled
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	if _, err := allowedRules(options); err != nil {
+		return err
+	}
+	if policy := policyOption(options); !validPolicy(policy) {
+		return fmt.Errorf("invalid firewall-policy %q: must be deny or reject", policy)
+	}
+	backend, _ := options["firewall-backend"].(string)
+	if _, err := selectBackend(backend, func(string) bool { return true }); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	allowed, err := allowedRules(ctx.Options)
+	if err != nil {
+		return err
+	}
+	policy := policyOption(ctx.Options)
+	sshPorts := sshdconfig.ResolvePorts(osdetect.GetSSHConfigPath(f.osInfo))
+	rules := planRules(sshPorts, allowed)
+
+	backend, err := f.backend(ctx.Options)
+	if err != nil {
+		return err
+	}
+	// Reading the rules needs root, which a dry run may lack
+	status, err := backend.Status()
+	if err != nil && !ctx.DryRun {
+		return err
+	}
+
+	if err == nil && upToDate(status, policy, rules) {
+		ctx.Logger.Success("✓ Firewall already configured (%s)", backend.Name())
+		return nil
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		ctx.Logger.Info("Would configure %s with default inbound policy %s", backend.Name(), policy)
+		for _, rule := range rules {
+			ctx.Logger.Info("Would allow %s", rule)
+		}
+		if backend.Name() == "nftables" && ctx.Verbose {
+			ctx.Logger.MultiLine("info", "nftables rule set:", strings.Split(strings.TrimRight(renderNftRuleset(policy, rules), "\n"), "\n"))
+		}
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("configuring the firewall requires root privileges")
+	}
+
+	// Save the current state and restore it automatically unless the new rules are kept
+	dir, err := os.MkdirTemp("", "iniq-firewall-rollback")
+	if err != nil {
+		return fmt.Errorf("failed to create rollback directory: %w", err)
+	}
+	script, err := backend.Snapshot(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	guard, err := armRollback(dir, script, rollbackDelay)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	ctx.Logger.Info("The previous firewall state is restored in %d seconds unless the new rules are confirmed", int(rollbackDelay.Seconds()))
+
+	if err := backend.Apply(ctx, policy, rules); err != nil {
+		return rollback(ctx, guard, err)
+	}
+	if err := f.confirm(ctx, backend, sshPorts); err != nil {
+		return rollback(ctx, guard, err)
+	}
+	guard.Cancel()
+
+	if err := backend.Persist(ctx, policy, rules); err != nil {
+		return err
+	}
+
+	ctx.Logger.Success("Firewall configured with %s", backend.Name())
+	return nil
+}
+
+// confirm checks that the firewall is active and allows SSH, and when running interactively
+// asks the user to confirm that new SSH connections still work
+func (f *Feature) confirm(ctx *features.ExecutionContext, backend backend, sshPorts []int) error {
+	status, err := backend.Status()
+	if err != nil {
+		return err
+	}
+	if !status.Active {
+		return fmt.Errorf("%s is not active after applying the rules", backend.Name())
+	}
+	if !sshAllowed(sshPorts, status.Rules) {
+		return fmt.Errorf("%s does not allow SSH after applying the rules", backend.Name())
+	}
+
+	yes, _ := ctx.Options["yes"].(bool)
+	if yes || !utils.IsTerminal(os.Stdin) {
+		return nil
+	}
+	fmt.Println("Open a new SSH connection to this server to check that you can still log in.")
+	if !confirmWithin("Keep the new firewall rules?", confirmTimeout, os.Stdin) {
+		return fmt.Errorf("firewall rules were not confirmed")
+	}
+	return nil
+}
+
+// rollback restores the previous firewall state after a failed or unconfirmed apply
+func rollback(ctx *features.ExecutionContext, guard *rollbackGuard, cause error) error {
+	ctx.Logger.Warning("Restoring the previous firewall state...")
+	if err := guard.Rollback(); err != nil {
+		return fmt.Errorf("%w (%v)", cause, err)
+	}
+	return cause
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 50 // The firewall is enabled last, once the SSH port is final
+}
+
+// DetectCurrentState detects and returns the current state of the firewall feature
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+
+	sshPorts := sshdconfig.ResolvePorts(osdetect.GetSSHConfigPath(f.osInfo))
+	state["ssh_ports"] = sshPorts
+
+	backend, err := f.backend(ctx.Options)
+	if err != nil {
+		state["firewall_error"] = err.Error()
+		return state, nil
+	}
+	state["firewall_backend"] = backend.Name()
+
+	status, err := backend.Status()
+	if err != nil {
+		if os.Geteuid() != 0 {
+			state["firewall_error"] = "Requires root to read firewall rules"
+			return state, nil
+		}
+		return state, err
+	}
+	state["firewall_status"] = status
+	state["ssh_allowed"] = !status.Active || status.Policy == "allow" || sshAllowed(sshPorts, status.Rules)
+
+	return state, nil
+}
+
+// DisplayCurrentState displays the current state of the firewall feature
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	backendName, _ := state["firewall_backend"].(string)
+	status, _ := state["firewall_status"].(Status)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Firewall")
+	switch {
+	case backendName == "":
+		fmt.Printf("\033[1;31m✗ Not installed\033[0m\n")
+	case !status.Active:
+		fmt.Printf("\033[1;33m⚠ %s inactive\033[0m\n", backendName)
+	default:
+		fmt.Printf("\033[1;32m✓ %s active\033[0m \033[90m(default %s)\033[0m\n", backendName, status.Policy)
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// The firewall is only configured on request
+	return false
+}
+
+// backend returns the firewall backend selected by the firewall-backend option
+func (f *Feature) backend(options map[string]any) (backend, error) {
+	choice, _ := options["firewall-backend"].(string)
+	name, err := selectBackend(choice, isInstalled)
+	if err != nil {
+		return nil, err
+	}
+	return newBackend(name), nil
+}
+
+// upToDate reports whether the firewall already enforces the policy and exactly the rules
+func upToDate(status Status, policy string, rules []Rule) bool {
+	if !status.Active || status.Policy != policy || len(status.Other) > 0 || len(status.Rules) != len(rules) {
+		return false
+	}
+	for _, rule := range rules {
+		if !slices.Contains(status.Rules, rule) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,422 @@
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expected    Rule
+		expectError bool
+	}{
+		{spec: "443", expected: Rule{Port: 443, Protocol: "tcp"}},
+		{spec: "53/UDP", expected: Rule{Port: 53, Protocol: "udp"}},
+		{spec: "5432@10.1.2.3/8", expected: Rule{Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"}},
+		{spec: "8080/tcp@192.168.1.10", expected: Rule{Port: 8080, Protocol: "tcp", Source: "192.168.1.10/32"}},
+		{spec: "10.0.0.0/8", expected: Rule{Source: "10.0.0.0/8"}},
+		{spec: "fd00::/8", expected: Rule{Source: "fd00::/8"}},
+		{spec: "0", expectError: true},
+		{spec: "70000", expectError: true},
+		{spec: "80/sctp", expectError: true},
+		{spec: "80@example.com", expectError: true},
+		{spec: "10.0.0.300", expectError: true},
+		{spec: "http", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, err := parseRule(tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rule != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, rule)
+			}
+
+			// String must produce a spec that parses to the same rule
+			if again, err := parseRule(rule.String()); err != nil || again != rule {
+				t.Errorf("String() %q does not round-trip: %+v, %v", rule.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestPlanRules(t *testing.T) {
+	allowed, err := allowedRules(map[string]any{"firewall-allow": []any{"2222", "443", "", "443/tcp", "10.0.0.0/8"}})
+	if err != nil {
+		t.Fatalf("allowedRules() failed: %v", err)
+	}
+
+	rules := planRules([]int{2222, 22}, allowed)
+	expected := []Rule{
+		{Port: 2222, Protocol: "tcp"},
+		{Port: 22, Protocol: "tcp"},
+		{Port: 443, Protocol: "tcp"},
+		{Source: "10.0.0.0/8"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %v, got %v", expected, rules)
+	}
+
+	if !sshAllowed([]int{2222, 22}, rules) {
+		t.Error("Expected SSH to be allowed by the planned rules")
+	}
+	if sshAllowed([]int{22}, []Rule{{Port: 22, Protocol: "tcp", Source: "10.0.0.0/8"}, {Port: 22, Protocol: "udp"}}) {
+		t.Error("Expected SSH limited to a network not to count as allowed")
+	}
+}
+
+func TestRenderNftRuleset(t *testing.T) {
+	rules := []Rule{
+		{Port: 22, Protocol: "tcp"},
+		{Port: 53, Protocol: "udp"},
+		{Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"},
+		{Source: "fd00::/8"},
+	}
+
+	ruleset := renderNftRuleset("deny", rules)
+	for _, expected := range []string{
+		"table inet iniq\ndelete table inet iniq\ntable inet iniq {\n",
+		"type filter hook input priority 0; policy drop;",
+		"ct state established,related accept",
+		"\t\ttcp dport 22 accept\n",
+		"\t\tudp dport 53 accept\n",
+		"\t\tip saddr 10.0.0.0/8 tcp dport 5432 accept\n",
+		"\t\tip6 saddr fd00::/8 accept\n",
+	} {
+		if !strings.Contains(ruleset, expected) {
+			t.Errorf("Expected rule set to contain %q, got:\n%s", expected, ruleset)
+		}
+	}
+	if strings.Contains(ruleset, "reject") {
+		t.Errorf("Expected no reject rule for the deny policy, got:\n%s", ruleset)
+	}
+
+	// The SSH rule must come before anything that could drop it
+	if strings.Index(ruleset, "tcp dport 22 accept") > strings.Index(ruleset, "udp dport 53 accept") {
+		t.Error("Expected the SSH rule first")
+	}
+
+	// Reading the rendered rule set back gives the same policy and rules
+	for _, policy := range []string{"deny", "reject"} {
+		status := parseNftRuleset(renderNftRuleset(policy, rules))
+		if !status.Active || status.Policy != policy || len(status.Other) != 0 || !reflect.DeepEqual(status.Rules, rules) {
+			t.Errorf("Unexpected status for policy %s: %+v", policy, status)
+		}
+	}
+
+	// nft list output uses its own formatting for the same rules
+	listing := `table inet iniq {
+	chain input {
+		type filter hook input priority filter; policy drop;
+		ct state established,related accept
+		iif "lo" accept
+		ip6 saddr fe80::/10 udp dport 546 accept
+		tcp dport 22 accept
+		tcp dport { 80, 443 } accept
+	}
+}`
+	status := parseNftRuleset(listing)
+	if !reflect.DeepEqual(status.Rules, []Rule{{Port: 22, Protocol: "tcp"}}) || len(status.Other) != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status := parseNftRuleset(""); status.Active {
+		t.Error("Expected a missing table to be inactive")
+	}
+}
+
+func TestSelectBackend(t *testing.T) {
+	tests := []struct {
+		choice      string
+		installed   []string
+		expected    string
+		expectError bool
+	}{
+		{choice: "auto", installed: []string{"ufw", "nft"}, expected: "ufw"},
+		{choice: "", installed: []string{"firewall-cmd", "nft"}, expected: "firewalld"},
+		{choice: "auto", installed: []string{"nft"}, expected: "nftables"},
+		{choice: "nftables", installed: []string{"ufw", "nft"}, expected: "nftables"},
+		{choice: "auto", expectError: true},
+		{choice: "iptables", installed: []string{"iptables"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.choice, tt.installed), func(t *testing.T) {
+			installed := func(program string) bool {
+				for _, name := range tt.installed {
+					if name == program {
+						return true
+					}
+				}
+				return false
+			}
+			name, err := selectBackend(tt.choice, installed)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %s", name)
+				}
+				return
+			}
+			if err != nil || name != tt.expected {
+				t.Errorf("Expected %s, got %s (%v)", tt.expected, name, err)
+			}
+		})
+	}
+}
+
+const ufwVerbose = `Status: active
+Logging: on (low)
+Default: deny (incoming), allow (outgoing), disabled (routed)
+New profiles: skip
+`
+
+const ufwNumbered = `Status: active
+
+     To                         Action      From
+     --                         ------      ----
+[ 1] 22/tcp                     ALLOW IN    Anywhere
+[ 2] 5432/tcp                   ALLOW IN    10.0.0.0/8                 # database
+[ 3] OpenSSH                    LIMIT IN    Anywhere
+[ 4] 80                         ALLOW IN    Anywhere
+[ 5] 25/tcp                     DENY IN     Anywhere
+[ 6] 53                         ALLOW OUT   Anywhere                   (out)
+[ 7] 22/tcp (v6)                ALLOW IN    Anywhere (v6)
+`
+
+func TestParseUFWStatus(t *testing.T) {
+	entries := parseUFWEntries(ufwNumbered)
+	if len(entries) != 6 {
+		t.Fatalf("Expected 6 inbound entries, got %+v", entries)
+	}
+
+	status := parseUFWStatus(ufwVerbose, entries)
+	expected := Status{
+		Active: true,
+		Policy: "deny",
+		Rules: []Rule{
+			{Port: 22, Protocol: "tcp"},
+			{Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"},
+			{Port: 80, Protocol: "tcp"},
+			{Port: 80, Protocol: "udp"},
+		},
+		Other: []string{"OpenSSH                    LIMIT IN    Anywhere"},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, status)
+	}
+
+	// Everything but the wanted rules is deleted, highest number first
+	stale := staleUFWEntries(entries, []Rule{{Port: 22, Protocol: "tcp"}, {Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"}})
+	if !reflect.DeepEqual(stale, []int{5, 4, 3}) {
+		t.Errorf("Expected stale entries [5 4 3], got %v", stale)
+	}
+
+	if status := parseUFWStatus("Status: inactive\n", nil); status.Active {
+		t.Errorf("Expected inactive status, got %+v", status)
+	}
+}
+
+func TestUFWAllowArgs(t *testing.T) {
+	tests := []struct {
+		rule     Rule
+		expected string
+	}{
+		{Rule{Port: 22, Protocol: "tcp"}, "allow 22/tcp"},
+		{Rule{Source: "10.0.0.0/8"}, "allow from 10.0.0.0/8"},
+		{Rule{Port: 53, Protocol: "udp", Source: "fd00::/8"}, "allow proto udp from fd00::/8 to any port 53"},
+	}
+
+	for _, tt := range tests {
+		if args := strings.Join(ufwAllowArgs(tt.rule), " "); args != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, args)
+		}
+	}
+}
+
+func TestUFWSnapshot(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-firewall-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	rulesFile := filepath.Join(tempDir, "user.rules")
+	if err := os.WriteFile(rulesFile, []byte("*filter\n"), 0640); err != nil {
+		t.Fatalf("Failed to write rules: %v", err)
+	}
+	missingFile := filepath.Join(tempDir, "user6.rules")
+
+	backend := &ufwBackend{
+		run: func(name string, args ...string) ([]byte, error) {
+			return []byte("Status: inactive\n"), nil
+		},
+		files: []string{rulesFile, missingFile},
+	}
+	script, err := backend.Snapshot(tempDir)
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+
+	saved := filepath.Join(tempDir, "0-user.rules")
+	expected := fmt.Sprintf("cat '%s' > '%s'\nrm -f '%s'\nufw --force disable\n", saved, rulesFile, missingFile)
+	if script != expected {
+		t.Errorf("Expected script:\n%s\nGot:\n%s", expected, script)
+	}
+	if content, err := os.ReadFile(saved); err != nil || string(content) != "*filter\n" {
+		t.Errorf("Expected saved rules, got %q (%v)", content, err)
+	}
+}
+
+const firewalldListAll = `public (active)
+  target: default
+  icmp-block-inversion: no
+  interfaces: eth0
+  sources:
+  services: cockpit dhcpv6-client ssh
+  ports: 8080/tcp 6000-6010/udp
+  protocols:
+  forward: yes
+  masquerade: no
+  forward-ports:
+  source-ports:
+  icmp-blocks:
+  rich rules:
+	rule family="ipv4" source address="10.0.0.0/8" port port="5432" protocol="tcp" accept
+	rule family="ipv6" source address="fd00::/8" accept
+	rule family="ipv4" source address="192.0.2.1" drop
+`
+
+func TestParseFirewalldZone(t *testing.T) {
+	zone := parseFirewalldZone(firewalldListAll)
+	if zone.Target != "default" || len(zone.Services) != 3 || len(zone.Ports) != 2 || len(zone.RichRules) != 3 {
+		t.Fatalf("Unexpected zone %+v", zone)
+	}
+
+	status := zone.status()
+	expected := Status{
+		Active: true,
+		Policy: "reject",
+		Rules: []Rule{
+			{Port: 22, Protocol: "tcp"},
+			{Port: 8080, Protocol: "tcp"},
+			{Port: 5432, Protocol: "tcp", Source: "10.0.0.0/8"},
+			{Source: "fd00::/8"},
+		},
+		Other: []string{"service cockpit", "port 6000-6010/udp", `rule family="ipv4" source address="192.0.2.1" drop`},
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, status)
+	}
+
+	// Rich rules written by INIQ parse back to the same rule
+	for _, rule := range status.Rules[2:] {
+		if parsed, ok := parseFirewalldRichRule(firewalldRichRuleFor(rule)); !ok || parsed != rule {
+			t.Errorf("Rich rule for %v does not round-trip: %+v", rule, parsed)
+		}
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	rules := []Rule{{Port: 22, Protocol: "tcp"}, {Port: 443, Protocol: "tcp"}}
+	tests := []struct {
+		name     string
+		status   Status
+		expected bool
+	}{
+		{name: "Matching", status: Status{Active: true, Policy: "deny", Rules: []Rule{rules[1], rules[0]}}, expected: true},
+		{name: "Inactive", status: Status{Policy: "deny", Rules: rules}},
+		{name: "Other policy", status: Status{Active: true, Policy: "reject", Rules: rules}},
+		{name: "Extra rule", status: Status{Active: true, Policy: "deny", Rules: append([]Rule{{Port: 80, Protocol: "tcp"}}, rules...)}},
+		{name: "Missing rule", status: Status{Active: true, Policy: "deny", Rules: rules[:1]}},
+		{name: "Unmanaged entry", status: Status{Active: true, Policy: "deny", Rules: rules, Other: []string{"service cockpit"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := upToDate(tt.status, "deny", rules); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRollbackGuard(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-firewall-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	marker := filepath.Join(tempDir, "restored")
+	script := "touch " + shellQuote(marker) + "\n"
+
+	// A cancelled rollback never runs
+	dir, err := os.MkdirTemp(tempDir, "rollback")
+	if err != nil {
+		t.Fatalf("Failed to create rollback dir: %v", err)
+	}
+	guard, err := armRollback(dir, script, time.Second)
+	if err != nil {
+		t.Fatalf("armRollback() failed: %v", err)
+	}
+	guard.Cancel()
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("Expected a cancelled rollback not to run")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected Cancel to remove the rollback directory")
+	}
+
+	// An immediate rollback runs the script and cleans up
+	dir, err = os.MkdirTemp(tempDir, "rollback")
+	if err != nil {
+		t.Fatalf("Failed to create rollback dir: %v", err)
+	}
+	guard, err = armRollback(dir, script, time.Hour)
+	if err != nil {
+		t.Fatalf("armRollback() failed: %v", err)
+	}
+	if err := guard.Rollback(); err != nil {
+		t.Fatalf("Rollback() failed: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("Expected the rollback script to run")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected the rollback script to remove its directory")
+	}
+}
+
+func TestConfirmWithin(t *testing.T) {
+	if !confirmWithin("Keep?", time.Second, strings.NewReader("yes\n")) {
+		t.Error("Expected yes to confirm")
+	}
+	if confirmWithin("Keep?", time.Second, strings.NewReader("\n")) {
+		t.Error("Expected an empty answer not to confirm")
+	}
+
+	// No answer times out
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	if confirmWithin("Keep?", 100*time.Millisecond, reader) {
+		t.Error("Expected a timeout not to confirm")
+	}
+}
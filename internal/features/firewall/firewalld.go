@@ -0,0 +1,287 @@
+package firewall
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+// firewalldKeptServices are services left in the zone because removing them breaks networking
+var firewalldKeptServices = map[string]bool{"dhcpv6-client": true}
+
+// firewalldRichRule matches the rich rules written by firewalldRichRuleFor
+var firewalldRichRule = regexp.MustCompile(`^rule family="(ipv4|ipv6)" source address="([^"]+)"(?: port port="(\d+)" protocol="(tcp|udp)")? accept$`)
+
+// firewalldZone is the configuration of a firewalld zone
+type firewalldZone struct {
+	Target    string
+	Services  []string
+	Ports     []string
+	RichRules []string
+}
+
+// parseFirewalldZone parses firewall-cmd --list-all output
+func parseFirewalldZone(output string) firewalldZone {
+	var zone firewalldZone
+	inRichRules := false
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inRichRules && strings.HasPrefix(trimmed, "rule ") {
+			zone.RichRules = append(zone.RichRules, trimmed)
+			continue
+		}
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			continue
+		}
+		inRichRules = key == "rich rules"
+		switch key {
+		case "target":
+			zone.Target = strings.TrimSpace(value)
+		case "services":
+			zone.Services = strings.Fields(value)
+		case "ports":
+			zone.Ports = strings.Fields(value)
+		}
+	}
+	return zone
+}
+
+// status converts the zone configuration to a firewall status
+func (z firewalldZone) status() Status {
+	status := Status{Active: true, Policy: "reject"}
+	switch z.Target {
+	case "DROP":
+		status.Policy = "deny"
+	case "ACCEPT":
+		status.Policy = "allow"
+	}
+
+	for _, name := range z.Services {
+		switch {
+		case name == "ssh":
+			status.Rules = append(status.Rules, Rule{Port: sshdconfig.DefaultPort, Protocol: "tcp"})
+		case !firewalldKeptServices[name]:
+			status.Other = append(status.Other, "service "+name)
+		}
+	}
+	for _, port := range z.Ports {
+		if rule, ok := parseFirewalldPort(port); ok {
+			status.Rules = append(status.Rules, rule)
+		} else {
+			status.Other = append(status.Other, "port "+port)
+		}
+	}
+	for _, richRule := range z.RichRules {
+		if rule, ok := parseFirewalldRichRule(richRule); ok {
+			status.Rules = append(status.Rules, rule)
+		} else {
+			status.Other = append(status.Other, richRule)
+		}
+	}
+	return status
+}
+
+// parseFirewalldPort parses a single port such as 443/tcp
+func parseFirewalldPort(port string) (Rule, bool) {
+	number, protocol, found := strings.Cut(port, "/")
+	value, err := strconv.Atoi(number)
+	if !found || err != nil || (protocol != "tcp" && protocol != "udp") {
+		return Rule{}, false
+	}
+	return Rule{Port: value, Protocol: protocol}, true
+}
+
+// parseFirewalldRichRule parses a rich rule written by firewalldRichRuleFor
+func parseFirewalldRichRule(richRule string) (Rule, bool) {
+	match := firewalldRichRule.FindStringSubmatch(richRule)
+	if match == nil {
+		return Rule{}, false
+	}
+	source, err := parseSource(match[2])
+	if err != nil {
+		return Rule{}, false
+	}
+	rule := Rule{Source: source}
+	if match[3] != "" {
+		rule.Port, _ = strconv.Atoi(match[3])
+		rule.Protocol = match[4]
+	}
+	return rule, true
+}
+
+// firewalldRichRuleFor renders a rule with a source network as a rich rule
+func firewalldRichRuleFor(rule Rule) string {
+	family := "ipv4"
+	if rule.ipv6() {
+		family = "ipv6"
+	}
+	richRule := fmt.Sprintf("rule family=%q source address=%q", family, rule.Source)
+	if rule.Port != 0 {
+		richRule += fmt.Sprintf(" port port=\"%d\" protocol=%q", rule.Port, rule.Protocol)
+	}
+	return richRule + " accept"
+}
+
+// firewalldTarget returns the zone target implementing a default policy
+func firewalldTarget(policy string) string {
+	if policy == "deny" {
+		return "DROP"
+	}
+	return "default"
+}
+
+// firewalldBackend manages the default zone of firewalld
+type firewalldBackend struct {
+	run runner
+}
+
+// Name returns the name of the firewall tool
+func (f *firewalldBackend) Name() string {
+	return "firewalld"
+}
+
+// running reports whether firewalld is running
+func (f *firewalldBackend) running() bool {
+	output, err := f.run("firewall-cmd", "--state")
+	return err == nil && strings.TrimSpace(string(output)) == "running"
+}
+
+// zone returns the name and configuration of the default zone
+func (f *firewalldBackend) zone() (string, firewalldZone, error) {
+	output, err := f.run("firewall-cmd", "--get-default-zone")
+	if err != nil {
+		return "", firewalldZone{}, fmt.Errorf("failed to get firewalld default zone: %w", err)
+	}
+	name := strings.TrimSpace(string(output))
+	output, err = f.run("firewall-cmd", "--zone="+name, "--list-all")
+	if err != nil {
+		return "", firewalldZone{}, fmt.Errorf("failed to list firewalld zone %s: %w", name, err)
+	}
+	return name, parseFirewalldZone(string(output)), nil
+}
+
+// Status reports the rules of the default zone, which is inactive while firewalld is stopped
+func (f *firewalldBackend) Status() (Status, error) {
+	if !f.running() {
+		return Status{}, nil
+	}
+	_, zone, err := f.zone()
+	if err != nil {
+		return Status{}, err
+	}
+	return zone.status(), nil
+}
+
+// Snapshot needs no files because rules are applied to the runtime configuration only;
+// reloading restores the permanent configuration, and firewalld is stopped again if it was
+func (f *firewalldBackend) Snapshot(dir string) (string, error) {
+	if !f.running() {
+		return "systemctl stop firewalld || rc-service firewalld stop\n", nil
+	}
+	return "firewall-cmd --reload\n", nil
+}
+
+// Apply changes the runtime configuration of the default zone; the zone target can only be
+// changed in the permanent configuration and is set by Persist
+func (f *firewalldBackend) Apply(ctx *features.ExecutionContext, policy string, rules []Rule) error {
+	if !f.running() {
+		ctx.Logger.Step("Starting firewalld...")
+		manager, err := service.Detect()
+		if err != nil {
+			return err
+		}
+		if err := manager.Restart("firewalld"); err != nil {
+			return err
+		}
+	}
+
+	name, zone, err := f.zone()
+	if err != nil {
+		return err
+	}
+	zoneArg := "--zone=" + name
+
+	// Add rules first so SSH stays reachable while other rules are removed. Services are
+	// removed below, so a port covered by the ssh service is added as a port as well.
+	present := make(map[Rule]bool)
+	for _, port := range zone.Ports {
+		if rule, ok := parseFirewalldPort(port); ok {
+			present[rule] = true
+		}
+	}
+	for _, richRule := range zone.RichRules {
+		if rule, ok := parseFirewalldRichRule(richRule); ok {
+			present[rule] = true
+		}
+	}
+	wanted := make(map[Rule]bool)
+	for _, rule := range rules {
+		wanted[rule] = true
+		if present[rule] {
+			continue
+		}
+		ctx.Logger.Step("Allowing %s...", rule)
+		arg := fmt.Sprintf("--add-port=%d/%s", rule.Port, rule.Protocol)
+		if rule.Source != "" {
+			arg = "--add-rich-rule=" + firewalldRichRuleFor(rule)
+		}
+		if err := run(f.run, "firewall-cmd", zoneArg, arg); err != nil {
+			return err
+		}
+	}
+
+	for _, serviceName := range zone.Services {
+		if !firewalldKeptServices[serviceName] {
+			if err := run(f.run, "firewall-cmd", zoneArg, "--remove-service="+serviceName); err != nil {
+				return err
+			}
+		}
+	}
+	for _, port := range zone.Ports {
+		if rule, ok := parseFirewalldPort(port); !ok || !wanted[rule] {
+			if err := run(f.run, "firewall-cmd", zoneArg, "--remove-port="+port); err != nil {
+				return err
+			}
+		}
+	}
+	for _, richRule := range zone.RichRules {
+		if rule, ok := parseFirewalldRichRule(richRule); ok && !wanted[rule] {
+			if err := run(f.run, "firewall-cmd", zoneArg, "--remove-rich-rule="+richRule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Persist saves the runtime configuration, sets the zone target and enables firewalld
+func (f *firewalldBackend) Persist(ctx *features.ExecutionContext, policy string, rules []Rule) error {
+	name, _, err := f.zone()
+	if err != nil {
+		return err
+	}
+	if err := run(f.run, "firewall-cmd", "--runtime-to-permanent"); err != nil {
+		return err
+	}
+	if err := run(f.run, "firewall-cmd", "--permanent", "--zone="+name, "--set-target="+firewalldTarget(policy)); err != nil {
+		return err
+	}
+	if err := run(f.run, "firewall-cmd", "--reload"); err != nil {
+		return err
+	}
+
+	manager, err := service.Detect()
+	if err == nil {
+		err = manager.Enable("firewalld")
+	}
+	if err != nil {
+		ctx.Logger.Warning("Failed to enable the firewalld service: %v", err)
+	}
+	return nil
+}
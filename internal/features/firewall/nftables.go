@@ -0,0 +1,225 @@
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+// nftTable is the nftables table holding the rules managed by INIQ
+const nftTable = "inet iniq"
+
+// nftRulesetFile is where the rule set is saved so it is loaded at boot
+const nftRulesetFile = "/etc/nftables.d/iniq.nft"
+
+// nftConfigFiles are the rule sets loaded by the nftables service on Debian and Red Hat systems
+var nftConfigFiles = []string{"/etc/nftables.conf", "/etc/sysconfig/nftables.conf"}
+
+// nftDHCPv6Rule accepts DHCPv6 replies so hosts keep their IPv6 leases
+const nftDHCPv6Rule = "ip6 saddr fe80::/10 udp dport 546 accept"
+
+// renderNftRuleset renders an nftables script that atomically replaces the INIQ table.
+// Established connections stay open, so applying it never drops the current SSH session.
+func renderNftRuleset(policy string, rules []Rule) string {
+	var b strings.Builder
+	b.WriteString("# Managed by INIQ, changes will be overwritten\n")
+
+	// Declaring the table first lets the delete succeed when it does not exist yet
+	fmt.Fprintf(&b, "table %s\n", nftTable)
+	fmt.Fprintf(&b, "delete table %s\n", nftTable)
+	fmt.Fprintf(&b, "table %s {\n", nftTable)
+	b.WriteString("\tchain input {\n")
+	b.WriteString("\t\ttype filter hook input priority 0; policy drop;\n")
+	b.WriteString("\t\tct state established,related accept\n")
+	b.WriteString("\t\tct state invalid drop\n")
+	b.WriteString("\t\tiif \"lo\" accept\n")
+	b.WriteString("\t\tmeta l4proto { icmp, ipv6-icmp } accept\n")
+	fmt.Fprintf(&b, "\t\t%s\n", nftDHCPv6Rule)
+	for _, rule := range rules {
+		fmt.Fprintf(&b, "\t\t%s\n", nftRule(rule))
+	}
+	if policy == "reject" {
+		b.WriteString("\t\treject with icmpx type admin-prohibited\n")
+	}
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// nftRule renders a rule as an nftables statement
+func nftRule(rule Rule) string {
+	var parts []string
+	if rule.Source != "" {
+		family := "ip"
+		if rule.ipv6() {
+			family = "ip6"
+		}
+		parts = append(parts, family, "saddr", rule.Source)
+	}
+	if rule.Port != 0 {
+		parts = append(parts, rule.Protocol, "dport", strconv.Itoa(rule.Port))
+	}
+	return strings.Join(append(parts, "accept"), " ")
+}
+
+// parseNftRuleset reads the policy and rules back from a listing of the INIQ table
+func parseNftRuleset(listing string) Status {
+	status := Status{Active: strings.Contains(listing, "hook input"), Policy: "allow"}
+	for _, line := range strings.Split(listing, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.Contains(line, "policy drop"):
+			status.Policy = "deny"
+		case strings.HasPrefix(line, "reject"):
+			status.Policy = "reject"
+		case line == nftDHCPv6Rule:
+			continue
+		case strings.HasSuffix(line, " accept") && (strings.Contains(line, "dport") || strings.Contains(line, "saddr")):
+			rule, ok := parseNftRule(line)
+			if !ok {
+				status.Other = append(status.Other, line)
+				continue
+			}
+			status.Rules = append(status.Rules, rule)
+		}
+	}
+	return status
+}
+
+// parseNftRule parses a statement rendered by nftRule
+func parseNftRule(line string) (Rule, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[len(fields)-1] != "accept" {
+		return Rule{}, false
+	}
+
+	var rule Rule
+	fields = fields[:len(fields)-1]
+	for len(fields) >= 3 {
+		switch {
+		case fields[1] == "saddr" && (fields[0] == "ip" || fields[0] == "ip6"):
+			source, err := parseSource(fields[2])
+			if err != nil {
+				return Rule{}, false
+			}
+			rule.Source = source
+		case fields[1] == "dport" && (fields[0] == "tcp" || fields[0] == "udp"):
+			port, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return Rule{}, false
+			}
+			rule.Port, rule.Protocol = port, fields[0]
+		default:
+			return Rule{}, false
+		}
+		fields = fields[3:]
+	}
+	if len(fields) != 0 {
+		return Rule{}, false
+	}
+	return rule, true
+}
+
+// nftBackend manages a dedicated nftables table
+type nftBackend struct {
+	run     runner
+	file    string
+	configs []string
+}
+
+// Name returns the name of the firewall tool
+func (n *nftBackend) Name() string {
+	return "nftables"
+}
+
+// Status reports the rules in the INIQ table, which is inactive when the table does not exist
+func (n *nftBackend) Status() (Status, error) {
+	output, err := n.run("nft", "list", "table", "inet", "iniq")
+	if err != nil {
+		return Status{}, nil
+	}
+	return parseNftRuleset(string(output)), nil
+}
+
+// Snapshot saves the complete running rule set
+func (n *nftBackend) Snapshot(dir string) (string, error) {
+	output, err := n.run("nft", "list", "ruleset")
+	if err != nil {
+		return "", fmt.Errorf("failed to list nftables rule set: %w", err)
+	}
+	path := filepath.Join(dir, "ruleset.nft")
+	if err := os.WriteFile(path, append([]byte("flush ruleset\n"), output...), 0600); err != nil {
+		return "", fmt.Errorf("failed to save nftables rule set: %w", err)
+	}
+	return "nft -f " + shellQuote(path) + "\n", nil
+}
+
+// Apply checks and loads the rendered rule set in one transaction
+func (n *nftBackend) Apply(ctx *features.ExecutionContext, policy string, rules []Rule) error {
+	file, err := os.CreateTemp("", "iniq-*.nft")
+	if err != nil {
+		return fmt.Errorf("failed to create nftables script: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(renderNftRuleset(policy, rules)); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write nftables script: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write nftables script: %w", err)
+	}
+
+	if err := run(n.run, "nft", "-c", "-f", file.Name()); err != nil {
+		return fmt.Errorf("nftables rejected the rule set: %w", err)
+	}
+	ctx.Logger.Step("Loading nftables rule set...")
+	return run(n.run, "nft", "-f", file.Name())
+}
+
+// Persist saves the rule set, includes it from the nftables service configuration and
+// enables the service
+func (n *nftBackend) Persist(ctx *features.ExecutionContext, policy string, rules []Rule) error {
+	if err := os.MkdirAll(filepath.Dir(n.file), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(n.file), err)
+	}
+	if err := safefile.WriteFile(n.file, []byte(renderNftRuleset(policy, rules)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", n.file, err)
+	}
+
+	include := fmt.Sprintf("include %q", n.file)
+	included := false
+	for _, config := range n.configs {
+		content, err := os.ReadFile(config)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(string(content), include) {
+			updated := strings.TrimRight(string(content), "\n") + "\n\n" + include + "\n"
+			if err := safefile.WriteFile(config, []byte(updated), 0644); err != nil {
+				return fmt.Errorf("failed to update %s: %w", config, err)
+			}
+			ctx.Logger.Info("Added %s to %s", n.file, config)
+		}
+		included = true
+		break
+	}
+	if !included {
+		ctx.Logger.Warning("No nftables service configuration found; load %s at boot to keep the rules", n.file)
+		return nil
+	}
+
+	manager, err := service.Detect()
+	if err == nil {
+		err = manager.Enable("nftables")
+	}
+	if err != nil {
+		ctx.Logger.Warning("Failed to enable the nftables service: %v", err)
+	}
+	return nil
+}
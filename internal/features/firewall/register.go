@@ -0,0 +1,13 @@
+package firewall
+
+import (
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// init registers the firewall feature
+func init() {
+	features.RegisterFirewallFeature = func(registry *features.Registry, osInfo *osdetect.Info) {
+		registry.Register(New(osInfo))
+	}
+}
@@ -0,0 +1,83 @@
+package firewall
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// confirmTimeout is how long the user has to confirm that SSH still works
+const confirmTimeout = 60 * time.Second
+
+// rollbackDelay is when the previous firewall state is restored unless the new rules are kept.
+// It outlasts the confirmation prompt so the rollback also fires if INIQ itself is cut off.
+const rollbackDelay = confirmTimeout + 60*time.Second
+
+// rollbackGuard restores the previous firewall state after a delay unless it is cancelled
+type rollbackGuard struct {
+	dir    string
+	script string
+	cmd    *exec.Cmd
+}
+
+// armRollback starts a detached shell that runs script after delay. It runs in its own
+// session, so it survives the SSH connection dropping and INIQ being killed with it.
+func armRollback(dir, script string, delay time.Duration) (*rollbackGuard, error) {
+	path := filepath.Join(dir, "rollback.sh")
+	content := "#!/bin/sh\n# Restores the firewall state saved by INIQ\n" + script + "rm -rf " + shellQuote(dir) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0700); err != nil {
+		return nil, fmt.Errorf("failed to write rollback script: %w", err)
+	}
+
+	seconds := int(delay.Round(time.Second) / time.Second)
+	cmd := exec.Command("sh", "-c", fmt.Sprintf("sleep %d && sh %s", seconds, shellQuote(path)))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to schedule firewall rollback: %w", err)
+	}
+	return &rollbackGuard{dir: dir, script: path, cmd: cmd}, nil
+}
+
+// Cancel stops the pending rollback and removes the saved state
+func (g *rollbackGuard) Cancel() {
+	// The shell and its sleep share a process group led by the shell
+	_ = syscall.Kill(-g.cmd.Process.Pid, syscall.SIGKILL)
+	_ = g.cmd.Wait()
+	os.RemoveAll(g.dir)
+}
+
+// Rollback restores the previous firewall state now
+func (g *rollbackGuard) Rollback() error {
+	_ = syscall.Kill(-g.cmd.Process.Pid, syscall.SIGKILL)
+	_ = g.cmd.Wait()
+	if output, err := exec.Command("sh", g.script).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore firewall state: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+// confirmWithin asks a yes/no question and returns false if it is not answered yes in time
+func confirmWithin(question string, timeout time.Duration, input io.Reader) bool {
+	fmt.Printf("%s [y/N] (%ds): ", question, int(timeout/time.Second))
+
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(input).ReadString('\n')
+		answer <- line
+	}()
+
+	select {
+	case line := <-answer:
+		line = strings.ToLower(strings.TrimSpace(line))
+		return line == "y" || line == "yes"
+	case <-time.After(timeout):
+		fmt.Println()
+		return false
+	}
+}
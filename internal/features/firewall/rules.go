@@ -0,0 +1,174 @@
+package firewall
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Rule allows inbound traffic
+type Rule struct {
+	// Port is the destination port, 0 for all ports
+	Port int
+
+	// Protocol is tcp or udp, empty when Port is 0
+	Protocol string
+
+	// Source is the allowed source network in CIDR notation, empty for any source
+	Source string
+}
+
+// String returns the rule in the form accepted by the firewall-allow option
+func (r Rule) String() string {
+	spec := "all"
+	if r.Port != 0 {
+		spec = fmt.Sprintf("%d/%s", r.Port, r.Protocol)
+	}
+	if r.Source != "" {
+		if r.Port == 0 {
+			return r.Source
+		}
+		spec += "@" + r.Source
+	}
+	return spec
+}
+
+// ipv6 reports whether the rule's source is an IPv6 network
+func (r Rule) ipv6() bool {
+	return strings.Contains(r.Source, ":")
+}
+
+// parseRule parses a firewall-allow entry: PORT[/PROTO][@CIDR] or a bare CIDR that allows
+// all traffic from a network. The protocol defaults to tcp.
+func parseRule(spec string) (Rule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Rule{}, fmt.Errorf("empty firewall rule")
+	}
+
+	// A bare network allows everything from it
+	if !strings.Contains(spec, "@") && strings.ContainsAny(spec, ".:") {
+		source, err := parseSource(spec)
+		if err != nil {
+			return Rule{}, err
+		}
+		return Rule{Source: source}, nil
+	}
+
+	var rule Rule
+	portSpec, source, hasSource := strings.Cut(spec, "@")
+	if hasSource {
+		var err error
+		if rule.Source, err = parseSource(source); err != nil {
+			return Rule{}, err
+		}
+	}
+
+	port, protocol, hasProtocol := strings.Cut(portSpec, "/")
+	rule.Protocol = "tcp"
+	if hasProtocol {
+		rule.Protocol = strings.ToLower(protocol)
+		if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			return Rule{}, fmt.Errorf("invalid protocol %q in firewall rule %q: must be tcp or udp", protocol, spec)
+		}
+	}
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return Rule{}, fmt.Errorf("invalid port %q in firewall rule %q", port, spec)
+	}
+	rule.Port = number
+	return rule, nil
+}
+
+// parseSource normalizes an address or network to CIDR notation
+func parseSource(source string) (string, error) {
+	if prefix, err := netip.ParsePrefix(source); err == nil {
+		return prefix.Masked().String(), nil
+	}
+	if addr, err := netip.ParseAddr(source); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+	}
+	return "", fmt.Errorf("invalid source network %q", source)
+}
+
+// allowedRules returns the rules from the firewall-allow option
+func allowedRules(options map[string]any) ([]Rule, error) {
+	var specs []string
+	switch v := options["firewall-allow"].(type) {
+	case []string:
+		specs = v
+	case []any:
+		for _, item := range v {
+			specs = append(specs, fmt.Sprint(item))
+		}
+	case string:
+		specs = strings.Split(v, ",")
+	}
+
+	var rules []Rule
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		rule, err := parseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// planRules returns the rule set to apply: the SSH ports first, open to any source so the
+// firewall can never lock out SSH, followed by the requested rules without duplicates
+func planRules(sshPorts []int, allowed []Rule) []Rule {
+	var rules []Rule
+	seen := make(map[Rule]bool)
+	add := func(rule Rule) {
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, port := range sshPorts {
+		add(Rule{Port: port, Protocol: "tcp"})
+	}
+	for _, rule := range allowed {
+		add(rule)
+	}
+	return rules
+}
+
+// sshAllowed reports whether every SSH port is open to any source
+func sshAllowed(sshPorts []int, rules []Rule) bool {
+	for _, port := range sshPorts {
+		allowed := false
+		for _, rule := range rules {
+			if rule.Source == "" && (rule.Port == 0 || (rule.Port == port && rule.Protocol == "tcp")) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// validPolicy reports whether policy is a supported default inbound policy
+func validPolicy(policy string) bool {
+	return policy == "deny" || policy == "reject"
+}
+
+// policyOption returns the default inbound policy from the firewall-policy option
+func policyOption(options map[string]any) string {
+	policy, _ := options["firewall-policy"].(string)
+	if policy = strings.ToLower(strings.TrimSpace(policy)); policy == "" {
+		return "deny"
+	}
+	return policy
+}
@@ -0,0 +1,261 @@
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+)
+
+// ufwFiles hold ufw's user rules and default policies
+var ufwFiles = []string{"/etc/ufw/user.rules", "/etc/ufw/user6.rules", "/etc/default/ufw"}
+
+// ufwEntry is a rule listed by ufw status numbered
+type ufwEntry struct {
+	// Number is the rule number used to delete it
+	Number int
+
+	// Text is the rule as listed by ufw
+	Text string
+
+	// Action is ALLOW, DENY, REJECT or LIMIT
+	Action string
+
+	// Rules are the rules the entry allows, nil if it cannot be expressed as rules
+	Rules []Rule
+}
+
+// ufwNumberedLine matches a rule in ufw status numbered output
+var ufwNumberedLine = regexp.MustCompile(`^\[\s*(\d+)\]\s+(.+?)\s{2,}(ALLOW|DENY|REJECT|LIMIT)(?: (IN|OUT|FWD))?\s+(.+)$`)
+
+// ufwDefaultLine matches the default incoming policy in ufw status verbose output
+var ufwDefaultLine = regexp.MustCompile(`^Default: (\w+) \(incoming\)`)
+
+// parseUFWEntries parses the inbound rules in ufw status numbered output
+func parseUFWEntries(output string) []ufwEntry {
+	var entries []ufwEntry
+	for _, line := range strings.Split(output, "\n") {
+		match := ufwNumberedLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		// Outgoing and routed rules are left alone
+		if match[4] == "OUT" || match[4] == "FWD" {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		from, _, _ := strings.Cut(match[5], "#")
+		entries = append(entries, ufwEntry{
+			Number: number,
+			Text:   strings.TrimSpace(line[strings.Index(line, "]")+1:]),
+			Action: match[3],
+			Rules:  parseUFWRule(match[2], from),
+		})
+	}
+	return entries
+}
+
+// parseUFWRule converts the To and From columns of a ufw rule to rules
+func parseUFWRule(to, from string) []Rule {
+	to = strings.TrimSpace(strings.TrimSuffix(to, "(v6)"))
+	from = strings.TrimSpace(strings.TrimSuffix(from, "(v6)"))
+
+	source := ""
+	if from != "Anywhere" {
+		var err error
+		if source, err = parseSource(from); err != nil {
+			return nil
+		}
+	}
+	if to == "Anywhere" {
+		return []Rule{{Source: source}}
+	}
+
+	// A port without a protocol allows both tcp and udp
+	port, protocol, hasProtocol := strings.Cut(to, "/")
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return nil
+	}
+	protocols := []string{"tcp", "udp"}
+	if hasProtocol {
+		if protocol != "tcp" && protocol != "udp" {
+			return nil
+		}
+		protocols = []string{protocol}
+	}
+
+	var rules []Rule
+	for _, protocol := range protocols {
+		rules = append(rules, Rule{Port: number, Protocol: protocol, Source: source})
+	}
+	return rules
+}
+
+// parseUFWStatus parses ufw status verbose output and the entries from ufw status numbered
+func parseUFWStatus(verbose string, entries []ufwEntry) Status {
+	var status Status
+	for _, line := range strings.Split(verbose, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "Status: active" {
+			status.Active = true
+		}
+		if match := ufwDefaultLine.FindStringSubmatch(line); match != nil {
+			status.Policy = match[1]
+		}
+	}
+
+	seen := make(map[Rule]bool)
+	for _, entry := range entries {
+		if entry.Action != "ALLOW" && entry.Action != "LIMIT" {
+			continue
+		}
+		if entry.Rules == nil {
+			status.Other = append(status.Other, entry.Text)
+			continue
+		}
+		for _, rule := range entry.Rules {
+			if !seen[rule] {
+				seen[rule] = true
+				status.Rules = append(status.Rules, rule)
+			}
+		}
+	}
+	return status
+}
+
+// ufwAllowArgs returns the ufw arguments that add a rule
+func ufwAllowArgs(rule Rule) []string {
+	switch {
+	case rule.Source == "":
+		return []string{"allow", fmt.Sprintf("%d/%s", rule.Port, rule.Protocol)}
+	case rule.Port == 0:
+		return []string{"allow", "from", rule.Source}
+	}
+	return []string{"allow", "proto", rule.Protocol, "from", rule.Source, "to", "any", "port", strconv.Itoa(rule.Port)}
+}
+
+// staleUFWEntries returns the numbers of inbound entries that are not part of the rule set,
+// highest first so deleting them does not renumber the remaining ones
+func staleUFWEntries(entries []ufwEntry, rules []Rule) []int {
+	wanted := make(map[Rule]bool)
+	for _, rule := range rules {
+		wanted[rule] = true
+	}
+
+	var stale []int
+	for _, entry := range entries {
+		if entry.Action == "ALLOW" && len(entry.Rules) == 1 && wanted[entry.Rules[0]] {
+			continue
+		}
+		stale = append(stale, entry.Number)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(stale)))
+	return stale
+}
+
+// ufwBackend manages rules through ufw
+type ufwBackend struct {
+	run   runner
+	files []string
+}
+
+// Name returns the name of the firewall tool
+func (u *ufwBackend) Name() string {
+	return "ufw"
+}
+
+// entries lists ufw's numbered rules
+func (u *ufwBackend) entries() ([]ufwEntry, error) {
+	output, err := u.run("ufw", "status", "numbered")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ufw rules: %w", err)
+	}
+	return parseUFWEntries(string(output)), nil
+}
+
+// Status reports ufw's state, default policy and rules
+func (u *ufwBackend) Status() (Status, error) {
+	output, err := u.run("ufw", "status", "verbose")
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to get ufw status: %w", err)
+	}
+	entries, err := u.entries()
+	if err != nil {
+		return Status{}, err
+	}
+	return parseUFWStatus(string(output), entries), nil
+}
+
+// Snapshot copies ufw's rule files; the restore script reloads ufw, or disables it again
+// if it was inactive
+func (u *ufwBackend) Snapshot(dir string) (string, error) {
+	status, err := u.Status()
+	if err != nil {
+		return "", err
+	}
+
+	var script strings.Builder
+	for i, file := range u.files {
+		content, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(&script, "rm -f %s\n", shellQuote(file))
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		saved := filepath.Join(dir, fmt.Sprintf("%d-%s", i, filepath.Base(file)))
+		if err := os.WriteFile(saved, content, 0600); err != nil {
+			return "", fmt.Errorf("failed to save %s: %w", file, err)
+		}
+		fmt.Fprintf(&script, "cat %s > %s\n", shellQuote(saved), shellQuote(file))
+	}
+	if status.Active {
+		script.WriteString("ufw reload\n")
+	} else {
+		script.WriteString("ufw --force disable\n")
+	}
+	return script.String(), nil
+}
+
+// Apply adds the rules, sets the default policy, enables ufw and then deletes other inbound rules
+func (u *ufwBackend) Apply(ctx *features.ExecutionContext, policy string, rules []Rule) error {
+	for _, rule := range rules {
+		ctx.Logger.Step("Allowing %s...", rule)
+		if err := run(u.run, "ufw", ufwAllowArgs(rule)...); err != nil {
+			return err
+		}
+	}
+
+	if err := run(u.run, "ufw", "default", policy, "incoming"); err != nil {
+		return err
+	}
+	ctx.Logger.Step("Enabling ufw...")
+	if err := run(u.run, "ufw", "--force", "enable"); err != nil {
+		return err
+	}
+
+	// ufw only lists rules while enabled
+	entries, err := u.entries()
+	if err != nil {
+		return err
+	}
+	for _, number := range staleUFWEntries(entries, rules) {
+		ctx.Logger.Step("Removing ufw rule %d...", number)
+		if err := run(u.run, "ufw", "--force", "delete", strconv.Itoa(number)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Persist does nothing because ufw saves its rules as they are changed
+func (u *ufwBackend) Persist(ctx *features.ExecutionContext, policy string, rules []Rule) error {
+	return nil
+}
@@ -0,0 +1,567 @@
+// Package hostkeys implements the SSH host key hygiene feature
+package hostkeys
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"github.com/teomyth/iniq/internal/utils"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// minRSABits is the smallest RSA host key kept; weaker keys are regenerated
+const minRSABits = 3072
+
+// stagedSuffix names new host keys and configuration while sshd validates them
+const stagedSuffix = ".iniq-new"
+
+// defaultKeyTypes are the host key types kept when none are configured
+var defaultKeyTypes = []string{sshkeys.KeyTypeED25519, sshkeys.KeyTypeRSA}
+
+// sshfpAlgorithms maps host key types to SSHFP algorithm numbers (RFC 4255, 6594, 7479)
+var sshfpAlgorithms = map[string]int{
+	"rsa":     1,
+	"dsa":     2,
+	"ecdsa":   3,
+	"ed25519": 4,
+}
+
+// HostKey describes an SSH host key found on disk
+type HostKey struct {
+	// Path is the private key path
+	Path string
+
+	// Type is the key type taken from the file name (ed25519, rsa, ecdsa, dsa)
+	Type string
+
+	// Bits is the key size for RSA keys
+	Bits int
+
+	// Fingerprint is the SHA256 fingerprint, empty if the public key is missing
+	Fingerprint string
+
+	// PublicKey is the parsed public key, nil if the public key is missing
+	PublicKey ssh.PublicKey
+}
+
+// hostKeyPlan lists the changes needed to bring host keys in line with the allowed types
+type hostKeyPlan struct {
+	// Remove are keys of disabled types
+	Remove []HostKey
+
+	// Generate are key types to (re)generate
+	Generate []string
+}
+
+// empty reports whether the plan has no changes
+func (p hostKeyPlan) empty() bool {
+	return len(p.Remove) == 0 && len(p.Generate) == 0
+}
+
+// Feature implements the SSH host key hygiene feature
+type Feature struct {
+	osInfo *osdetect.Info
+}
+
+// New creates a new SSH host key hygiene feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+	}
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "hostkeys"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Remove weak SSH host keys and generate strong ones"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "host-keys",
+			Shorthand: "",
+			Usage:     "remove disabled SSH host key types and generate missing ed25519/RSA-4096 keys",
+			Default:   false,
+			Required:  false,
+		},
+		{
+			Name:      "regenerate-host-keys",
+			Shorthand: "",
+			Usage:     "regenerate all SSH host keys (e.g. for machines cloned from a golden image)",
+			Default:   false,
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	hostKeys, _ := options["host-keys"].(bool)
+	regenerate, _ := options["regenerate-host-keys"].(bool)
+	return hostKeys || regenerate
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	for _, keyType := range allowedKeyTypes(options) {
+		if keyType != sshkeys.KeyTypeED25519 && keyType != sshkeys.KeyTypeRSA {
+			return fmt.Errorf("invalid host key type %q: only ed25519 and rsa can be generated", keyType)
+		}
+	}
+	return nil
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	sshConfigFile := osdetect.GetSSHConfigPath(f.osInfo)
+	sshDir := filepath.Dir(sshConfigFile)
+
+	// Inventory existing host keys
+	keys, err := inventoryHostKeys(sshDir)
+	if err != nil {
+		return err
+	}
+
+	regenerate, _ := ctx.Options["regenerate-host-keys"].(bool)
+	allowed := allowedKeyTypes(ctx.Options)
+	plan := planHostKeys(keys, allowed, regenerate)
+
+	// Read the current sshd configuration; without one, sshd loads the default key paths
+	wantDirectives := hostKeyPaths(sshDir, allowed)
+	directivesMatch := true
+	configContent, err := os.ReadFile(sshConfigFile)
+	if err == nil {
+		directivesMatch = slices.Equal(sshdconfig.GetAll(string(configContent), "HostKey"), wantDirectives)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read SSH config file: %w", err)
+	}
+
+	if plan.empty() && directivesMatch {
+		ctx.Logger.Success("✓ SSH host keys already follow best practices")
+		ctx.Logger.MultiLine("info", "Host key fingerprints:", fingerprintLines(keys))
+		return nil
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		for _, key := range plan.Remove {
+			ctx.Logger.Info("Would remove %s host key %s", key.Type, key.Path)
+		}
+		for _, keyType := range plan.Generate {
+			ctx.Logger.Info("Would generate new %s host key", keyType)
+		}
+		if !directivesMatch {
+			ctx.Logger.Info("Would set HostKey directives: %s", strings.Join(wantDirectives, ", "))
+		}
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("managing SSH host keys requires root privileges")
+	}
+
+	if regenerate {
+		ctx.Logger.Warning("Regenerating host keys changes this server's identity; clients must update known_hosts")
+	}
+
+	// Remove keys of disabled types and generate new keys, once sshd accepts the
+	// configuration with the new keys
+	hostname, _ := os.Hostname()
+	validate := func(staged map[string]string) error {
+		paths := make([]string, 0, len(wantDirectives))
+		for _, path := range wantDirectives {
+			if stagedPath, ok := staged[path]; ok {
+				path = stagedPath
+			}
+			paths = append(paths, path)
+		}
+		return checkSSHConfig(sshConfigFile, sshdconfig.SetAll(string(configContent), "HostKey", paths))
+	}
+	keys, err = applyHostKeyPlan(ctx, sshDir, plan, "root@"+hostname, validate)
+	if err != nil {
+		return err
+	}
+
+	// Point sshd at the remaining keys
+	if !directivesMatch {
+		if err := f.updateHostKeyDirectives(ctx, sshConfigFile, string(configContent), wantDirectives); err != nil {
+			return err
+		}
+	}
+
+	// Reload SSH service to load the new keys
+	if err := sshdconfig.Reload(ctx.Logger, f.osInfo); err != nil {
+		return err
+	}
+
+	// Print fingerprints for known_hosts and DNS distribution
+	ctx.Logger.MultiLine("info", "Host key fingerprints:", fingerprintLines(keys))
+	ctx.Logger.MultiLine("info", "SSHFP records:", sshfpRecords(hostname, keys))
+
+	ctx.Logger.Success("SSH host keys configured")
+	return nil
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 45 // Host keys are replaced after the SSH server is otherwise configured
+}
+
+// DetectCurrentState detects and returns the current state of the host keys feature
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+
+	sshDir := filepath.Dir(osdetect.GetSSHConfigPath(f.osInfo))
+	state["ssh_dir"] = sshDir
+
+	keys, err := inventoryHostKeys(sshDir)
+	if err != nil {
+		return state, err
+	}
+	state["host_keys"] = keys
+
+	// Find keys that would be removed or regenerated
+	plan := planHostKeys(keys, allowedKeyTypes(ctx.Options), false)
+	state["weak_host_keys"] = plan.Remove
+	state["missing_host_key_types"] = plan.Generate
+
+	return state, nil
+}
+
+// DisplayCurrentState displays the current state of the host keys feature
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	keys, _ := state["host_keys"].([]HostKey)
+	weak, _ := state["weak_host_keys"].([]HostKey)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Host Keys")
+	if len(keys) == 0 {
+		fmt.Printf("\033[1;31m✗ None found\033[0m\n")
+		return
+	}
+	fmt.Printf("\033[1;32m✓ %d key(s) found\033[0m\n", len(keys))
+
+	for _, key := range keys {
+		fmt.Printf("    \033[90m%-8s\033[0m %s", key.Type, key.Fingerprint)
+		if key.Type == "rsa" && key.Bits > 0 {
+			fmt.Printf(" \033[90m(%d bits)\033[0m", key.Bits)
+		}
+		fmt.Println()
+	}
+
+	if len(weak) > 0 {
+		fmt.Printf("    \033[1;33m⚠\033[0m \033[0;37mRemove disabled host key types with --host-keys\033[0m\n")
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// Host keys are only managed on request
+	return false
+}
+
+// allowedKeyTypes returns the host key types to keep, from the host-key-types option
+func allowedKeyTypes(options map[string]any) []string {
+	var types []string
+	switch v := options["host-key-types"].(type) {
+	case []string:
+		types = v
+	case []any:
+		for _, item := range v {
+			types = append(types, fmt.Sprint(item))
+		}
+	case string:
+		types = strings.Split(v, ",")
+	}
+
+	var result []string
+	for _, keyType := range types {
+		if keyType = strings.ToLower(strings.TrimSpace(keyType)); keyType != "" {
+			result = append(result, keyType)
+		}
+	}
+	if len(result) == 0 {
+		return defaultKeyTypes
+	}
+	return result
+}
+
+// inventoryHostKeys lists the host keys in an SSH configuration directory
+func inventoryHostKeys(sshDir string) ([]HostKey, error) {
+	paths, err := filepath.Glob(filepath.Join(sshDir, "ssh_host_*_key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host keys: %w", err)
+	}
+	sort.Strings(paths)
+
+	keys := make([]HostKey, 0, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		key := HostKey{
+			Path: path,
+			Type: strings.TrimSuffix(strings.TrimPrefix(name, "ssh_host_"), "_key"),
+		}
+
+		// The public key carries the type details and fingerprint
+		if publicKey := readHostPublicKey(path); publicKey != nil {
+			key.PublicKey = publicKey
+			key.Fingerprint = ssh.FingerprintSHA256(publicKey)
+			key.Bits = rsaBits(publicKey)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// readHostPublicKey reads the public key of a host key, falling back to the private key
+// when the .pub file is missing. It returns nil if neither can be parsed.
+func readHostPublicKey(path string) ssh.PublicKey {
+	if data, err := os.ReadFile(path + ".pub"); err == nil {
+		if publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+			return publicKey
+		}
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if signer, err := ssh.ParsePrivateKey(data); err == nil {
+			return signer.PublicKey()
+		}
+	}
+	return nil
+}
+
+// rsaBits returns the modulus size of an RSA public key, or 0 for other key types
+func rsaBits(publicKey ssh.PublicKey) int {
+	cryptoKey, ok := publicKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return 0
+	}
+	if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok {
+		return rsaKey.N.BitLen()
+	}
+	return 0
+}
+
+// planHostKeys decides which host keys to remove and which types to generate
+func planHostKeys(keys []HostKey, allowed []string, regenerate bool) hostKeyPlan {
+	var plan hostKeyPlan
+	present := make(map[string]bool)
+
+	for _, key := range keys {
+		if !slices.Contains(allowed, key.Type) {
+			plan.Remove = append(plan.Remove, key)
+			continue
+		}
+		present[key.Type] = true
+
+		// Regenerate on request, when the key is unreadable, or when RSA is too short
+		weakRSA := key.Type == sshkeys.KeyTypeRSA && key.Bits > 0 && key.Bits < minRSABits
+		if regenerate || key.PublicKey == nil || weakRSA {
+			plan.Generate = append(plan.Generate, key.Type)
+		}
+	}
+
+	for _, keyType := range allowed {
+		if !present[keyType] {
+			plan.Generate = append(plan.Generate, keyType)
+		}
+	}
+
+	return plan
+}
+
+// applyHostKeyPlan removes and generates host keys and returns the resulting inventory.
+// New keys are first written next to their final paths and passed to validate, keyed by
+// final path. Existing keys are only removed or replaced once validate accepts them.
+func applyHostKeyPlan(ctx *features.ExecutionContext, sshDir string, plan hostKeyPlan, comment string, validate func(staged map[string]string) error) ([]HostKey, error) {
+	staged := make(map[string]string)
+	generatedKeys := make(map[string]*sshkeys.GeneratedKey)
+	defer func() {
+		for _, stagedPath := range staged {
+			os.Remove(stagedPath)
+			os.Remove(stagedPath + ".pub")
+		}
+	}()
+
+	for _, keyType := range plan.Generate {
+		ctx.Logger.Step("Generating %s host key...", keyType)
+		generated, err := sshkeys.GenerateKey(keyType, comment)
+		if err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(sshDir, "ssh_host_"+keyType+"_key")
+		stagedPath := path + stagedSuffix
+		staged[path] = stagedPath
+		generatedKeys[path] = generated
+		if err := writeHostKey(stagedPath, generated); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validate(staged); err != nil {
+		return nil, err
+	}
+
+	for _, key := range plan.Remove {
+		ctx.Logger.Step("Removing %s host key...", key.Type)
+		for _, path := range []string{key.Path, key.Path + ".pub"} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove host key %s: %w", path, err)
+			}
+		}
+	}
+
+	// Writing the final paths again keeps the owner and group of replaced keys
+	for path, generated := range generatedKeys {
+		if err := writeHostKey(path, generated); err != nil {
+			return nil, err
+		}
+	}
+
+	return inventoryHostKeys(sshDir)
+}
+
+// checkSSHConfig validates sshd configuration content with sshd -t, using a scratch file
+// next to the SSH config file so relative Include directives resolve the same way.
+// Without sshd installed there is nothing to validate against.
+func checkSSHConfig(sshConfigFile, content string) error {
+	sshd, err := exec.LookPath("sshd")
+	if err != nil {
+		return nil
+	}
+
+	checkFile := sshConfigFile + stagedSuffix
+	if err := safefile.WriteFile(checkFile, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", checkFile, err)
+	}
+	defer os.Remove(checkFile)
+
+	if output, err := exec.Command(sshd, "-t", "-f", checkFile).CombinedOutput(); err != nil {
+		return fmt.Errorf("sshd rejected the new host keys: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeHostKey writes a host key pair atomically, so sshd never sees a partial key.
+// An existing private key keeps its owner and group (some distributions use 0640
+// root:ssh_keys) but loses any world permissions.
+func writeHostKey(path string, key *sshkeys.GeneratedKey) error {
+	if err := safefile.WriteFile(path, key.PrivateKey, 0600); err != nil {
+		return fmt.Errorf("failed to write host key %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to write host key %s: %w", path, err)
+	}
+	if mode := info.Mode().Perm(); mode&0007 != 0 {
+		if err := os.Chmod(path, mode&^0007); err != nil {
+			return fmt.Errorf("failed to set permissions on host key %s: %w", path, err)
+		}
+	}
+
+	if err := safefile.WriteFile(path+".pub", key.AuthorizedKey, 0644); err != nil {
+		return fmt.Errorf("failed to write host key %s.pub: %w", path, err)
+	}
+	return nil
+}
+
+// updateHostKeyDirectives sets the HostKey directives and validates the result with sshd -t
+func (f *Feature) updateHostKeyDirectives(ctx *features.ExecutionContext, sshConfigFile, configContent string, paths []string) error {
+	// Check if backup option is enabled
+	backupEnabled, hasBackup := ctx.Options["backup"].(bool)
+
+	// Make a backup of the original file
+	backupPath, err := utils.BackupFile(sshConfigFile, hasBackup && backupEnabled)
+	if err != nil {
+		return fmt.Errorf("failed to create backup of SSH config file: %w", err)
+	}
+	if backupPath != "" {
+		ctx.Logger.Info("Created backup of SSH config file: %s", backupPath)
+	}
+
+	ctx.Logger.Step("Updating HostKey directives...")
+	newContent := sshdconfig.SetAll(configContent, "HostKey", paths)
+	if err := safefile.WriteFile(sshConfigFile, []byte(newContent), 0644); err != nil {
+		return fmt.Errorf("failed to write SSH config file: %w", err)
+	}
+
+	// Validate the configuration before restarting, and roll back if sshd rejects it
+	if sshd, err := exec.LookPath("sshd"); err == nil {
+		if output, err := exec.Command(sshd, "-t", "-f", sshConfigFile).CombinedOutput(); err != nil {
+			_ = safefile.WriteFile(sshConfigFile, []byte(configContent), 0644)
+			return fmt.Errorf("sshd rejected the new configuration: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// hostKeyPaths returns the private key paths of the given types
+func hostKeyPaths(sshDir string, keyTypes []string) []string {
+	paths := make([]string, 0, len(keyTypes))
+	for _, keyType := range keyTypes {
+		paths = append(paths, filepath.Join(sshDir, "ssh_host_"+keyType+"_key"))
+	}
+	return paths
+}
+
+// fingerprintLines formats host key fingerprints for display
+func fingerprintLines(keys []HostKey) []string {
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Fingerprint != "" {
+			lines = append(lines, fmt.Sprintf("%s %s", key.Type, key.Fingerprint))
+		}
+	}
+	return lines
+}
+
+// sshfpRecords formats SHA-256 SSHFP DNS records for the host keys
+func sshfpRecords(hostname string, keys []HostKey) []string {
+	var records []string
+	for _, key := range keys {
+		if record := sshfpRecord(hostname, key); record != "" {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// sshfpRecord formats the SHA-256 SSHFP DNS record of a host key
+func sshfpRecord(hostname string, key HostKey) string {
+	algorithm, ok := sshfpAlgorithms[key.Type]
+	if !ok || key.PublicKey == nil {
+		return ""
+	}
+	sum := sha256.Sum256(key.PublicKey.Marshal())
+	return fmt.Sprintf("%s IN SSHFP %d 2 %s", hostname, algorithm, hex.EncodeToString(sum[:]))
+}
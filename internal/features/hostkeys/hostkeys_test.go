@@ -0,0 +1,307 @@
+package hostkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFeatureInterface(t *testing.T) {
+	// Verify that Feature implements the features.Feature interface
+	var _ features.Feature = (*Feature)(nil)
+}
+
+func TestNew(t *testing.T) {
+	osInfo, _ := osdetect.Detect()
+	feature := New(osInfo)
+
+	if feature == nil {
+		t.Fatal("New returned nil")
+	}
+
+	if feature.Name() != "hostkeys" {
+		t.Errorf("Expected feature name 'hostkeys', got %q", feature.Name())
+	}
+
+	if feature.Description() == "" {
+		t.Error("Feature description is empty")
+	}
+}
+
+func TestShouldActivate(t *testing.T) {
+	feature := New(nil)
+
+	tests := []struct {
+		name     string
+		options  map[string]any
+		expected bool
+	}{
+		{"Empty options", map[string]any{}, false},
+		{"With host-keys", map[string]any{"host-keys": true}, true},
+		{"With regenerate-host-keys", map[string]any{"regenerate-host-keys": true}, true},
+		{"With skip-sudo", map[string]any{"host-keys": true, "skip-sudo": true}, true},
+		{"With skip-privileged", map[string]any{"host-keys": true, "skip-sudo": true, "skip-privileged": true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := feature.ShouldActivate(tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	feature := New(nil)
+
+	if err := feature.ValidateOptions(map[string]any{"host-key-types": []any{"ed25519", "RSA"}}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := feature.ValidateOptions(map[string]any{"host-key-types": "ed25519,dsa"}); err == nil {
+		t.Error("Expected error for dsa host key type")
+	}
+}
+
+func TestPlanHostKeys(t *testing.T) {
+	ed25519Key := HostKey{Type: "ed25519", PublicKey: testPublicKey(t)}
+	strongRSA := HostKey{Type: "rsa", Bits: 4096, PublicKey: testPublicKey(t)}
+	weakRSA := HostKey{Type: "rsa", Bits: 2048, PublicKey: testPublicKey(t)}
+	ecdsaKey := HostKey{Type: "ecdsa", PublicKey: testPublicKey(t)}
+	unreadable := HostKey{Type: "ed25519"}
+
+	tests := []struct {
+		name           string
+		keys           []HostKey
+		regenerate     bool
+		expectRemove   []string
+		expectGenerate []string
+	}{
+		{
+			name:           "Nothing to do",
+			keys:           []HostKey{ed25519Key, strongRSA},
+			expectGenerate: nil,
+		},
+		{
+			name:           "No keys",
+			keys:           nil,
+			expectGenerate: []string{"ed25519", "rsa"},
+		},
+		{
+			name:           "Weak RSA and ecdsa",
+			keys:           []HostKey{ecdsaKey, ed25519Key, weakRSA},
+			expectRemove:   []string{"ecdsa"},
+			expectGenerate: []string{"rsa"},
+		},
+		{
+			name:           "Unreadable key",
+			keys:           []HostKey{unreadable, strongRSA},
+			expectGenerate: []string{"ed25519"},
+		},
+		{
+			name:           "Regenerate all",
+			keys:           []HostKey{ed25519Key, strongRSA},
+			regenerate:     true,
+			expectGenerate: []string{"ed25519", "rsa"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planHostKeys(tt.keys, defaultKeyTypes, tt.regenerate)
+
+			var removed []string
+			for _, key := range plan.Remove {
+				removed = append(removed, key.Type)
+			}
+			if !slices.Equal(removed, tt.expectRemove) {
+				t.Errorf("Expected remove %v, got %v", tt.expectRemove, removed)
+			}
+			if !slices.Equal(plan.Generate, tt.expectGenerate) {
+				t.Errorf("Expected generate %v, got %v", tt.expectGenerate, plan.Generate)
+			}
+		})
+	}
+}
+
+func TestApplyHostKeyPlan(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-hostkeys-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// An ecdsa key is present, only ed25519 is allowed
+	ecdsaPath := filepath.Join(tempDir, "ssh_host_ecdsa_key")
+	if err := os.WriteFile(ecdsaPath, []byte("private"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if err := os.WriteFile(ecdsaPath+".pub", ssh.MarshalAuthorizedKey(testPublicKey(t)), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	keys, err := inventoryHostKeys(tempDir)
+	if err != nil {
+		t.Fatalf("inventoryHostKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Type != "ecdsa" || keys[0].Fingerprint == "" {
+		t.Fatalf("Expected one readable ecdsa key, got %+v", keys)
+	}
+
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{},
+		Logger:  logger.New(false, true),
+	}
+	allowed := []string{sshkeys.KeyTypeED25519}
+	plan := planHostKeys(keys, allowed, false)
+
+	var validated map[string]string
+	validate := func(staged map[string]string) error {
+		validated = staged
+		return nil
+	}
+	keys, err = applyHostKeyPlan(ctx, tempDir, plan, "root@test", validate)
+	if err != nil {
+		t.Fatalf("applyHostKeyPlan failed: %v", err)
+	}
+
+	if len(keys) != 1 || keys[0].Type != "ed25519" || keys[0].PublicKey == nil {
+		t.Fatalf("Expected one ed25519 key, got %+v", keys)
+	}
+	if _, err := os.Stat(ecdsaPath); !os.IsNotExist(err) {
+		t.Error("Expected ecdsa key to be removed")
+	}
+
+	info, err := os.Stat(keys[0].Path)
+	if err != nil {
+		t.Fatalf("Failed to stat key: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected private key mode 0600, got %o", info.Mode().Perm())
+	}
+
+	pub, err := os.ReadFile(keys[0].Path + ".pub")
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(string(pub)), "root@test") {
+		t.Errorf("Expected public key comment root@test, got %q", pub)
+	}
+
+	// The plan is now empty
+	if plan := planHostKeys(keys, allowed, false); !plan.empty() {
+		t.Errorf("Expected empty plan, got %+v", plan)
+	}
+
+	// The new key was validated under a staged path that is cleaned up afterwards
+	stagedPath, ok := validated[keys[0].Path]
+	if !ok {
+		t.Fatalf("Expected %s to be validated, got %v", keys[0].Path, validated)
+	}
+	if _, err := os.Stat(stagedPath); !os.IsNotExist(err) {
+		t.Errorf("Expected staged key %s to be removed", stagedPath)
+	}
+}
+
+func TestApplyHostKeyPlanValidationFailure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-hostkeys-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A weak ecdsa key is present, only ed25519 is allowed
+	ecdsaPath := filepath.Join(tempDir, "ssh_host_ecdsa_key")
+	if err := os.WriteFile(ecdsaPath, []byte("private"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if err := os.WriteFile(ecdsaPath+".pub", ssh.MarshalAuthorizedKey(testPublicKey(t)), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	keys, err := inventoryHostKeys(tempDir)
+	if err != nil {
+		t.Fatalf("inventoryHostKeys failed: %v", err)
+	}
+
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{},
+		Logger:  logger.New(false, true),
+	}
+	plan := planHostKeys(keys, []string{sshkeys.KeyTypeED25519}, false)
+
+	// The staged key exists while sshd validates it, but sshd rejects the configuration
+	validate := func(staged map[string]string) error {
+		for _, stagedPath := range staged {
+			if _, err := os.Stat(stagedPath); err != nil {
+				t.Errorf("Expected staged key %s to exist during validation", stagedPath)
+			}
+		}
+		return errors.New("sshd rejected the new host keys")
+	}
+	if _, err := applyHostKeyPlan(ctx, tempDir, plan, "root@test", validate); err == nil {
+		t.Fatal("Expected validation error, got nil")
+	}
+
+	// Nothing is removed or replaced, and no staged files are left behind
+	for _, path := range []string{ecdsaPath, ecdsaPath + ".pub"} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept: %v", path, err)
+		}
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 2 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("Expected only the ecdsa key pair, got %v", names)
+	}
+}
+
+func TestSSHFPRecord(t *testing.T) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGYHQpLNUpHXhzwbKEoRwqnye5XpB4Dh2NFY5BnHy0zY"))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+
+	record := sshfpRecord("host.example.com", HostKey{Type: "ed25519", PublicKey: publicKey})
+	if !strings.HasPrefix(record, "host.example.com IN SSHFP 4 2 ") {
+		t.Errorf("Unexpected SSHFP record %q", record)
+	}
+	if len(strings.Fields(record)) != 6 || len(strings.Fields(record)[5]) != 64 {
+		t.Errorf("Expected a SHA-256 hex digest, got %q", record)
+	}
+
+	if record := sshfpRecord("host", HostKey{Type: "ed25519"}); record != "" {
+		t.Errorf("Expected no record without a public key, got %q", record)
+	}
+}
+
+// testPublicKey returns a fresh ecdsa P-256 public key
+func testPublicKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	publicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to convert key: %v", err)
+	}
+	return publicKey
+}
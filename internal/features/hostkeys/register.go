@@ -0,0 +1,13 @@
+package hostkeys
+
+import (
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// init registers the host keys feature
+func init() {
+	features.RegisterHostKeysFeature = func(registry *features.Registry, osInfo *osdetect.Info) {
+		registry.Register(New(osInfo))
+	}
+}
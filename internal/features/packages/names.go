@@ -0,0 +1,145 @@
+package packages
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// packageNamePattern matches package names of all supported package managers
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9@][A-Za-z0-9@._+:-]*$`)
+
+// packageNames maps Debian package names to their names with other package managers.
+// An empty name means the package manager has no such package.
+var packageNames = map[string]map[osdetect.PackageManager]string{
+	"vim": {
+		osdetect.DNF: "vim-enhanced",
+		osdetect.YUM: "vim-enhanced",
+	},
+	"dnsutils": {
+		osdetect.DNF:    "bind-utils",
+		osdetect.YUM:    "bind-utils",
+		osdetect.Zypper: "bind-utils",
+		osdetect.Pacman: "bind",
+		osdetect.APK:    "bind-tools",
+	},
+	"openssh-client": {
+		osdetect.DNF:    "openssh-clients",
+		osdetect.YUM:    "openssh-clients",
+		osdetect.Zypper: "openssh-clients",
+		osdetect.Pacman: "openssh",
+	},
+	"netcat": {
+		osdetect.APT:    "netcat-openbsd",
+		osdetect.DNF:    "nmap-ncat",
+		osdetect.YUM:    "nmap-ncat",
+		osdetect.Zypper: "netcat-openbsd",
+		osdetect.Pacman: "openbsd-netcat",
+		osdetect.APK:    "netcat-openbsd",
+	},
+	"iputils-ping": {
+		osdetect.DNF:    "iputils",
+		osdetect.YUM:    "iputils",
+		osdetect.Zypper: "iputils",
+		osdetect.Pacman: "iputils",
+		osdetect.APK:    "iputils",
+	},
+	"fd-find": {
+		osdetect.Zypper: "fd",
+		osdetect.Pacman: "fd",
+		osdetect.APK:    "fd",
+	},
+	"python3-pip": {
+		osdetect.Pacman: "python-pip",
+		osdetect.APK:    "py3-pip",
+	},
+}
+
+// nameMap holds package names per package manager, from the built-in names and the package-names option
+type nameMap map[string]map[osdetect.PackageManager]string
+
+// resolve returns the name of a package with a package manager, and false when it has no such package
+func (m nameMap) resolve(pkg string, pm osdetect.PackageManager) (string, bool) {
+	for _, names := range []map[osdetect.PackageManager]string{m[pkg], packageNames[pkg]} {
+		if name, ok := names[pm]; ok {
+			return name, name != ""
+		}
+	}
+	return pkg, true
+}
+
+// nameMapOption returns the package-names option, which maps a package to its name per
+// package manager, for example {vim: {dnf: vim-enhanced}}
+func nameMapOption(options map[string]any) (nameMap, error) {
+	names := make(nameMap)
+	raw, ok := options["package-names"].(map[string]any)
+	if !ok {
+		return names, nil
+	}
+
+	for pkg, value := range raw {
+		perManager, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid package-names entry %q: must map package managers to names", pkg)
+		}
+		names[pkg] = make(map[osdetect.PackageManager]string)
+		for pm, name := range perManager {
+			if !knownPackageManager(osdetect.PackageManager(pm)) {
+				return nil, fmt.Errorf("invalid package-names entry %q: unknown package manager %q", pkg, pm)
+			}
+			nameString, ok := name.(string)
+			if !ok {
+				if name != nil {
+					return nil, fmt.Errorf("invalid package-names entry %q: name for %s must be a string", pkg, pm)
+				}
+				nameString = ""
+			}
+			if nameString = strings.TrimSpace(nameString); nameString != "" && !packageNamePattern.MatchString(nameString) {
+				return nil, fmt.Errorf("invalid package name %q", nameString)
+			}
+			names[pkg][osdetect.PackageManager(pm)] = nameString
+		}
+	}
+	return names, nil
+}
+
+// knownPackageManager reports whether a package manager can be named in package-names
+func knownPackageManager(pm osdetect.PackageManager) bool {
+	switch pm {
+	case osdetect.APT, osdetect.DNF, osdetect.YUM, osdetect.Zypper, osdetect.Pacman, osdetect.APK, osdetect.Brew:
+		return true
+	}
+	return false
+}
+
+// listOption returns the package names of a list option, which config files give as a
+// list and environment variables as a comma-separated string
+func listOption(options map[string]any, name string) ([]string, error) {
+	var values []string
+	switch v := options[name].(type) {
+	case []string:
+		values = v
+	case []any:
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	var result []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value == "" || seen[value] {
+			continue
+		}
+		if !packageNamePattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid package name %q in %s", value, name)
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result, nil
+}
@@ -0,0 +1,247 @@
+// Package packages implements the baseline package installation feature
+package packages
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/pkgmanager"
+)
+
+// Feature implements the baseline package installation feature
+type Feature struct {
+	osInfo *osdetect.Info
+}
+
+// New creates a new package installation feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+	}
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "packages"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Install the baseline packages"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "packages",
+			Shorthand: "",
+			Usage:     "packages to install, by their Debian names (e.g. curl,vim,htop)",
+			Default:   []string{},
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	install, _ := listOption(options, "packages")
+	remove, _ := listOption(options, "packages-remove")
+	return len(install) > 0 || len(remove) > 0
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	_, err := selectPackages(options, f.osInfo.PackageManager)
+	return err
+}
+
+// selection is the packages to install and remove with one package manager
+type selection struct {
+	// Install and Remove hold the names used by the package manager
+	Install []string
+	Remove  []string
+	// Unavailable lists requested packages the package manager has no package for
+	Unavailable []string
+}
+
+// selectPackages returns the packages to install and remove, translated to the package manager's names
+func selectPackages(options map[string]any, pm osdetect.PackageManager) (selection, error) {
+	var s selection
+	install, err := listOption(options, "packages")
+	if err != nil {
+		return s, err
+	}
+	remove, err := listOption(options, "packages-remove")
+	if err != nil {
+		return s, err
+	}
+	names, err := nameMapOption(options)
+	if err != nil {
+		return s, err
+	}
+
+	for _, pkg := range install {
+		if slices.Contains(remove, pkg) {
+			return s, fmt.Errorf("package %s is listed in both packages and packages-remove", pkg)
+		}
+		if name, ok := names.resolve(pkg, pm); ok {
+			s.Install = append(s.Install, name)
+		} else {
+			s.Unavailable = append(s.Unavailable, pkg)
+		}
+	}
+	for _, pkg := range remove {
+		if name, ok := names.resolve(pkg, pm); ok {
+			s.Remove = append(s.Remove, name)
+		}
+	}
+	return s, nil
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	s, err := selectPackages(ctx.Options, f.osInfo.PackageManager)
+	if err != nil {
+		return err
+	}
+	manager, err := pkgmanager.New(f.osInfo.PackageManager)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range s.Unavailable {
+		ctx.Logger.Warning("Skipping %s, which %s has no package for", pkg, manager.Kind())
+	}
+	missing, err := filterInstalled(manager, s.Install, false)
+	if err != nil {
+		return err
+	}
+	unwanted, err := filterInstalled(manager, s.Remove, true)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) == 0 && len(unwanted) == 0 {
+		ctx.Logger.Success("✓ Packages already up to date")
+		return nil
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		if len(missing) > 0 {
+			ctx.Logger.Info("Would install %s with %s", strings.Join(missing, ", "), manager.Kind())
+			if pkgmanager.UpgradesSystem(manager.Kind()) {
+				ctx.Logger.Info("Would upgrade all installed packages first, as %s only installs with a full system upgrade", manager.Kind())
+			}
+		}
+		if len(unwanted) > 0 {
+			ctx.Logger.Info("Would remove %s with %s", strings.Join(unwanted, ", "), manager.Kind())
+		}
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 && manager.Kind() != osdetect.Brew {
+		return fmt.Errorf("installing packages requires root privileges")
+	}
+
+	if len(missing) > 0 {
+		if pkgmanager.UpgradesSystem(manager.Kind()) {
+			ctx.Logger.Warning("Upgrading all installed packages first, as %s only installs with a full system upgrade", manager.Kind())
+		}
+		ctx.Logger.Step("Installing %s...", strings.Join(missing, ", "))
+		warn := func(err error) { ctx.Logger.Warning("Failed to update package metadata: %v", err) }
+		if err := pkgmanager.UpdateAndInstall(manager, warn, missing...); err != nil {
+			return fmt.Errorf("failed to install packages: %w", err)
+		}
+	}
+	if len(unwanted) > 0 {
+		ctx.Logger.Step("Removing %s...", strings.Join(unwanted, ", "))
+		if err := manager.Remove(unwanted...); err != nil {
+			return fmt.Errorf("failed to remove packages: %w", err)
+		}
+	}
+
+	ctx.Logger.Success("Packages up to date (%d installed, %d removed)", len(missing), len(unwanted))
+	return nil
+}
+
+// filterInstalled returns the packages that are installed, or those that are not
+func filterInstalled(manager pkgmanager.Manager, packages []string, installed bool) ([]string, error) {
+	var result []string
+	for _, pkg := range packages {
+		isInstalled, err := manager.IsInstalled(pkg)
+		if err != nil {
+			return nil, err
+		}
+		if isInstalled == installed {
+			result = append(result, pkg)
+		}
+	}
+	return result, nil
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 5 // Packages are installed first, so later features can use the tools they bring
+}
+
+// DetectCurrentState detects and returns the current state of the packages feature
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+	state["package_manager"] = string(f.osInfo.PackageManager)
+
+	s, err := selectPackages(ctx.Options, f.osInfo.PackageManager)
+	if err != nil {
+		return state, err
+	}
+	state["packages_configured"] = len(s.Install) > 0 || len(s.Remove) > 0 || len(s.Unavailable) > 0
+	state["packages_unavailable"] = s.Unavailable
+
+	manager, err := pkgmanager.New(f.osInfo.PackageManager)
+	if err != nil {
+		state["packages_error"] = err.Error()
+		return state, nil
+	}
+	if state["packages_missing"], err = filterInstalled(manager, s.Install, false); err != nil {
+		return state, err
+	}
+	if state["packages_unwanted"], err = filterInstalled(manager, s.Remove, true); err != nil {
+		return state, err
+	}
+	state["packages_wanted"] = len(s.Install)
+
+	return state, nil
+}
+
+// DisplayCurrentState displays the current state of the packages feature
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	missing, _ := state["packages_missing"].([]string)
+	unwanted, _ := state["packages_unwanted"].([]string)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Packages")
+	if len(missing) == 0 && len(unwanted) == 0 {
+		fmt.Printf("\033[1;32m✓ Up to date\033[0m\n")
+	} else {
+		fmt.Printf("\033[1;33m⚠ %d to install, %d to remove\033[0m\n", len(missing), len(unwanted))
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// Packages come from the configuration only
+	return false
+}
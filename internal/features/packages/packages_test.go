@@ -0,0 +1,160 @@
+package packages
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+func TestSelectPackages(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]any
+		pm        osdetect.PackageManager
+		want      selection
+		expectErr bool
+	}{
+		{
+			name:    "names unchanged on Debian",
+			options: map[string]any{"packages": []string{"curl", "vim", "htop"}},
+			pm:      osdetect.APT,
+			want:    selection{Install: []string{"curl", "vim", "htop"}},
+		},
+		{
+			name:    "built-in names on Fedora",
+			options: map[string]any{"packages": []any{"curl", "vim", "dnsutils"}},
+			pm:      osdetect.DNF,
+			want:    selection{Install: []string{"curl", "vim-enhanced", "bind-utils"}},
+		},
+		{
+			name:    "built-in name on Debian",
+			options: map[string]any{"packages": "netcat"},
+			pm:      osdetect.APT,
+			want:    selection{Install: []string{"netcat-openbsd"}},
+		},
+		{
+			name: "configured names override built-in names",
+			options: map[string]any{
+				"packages":      []string{"vim", "htop", "fd-find"},
+				"package-names": map[string]any{"vim": map[string]any{"apk": "vim-full"}, "htop": map[string]any{"apk": ""}},
+			},
+			pm:   osdetect.APK,
+			want: selection{Install: []string{"vim-full", "fd"}, Unavailable: []string{"htop"}},
+		},
+		{
+			name:    "removal and duplicates",
+			options: map[string]any{"packages": "curl, curl", "packages-remove": []string{"telnet", "vim"}},
+			pm:      osdetect.YUM,
+			want:    selection{Install: []string{"curl"}, Remove: []string{"telnet", "vim-enhanced"}},
+		},
+		{
+			name:      "package installed and removed",
+			options:   map[string]any{"packages": []string{"curl"}, "packages-remove": []string{"curl"}},
+			pm:        osdetect.APT,
+			expectErr: true,
+		},
+		{
+			name:      "option-like package name",
+			options:   map[string]any{"packages": []string{"--allow-downgrades"}},
+			pm:        osdetect.APT,
+			expectErr: true,
+		},
+		{
+			name:      "unknown package manager in names",
+			options:   map[string]any{"packages": []string{"vim"}, "package-names": map[string]any{"vim": map[string]any{"emerge": "vim"}}},
+			pm:        osdetect.APT,
+			expectErr: true,
+		},
+		{
+			name:      "invalid mapped name",
+			options:   map[string]any{"packages": []string{"vim"}, "package-names": map[string]any{"vim": map[string]any{"apt": "vim; reboot"}}},
+			pm:        osdetect.APT,
+			expectErr: true,
+		},
+		{
+			name:      "names not a map",
+			options:   map[string]any{"packages": []string{"vim"}, "package-names": map[string]any{"vim": "vim-enhanced"}},
+			pm:        osdetect.APT,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectPackages(tt.options, tt.pm)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShouldActivate(t *testing.T) {
+	f := New(&osdetect.Info{PackageManager: osdetect.APT})
+	tests := []struct {
+		name     string
+		options  map[string]any
+		expected bool
+	}{
+		{"no packages", map[string]any{"packages": []string{}}, false},
+		{"packages", map[string]any{"packages": []string{"curl"}}, true},
+		{"removal only", map[string]any{"packages-remove": []any{"telnet"}}, true},
+		{"sudo declined for the user", map[string]any{"packages": []string{"curl"}, "skip-sudo": true}, true},
+		{"skip privileged", map[string]any{"packages": []string{"curl"}, "skip-sudo": true, "skip-privileged": true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.ShouldActivate(tt.options); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// fakeManager reports the packages in installed as installed and records changes
+type fakeManager struct {
+	installed []string
+}
+
+func (m *fakeManager) Kind() osdetect.PackageManager { return osdetect.APT }
+func (m *fakeManager) Install(packages ...string) error {
+	m.installed = append(m.installed, packages...)
+	return nil
+}
+func (m *fakeManager) Remove(packages ...string) error { return nil }
+func (m *fakeManager) IsInstalled(pkg string) (bool, error) {
+	return slices.Contains(m.installed, pkg), nil
+}
+func (m *fakeManager) Update() error { return nil }
+
+func TestFilterInstalled(t *testing.T) {
+	manager := &fakeManager{installed: []string{"curl", "telnet"}}
+
+	missing, err := filterInstalled(manager, []string{"curl", "vim", "htop"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{"vim", "htop"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("Expected missing %v, got %v", want, missing)
+	}
+
+	present, err := filterInstalled(manager, []string{"telnet", "rsh-client"}, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []string{"telnet"}; !reflect.DeepEqual(present, want) {
+		t.Errorf("Expected present %v, got %v", want, present)
+	}
+}
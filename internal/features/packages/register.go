@@ -0,0 +1,13 @@
+package packages
+
+import (
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// init registers the packages feature
+func init() {
+	features.RegisterPackagesFeature = func(registry *features.Registry, osInfo *osdetect.Info) {
+		registry.Register(New(osInfo))
+	}
+}
@@ -24,4 +24,28 @@ func RegisterFeatures(registry *Registry, osInfo *osdetect.Info) {
 	if RegisterSecurityFeature != nil {
 		RegisterSecurityFeature(registry, osInfo)
 	}
+
+	if RegisterHostKeysFeature != nil {
+		RegisterHostKeysFeature(registry, osInfo)
+	}
+
+	if RegisterFirewallFeature != nil {
+		RegisterFirewallFeature(registry, osInfo)
+	}
+
+	if RegisterFail2banFeature != nil {
+		RegisterFail2banFeature(registry, osInfo)
+	}
+	if RegisterUpdatesFeature != nil {
+		RegisterUpdatesFeature(registry, osInfo)
+	}
+	if RegisterPackagesFeature != nil {
+		RegisterPackagesFeature(registry, osInfo)
+	}
+	if RegisterSystemFeature != nil {
+		RegisterSystemFeature(registry, osInfo)
+	}
+	if RegisterSysctlFeature != nil {
+		RegisterSysctlFeature(registry, osInfo)
+	}
 }
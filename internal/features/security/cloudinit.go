@@ -0,0 +1,126 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/cloudinit"
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+// sshdSettings returns the effective values of the settings cloud-init also manages
+func (f *Feature) sshdSettings(config string) map[string]string {
+	return map[string]string{
+		"PasswordAuthentication": f.parseSSHSetting(config, "PasswordAuthentication").EffectiveValue,
+		"PermitRootLogin":        f.parseSSHSetting(config, "PermitRootLogin").EffectiveValue,
+	}
+}
+
+// detectCloudInit records the cloud-init settings that override or may override config
+func (f *Feature) detectCloudInit(config string, state map[string]any) {
+	cloudInit, err := cloudinit.Detect("/")
+	if err != nil {
+		state["cloud_init_error"] = err.Error()
+		return
+	}
+	state["cloud_init_installed"] = cloudInit.Installed
+	state["cloud_init_conflicts"] = cloudInit.Conflicts(f.sshdSettings(config))
+	if _, err := os.Stat(cloudinit.ConfigFile); err == nil {
+		state["cloud_init_config"] = cloudinit.ConfigFile
+	}
+}
+
+// alignCloudInit makes cloud-init agree with the SSH settings in config. Conflicting
+// directives in cloud-init's sshd drop-ins are rewritten, and cloudinit.ConfigFile sets
+// ssh_pwauth so cloud-init does not change password authentication on later boots.
+// It reports whether a drop-in was rewritten, which sshd only picks up on reload.
+func (f *Feature) alignCloudInit(ctx *features.ExecutionContext, config string) (bool, error) {
+	cloudInit, err := cloudinit.Detect("/")
+	if err != nil {
+		return false, err
+	}
+	settings := f.sshdSettings(config)
+
+	directives := make([]string, 0, len(cloudInit.SSHDirectives))
+	for directive := range cloudInit.SSHDirectives {
+		directives = append(directives, directive)
+	}
+	sort.Strings(directives)
+	rewritten := false
+	for _, directive := range directives {
+		setting := cloudInit.SSHDirectives[directive]
+		want := settings[directive]
+		if strings.EqualFold(setting.Value, want) {
+			continue
+		}
+		content, err := os.ReadFile(setting.File)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to read %s: %w", setting.File, err)
+		}
+		updated := sshdconfig.Set(string(content), directive, want)
+		if err := safefile.WriteFile(setting.File, []byte(updated), 0644); err != nil {
+			return rewritten, fmt.Errorf("failed to write %s: %w", setting.File, err)
+		}
+		ctx.Logger.Info("Set %s %s in %s", directive, want, setting.File)
+		rewritten = true
+	}
+
+	if !cloudInit.Installed {
+		return rewritten, nil
+	}
+	content := cloudinit.RenderConfig(strings.EqualFold(settings["PasswordAuthentication"], "yes"))
+	if err := os.MkdirAll(filepath.Dir(cloudinit.ConfigFile), 0755); err != nil {
+		return rewritten, fmt.Errorf("failed to create %s: %w", filepath.Dir(cloudinit.ConfigFile), err)
+	}
+	if err := safefile.WriteFile(cloudinit.ConfigFile, []byte(content), 0644); err != nil {
+		return rewritten, fmt.Errorf("failed to write %s: %w", cloudinit.ConfigFile, err)
+	}
+	ctx.Logger.Info("Wrote cloud-init configuration %s", cloudinit.ConfigFile)
+	return rewritten, nil
+}
+
+// keepCloudInit makes cloud-init keep the current SSH settings when none of them change
+func (f *Feature) keepCloudInit(ctx *features.ExecutionContext) error {
+	if ctx.DryRun {
+		ctx.Logger.Info("Would make cloud-init keep these settings (%s)", cloudinit.ConfigFile)
+		return nil
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("configuring cloud-init requires root privileges")
+	}
+
+	sshConfigFile := osdetect.GetSSHConfigPath(f.osInfo)
+	configContent, err := os.ReadFile(sshConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH config file: %w", err)
+	}
+
+	rewritten, err := f.alignCloudInit(ctx, string(configContent))
+	if err != nil {
+		return fmt.Errorf("failed to configure cloud-init: %w", err)
+	}
+	if !rewritten {
+		return nil
+	}
+	return sshdconfig.Reload(ctx.Logger, f.osInfo)
+}
+
+// warnCloudInit warns about cloud-init settings that override or may override config
+func (f *Feature) warnCloudInit(ctx *features.ExecutionContext, config string) {
+	state := make(map[string]any)
+	f.detectCloudInit(config, state)
+	conflicts, _ := state["cloud_init_conflicts"].([]string)
+	for _, conflict := range conflicts {
+		ctx.Logger.Warning("cloud-init: %s", conflict)
+	}
+	if len(conflicts) > 0 {
+		ctx.Logger.Info("Run with --cloud-init-config to make cloud-init keep these settings")
+	}
+}
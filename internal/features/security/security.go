@@ -4,12 +4,14 @@ package security
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 
+	"github.com/teomyth/iniq/internal/cloudinit"
 	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sshdconfig"
 	"github.com/teomyth/iniq/internal/utils"
 	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
 )
 
 // Feature implements the SSH security configuration feature
@@ -65,6 +67,20 @@ func (f *Feature) Flags() []features.Flag {
 			Default:   false,
 			Required:  false,
 		},
+		{
+			Name:      "ssh-user-ca",
+			Shorthand: "",
+			Usage:     "trust SSH user certificates signed by the CA key from this source (e.g. url:https://ca/user_ca.pub)",
+			Default:   "",
+			Required:  false,
+		},
+		{
+			Name:      "cloud-init-config",
+			Shorthand: "",
+			Usage:     "make cloud-init keep the SSH settings applied by iniq (writes /etc/cloud/cloud.cfg.d/99-iniq.cfg)",
+			Default:   false,
+			Required:  false,
+		},
 		{
 			Name:      "skip-sudo",
 			Shorthand: "S",
@@ -102,9 +118,12 @@ func (f *Feature) ShouldActivate(options map[string]any) bool {
 	// Check new parameters
 	sshRootLogin, hasRootLogin := options["ssh-root-login"].(string)
 	sshPasswordAuth, hasPasswordAuth := options["ssh-password-auth"].(string)
+	sshUserCA, hasUserCA := options["ssh-user-ca"].(string)
+	cloudInitConfig, hasCloudInitConfig := options["cloud-init-config"].(bool)
 
 	result := (((hasNoRoot && sshNoRoot) || (hasNoPass && sshNoPass)) ||
-		((hasRootLogin && sshRootLogin != "") || (hasPasswordAuth && sshPasswordAuth != ""))) &&
+		((hasRootLogin && sshRootLogin != "") || (hasPasswordAuth && sshPasswordAuth != "")) ||
+		(hasUserCA && sshUserCA != "") || (hasCloudInitConfig && cloudInitConfig)) &&
 		(!hasSkipSudo || !skipSudo)
 
 	// If SSH security feature is activated, mark that we have changes
@@ -242,8 +261,14 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 		}
 	}
 
+	// Fetch the user CA keys, if configured
+	userCA, err := resolveUserCA(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Check if any changes are needed and provide appropriate feedback
-	hasChanges := opts.RootLoginAction != "keep" || opts.PasswordAuthAction != "keep"
+	hasChanges := opts.RootLoginAction != "keep" || opts.PasswordAuthAction != "keep" || userCA != nil
 
 	if !hasChanges {
 		// No changes needed - show confirmation message
@@ -269,6 +294,10 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 		ctx.Logger.Info("  - Root login: %s (unchanged)", rootStatus)
 		ctx.Logger.Info("  - Password authentication: %s (unchanged)", passwordStatus)
 
+		// cloud-init can still override the unchanged settings on a later boot
+		if alignCloudInit, _ := ctx.Options["cloud-init-config"].(bool); alignCloudInit {
+			return f.keepCloudInit(ctx)
+		}
 		return nil
 	}
 
@@ -284,6 +313,12 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 		} else if opts.PasswordAuthAction == "disable" {
 			ctx.Logger.Info("Would disable SSH password authentication")
 		}
+		if userCA != nil {
+			describeUserCA(ctx, userCA, osdetect.GetSSHConfigPath(f.osInfo))
+		}
+		if alignCloudInit, _ := ctx.Options["cloud-init-config"].(bool); alignCloudInit {
+			ctx.Logger.Info("Would make cloud-init keep these settings (%s)", cloudinit.ConfigFile)
+		}
 		return nil
 	}
 
@@ -339,20 +374,40 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 		configChanges = append(configChanges, "PasswordAuthentication no")
 	}
 
+	// Apply user certificate authority configuration
+	if userCA != nil {
+		var caChanges []string
+		newContent, caChanges, err = f.applyUserCA(ctx, userCA, sshConfigFile, newContent)
+		if err != nil {
+			return err
+		}
+		configChanges = append(configChanges, caChanges...)
+	}
+
 	// Show configuration changes
 	ctx.Logger.MultiLine("info", "Applying the following SSH configuration changes:", configChanges)
 
 	// Write updated config
 	ctx.Logger.Step("Modifying SSH configuration file...")
-	if err := os.WriteFile(sshConfigFile, []byte(newContent), 0644); err != nil {
+	if err := safefile.WriteFile(sshConfigFile, []byte(newContent), 0644); err != nil {
 		return fmt.Errorf("failed to write SSH config file: %w", err)
 	}
 
-	// Restart SSH service
-	if err := f.restartSSHService(ctx); err != nil {
-		return fmt.Errorf("failed to restart SSH service: %w", err)
+	// Make cloud-init agree before sshd picks up its drop-ins
+	if alignCloudInit, _ := ctx.Options["cloud-init-config"].(bool); alignCloudInit {
+		if _, err := f.alignCloudInit(ctx, newContent); err != nil {
+			return fmt.Errorf("failed to configure cloud-init: %w", err)
+		}
 	}
 
+	// Reload SSH service
+	if err := sshdconfig.Reload(ctx.Logger, f.osInfo); err != nil {
+		return err
+	}
+
+	// Drop-ins written by cloud-init are read before sshd_config and win over it
+	f.warnCloudInit(ctx, newContent)
+
 	ctx.Logger.Success("SSH security settings configured")
 	return nil
 }
@@ -380,6 +435,7 @@ func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string
 			state["password_auth_explicit"] = false
 			state["permit_root_login_source"] = "default"
 			state["password_auth_source"] = "default"
+			detectUserCA("", state)
 			state["is_root"] = false
 			return state, nil
 		}
@@ -419,6 +475,12 @@ func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string
 	state["permit_root_login_source"] = rootLoginResult.Source
 	state["password_auth_source"] = passwordAuthResult.Source
 
+	// Detect user certificate authority configuration
+	detectUserCA(string(configContent), state)
+
+	// Detect cloud-init settings that override these
+	f.detectCloudInit(string(configContent), state)
+
 	// Check if running as root
 	state["is_root"] = os.Geteuid() == 0
 
@@ -582,6 +644,9 @@ func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[
 	}
 	fmt.Println()
 
+	// User certificate authority
+	displayUserCA(state)
+
 	// Security recommendations
 	fmt.Printf("  \033[1;34m%s\033[0m:\n", "Security Recommendations")
 
@@ -847,23 +912,3 @@ func (f *Feature) enablePasswordAuth(config string) string {
 func (f *Feature) disablePasswordAuth(config string) string {
 	return f.configurePasswordAuth(config, false)
 }
-
-// restartSSHService restarts the SSH service
-func (f *Feature) restartSSHService(ctx *features.ExecutionContext) error {
-	ctx.Logger.Info("Restarting SSH service")
-
-	// Get restart command based on OS
-	restartCmd := osdetect.GetServiceRestartCommand("ssh", f.osInfo)
-	if restartCmd == "" {
-		return fmt.Errorf("failed to determine SSH service restart command")
-	}
-
-	// Execute restart command
-	cmd := exec.Command("sh", "-c", restartCmd)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to restart SSH service: %w", err)
-	}
-
-	ctx.Logger.Success("SSH service restarted")
-	return nil
-}
@@ -1,6 +1,8 @@
 package security
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/teomyth/iniq/internal/features"
@@ -100,6 +102,21 @@ func TestShouldActivate(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name: "With cloud-init-config only",
+			options: map[string]any{
+				"cloud-init-config": true,
+			},
+			expected: true,
+		},
+		{
+			name: "With cloud-init-config but skip-sudo true",
+			options: map[string]any{
+				"cloud-init-config": true,
+				"skip-sudo":         true,
+			},
+			expected: false,
+		},
 	}
 
 	// Run tests
@@ -291,6 +308,28 @@ func TestExecute(t *testing.T) {
 	}
 }
 
+func TestExecuteCloudInitOnly(t *testing.T) {
+	osInfo, _ := osdetect.Detect()
+	feature := New(osInfo)
+
+	// Without SSH setting changes, cloud-init is still aligned instead of returning early
+	var output bytes.Buffer
+	log := logger.New(false, false)
+	log.SetOutput(&output)
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{"cloud-init-config": true},
+		Logger:  log,
+		DryRun:  true,
+	}
+
+	if err := feature.Execute(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), "Would make cloud-init keep these settings") {
+		t.Errorf("Expected cloud-init to be aligned, got:\n%s", output.String())
+	}
+}
+
 func TestDisableRootLogin(t *testing.T) {
 	// Test the disableRootLogin function
 	osInfo, _ := osdetect.Detect()
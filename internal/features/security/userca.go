@@ -0,0 +1,315 @@
+package security
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	sshfeature "github.com/teomyth/iniq/internal/features/ssh"
+	"github.com/teomyth/iniq/internal/sshdconfig"
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// userCAKeysFile is the file name of the installed user CA keys, relative to the SSH config directory
+	userCAKeysFile = "trusted_user_ca_keys"
+
+	// principalsDir is the directory of per-user principals files, relative to the SSH config directory
+	principalsDir = "auth_principals"
+
+	// passwdFile lists the local users
+	passwdFile = "/etc/passwd"
+)
+
+// userCAConfig is the user certificate authority configuration to apply
+type userCAConfig struct {
+	// Source is the key source the CA keys were fetched from
+	Source string
+
+	// Keys are the CA public keys
+	Keys []*sshkeys.Key
+
+	// Principals maps usernames to the certificate principals they accept
+	Principals map[string][]string
+}
+
+// resolveUserCA fetches the user CA keys configured in the options.
+// It returns nil if no user CA is configured.
+func resolveUserCA(ctx *features.ExecutionContext) (*userCAConfig, error) {
+	source, _ := ctx.Options["ssh-user-ca"].(string)
+	if source == "" {
+		return nil, nil
+	}
+
+	ctx.Logger.Info("Fetching SSH user CA key from %s", source)
+	keys, err := sshfeature.FetchKeySource(ctx.Options, source)
+	if err != nil {
+		// The fetcher already retried with backoff
+		return nil, features.NotRetryable(fmt.Errorf("failed to fetch SSH user CA key: %w", err))
+	}
+
+	// Honour fingerprint pins on the CA source, the CA can sign any identity
+	if _, pins := sshkeys.SplitPins(source); len(pins) > 0 {
+		pinned, _, _ := sshkeys.FilterPinned(keys, pins)
+		if len(pinned) == 0 {
+			return nil, fmt.Errorf("no SSH user CA key from %s matches the pinned fingerprints", source)
+		}
+		keys = pinned
+	}
+
+	return &userCAConfig{
+		Source:     source,
+		Keys:       sshkeys.UniqueKeys(keys),
+		Principals: principalsFromOptions(ctx.Options),
+	}, nil
+}
+
+// principalsFromOptions returns the per-user principals from the ssh-user-ca-principals option.
+// Config files produce either a nested map or flattened "ssh-user-ca-principals.<user>" keys.
+func principalsFromOptions(options map[string]any) map[string][]string {
+	const prefix = "ssh-user-ca-principals"
+	principals := make(map[string][]string)
+
+	switch v := options[prefix].(type) {
+	case map[string][]string:
+		for user, list := range v {
+			principals[user] = list
+		}
+	case map[string]any:
+		for user, list := range v {
+			principals[user] = toStringList(list)
+		}
+	}
+
+	for key, value := range options {
+		if user, ok := strings.CutPrefix(key, prefix+"."); ok && user != "" {
+			principals[user] = toStringList(value)
+		}
+	}
+
+	return principals
+}
+
+// toStringList converts a list or comma-separated string option to a string slice
+func toStringList(value any) []string {
+	var list []string
+	switch v := value.(type) {
+	case []string:
+		list = v
+	case []any:
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+	case string:
+		list = strings.Split(v, ",")
+	}
+
+	var result []string
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// applyUserCA installs the CA keys and principals files and returns the updated sshd config
+func (f *Feature) applyUserCA(ctx *features.ExecutionContext, userCA *userCAConfig, sshConfigFile, config string) (string, []string, error) {
+	sshDir := filepath.Dir(sshConfigFile)
+	caPath := filepath.Join(sshDir, userCAKeysFile)
+	var changes []string
+
+	// Write CA keys
+	ctx.Logger.Step("Installing SSH user CA keys...")
+	var content strings.Builder
+	for _, key := range userCA.Keys {
+		content.WriteString(key.Content + "\n")
+	}
+	if err := safefile.WriteFile(caPath, []byte(content.String()), 0644); err != nil {
+		return config, nil, fmt.Errorf("failed to write SSH user CA keys: %w", err)
+	}
+	config = sshdconfig.Set(config, "TrustedUserCAKeys", caPath)
+	changes = append(changes, "TrustedUserCAKeys "+caPath)
+
+	if len(userCA.Principals) == 0 {
+		return config, changes, nil
+	}
+
+	// Write one principals file per user
+	dir := filepath.Join(sshDir, principalsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return config, nil, fmt.Errorf("failed to create principals directory: %w", err)
+	}
+	for _, user := range sortedUsers(userCA.Principals) {
+		// The username becomes a file name, so it must not leave the directory
+		if user == "" || user == "." || user == ".." || strings.ContainsRune(user, '/') {
+			return config, nil, fmt.Errorf("invalid username in ssh-user-ca-principals: %q", user)
+		}
+		path := filepath.Join(dir, user)
+		data := strings.Join(userCA.Principals[user], "\n") + "\n"
+		if err := safefile.WriteFile(path, []byte(data), 0644); err != nil {
+			return config, nil, fmt.Errorf("failed to write principals for %s: %w", user, err)
+		}
+		ctx.Logger.Info("Principals for %s: %s", user, strings.Join(userCA.Principals[user], ", "))
+	}
+
+	principalsFile := filepath.Join(dir, "%u")
+	config = sshdconfig.Set(config, "AuthorizedPrincipalsFile", principalsFile)
+	changes = append(changes, "AuthorizedPrincipalsFile "+principalsFile)
+	warnMissingPrincipals(ctx, usersWithoutPrincipals(passwdFile, dir, nil))
+
+	return config, changes, nil
+}
+
+// describeUserCA logs the changes a user CA configuration would make
+func describeUserCA(ctx *features.ExecutionContext, userCA *userCAConfig, sshConfigFile string) {
+	for _, key := range userCA.Keys {
+		ctx.Logger.Info("Would trust SSH user CA %s %s", key.Type, key.Fingerprint)
+	}
+	for _, user := range sortedUsers(userCA.Principals) {
+		ctx.Logger.Info("Would allow principals for %s: %s", user, strings.Join(userCA.Principals[user], ", "))
+	}
+	if len(userCA.Principals) > 0 {
+		dir := filepath.Join(filepath.Dir(sshConfigFile), principalsDir)
+		warnMissingPrincipals(ctx, usersWithoutPrincipals(passwdFile, dir, userCA.Principals))
+	}
+}
+
+// warnMissingPrincipals warns about users who lose certificate login to AuthorizedPrincipalsFile
+func warnMissingPrincipals(ctx *features.ExecutionContext, users []string) {
+	for _, user := range users {
+		ctx.Logger.Warning("%s has no principals file and can no longer log in with a certificate, add it to ssh-user-ca-principals to keep certificate login", user)
+	}
+}
+
+// usersWithoutPrincipals returns the local users who can log in but have neither a
+// principals file in dir nor configured principals. AuthorizedPrincipalsFile applies to
+// every user, so certificates no longer match these users by their username.
+func usersWithoutPrincipals(passwdPath, dir string, configured map[string][]string) []string {
+	data, err := os.ReadFile(passwdPath)
+	if err != nil {
+		return nil
+	}
+
+	var users []string
+	for _, line := range strings.Split(string(data), "\n") {
+		// Format: username:x:uid:gid:gecos:home:shell
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 7 || fields[0] == "" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		user, shell := fields[0], filepath.Base(fields[6])
+		uid, err := strconv.Atoi(fields[2])
+		// System accounts and accounts without a login shell cannot log in over SSH
+		if err != nil || (uid != 0 && uid < 1000) || uid == 65534 || shell == "nologin" || shell == "false" {
+			continue
+		}
+		if _, ok := configured[user]; ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, user)); err == nil {
+			continue
+		}
+		users = append(users, user)
+	}
+	return users
+}
+
+// detectUserCA adds the user CA state of an sshd config to the state map
+func detectUserCA(config string, state map[string]any) {
+	state["user_ca_file"] = ""
+	state["user_ca_fingerprints"] = []string{}
+	state["principals_file"] = ""
+	state["user_principals"] = map[string][]string{}
+
+	caFile, ok := sshdconfig.Get(config, "TrustedUserCAKeys")
+	if !ok || caFile == "none" {
+		return
+	}
+	state["user_ca_file"] = caFile
+
+	// Fingerprint the trusted CA keys
+	if data, err := os.ReadFile(caFile); err == nil {
+		var fingerprints []string
+		rest := data
+		for len(rest) > 0 {
+			key, _, _, next, err := ssh.ParseAuthorizedKey(rest)
+			if err != nil {
+				break
+			}
+			fingerprints = append(fingerprints, ssh.FingerprintSHA256(key))
+			rest = next
+		}
+		state["user_ca_fingerprints"] = fingerprints
+	}
+
+	principalsFile, ok := sshdconfig.Get(config, "AuthorizedPrincipalsFile")
+	if !ok || principalsFile == "none" {
+		return
+	}
+	state["principals_file"] = principalsFile
+
+	// Read the principals of every user with a principals file
+	if !strings.Contains(principalsFile, "%u") {
+		return
+	}
+	matches, _ := filepath.Glob(strings.ReplaceAll(principalsFile, "%u", "*"))
+	principals := make(map[string][]string)
+	prefix, suffix, _ := strings.Cut(principalsFile, "%u")
+	for _, match := range matches {
+		user := strings.TrimSuffix(strings.TrimPrefix(match, prefix), suffix)
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				principals[user] = append(principals[user], line)
+			}
+		}
+	}
+	state["user_principals"] = principals
+}
+
+// sortedUsers returns the users of a principals map in a stable order
+func sortedUsers(principals map[string][]string) []string {
+	users := make([]string, 0, len(principals))
+	for user := range principals {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// displayUserCA prints the user CA state
+func displayUserCA(state map[string]any) {
+	caFile, _ := state["user_ca_file"].(string)
+	fingerprints, _ := state["user_ca_fingerprints"].([]string)
+	principalsFile, _ := state["principals_file"].(string)
+	principals, _ := state["user_principals"].(map[string][]string)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "User CA")
+	if caFile == "" {
+		fmt.Printf("\033[90mNot configured\033[0m\n")
+		return
+	}
+	if len(fingerprints) == 0 {
+		fmt.Printf("\033[1;31m✗ No valid keys\033[0m \033[90m(%s)\033[0m\n", caFile)
+		return
+	}
+	fmt.Printf("\033[1;32m✓ %s\033[0m \033[90m(%s)\033[0m\n", strings.Join(fingerprints, ", "), caFile)
+
+	if principalsFile == "" {
+		return
+	}
+	fmt.Printf("  \033[1;34m%s\033[0m: \033[90m(%s)\033[0m\n", "Principals", principalsFile)
+	for _, user := range sortedUsers(principals) {
+		fmt.Printf("    %s: %s\n", user, strings.Join(principals[user], ", "))
+	}
+}
@@ -0,0 +1,158 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/sshkeys"
+)
+
+const testCAKey = `ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGYHQpLNUpHXhzwbKEoRwqnye5XpB4Dh2NFY5BnHy0zY user-ca@example.com`
+
+func TestPrincipalsFromOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  map[string]any
+		expected map[string][]string
+	}{
+		{
+			name:     "Not configured",
+			options:  map[string]any{},
+			expected: map[string][]string{},
+		},
+		{
+			name: "Nested map from config file",
+			options: map[string]any{
+				"ssh-user-ca-principals": map[string]any{
+					"alice": []any{"alice", "ops"},
+				},
+			},
+			expected: map[string][]string{"alice": {"alice", "ops"}},
+		},
+		{
+			name: "Flattened keys",
+			options: map[string]any{
+				"ssh-user-ca-principals.deploy": "deploy, ci",
+			},
+			expected: map[string][]string{"deploy": {"deploy", "ci"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := principalsFromOptions(tt.options)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+			for user, principals := range tt.expected {
+				if strings.Join(result[user], ",") != strings.Join(principals, ",") {
+					t.Errorf("Expected principals %v for %s, got %v", principals, user, result[user])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyAndDetectUserCA(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "security-userca-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	caKey, err := sshkeys.ParseKeyString(testCAKey, sshkeys.File, "test")
+	if err != nil {
+		t.Fatalf("Failed to parse CA key: %v", err)
+	}
+
+	osInfo, _ := osdetect.Detect()
+	feature := New(osInfo)
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{},
+		Logger:  logger.New(false, true),
+	}
+
+	userCA := &userCAConfig{
+		Keys: []*sshkeys.Key{caKey},
+		Principals: map[string][]string{
+			"alice":  {"alice", "ops"},
+			"deploy": {"deploy"},
+		},
+	}
+
+	sshConfigFile := filepath.Join(tempDir, "sshd_config")
+	config, changes, err := feature.applyUserCA(ctx, userCA, sshConfigFile, "Port 22\nMatch User git\n    X11Forwarding no")
+	if err != nil {
+		t.Fatalf("Failed to apply user CA: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("Expected 2 changes, got %v", changes)
+	}
+
+	// Directives must be global, not part of the Match block
+	matchIndex := strings.Index(config, "Match User git")
+	if idx := strings.Index(config, "TrustedUserCAKeys "); idx < 0 || idx > matchIndex {
+		t.Errorf("Expected TrustedUserCAKeys before Match block, got:\n%s", config)
+	}
+	if idx := strings.Index(config, "AuthorizedPrincipalsFile "); idx < 0 || idx > matchIndex {
+		t.Errorf("Expected AuthorizedPrincipalsFile before Match block, got:\n%s", config)
+	}
+
+	state := make(map[string]any)
+	detectUserCA(config, state)
+
+	fingerprints, _ := state["user_ca_fingerprints"].([]string)
+	if len(fingerprints) != 1 || fingerprints[0] != caKey.Fingerprint {
+		t.Errorf("Expected CA fingerprint %s, got %v", caKey.Fingerprint, fingerprints)
+	}
+
+	principals, _ := state["user_principals"].(map[string][]string)
+	if strings.Join(principals["alice"], ",") != "alice,ops" || strings.Join(principals["deploy"], ",") != "deploy" {
+		t.Errorf("Unexpected principals: %v", principals)
+	}
+
+	// Usernames must not escape the principals directory
+	userCA.Principals = map[string][]string{"../evil": {"root"}}
+	if _, _, err := feature.applyUserCA(ctx, userCA, sshConfigFile, ""); err == nil {
+		t.Error("Expected error for invalid username, got none")
+	}
+}
+
+func TestUsersWithoutPrincipals(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "security-userca-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	passwd := filepath.Join(tempDir, "passwd")
+	content := "root:x:0:0:root:/root:/bin/bash\n" +
+		"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\n" +
+		"alice:x:1000:1000::/home/alice:/bin/bash\n" +
+		"bob:x:1001:1001::/home/bob:/bin/zsh\n" +
+		"carol:x:1002:1002::/home/carol:/bin/sh\n" +
+		"svc:x:1003:1003::/srv:/bin/false\n" +
+		"nobody:x:65534:65534:nobody:/nonexistent:/bin/sh\n"
+	if err := os.WriteFile(passwd, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write passwd: %v", err)
+	}
+
+	dir := filepath.Join(tempDir, principalsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create principals directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bob"), []byte("bob\n"), 0644); err != nil {
+		t.Fatalf("Failed to write principals: %v", err)
+	}
+
+	// bob has a file and carol is configured, the system accounts cannot log in
+	users := usersWithoutPrincipals(passwd, dir, map[string][]string{"carol": {"carol"}})
+	if strings.Join(users, ",") != "root,alice" {
+		t.Errorf("Expected root and alice to lose certificate login, got %v", users)
+	}
+}
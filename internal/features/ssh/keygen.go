@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/sshkeys"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// generateUserKey creates ~/.ssh/id_<type> for the user, keeping an existing key pair.
+// The public key and fingerprint are stored in the options for the final summary.
+func (f *Feature) generateUserKey(ctx *features.ExecutionContext, username, homeDir, keyType string) error {
+	name := "id_" + keyType
+	keyPath := filepath.Join(homeDir, ".ssh", name)
+
+	// Skip if dry run
+	if ctx.DryRun {
+		if _, err := os.Lstat(keyPath); err == nil {
+			ctx.Logger.Info("SSH key %s already exists, would keep it", keyPath)
+		} else {
+			ctx.Logger.Info("Would generate %s key pair %s for user '%s'", keyType, keyPath, username)
+		}
+		return nil
+	}
+
+	dir, err := f.openUserSSHDir(username, homeDir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	// Never overwrite an existing key, it may already be registered somewhere
+	if dir.Exists(name + ".pub") {
+		data, err := dir.ReadFile(name + ".pub")
+		if err != nil {
+			return fmt.Errorf("failed to read existing public key: %w", err)
+		}
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse existing public key %s.pub: %w", keyPath, err)
+		}
+		ctx.Logger.Info("SSH key %s already exists, keeping it", keyPath)
+		recordGeneratedKey(ctx, keyPath, publicKey, data)
+		return nil
+	} else if dir.Exists(name) {
+		return features.NotRetryable(fmt.Errorf("private key %s exists without a public key, refusing to replace it", keyPath))
+	}
+
+	passphrase, err := keyPassphrase(ctx, keyPath)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Step("Generating %s key pair for user '%s'...", keyType, username)
+	hostname, _ := os.Hostname()
+	key, err := sshkeys.GenerateKeyWithPassphrase(keyType, username+"@"+hostname, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// Both files are owned by the user
+	if err := dir.WriteFile(name, key.PrivateKey, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := dir.WriteFile(name+".pub", key.AuthorizedKey, 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	ctx.Logger.Success("Generated SSH key %s", keyPath)
+	recordGeneratedKey(ctx, keyPath, key.PublicKey, key.AuthorizedKey)
+	return nil
+}
+
+// passphraseEnv holds the passphrase for generated keys in unattended runs
+const passphraseEnv = "INIQ_KEY_PASSPHRASE"
+
+// keyPassphrase returns the passphrase for a generated key from the INIQ_KEY_PASSPHRASE
+// environment variable or the file named by generate-key-passphrase-file, or prompts for
+// one in interactive mode. An empty passphrase means no encryption. The passphrase itself
+// is never read from the configuration, which is often world-readable or committed.
+func keyPassphrase(ctx *features.ExecutionContext, keyPath string) ([]byte, error) {
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if file := stringOption(ctx.Options, "generate-key-passphrase-file"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		// Editors end the file with a newline that is not part of the passphrase
+		passphrase := strings.TrimRight(string(data), "\r\n")
+		if passphrase == "" {
+			return nil, fmt.Errorf("passphrase file %s is empty", file)
+		}
+		return []byte(passphrase), nil
+	}
+	if !ctx.Interactive || !term.IsTerminal(int(syscall.Stdin)) {
+		return nil, nil
+	}
+
+	fmt.Printf("Enter passphrase for %s (empty for no passphrase): ", keyPath)
+	passphrase, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	fmt.Println() // Add newline after passphrase input
+	if len(passphrase) == 0 {
+		return nil, nil
+	}
+
+	fmt.Print("Confirm passphrase: ")
+	confirm, err := term.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read confirmation passphrase: %w", err)
+	}
+	fmt.Println() // Add newline after passphrase input
+
+	if string(passphrase) != string(confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// recordGeneratedKey stores a generated key in the options so it can be shown at the end of the run
+func recordGeneratedKey(ctx *features.ExecutionContext, keyPath string, publicKey ssh.PublicKey, authorizedKey []byte) {
+	ctx.Options["generated-key-path"] = keyPath
+	ctx.Options["generated-key-fingerprint"] = ssh.FingerprintSHA256(publicKey)
+	ctx.Options["generated-key-public"] = string(authorizedKey)
+}
@@ -0,0 +1,111 @@
+package ssh
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateUserKey(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-keygen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("Failed to get current user: %v", err)
+	}
+
+	t.Setenv(passphraseEnv, "secret")
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{},
+		Logger:  logger.New(false, true),
+	}
+	// Use the temp dir as a fake root containing the user's home
+	homeDir := filepath.Join("/home", currentUser.Username)
+	if err := os.MkdirAll(filepath.Join(tempDir, homeDir), 0755); err != nil {
+		t.Fatalf("Failed to create home dir: %v", err)
+	}
+	feature := New(nil)
+	feature.root = tempDir
+
+	if err := feature.generateUserKey(ctx, currentUser.Username, homeDir, "ed25519"); err != nil {
+		t.Fatalf("generateUserKey failed: %v", err)
+	}
+
+	keyPath := filepath.Join(tempDir, homeDir, ".ssh", "id_ed25519")
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("Private key not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected private key mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// The private key is protected by the passphrase from the environment
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read private key: %v", err)
+	}
+	if _, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte("secret")); err != nil {
+		t.Errorf("Failed to decrypt private key: %v", err)
+	}
+
+	fingerprint, _ := ctx.Options["generated-key-fingerprint"].(string)
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		t.Errorf("Expected generated key fingerprint, got %q", fingerprint)
+	}
+	publicKey, _ := ctx.Options["generated-key-public"].(string)
+
+	// A second run keeps the existing key
+	ctx.Options = map[string]any{}
+	if err := feature.generateUserKey(ctx, currentUser.Username, homeDir, "ed25519"); err != nil {
+		t.Fatalf("generateUserKey failed on existing key: %v", err)
+	}
+	if ctx.Options["generated-key-public"] != publicKey {
+		t.Error("Expected existing key to be kept")
+	}
+}
+
+func TestKeyPassphrase(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-keygen-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	passphraseFile := filepath.Join(tempDir, "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write passphrase file: %v", err)
+	}
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{"generate-key-passphrase-file": passphraseFile},
+		Logger:  logger.New(false, true),
+	}
+
+	passphrase, err := keyPassphrase(ctx, "id_ed25519")
+	if err != nil || string(passphrase) != "from file" {
+		t.Errorf("Expected passphrase from file, got %q, %v", passphrase, err)
+	}
+
+	// The environment variable takes precedence over the file
+	t.Setenv(passphraseEnv, "from env")
+	passphrase, err = keyPassphrase(ctx, "id_ed25519")
+	if err != nil || string(passphrase) != "from env" {
+		t.Errorf("Expected passphrase from environment, got %q, %v", passphrase, err)
+	}
+
+	// A passphrase in the configuration is refused
+	feature := New(nil)
+	if err := feature.ValidateOptions(map[string]any{"generate-key": "ed25519", "generate-key-passphrase": "secret"}); err == nil {
+		t.Error("Expected error for passphrase in configuration, got none")
+	}
+}
@@ -6,23 +6,29 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/teomyth/iniq/internal/features"
 	"github.com/teomyth/iniq/internal/utils"
 	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
 	"github.com/teomyth/iniq/pkg/sshkeys"
 )
 
 // Feature implements the SSH key management feature
 type Feature struct {
 	osInfo *osdetect.Info
+
+	// root is prepended to home directory paths, it is only changed by tests
+	root string
 }
 
 // New creates a new SSH key management feature
 func New(osInfo *osdetect.Info) *Feature {
 	return &Feature{
 		osInfo: osInfo,
+		root:   "/",
 	}
 }
 
@@ -42,10 +48,24 @@ func (f *Feature) Flags() []features.Flag {
 		{
 			Name:      "key",
 			Shorthand: "k",
-			Usage:     "SSH key sources (github:user, gitlab:user, url:URL, file:path)",
+			Usage:     "SSH key sources (github:user, gh-team:org/team, gitlab:user, url:URL, file:path)",
 			Default:   []string{},
 			Required:  false,
 		},
+		{
+			Name:      "keys-exclusive",
+			Shorthand: "",
+			Usage:     "replace authorized_keys with exactly the keys from the given sources",
+			Default:   false,
+			Required:  false,
+		},
+		{
+			Name:      "generate-key",
+			Shorthand: "",
+			Usage:     "generate an SSH key pair for the user (ed25519 or rsa)",
+			Default:   "",
+			Required:  false,
+		},
 	}
 }
 
@@ -57,6 +77,11 @@ func (f *Feature) ShouldActivate(options map[string]any) bool {
 		return true
 	}
 
+	// Activate when a key pair should be generated for the user
+	if stringOption(options, "generate-key") != "" {
+		return true
+	}
+
 	// Otherwise, it will only be activated if the SSH key is provided
 	keys, ok := options["keys"].([]string)
 	return ok && len(keys) > 0
@@ -64,6 +89,18 @@ func (f *Feature) ShouldActivate(options map[string]any) bool {
 
 // ValidateOptions validates the feature options
 func (f *Feature) ValidateOptions(options map[string]any) error {
+	// Check if the key type to generate is supported
+	switch keyType := stringOption(options, "generate-key"); keyType {
+	case "", sshkeys.KeyTypeED25519, sshkeys.KeyTypeRSA:
+	default:
+		return fmt.Errorf("invalid key type for --generate-key: %s (supported: ed25519, rsa)", keyType)
+	}
+
+	// A passphrase in the configuration would sit next to the key it protects in plaintext
+	if stringOption(options, "generate-key-passphrase") != "" {
+		return fmt.Errorf("generate-key-passphrase is not read from the configuration, set %s or generate-key-passphrase-file instead", passphraseEnv)
+	}
+
 	// Check if keys are valid
 	keys, ok := options["keys"].([]string)
 	if !ok {
@@ -82,79 +119,76 @@ func (f *Feature) ValidateOptions(options map[string]any) error {
 
 // Execute executes the feature functionality
 func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	if err := f.importKeys(ctx); err != nil {
+		return err
+	}
+
+	// Generate a key pair for the user if requested
+	keyType := stringOption(ctx.Options, "generate-key")
+	if keyType == "" {
+		return nil
+	}
+	username, err := targetUsername(ctx.Options)
+	if err != nil {
+		return err
+	}
+	homeDir := osdetect.GetUserHomeDir(username, f.osInfo)
+	return f.generateUserKey(ctx, username, homeDir, keyType)
+}
+
+// importKeys installs the keys from the configured key sources into authorized_keys
+func (f *Feature) importKeys(ctx *features.ExecutionContext) error {
+	// Key sources are asked for in the interactive flow, before the feature runs, so a
+	// missing list means only key generation or nothing was requested
 	keys, ok := ctx.Options["keys"].([]string)
 	if !ok || len(keys) == 0 {
-		// If in interactive mode, prompt the user to enter the SSH key
-		if ctx.Interactive {
-			ctx.Logger.Info("SSH Key Management")
-			fmt.Println("Enter SSH key sources:")
-			fmt.Println("  • github:username     - Import keys from GitHub user")
-			fmt.Println("  • gitlab:username     - Import keys from GitLab user")
-			fmt.Println("  • url:https://...     - Import keys from URL")
-			fmt.Println("  • file:/path/to/key   - Import keys from local file")
-			fmt.Println("\nMultiple sources can be separated by semicolons (;)")
-			fmt.Print("Or leave empty to skip: ")
-			var input string
-			_, _ = fmt.Scanln(&input) // Ignore error for user input
-			if input != "" {
-				// parsed input SSH key
-				keyList := strings.Split(input, ";")
-				for _, key := range keyList {
-					keys = append(keys, strings.TrimSpace(key))
-				}
-				ctx.Options["keys"] = keys
-			} else {
-				ctx.Logger.Info("No SSH keys specified, skipping")
-				return nil
-			}
-		} else {
-			ctx.Logger.Info("No SSH keys specified, skipping")
-			return nil
-		}
+		ctx.Logger.Info("No SSH keys specified, skipping")
+		return nil
 	}
 
 	// Get username
-	username, ok := ctx.Options["user"].(string)
-	if !ok || username == "" {
-		// Use real user if not specified (considering sudo environment)
-		currentUser, err := getRealUser()
-		if err != nil {
-			return fmt.Errorf("failed to get current user: %w", err)
-		}
-		username = currentUser.Username
+	username, err := targetUsername(ctx.Options)
+	if err != nil {
+		return err
 	}
 
 	// Get user home directory
 	homeDir := osdetect.GetUserHomeDir(username, f.osInfo)
 
-	// Create .ssh directory if it doesn't exist
-	sshDir := filepath.Join(homeDir, ".ssh")
-	if !ctx.DryRun {
-		if err := os.MkdirAll(sshDir, 0700); err != nil {
-			return fmt.Errorf("failed to create .ssh directory: %w", err)
-		}
-	}
-
 	// Authorized keys file
-	authKeysFile := filepath.Join(sshDir, "authorized_keys")
+	authKeysFile := filepath.Join(homeDir, ".ssh", "authorized_keys")
+
+	// Check if authorized_keys should contain exactly the keys from the given sources
+	exclusive, _ := ctx.Options["keys-exclusive"].(bool)
 
 	// Process each key source
 	var allKeys []*sshkeys.Key
+	var failedSources []string
 	for _, keySource := range keys {
 		sourceKeys, err := f.processKeySource(ctx, keySource)
 		if err != nil {
 			ctx.Logger.Warning("Failed to process key source %s: %v", keySource, err)
+			failedSources = append(failedSources, keySource)
 			continue
 		}
 		allKeys = append(allKeys, sourceKeys...)
 	}
 
+	// Replacing the file after a partial or failed fetch would silently revoke keys, so refuse instead
+	if exclusive && len(failedSources) > 0 {
+		// Key fetches are already retried with backoff per source
+		return features.NotRetryable(fmt.Errorf("refusing to replace authorized_keys exclusively: failed to process key sources: %s", strings.Join(failedSources, ", ")))
+	}
+
 	// Skip if no keys found
 	if len(allKeys) == 0 {
 		ctx.Logger.Warning("No valid SSH keys found")
 		return nil
 	}
 
+	// Remove duplicates across sources, e.g. a user who is also in an imported team
+	allKeys = sshkeys.UniqueKeys(allKeys)
+
 	// Format key information for display
 	var keyLines []string
 	for _, key := range allKeys {
@@ -175,6 +209,8 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 		switch key.Source {
 		case sshkeys.GitHub:
 			sourceDesc = fmt.Sprintf("From GitHub (%s)", key.SourceValue)
+		case sshkeys.GitHubTeam:
+			sourceDesc = fmt.Sprintf("From GitHub team (%s)", key.SourceValue)
 		case sshkeys.GitLab:
 			sourceDesc = fmt.Sprintf("From GitLab (%s)", key.SourceValue)
 		case sshkeys.URL:
@@ -210,61 +246,58 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 
 	// Skip if dry run
 	if ctx.DryRun {
-		ctx.Logger.Info("Would add %d SSH keys to %s", len(allKeys), authKeysFile)
-		return nil
-	}
-
-	// Check if backup option is enabled
-	backupEnabled, hasBackup := ctx.Options["backup"].(bool)
-
-	// Backup existing authorized_keys file if it exists
-	if _, err := os.Stat(authKeysFile); err == nil {
-		backupPath, err := utils.BackupFile(authKeysFile, hasBackup && backupEnabled)
-		if err != nil {
-			return fmt.Errorf("failed to create backup of authorized_keys file: %w", err)
-		}
-		if backupPath != "" {
-			ctx.Logger.Info("Created backup of authorized_keys file: %s", backupPath)
+		if exclusive {
+			ctx.Logger.Info("Would replace %s with %d SSH keys", authKeysFile, len(allKeys))
+		} else {
+			ctx.Logger.Info("Would add %d SSH keys to %s", len(allKeys), authKeysFile)
 		}
+		return nil
 	}
 
-	// First, clean any duplicate keys that might already exist in the file
-	ctx.Logger.Step("Cleaning any duplicate SSH keys...")
-	if err := sshkeys.CleanDuplicateKeys(authKeysFile); err != nil {
-		ctx.Logger.Warning("Failed to clean duplicate keys: %v", err)
-		// Continue anyway, this is not a critical error
+	// Open ~/.ssh without following symlinks, the user controls everything inside it
+	dir, err := f.openUserSSHDir(username, homeDir)
+	if err != nil {
+		return err
 	}
+	defer dir.Close()
 
-	// Write keys to authorized_keys file
-	ctx.Logger.Step("Installing keys for user '%s'...", username)
-	if err := sshkeys.WriteToAuthorizedKeys(authKeysFile, allKeys, true); err != nil {
-		return fmt.Errorf("failed to write keys to authorized_keys: %w", err)
+	existing, err := dir.ReadFile("authorized_keys")
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read authorized_keys file: %w", err)
 	}
 
-	// Set correct permissions
-	if err := os.Chmod(authKeysFile, 0600); err != nil {
-		return fmt.Errorf("failed to set permissions on authorized_keys: %w", err)
+	// Backup existing authorized_keys file if it exists
+	if err == nil {
+		backupEnabled, hasBackup := ctx.Options["backup"].(bool)
+		backupName := filepath.Base(utils.BackupPath(authKeysFile, hasBackup && backupEnabled))
+		if err := dir.WriteFile(backupName, existing, 0600); err != nil {
+			return fmt.Errorf("failed to create backup of authorized_keys file: %w", err)
+		}
+		ctx.Logger.Info("Created backup of authorized_keys file: %s", filepath.Join(dir.Path(), backupName))
 	}
 
-	// Set correct ownership
-	if os.Geteuid() == 0 {
-		// Get user UID and GID
-		u, err := user.Lookup(username)
+	var content []byte
+	if exclusive {
+		// Replace the file so that keys no longer provided by any source are removed
+		ctx.Logger.Step("Replacing authorized keys for user '%s'...", username)
+		content = sshkeys.MergeAuthorizedKeys(nil, allKeys)
+	} else {
+		// First, clean any duplicate keys that might already exist in the file
+		ctx.Logger.Step("Cleaning any duplicate SSH keys...")
+		cleaned, _, err := sshkeys.RemoveDuplicateKeys(existing)
 		if err != nil {
-			return fmt.Errorf("failed to lookup user: %w", err)
+			ctx.Logger.Warning("Failed to clean duplicate keys: %v", err)
+			// Continue anyway, this is not a critical error
+			cleaned = existing
 		}
 
-		// Parse UID and GID
-		uid, _ := fmt.Sscanf(u.Uid, "%d", new(int))
-		gid, _ := fmt.Sscanf(u.Gid, "%d", new(int))
+		ctx.Logger.Step("Installing keys for user '%s'...", username)
+		content = sshkeys.MergeAuthorizedKeys(cleaned, allKeys)
+	}
 
-		// Set ownership
-		if err := os.Chown(sshDir, uid, gid); err != nil {
-			return fmt.Errorf("failed to set ownership of .ssh directory: %w", err)
-		}
-		if err := os.Chown(authKeysFile, uid, gid); err != nil {
-			return fmt.Errorf("failed to set ownership of authorized_keys: %w", err)
-		}
+	// Write keys to authorized_keys file, owned by the user with mode 0600
+	if err := dir.WriteFile("authorized_keys", content, 0600); err != nil {
+		return fmt.Errorf("failed to write keys to authorized_keys: %w", err)
 	}
 
 	ctx.Logger.Success("Keys installed successfully")
@@ -280,6 +313,51 @@ func (f *Feature) Priority() int {
 	return 20 // SSH key import should run after user creation
 }
 
+// openUserSSHDir opens the .ssh directory of a user, creating it if it doesn't exist
+func (f *Feature) openUserSSHDir(username, homeDir string) (*safefile.UserDir, error) {
+	uid, gid, err := lookupOwner(username)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := safefile.OpenUserDir(f.root, homeDir, ".ssh", uid, gid, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open .ssh directory: %w", err)
+	}
+	return dir, nil
+}
+
+// lookupOwner returns the numeric UID and GID of a user
+func lookupOwner(username string) (int, int, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lookup user: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid UID %q for user %s", u.Uid, username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid GID %q for user %s", u.Gid, username)
+	}
+	return uid, gid, nil
+}
+
+// targetUsername returns the user whose keys are managed, defaulting to the real user
+func targetUsername(options map[string]any) (string, error) {
+	if username, ok := options["user"].(string); ok && username != "" {
+		return username, nil
+	}
+
+	// Use real user if not specified (considering sudo environment)
+	currentUser, err := getRealUser()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current user: %w", err)
+	}
+	return currentUser.Username, nil
+}
+
 // getRealUser returns the real user, even when running with sudo
 func getRealUser() (*user.User, error) {
 	// Check if we're running with sudo
@@ -441,32 +519,222 @@ func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[str
 
 // processKeySource processes a key source and returns the keys
 func (f *Feature) processKeySource(ctx *features.ExecutionContext, keySource string) ([]*sshkeys.Key, error) {
+	// Separate fingerprint pins from the source
+	spec, pins := sshkeys.SplitPins(keySource)
+
 	// Parse key source
-	source, value, err := parseKeySource(keySource)
+	source, value, err := parseKeySource(spec)
 	if err != nil {
 		return nil, err
 	}
 
+	// Add pins for this source from the configuration
+	pins = append(pins, configuredPins(ctx.Options, source, value)...)
+
 	ctx.Logger.Info("Processing SSH key source: %s:%s", source, value)
 
+	fetcher, err := newFetcher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get keys based on source
+	keys, err := fetchKeys(fetcher, ctx.Options, source, value)
+	if err != nil || len(pins) == 0 {
+		return keys, err
+	}
+
+	// Only install keys matching the pins, so a compromised account cannot plant keys
+	pinned, unexpected, missing := sshkeys.FilterPinned(keys, pins)
+	for _, key := range unexpected {
+		ctx.Logger.Warning("Ignoring unpinned %s key %s from %s:%s", key.Type, key.Fingerprint, source, value)
+	}
+	for _, pin := range missing {
+		ctx.Logger.Warning("Pinned key %s is no longer offered by %s:%s", pin, source, value)
+	}
+	if len(pinned) == 0 {
+		return nil, fmt.Errorf("no keys from %s:%s match the pinned fingerprints", source, value)
+	}
+
+	return pinned, nil
+}
+
+// FetchKeySource fetches the keys of a key source without applying fingerprint pins.
+// It is used to produce pin lists from a trusted fetch.
+func FetchKeySource(options map[string]any, keySource string) ([]*sshkeys.Key, error) {
+	spec, _ := sshkeys.SplitPins(keySource)
+	if err := validateKeySource(spec); err != nil {
+		return nil, err
+	}
+
+	source, value, err := parseKeySource(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Always fetch live keys when producing pins, never a cached copy
+	fetcher, err := fetcherFromOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchKeys(fetcher, options, source, value)
+}
+
+// fetchKeys fetches the keys of a parsed key source
+func fetchKeys(fetcher *sshkeys.Fetcher, options map[string]any, source, value string) ([]*sshkeys.Key, error) {
 	switch source {
-	case "github", "gh":
-		return sshkeys.FetchFromGitHub(value)
-	case "gitlab", "gl":
-		return sshkeys.FetchFromGitLab(value)
+	case "github":
+		return fetcher.FetchFromGitHub(value)
+	case "github-team":
+		org, team, _ := strings.Cut(value, "/")
+		return fetcher.FetchFromGitHubTeam(org, team, githubToken(options))
+	case "gitlab":
+		return fetcher.FetchFromGitLab(value)
 	case "url":
-		return sshkeys.FetchFromURL(value)
-	case "file":
-		return sshkeys.ReadFromFile(value)
+		return fetcher.FetchFromURL(value)
 	default:
-		// Try as file path if no prefix
-		return sshkeys.ReadFromFile(keySource)
+		return sshkeys.ReadFromFile(value)
 	}
 }
 
+// newFetcher creates a key fetcher that caches responses for offline re-runs
+func newFetcher(ctx *features.ExecutionContext) (*sshkeys.Fetcher, error) {
+	fetcher, err := fetcherFromOptions(ctx.Options)
+	if err != nil {
+		return nil, err
+	}
+	fetcher.Warn = ctx.Logger.Warning
+
+	if noCache, ok := ctx.Options["no-key-cache"].(bool); ok && noCache {
+		return fetcher, nil
+	}
+
+	fetcher.CacheDir = keyCacheDir(ctx.Options)
+	// A dry run may use cached keys but must not modify the cache
+	fetcher.CacheReadOnly = ctx.DryRun
+
+	return fetcher, nil
+}
+
+// fetcherFromOptions creates a key fetcher using the proxy and TLS settings from the options
+func fetcherFromOptions(options map[string]any) (*sshkeys.Fetcher, error) {
+	cfg := sshkeys.TransportConfig{
+		Proxy:      stringOption(options, "key-proxy"),
+		NoProxy:    stringOption(options, "key-no-proxy"),
+		CAFiles:    stringListOption(options, "key-ca-files"),
+		ClientCert: stringOption(options, "key-client-cert"),
+		ClientKey:  stringOption(options, "key-client-key"),
+	}
+
+	fetcher := sshkeys.NewFetcher()
+	client, err := sshkeys.NewHTTPClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key source network settings: %w", err)
+	}
+	fetcher.Client = client
+
+	// Certificate verification can only be disabled for url: sources
+	if insecure, ok := options["insecure-url-keys"].(bool); ok && insecure {
+		cfg.Insecure = true
+		if fetcher.URLClient, err = sshkeys.NewHTTPClient(cfg); err != nil {
+			return nil, fmt.Errorf("invalid key source network settings: %w", err)
+		}
+	}
+
+	// Signed bundles are required for url: sources once allowed signers are configured
+	if path := stringOption(options, "url-keys-allowed-signers"); path != "" {
+		signers, err := sshkeys.ReadAllowedSigners(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(signers) == 0 {
+			return nil, fmt.Errorf("no allowed signers found in %s", path)
+		}
+		fetcher.AllowedSigners = signers
+		fetcher.SignatureNamespace = stringOption(options, "url-keys-signature-namespace")
+	}
+
+	return fetcher, nil
+}
+
+// keyCacheDir returns the directory used to cache fetched keys
+func keyCacheDir(options map[string]any) string {
+	if dir, ok := options["key-cache-dir"].(string); ok && dir != "" {
+		return dir
+	}
+	if os.Geteuid() == 0 {
+		return sshkeys.DefaultCacheDir
+	}
+
+	// Non-root users cannot write to the system cache directory
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "iniq", "keys")
+	}
+	return ""
+}
+
+// configuredPins returns the fingerprint pins configured for a source in the key-pins list
+func configuredPins(options map[string]any, source, value string) []string {
+	var pins []string
+	for _, entry := range stringListOption(options, "key-pins") {
+		spec, entryPins := sshkeys.SplitPins(entry)
+		entrySource, entryValue, err := parseKeySource(spec)
+		if err == nil && entrySource == source && entryValue == value {
+			pins = append(pins, entryPins...)
+		}
+	}
+	return pins
+}
+
+// stringOption returns a string option, or an empty string if it is not set
+func stringOption(options map[string]any, name string) string {
+	value, _ := options[name].(string)
+	return value
+}
+
+// stringListOption returns a list option, which is []any when read from a config file
+func stringListOption(options map[string]any, name string) []string {
+	switch v := options[name].(type) {
+	case []string:
+		return v
+	case []any:
+		var values []string
+		for _, entry := range v {
+			if s, ok := entry.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	}
+	return nil
+}
+
+// githubToken returns the GitHub API token from the configuration or the environment
+func githubToken(options map[string]any) string {
+	if token, ok := options["github-token"].(string); ok && token != "" {
+		return token
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
 // validateKeySource validates a key source
 func validateKeySource(keySource string) error {
+	// Validate fingerprint pins
+	keySource, pins := sshkeys.SplitPins(keySource)
+	for _, pin := range pins {
+		if len(pin) != len("SHA256:")+43 {
+			return fmt.Errorf("invalid fingerprint pin: %s", pin)
+		}
+	}
+
 	// Parse key source
 	source, value, err := parseKeySource(keySource)
 	if err != nil {
@@ -479,6 +747,11 @@ func validateKeySource(keySource string) error {
 		if value == "" {
 			return fmt.Errorf("username is required for %s", source)
 		}
+	case "github-team":
+		org, team, found := strings.Cut(value, "/")
+		if !found || org == "" || team == "" || strings.Contains(team, "/") {
+			return fmt.Errorf("invalid GitHub team: %s (must be org/team)", value)
+		}
 	case "url":
 		if value == "" {
 			return fmt.Errorf("URL is required")
@@ -510,10 +783,12 @@ func parseKeySource(keySource string) (string, string, error) {
 
 		// Validate source
 		switch source {
-		case "github", "gh", "gitlab", "gl", "url", "file", "f":
+		case "github", "gh", "github-team", "gh-team", "gitlab", "gl", "url", "file", "f":
 			// Map short forms to full forms
 			if source == "gh" {
 				source = "github"
+			} else if source == "gh-team" {
+				source = "github-team"
 			} else if source == "gl" {
 				source = "gitlab"
 			} else if source == "f" {
@@ -560,6 +835,8 @@ func displaySSHKeySummary(ctx *features.ExecutionContext, keys []*sshkeys.Key, u
 		switch sshkeys.Source(source) {
 		case sshkeys.GitHub:
 			sourceDesc = fmt.Sprintf("From GitHub (%s):", value)
+		case sshkeys.GitHubTeam:
+			sourceDesc = fmt.Sprintf("From GitHub team (%s):", value)
 		case sshkeys.GitLab:
 			sourceDesc = fmt.Sprintf("From GitLab (%s):", value)
 		case sshkeys.URL:
@@ -1,11 +1,17 @@
 package ssh
 
 import (
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/teomyth/iniq/internal/features"
 	"github.com/teomyth/iniq/internal/logger"
 	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
 )
 
 func TestFeatureInterface(t *testing.T) {
@@ -68,6 +74,13 @@ func TestShouldActivate(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name: "With generate-key",
+			options: map[string]any{
+				"generate-key": "ed25519",
+			},
+			expected: true,
+		},
 	}
 
 	// Run tests
@@ -111,6 +124,34 @@ func TestValidateOptions(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "With valid GitHub team",
+			options: map[string]any{
+				"keys": []string{"gh-team:acme/oncall", "github-team:acme/sre"},
+			},
+			expectError: false,
+		},
+		{
+			name: "With fingerprint pin",
+			options: map[string]any{
+				"keys": []string{"gh:alice#SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"},
+			},
+			expectError: false,
+		},
+		{
+			name: "With truncated fingerprint pin",
+			options: map[string]any{
+				"keys": []string{"gh:alice#SHA256:abc"},
+			},
+			expectError: true,
+		},
+		{
+			name: "With GitHub team missing team name",
+			options: map[string]any{
+				"keys": []string{"gh-team:acme"},
+			},
+			expectError: true,
+		},
 		{
 			name: "With non-slice keys",
 			options: map[string]any{
@@ -118,6 +159,20 @@ func TestValidateOptions(t *testing.T) {
 			},
 			expectError: false, // Will be handled by ShouldActivate
 		},
+		{
+			name: "With generate-key rsa",
+			options: map[string]any{
+				"generate-key": "rsa",
+			},
+			expectError: false,
+		},
+		{
+			name: "With unsupported generate-key type",
+			options: map[string]any{
+				"generate-key": "dsa",
+			},
+			expectError: true,
+		},
 	}
 
 	// Run tests
@@ -172,3 +227,188 @@ func TestExecute(t *testing.T) {
 		}
 	}()
 }
+
+func TestConfiguredPins(t *testing.T) {
+	options := map[string]any{
+		"key-pins": []any{
+			"github:alice#SHA256:one",
+			"gh:alice#SHA256:two,SHA256:three",
+			"gh:bob#SHA256:four",
+			"not-a-source:x#SHA256:five",
+		},
+	}
+
+	pins := configuredPins(options, "github", "alice")
+	expected := []string{"SHA256:one", "SHA256:two", "SHA256:three"}
+	if len(pins) != len(expected) {
+		t.Fatalf("Expected pins %v, got %v", expected, pins)
+	}
+	for i := range expected {
+		if pins[i] != expected[i] {
+			t.Errorf("Expected pin %q, got %q", expected[i], pins[i])
+		}
+	}
+
+	if pins := configuredPins(options, "gitlab", "alice"); len(pins) != 0 {
+		t.Errorf("Expected no pins for gitlab:alice, got %v", pins)
+	}
+}
+
+func TestExecuteFakeRoot(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-ssh-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatalf("Failed to get current user: %v", err)
+	}
+
+	keyFile := filepath.Join(tempDir, "key.pub")
+	keyLine := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGYHQpLNUpHXhzwbKEoRwqnye5XpB4Dh2NFY5BnHy0zY alice@example.com"
+	if err := os.WriteFile(keyFile, []byte(keyLine+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	// The temp dir is a fake root containing the user's home directory
+	root := filepath.Join(tempDir, "root")
+	homeDir := filepath.Join(root, "home", currentUser.Username)
+	if err := os.MkdirAll(homeDir, 0755); err != nil {
+		t.Fatalf("Failed to create home dir: %v", err)
+	}
+
+	osInfo := &osdetect.Info{Type: osdetect.Linux}
+	feature := New(osInfo)
+	feature.root = root
+
+	newContext := func() *features.ExecutionContext {
+		return &features.ExecutionContext{
+			Options: map[string]any{
+				"user": currentUser.Username,
+				"keys": []string{"file:" + keyFile},
+			},
+			Logger: logger.New(false, true),
+		}
+	}
+
+	t.Run("Writes authorized_keys", func(t *testing.T) {
+		if err := feature.Execute(newContext()); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+
+		authKeysFile := filepath.Join(homeDir, ".ssh", "authorized_keys")
+		data, err := os.ReadFile(authKeysFile)
+		if err != nil {
+			t.Fatalf("Failed to read authorized_keys: %v", err)
+		}
+		if strings.TrimSpace(string(data)) != keyLine {
+			t.Errorf("Unexpected authorized_keys content %q", data)
+		}
+
+		info, err := os.Stat(authKeysFile)
+		if err != nil {
+			t.Fatalf("Failed to stat authorized_keys: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected authorized_keys mode 0600, got %o", info.Mode().Perm())
+		}
+
+		info, err = os.Stat(filepath.Join(homeDir, ".ssh"))
+		if err != nil {
+			t.Fatalf("Failed to stat .ssh: %v", err)
+		}
+		if info.Mode().Perm() != 0700 {
+			t.Errorf("Expected .ssh mode 0700, got %o", info.Mode().Perm())
+		}
+	})
+
+	t.Run("Exclusive refuses when every source fails", func(t *testing.T) {
+		ctx := newContext()
+		ctx.Options["keys"] = []string{"file:" + filepath.Join(tempDir, "missing.pub")}
+		ctx.Options["keys-exclusive"] = true
+
+		err := feature.Execute(ctx)
+		if !errors.Is(err, features.ErrNotRetryable) {
+			t.Errorf("Expected a not retryable error, got %v", err)
+		}
+
+		data, _ := os.ReadFile(filepath.Join(homeDir, ".ssh", "authorized_keys"))
+		if strings.TrimSpace(string(data)) != keyLine {
+			t.Errorf("Expected authorized_keys to be kept, got %q", data)
+		}
+	})
+
+	t.Run("Refuses symlinked authorized_keys", func(t *testing.T) {
+		victim := filepath.Join(tempDir, "victim")
+		if err := os.WriteFile(victim, []byte("original\n"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		authKeysFile := filepath.Join(homeDir, ".ssh", "authorized_keys")
+		os.Remove(authKeysFile)
+		if err := os.Symlink(victim, authKeysFile); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		err := feature.Execute(newContext())
+		if !errors.Is(err, safefile.ErrSymlink) {
+			t.Errorf("Expected symlink error, got %v", err)
+		}
+
+		data, _ := os.ReadFile(victim)
+		if string(data) != "original\n" {
+			t.Errorf("Symlink target was modified: %q", data)
+		}
+	})
+
+	t.Run("Refuses symlinked .ssh directory", func(t *testing.T) {
+		elsewhere := filepath.Join(tempDir, "elsewhere")
+		if err := os.Mkdir(elsewhere, 0700); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		os.RemoveAll(filepath.Join(homeDir, ".ssh"))
+		if err := os.Symlink(elsewhere, filepath.Join(homeDir, ".ssh")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+
+		err := feature.Execute(newContext())
+		if !errors.Is(err, safefile.ErrSymlink) {
+			t.Errorf("Expected symlink error, got %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(elsewhere, "authorized_keys")); !os.IsNotExist(err) {
+			t.Error("authorized_keys was written through the symlink")
+		}
+	})
+}
+
+func TestImportKeysWithoutSources(t *testing.T) {
+	// Any read from stdin would pick up this key source
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer reader.Close()
+	if _, err := writer.WriteString("github:someone\n"); err != nil {
+		t.Fatalf("Failed to write to pipe: %v", err)
+	}
+	writer.Close()
+	stdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = stdin }()
+
+	// Only key generation was requested, so key sources are not asked for again
+	feature := New(&osdetect.Info{Type: osdetect.Linux})
+	ctx := &features.ExecutionContext{
+		Options:     map[string]any{"generate-key": "ed25519"},
+		Logger:      logger.New(false, true),
+		Interactive: true,
+	}
+	if err := feature.importKeys(ctx); err != nil {
+		t.Fatalf("importKeys failed: %v", err)
+	}
+	if _, ok := ctx.Options["keys"]; ok {
+		t.Errorf("Expected no key sources to be read, got %v", ctx.Options["keys"])
+	}
+}
@@ -0,0 +1,74 @@
+package sudo
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/internal/sudoers"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// adminGroupFile is the drop-in granting the admin group sudo access when the distribution's policy does not
+const adminGroupFile = "/etc/sudoers.d/01-iniq-admin-group"
+
+// EnsureAdminGroup creates the admin group and a sudoers rule for it when the system has neither,
+// and returns the group. Must run as root.
+func EnsureAdminGroup(log *logger.Logger, osInfo *osdetect.Info, override string) (sudoers.AdminGroup, error) {
+	group, err := sudoers.LocalAdminGroup(osInfo, override)
+	if err != nil {
+		return group, fmt.Errorf("failed to resolve admin group: %w", err)
+	}
+
+	if !group.Exists() {
+		log.Step("Creating group %s...", group.Name)
+		args := groupAddCommand(group.Name, isInstalled)
+		if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return group, fmt.Errorf("failed to create group %s: %s: %w", group.Name, strings.TrimSpace(string(output)), err)
+		}
+	}
+
+	// Without a readable policy there is no way to tell whether a rule is missing
+	if group.PolicyRead && !group.HasRule() {
+		log.Step("Granting group %s sudo access in %s", group.Name, adminGroupFile)
+		if err := installSudoersFile(log, adminGroupFile, renderAdminGroupRule(group.Name)); err != nil {
+			return group, fmt.Errorf("failed to install sudo rule for group %s: %w", group.Name, err)
+		}
+	}
+
+	return group, nil
+}
+
+// GroupAddCommand returns the command creating group on this system
+func GroupAddCommand(group string) []string {
+	return groupAddCommand(group, isInstalled)
+}
+
+// GroupMemberCommand returns the command adding username to group on this system
+func GroupMemberCommand(username, group string) []string {
+	return groupMemberCommand(username, group, isInstalled)
+}
+
+// groupAddCommand returns the command creating group. Alpine and other busybox systems
+// ship addgroup instead of the shadow utilities' groupadd.
+func groupAddCommand(group string, installed func(string) bool) []string {
+	if !installed("groupadd") && installed("addgroup") {
+		return []string{"addgroup", group}
+	}
+	return []string{"groupadd", "-f", group}
+}
+
+// groupMemberCommand returns the command adding username to group, using busybox adduser
+// where usermod is missing
+func groupMemberCommand(username, group string, installed func(string) bool) []string {
+	if !installed("usermod") && installed("adduser") {
+		return []string{"adduser", username, group}
+	}
+	return []string{"usermod", "-aG", group, username}
+}
+
+// renderAdminGroupRule returns the content of the admin group drop-in
+func renderAdminGroupRule(group string) string {
+	return fmt.Sprintf("# Managed by INIQ, changes will be overwritten\n%%%s ALL=(ALL:ALL) ALL\n", group)
+}
@@ -0,0 +1,79 @@
+package sudo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/sudoers"
+)
+
+func TestRenderAdminGroupRule(t *testing.T) {
+	for _, group := range []string{"sudo", "wheel", "ops"} {
+		t.Run(group, func(t *testing.T) {
+			policy, err := sudoers.Parse(adminGroupFile, renderAdminGroupRule(group))
+			if err != nil {
+				t.Fatalf("Rendered rule does not parse: %v", err)
+			}
+
+			rule := policy.GroupRule(group, "")
+			if rule == nil || rule.NoPasswd() {
+				t.Errorf("Expected password-protected rule for %s, got %+v", group, rule)
+			}
+			if other := policy.GroupRule("users", ""); other != nil {
+				t.Errorf("Expected no rule for other groups, got %+v", other)
+			}
+		})
+	}
+}
+
+func TestGroupAddCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed []string
+		expected  []string
+	}{
+		{"shadow utilities", []string{"groupadd", "addgroup"}, []string{"groupadd", "-f", "wheel"}},
+		{"busybox", []string{"addgroup"}, []string{"addgroup", "wheel"}},
+		{"neither", nil, []string{"groupadd", "-f", "wheel"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if args := groupAddCommand("wheel", installedPrograms(tt.installed)); !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, args)
+			}
+		})
+	}
+}
+
+func TestGroupMemberCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed []string
+		expected  []string
+	}{
+		{"shadow utilities", []string{"usermod", "adduser"}, []string{"usermod", "-aG", "wheel", "deploy"}},
+		{"busybox", []string{"adduser"}, []string{"adduser", "deploy", "wheel"}},
+		{"neither", nil, []string{"usermod", "-aG", "wheel", "deploy"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if args := groupMemberCommand("deploy", "wheel", installedPrograms(tt.installed)); !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, args)
+			}
+		})
+	}
+}
+
+// installedPrograms returns an isInstalled replacement reporting only programs as installed
+func installedPrograms(programs []string) func(string) bool {
+	return func(program string) bool {
+		for _, p := range programs {
+			if p == program {
+				return true
+			}
+		}
+		return false
+	}
+}
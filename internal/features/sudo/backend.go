@@ -0,0 +1,59 @@
+package sudo
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/teomyth/iniq/internal/features"
+)
+
+// backend grants and reports administrator privileges through a privilege escalation tool
+type backend interface {
+	// Name returns the name of the tool, such as sudo or doas
+	Name() string
+
+	// Validate checks that the requested grant can be expressed in the tool's configuration
+	Validate(options map[string]any, rules []commandRule) error
+
+	// Detect adds the user's privileges to the feature state
+	Detect(ctx *features.ExecutionContext, username string, state map[string]any)
+
+	// UpToDate reports whether the user already has the requested grant
+	UpToDate(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule, state map[string]any) bool
+
+	// Configure grants the user privileges
+	Configure(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule) error
+}
+
+// selectBackend returns the name of the backend to use. An empty or "auto" choice picks sudo
+// when it is installed and doas when only doas is, so existing sudo setups keep working.
+func selectBackend(choice string, installed func(string) bool) (string, error) {
+	switch choice {
+	case "sudo", "doas":
+		return choice, nil
+	case "", "auto":
+		if !installed("sudo") && installed("doas") {
+			return "doas", nil
+		}
+		return "sudo", nil
+	}
+	return "", fmt.Errorf("invalid privilege-backend %q: must be auto, sudo or doas", choice)
+}
+
+// backend returns the privilege backend selected by the privilege-backend option
+func (f *Feature) backend(options map[string]any) (backend, error) {
+	name, err := selectBackend(stringValue(options["privilege-backend"]), isInstalled)
+	if err != nil {
+		return nil, err
+	}
+	if name == "doas" {
+		return &doasBackend{f: f, file: doasConfigFile, dir: doasConfigDir}, nil
+	}
+	return &sudoBackend{f: f}, nil
+}
+
+// isInstalled reports whether a program is in the PATH
+func isInstalled(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
@@ -0,0 +1,176 @@
+package sudo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sudoers"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+// defaultsFile is the drop-in holding the managed sudo Defaults. The 00- prefix makes
+// sudo read it before other drop-ins, so local files can still override a setting.
+const defaultsFile = "/etc/sudoers.d/00-iniq-defaults"
+
+// hardeningDefaults are the sudo Defaults managed by the sudo-defaults option
+type hardeningDefaults struct {
+	Logfile          string
+	TimestampTimeout int
+	PasswdTries      int
+	Lecture          string
+	IOLog            bool
+}
+
+// defaultsFromOptions returns the sudo Defaults from the options, using the built-in values for unset options
+func defaultsFromOptions(options map[string]any) (hardeningDefaults, error) {
+	defaults := hardeningDefaults{
+		Logfile:          "/var/log/sudo.log",
+		TimestampTimeout: 5,
+		PasswdTries:      3,
+		Lecture:          "once",
+		IOLog:            toBool(options["sudo-io-log"]),
+	}
+
+	if logfile := stringValue(options["sudo-logfile"]); logfile != "" {
+		defaults.Logfile = logfile
+	}
+	if lecture := stringValue(options["sudo-lecture"]); lecture != "" {
+		defaults.Lecture = lecture
+	}
+
+	var err error
+	if defaults.TimestampTimeout, err = intOption(options, "sudo-timestamp-timeout", defaults.TimestampTimeout); err != nil {
+		return defaults, err
+	}
+	if defaults.PasswdTries, err = intOption(options, "sudo-passwd-tries", defaults.PasswdTries); err != nil {
+		return defaults, err
+	}
+
+	if !filepath.IsAbs(defaults.Logfile) || strings.ContainsAny(defaults.Logfile, "\"\\ \t\n,") {
+		return defaults, fmt.Errorf("invalid sudo-logfile %q: must be an absolute path without spaces, quotes or commas", defaults.Logfile)
+	}
+	if defaults.TimestampTimeout < 0 {
+		return defaults, fmt.Errorf("invalid sudo-timestamp-timeout %d: must not be negative", defaults.TimestampTimeout)
+	}
+	if defaults.PasswdTries < 1 {
+		return defaults, fmt.Errorf("invalid sudo-passwd-tries %d: must be at least 1", defaults.PasswdTries)
+	}
+	switch defaults.Lecture {
+	case "always", "once", "never":
+	default:
+		return defaults, fmt.Errorf("invalid sudo-lecture %q: must be always, once or never", defaults.Lecture)
+	}
+
+	return defaults, nil
+}
+
+// intOption returns an integer option, which config files and environment variables may give as a string
+func intOption(options map[string]any, name string, fallback int) (int, error) {
+	switch v := options[name].(type) {
+	case nil:
+		return fallback, nil
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		if v == "" {
+			return fallback, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: must be a number", name, v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid %s: must be a number", name)
+}
+
+// renderDefaults returns the content of the managed Defaults drop-in
+func renderDefaults(defaults hardeningDefaults) string {
+	var content strings.Builder
+	content.WriteString("# Managed by INIQ, changes will be overwritten\n")
+	content.WriteString("Defaults use_pty\n")
+	fmt.Fprintf(&content, "Defaults logfile=\"%s\"\n", defaults.Logfile)
+	fmt.Fprintf(&content, "Defaults timestamp_timeout=%d\n", defaults.TimestampTimeout)
+	fmt.Fprintf(&content, "Defaults passwd_tries=%d\n", defaults.PasswdTries)
+	fmt.Fprintf(&content, "Defaults lecture=%s\n", defaults.Lecture)
+	if defaults.IOLog {
+		content.WriteString("Defaults log_input,log_output\n")
+	}
+	return content.String()
+}
+
+// applyDefaults installs the managed Defaults drop-in. The file is validated with
+// visudo before it is installed, so a bad setting never reaches /etc/sudoers.d.
+func (f *Feature) applyDefaults(ctx *features.ExecutionContext) error {
+	defaults, err := defaultsFromOptions(ctx.Options)
+	if err != nil {
+		return err
+	}
+	content := renderDefaults(defaults)
+
+	if existing, err := safefile.ReadFile(defaultsFile); err == nil && string(existing) == content {
+		ctx.Logger.Info("Sudo hardening defaults are already up to date")
+		return nil
+	}
+
+	settings := []string{
+		"use_pty: yes",
+		fmt.Sprintf("Log file: %s", defaults.Logfile),
+		fmt.Sprintf("Timestamp timeout: %d minutes", defaults.TimestampTimeout),
+		fmt.Sprintf("Password tries: %d", defaults.PasswdTries),
+		fmt.Sprintf("Lecture: %s", defaults.Lecture),
+		fmt.Sprintf("I/O logging: %s", yesNo(defaults.IOLog)),
+		fmt.Sprintf("Configuration file: %s", defaultsFile),
+	}
+
+	if ctx.DryRun {
+		ctx.Logger.MultiLine("info", "Would install sudo hardening defaults:", settings)
+		return nil
+	}
+	ctx.Logger.MultiLine("info", "Installing sudo hardening defaults:", settings)
+
+	if err := installSudoersFile(ctx.Logger, defaultsFile, content); err != nil {
+		return fmt.Errorf("failed to install sudo defaults: %w", err)
+	}
+
+	ctx.Logger.Success("Sudo hardening defaults installed")
+	return nil
+}
+
+// detectDefaults reports the effective global sudo Defaults managed by INIQ
+func detectDefaults(state map[string]any) {
+	_, err := os.Stat(defaultsFile)
+	state["sudo_defaults_file"] = defaultsFile
+	state["sudo_defaults_installed"] = err == nil
+
+	policy, err := sudoers.Load(sudoers.DefaultPath)
+	if err != nil {
+		return
+	}
+	settings := policy.GlobalDefaults()
+	state["sudo_defaults"] = map[string]string{
+		"use_pty":           settings["use_pty"],
+		"logfile":           settings["logfile"],
+		"timestamp_timeout": settings["timestamp_timeout"],
+		"passwd_tries":      settings["passwd_tries"],
+		"lecture":           settings["lecture"],
+		"log_input":         settings["log_input"],
+		"log_output":        settings["log_output"],
+	}
+}
+
+// yesNo formats a bool for the configuration overview
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,89 @@
+package sudo
+
+import (
+	"testing"
+
+	"github.com/teomyth/iniq/internal/sudoers"
+)
+
+func TestDefaultsFromOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     map[string]any
+		expected    hardeningDefaults
+		expectError bool
+	}{
+		{
+			name:     "Built-in values",
+			options:  map[string]any{},
+			expected: hardeningDefaults{Logfile: "/var/log/sudo.log", TimestampTimeout: 5, PasswdTries: 3, Lecture: "once"},
+		},
+		{
+			name: "Configured values",
+			options: map[string]any{
+				"sudo-logfile":           "/var/log/sudo/sudo.log",
+				"sudo-timestamp-timeout": 0,
+				"sudo-passwd-tries":      "5",
+				"sudo-lecture":           "never",
+				"sudo-io-log":            true,
+			},
+			expected: hardeningDefaults{Logfile: "/var/log/sudo/sudo.log", TimestampTimeout: 0, PasswdTries: 5, Lecture: "never", IOLog: true},
+		},
+		{name: "Relative logfile", options: map[string]any{"sudo-logfile": "sudo.log"}, expectError: true},
+		{name: "Logfile with quote", options: map[string]any{"sudo-logfile": "/var/log/\"sudo"}, expectError: true},
+		{name: "Negative timeout", options: map[string]any{"sudo-timestamp-timeout": -1}, expectError: true},
+		{name: "Non-numeric tries", options: map[string]any{"sudo-passwd-tries": "three"}, expectError: true},
+		{name: "Zero tries", options: map[string]any{"sudo-passwd-tries": 0}, expectError: true},
+		{name: "Invalid lecture", options: map[string]any{"sudo-lecture": "sometimes"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaults, err := defaultsFromOptions(tt.options)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if defaults != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, defaults)
+			}
+		})
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	defaults := hardeningDefaults{Logfile: "/var/log/sudo.log", TimestampTimeout: 5, PasswdTries: 3, Lecture: "once", IOLog: true}
+
+	policy, err := sudoers.Parse(defaultsFile, renderDefaults(defaults))
+	if err != nil {
+		t.Fatalf("Failed to parse rendered defaults: %v", err)
+	}
+
+	expected := map[string]string{
+		"use_pty":           "true",
+		"logfile":           "/var/log/sudo.log",
+		"timestamp_timeout": "5",
+		"passwd_tries":      "3",
+		"lecture":           "once",
+		"log_input":         "true",
+		"log_output":        "true",
+	}
+	settings := policy.GlobalDefaults()
+	for name, value := range expected {
+		if settings[name] != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, settings[name])
+		}
+	}
+
+	// I/O logging is only enabled on request
+	defaults.IOLog = false
+	policy, _ = sudoers.Parse(defaultsFile, renderDefaults(defaults))
+	if _, ok := policy.GlobalDefaults()["log_input"]; ok {
+		t.Error("Expected no log_input without I/O logging")
+	}
+}
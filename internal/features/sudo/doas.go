@@ -0,0 +1,520 @@
+package sudo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/utils"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+const (
+	// doasConfigFile is the main doas configuration
+	doasConfigFile = "/etc/doas.conf"
+
+	// doasConfigDir holds doas drop-ins on systems that support them, such as Alpine
+	doasConfigDir = "/etc/doas.d"
+)
+
+// doasBackend grants privileges through doas rules, in a drop-in when /etc/doas.d exists
+// and otherwise in a managed block of /etc/doas.conf
+type doasBackend struct {
+	f    *Feature
+	file string
+	dir  string
+}
+
+// doasRule is a parsed doas.conf rule
+type doasRule struct {
+	File     string
+	Line     int
+	Permit   bool
+	Options  []string
+	Identity string
+	Target   string
+	Command  string
+	Args     []string
+}
+
+// Source returns the file and line of the rule
+func (r *doasRule) Source() string {
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
+
+// NoPass reports whether the rule lets the user run commands without a password
+func (r *doasRule) NoPass() bool {
+	return slices.Contains(r.Options, "nopass")
+}
+
+// Name returns the name of the tool
+func (b *doasBackend) Name() string {
+	return "doas"
+}
+
+// Validate checks that the requested grant can be expressed in doas.conf
+func (b *doasBackend) Validate(options map[string]any, rules []commandRule) error {
+	if sudoDefaults, _ := options["sudo-defaults"].(bool); sudoDefaults {
+		return fmt.Errorf("sudo-defaults requires the sudo privilege backend")
+	}
+	for i, rule := range rules {
+		if rule.NoExec {
+			return fmt.Errorf("sudo rule %d: noexec is not supported by doas", i+1)
+		}
+		for _, command := range rule.Commands {
+			if strings.HasPrefix(command, "sudoedit") {
+				return fmt.Errorf("sudo rule %d: sudoedit is not supported by doas", i+1)
+			}
+		}
+		for _, runAs := range rule.RunAs {
+			if strings.HasPrefix(runAs, "%") {
+				return fmt.Errorf("sudo rule %d: doas cannot run commands as group %s", i+1, runAs)
+			}
+		}
+	}
+	return nil
+}
+
+// target returns the file holding the user's rules and whether INIQ owns the whole file
+func (b *doasBackend) target(username string) (string, bool) {
+	if info, err := os.Stat(b.dir); err == nil && info.IsDir() {
+		return filepath.Join(b.dir, "iniq-"+username+".conf"), true
+	}
+	return b.file, false
+}
+
+// Detect adds the user's doas privileges to the feature state
+func (b *doasBackend) Detect(ctx *features.ExecutionContext, username string, state map[string]any) {
+	path, _ := b.target(username)
+	state["doas_config"] = path
+	state["in_sudo_group"] = false
+
+	rules, err := b.load()
+	if err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			state["passwordless_sudo_requires_privileges"] = true
+		} else {
+			ctx.Logger.Warning("Failed to read doas configuration: %v", err)
+			state["sudo_check_error"] = err.Error()
+		}
+		state["has_sudo"] = false
+		state["has_passwordless_sudo"] = false
+		return
+	}
+
+	var groups []string
+	if u, err := user.Lookup(username); err == nil {
+		if gids, err := u.GroupIds(); err == nil {
+			for _, gid := range gids {
+				if group, err := user.LookupGroupId(gid); err == nil {
+					groups = append(groups, group.Name)
+				}
+			}
+		}
+	}
+
+	access, restricted := doasAccess(rules, username, groups)
+	state["has_sudo"] = username == "root" || (access != nil && access.Permit)
+	state["has_passwordless_sudo"] = access != nil && access.Permit && access.NoPass()
+	state["doas_restricted_rules"] = restricted
+	state["passwordless_sudo_requires_privileges"] = false
+	if access != nil && access.Permit {
+		state["sudo_source"] = access.Source()
+		state["in_sudo_group"] = strings.HasPrefix(access.Identity, ":")
+	}
+}
+
+// load parses doas.conf followed by the drop-ins in lexical order. Missing files are skipped.
+func (b *doasBackend) load() ([]doasRule, error) {
+	files := []string{b.file}
+	if matches, err := filepath.Glob(filepath.Join(b.dir, "*.conf")); err == nil {
+		slices.Sort(matches)
+		files = append(files, matches...)
+	}
+
+	var rules []doasRule
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		parsed, err := parseDoas(file, string(content))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// doasAccess returns the last rule that decides whether the user may run any command as root,
+// and the number of command-restricted rules that permit the user something
+func doasAccess(rules []doasRule, username string, groups []string) (*doasRule, int) {
+	var access *doasRule
+	restricted := 0
+	for i := range rules {
+		rule := &rules[i]
+		if !doasIdentityMatches(rule.Identity, username, groups) {
+			continue
+		}
+		if rule.Command != "" {
+			if rule.Permit {
+				restricted++
+			}
+			continue
+		}
+		if rule.Target == "" || rule.Target == "root" || rule.Target == "0" {
+			access = rule
+		}
+	}
+	return access, restricted
+}
+
+// doasIdentityMatches reports whether a rule identity, a user name or :group, matches the user
+func doasIdentityMatches(identity, username string, groups []string) bool {
+	if group, ok := strings.CutPrefix(identity, ":"); ok {
+		return slices.Contains(groups, group)
+	}
+	return identity == username
+}
+
+// UpToDate reports whether the user already has the requested doas grant
+func (b *doasBackend) UpToDate(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule, state map[string]any) bool {
+	path, dropIn := b.target(username)
+	if existing, err := safefile.ReadFile(path); err == nil {
+		current := string(existing)
+		if !dropIn {
+			current, _ = managedBlock(current, username)
+		}
+		if current == b.render(username, nopasswd, rules, dropIn) {
+			ctx.Logger.Info("User %s already has the configured doas rules", username)
+			return true
+		}
+	}
+
+	// Access granted outside INIQ, such as a :wheel rule, is left alone
+	hasSudo, _ := state["has_sudo"].(bool)
+	hasPasswordless, _ := state["has_passwordless_sudo"].(bool)
+	if len(rules) == 0 && hasSudo && nopasswd == hasPasswordless {
+		ctx.Logger.Info("User %s already has doas configured", username)
+		return true
+	}
+	return false
+}
+
+// render returns the user's rules as a drop-in or as a managed block of doas.conf
+func (b *doasBackend) render(username string, nopasswd bool, rules []commandRule, dropIn bool) string {
+	content := renderDoas(username, nopasswd, rules)
+	if dropIn {
+		return "# Managed by INIQ, changes will be overwritten\n" + content
+	}
+	return content
+}
+
+// Configure grants the user doas privileges. The new configuration is checked with
+// doas -C before it is installed, so a bad rule never locks out existing users.
+func (b *doasBackend) Configure(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule) error {
+	if b.f.osInfo.Type != osdetect.Linux {
+		return fmt.Errorf("doas is only supported on Linux")
+	}
+	if _, err := user.Lookup(username); err != nil {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	path, dropIn := b.target(username)
+	content := b.render(username, nopasswd, rules, dropIn)
+	if !dropIn {
+		existing, err := b.read(path)
+		if err != nil {
+			return err
+		}
+		content = replaceManagedBlock(existing, username, content)
+	}
+
+	ctx.Logger.MultiLine("info", "Configuring doas with the following settings:", accessSettings("Doas", username, nopasswd, rules, path))
+
+	tempFile, err := writeTempSudoers(content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile)
+
+	ctx.Logger.Step("Validating doas configuration...")
+	if output, err := exec.Command("doas", "-C", tempFile).CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid doas configuration: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	ctx.Logger.Step("Writing doas configuration %s", path)
+	if os.Geteuid() == 0 {
+		backupEnabled, hasBackup := ctx.Options["backup"].(bool)
+		if _, err := os.Stat(path); err == nil {
+			backupPath, err := utils.BackupFile(path, hasBackup && backupEnabled)
+			if err != nil {
+				return fmt.Errorf("failed to create backup of doas configuration: %w", err)
+			}
+			if backupPath != "" {
+				ctx.Logger.Info("Created backup of doas configuration: %s", backupPath)
+			}
+		}
+		if err := safefile.WriteFile(path, []byte(content), 0400); err != nil {
+			return fmt.Errorf("failed to write doas configuration: %w", err)
+		}
+		if err := os.Chmod(path, 0400); err != nil {
+			return fmt.Errorf("failed to set permissions on doas configuration: %w", err)
+		}
+	} else {
+		// Not running as root, the current user must already be allowed to use doas
+		cmd := exec.Command("doas", "install", "-m", "0400", tempFile, path)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to install doas configuration: %w", err)
+		}
+	}
+
+	ctx.Logger.Success("Doas configured successfully")
+	return nil
+}
+
+// read returns the content of a doas configuration file, or an empty string if it does not exist.
+// doas.conf is usually only readable by root, so it is read through doas otherwise.
+func (b *doasBackend) read(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if errors.Is(err, fs.ErrPermission) && os.Geteuid() != 0 {
+		cmd := exec.Command("doas", "cat", path)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		content, err = cmd.Output()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read doas configuration: %w", err)
+	}
+	return string(content), nil
+}
+
+// renderDoas returns the doas rules for a user. Without command rules the user may run
+// any command as any user, otherwise one rule is written per command and target user.
+func renderDoas(username string, nopasswd bool, rules []commandRule) string {
+	if len(rules) == 0 {
+		if nopasswd {
+			return fmt.Sprintf("permit nopass %s\n", username)
+		}
+		return fmt.Sprintf("permit %s\n", username)
+	}
+
+	var content strings.Builder
+	for _, rule := range rules {
+		var options string
+		if rule.NoPasswd {
+			options += "nopass "
+		}
+		if rule.SetEnv {
+			options += "keepenv "
+		}
+		for _, runAs := range rule.RunAs {
+			target := ""
+			if runAs != "ALL" {
+				target = " as " + strings.TrimPrefix(runAs, "#")
+			}
+			for _, command := range rule.Commands {
+				fields := strings.Fields(command)
+				fmt.Fprintf(&content, "permit %s%s%s cmd %s", options, username, target, quoteDoas(fields[0]))
+				if len(fields) > 1 {
+					content.WriteString(" args")
+					for _, arg := range fields[1:] {
+						content.WriteString(" " + quoteDoas(arg))
+					}
+				}
+				content.WriteString("\n")
+			}
+		}
+	}
+	return content.String()
+}
+
+// quoteDoas quotes a doas.conf word if it contains characters the parser treats specially
+func quoteDoas(word string) string {
+	if !strings.ContainsAny(word, "#\"\\{} \t") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
+
+// managedBlockMarkers returns the lines that delimit a user's managed block in doas.conf
+func managedBlockMarkers(username string) (string, string) {
+	return "# BEGIN INIQ " + username + "\n", "# END INIQ " + username + "\n"
+}
+
+// managedBlock returns the content of a user's managed block in doas.conf
+func managedBlock(content, username string) (string, bool) {
+	begin, end := managedBlockMarkers(username)
+	_, rest, found := strings.Cut(content, begin)
+	if !found {
+		return "", false
+	}
+	block, _, found := strings.Cut(rest, end)
+	return block, found
+}
+
+// replaceManagedBlock replaces a user's managed block in doas.conf, or appends it. doas uses
+// the last matching rule, so an appended block takes precedence over earlier rules.
+func replaceManagedBlock(content, username, block string) string {
+	begin, end := managedBlockMarkers(username)
+	if before, rest, found := strings.Cut(content, begin); found {
+		if _, after, found := strings.Cut(rest, end); found {
+			return before + begin + block + end + after
+		}
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + begin + block + end
+}
+
+// parseDoas parses the rules of a doas.conf file
+func parseDoas(name, content string) ([]doasRule, error) {
+	var rules []doasRule
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := lines[i]
+		// A trailing backslash continues the rule on the next line
+		for strings.HasSuffix(line, `\`) && i+1 < len(lines) {
+			i++
+			line = strings.TrimSuffix(line, `\`) + " " + lines[i]
+		}
+
+		words, err := splitDoasWords(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		rule, err := parseDoasRule(words)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNumber, err)
+		}
+		rule.File = name
+		rule.Line = lineNumber
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseDoasRule parses the words of a rule: permit|deny [options] identity [as target] [cmd command [args ...]]
+func parseDoasRule(words []string) (doasRule, error) {
+	var rule doasRule
+	switch words[0] {
+	case "permit":
+		rule.Permit = true
+	case "deny":
+	default:
+		return rule, fmt.Errorf("expected permit or deny, got %q", words[0])
+	}
+
+	i := 1
+options:
+	for ; i < len(words) && rule.Permit; i++ {
+		switch words[i] {
+		case "nopass", "nolog", "persist", "keepenv":
+			rule.Options = append(rule.Options, words[i])
+		case "setenv":
+			// Skip the variable list in braces
+			for i < len(words) && words[i] != "}" {
+				i++
+			}
+			if i == len(words) {
+				return rule, fmt.Errorf("unterminated setenv list")
+			}
+		default:
+			break options
+		}
+	}
+	if i == len(words) {
+		return rule, fmt.Errorf("missing identity")
+	}
+	rule.Identity = words[i]
+	words = words[i+1:]
+
+	if len(words) >= 2 && words[0] == "as" {
+		rule.Target = words[1]
+		words = words[2:]
+	}
+	if len(words) >= 2 && words[0] == "cmd" {
+		rule.Command = words[1]
+		words = words[2:]
+		if len(words) >= 1 && words[0] == "args" {
+			rule.Args = words[1:]
+			words = nil
+		}
+	}
+	if len(words) > 0 {
+		return rule, fmt.Errorf("unexpected %q", words[0])
+	}
+	return rule, nil
+}
+
+// splitDoasWords splits a doas.conf line into words, honoring quotes, escapes and comments
+func splitDoasWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quoted, escaped := false, false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '"':
+			quoted, inWord = !quoted, true
+		case quoted:
+			word.WriteRune(r)
+		case r == '#':
+			if inWord {
+				words = append(words, word.String())
+			}
+			return words, nil
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case r == '{' || r == '}':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			words = append(words, string(r))
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,277 @@
+package sudo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/logger"
+)
+
+func TestSelectBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		choice      string
+		installed   []string
+		expected    string
+		expectError bool
+	}{
+		{name: "Auto with sudo", choice: "auto", installed: []string{"sudo"}, expected: "sudo"},
+		{name: "Auto with both", choice: "", installed: []string{"sudo", "doas"}, expected: "sudo"},
+		{name: "Auto with doas only", choice: "auto", installed: []string{"doas"}, expected: "doas"},
+		{name: "Auto with neither", choice: "", expected: "sudo"},
+		{name: "Explicit doas", choice: "doas", installed: []string{"sudo"}, expected: "doas"},
+		{name: "Invalid", choice: "su", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installed := func(program string) bool {
+				for _, name := range tt.installed {
+					if name == program {
+						return true
+					}
+				}
+				return false
+			}
+
+			name, err := selectBackend(tt.choice, installed)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestRenderDoas(t *testing.T) {
+	tests := []struct {
+		name     string
+		nopasswd bool
+		rules    []commandRule
+		expected string
+	}{
+		{name: "Passwordless", nopasswd: true, expected: "permit nopass deploy\n"},
+		{name: "With password", expected: "permit deploy\n"},
+		{
+			name: "Restricted",
+			rules: []commandRule{
+				{Commands: []string{"/usr/bin/systemctl restart nginx", "/usr/bin/apk"}, RunAs: []string{"root"}, NoPasswd: true},
+				{Commands: []string{"/usr/bin/psql -c #1"}, RunAs: []string{"#70", "ALL"}, SetEnv: true},
+			},
+			expected: "permit nopass deploy as root cmd /usr/bin/systemctl args restart nginx\n" +
+				"permit nopass deploy as root cmd /usr/bin/apk\n" +
+				"permit keepenv deploy as 70 cmd /usr/bin/psql args -c \"#1\"\n" +
+				"permit keepenv deploy cmd /usr/bin/psql args -c \"#1\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := renderDoas("deploy", tt.nopasswd, tt.rules)
+			if content != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, content)
+			}
+
+			// The rendered rules must parse back
+			rules, err := parseDoas("doas.conf", content)
+			if err != nil {
+				t.Fatalf("Rendered rules do not parse: %v", err)
+			}
+			if len(rules) == 0 || rules[0].Identity != "deploy" {
+				t.Errorf("Unexpected parsed rules: %+v", rules)
+			}
+		})
+	}
+}
+
+func TestParseDoas(t *testing.T) {
+	content := `# Alpine default
+permit persist :wheel
+permit nopass keepenv setenv { PATH HOME=/root } deploy as root
+deny deploy as root cmd /bin/sh # no shells
+permit nopass backup cmd "/usr/bin/rsync" \
+	args --server
+`
+
+	rules, err := parseDoas("/etc/doas.conf", content)
+	if err != nil {
+		t.Fatalf("parseDoas() failed: %v", err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("Expected 4 rules, got %d: %+v", len(rules), rules)
+	}
+
+	if wheel := rules[0]; !wheel.Permit || wheel.Identity != ":wheel" || wheel.NoPass() || wheel.Line != 2 {
+		t.Errorf("Unexpected wheel rule: %+v", wheel)
+	}
+	if deploy := rules[1]; !deploy.NoPass() || deploy.Identity != "deploy" || deploy.Target != "root" || deploy.Command != "" {
+		t.Errorf("Unexpected deploy rule: %+v", deploy)
+	}
+	if deny := rules[2]; deny.Permit || deny.Command != "/bin/sh" {
+		t.Errorf("Unexpected deny rule: %+v", deny)
+	}
+	if backup := rules[3]; backup.Command != "/usr/bin/rsync" || len(backup.Args) != 1 || backup.Args[0] != "--server" || backup.Line != 5 {
+		t.Errorf("Unexpected backup rule: %+v", backup)
+	}
+
+	for _, invalid := range []string{"allow bob", "permit", "permit nopass", "permit bob cmd", "permit \"bob", "permit setenv { A bob"} {
+		if _, err := parseDoas("doas.conf", invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestDoasAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		groups     []string
+		hasAccess  bool
+		nopass     bool
+		restricted int
+	}{
+		{name: "No rules", content: "permit alice"},
+		{name: "User rule", content: "permit nopass bob", hasAccess: true, nopass: true},
+		{name: "Group rule", content: "permit persist :wheel", groups: []string{"bob", "wheel"}, hasAccess: true},
+		{name: "Other group", content: "permit :wheel", groups: []string{"bob"}},
+		{name: "Later deny wins", content: "permit nopass bob\ndeny bob", hasAccess: false},
+		{name: "Other target", content: "permit bob as postgres"},
+		{name: "Restricted only", content: "permit nopass bob cmd /usr/bin/apk\npermit bob cmd /bin/ls", restricted: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseDoas("/etc/doas.conf", tt.content)
+			if err != nil {
+				t.Fatalf("parseDoas() failed: %v", err)
+			}
+			access, restricted := doasAccess(rules, "bob", tt.groups)
+			hasAccess := access != nil && access.Permit
+			if hasAccess != tt.hasAccess {
+				t.Errorf("Expected access %v, got %v", tt.hasAccess, hasAccess)
+			}
+			if hasAccess && access.NoPass() != tt.nopass {
+				t.Errorf("Expected nopass %v, got %v", tt.nopass, access.NoPass())
+			}
+			if restricted != tt.restricted {
+				t.Errorf("Expected %d restricted rules, got %d", tt.restricted, restricted)
+			}
+		})
+	}
+}
+
+func TestReplaceManagedBlock(t *testing.T) {
+	content := "permit :wheel"
+	content = replaceManagedBlock(content, "bob", "permit bob\n")
+	expected := "permit :wheel\n# BEGIN INIQ bob\npermit bob\n# END INIQ bob\n"
+	if content != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, content)
+	}
+
+	content = replaceManagedBlock(content+"permit alice\n", "bob", "permit nopass bob\n")
+	expected = "permit :wheel\n# BEGIN INIQ bob\npermit nopass bob\n# END INIQ bob\npermit alice\n"
+	if content != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, content)
+	}
+
+	if block, found := managedBlock(content, "bob"); !found || block != "permit nopass bob\n" {
+		t.Errorf("Unexpected managed block %q (found %v)", block, found)
+	}
+	if _, found := managedBlock(content, "alice"); found {
+		t.Error("Expected no managed block for alice")
+	}
+}
+
+func TestDoasDetect(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-doas-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dir := filepath.Join(tempDir, "doas.d")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("Failed to create doas.d: %v", err)
+	}
+	files := map[string]string{
+		"doas.conf":             "permit root\n",
+		"doas.d/10-a.conf":      "permit root cmd /bin/ls\n",
+		"doas.d/iniq-root.conf": "permit nopass root\n",
+		"doas.d/ignored":        "deny root\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0400); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	b := &doasBackend{file: filepath.Join(tempDir, "doas.conf"), dir: dir}
+	if path, dropIn := b.target("root"); !dropIn || path != filepath.Join(dir, "iniq-root.conf") {
+		t.Errorf("Expected drop-in target, got %s (%v)", path, dropIn)
+	}
+
+	ctx := &features.ExecutionContext{Options: map[string]any{}, Logger: logger.New(false, false)}
+	state := make(map[string]any)
+	b.Detect(ctx, "root", state)
+	if hasSudo, _ := state["has_sudo"].(bool); !hasSudo {
+		t.Error("Expected root to have access")
+	}
+	if nopass, _ := state["has_passwordless_sudo"].(bool); !nopass {
+		t.Error("Expected the drop-in to make access passwordless")
+	}
+	if source := state["sudo_source"]; source != filepath.Join(dir, "iniq-root.conf")+":1" {
+		t.Errorf("Unexpected source %v", source)
+	}
+	if restricted := state["doas_restricted_rules"]; restricted != 1 {
+		t.Errorf("Expected 1 restricted rule, got %v", restricted)
+	}
+
+	if !b.UpToDate(ctx, "root", true, nil, state) {
+		t.Error("Expected the drop-in to be up to date")
+	}
+
+	// Without a drop-in directory the rules go into doas.conf
+	b.dir = filepath.Join(tempDir, "missing")
+	if path, dropIn := b.target("root"); dropIn || path != b.file {
+		t.Errorf("Expected doas.conf target, got %s (%v)", path, dropIn)
+	}
+}
+
+func TestDoasValidate(t *testing.T) {
+	b := &doasBackend{}
+	tests := []struct {
+		name    string
+		options map[string]any
+		rules   []commandRule
+	}{
+		{name: "Sudo defaults", options: map[string]any{"sudo-defaults": true}},
+		{name: "Noexec", rules: []commandRule{{Commands: []string{"/bin/ls"}, RunAs: []string{"root"}, NoExec: true}}},
+		{name: "Sudoedit", rules: []commandRule{{Commands: []string{"sudoedit /etc/hosts"}, RunAs: []string{"root"}}}},
+		{name: "Group target", rules: []commandRule{{Commands: []string{"/bin/ls"}, RunAs: []string{"%adm"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.options == nil {
+				tt.options = map[string]any{}
+			}
+			if err := b.Validate(tt.options, tt.rules); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+
+	if err := b.Validate(map[string]any{}, []commandRule{{Commands: []string{"/bin/ls"}, RunAs: []string{"root"}}}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
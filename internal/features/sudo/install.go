@@ -0,0 +1,54 @@
+package sudo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+// installSudoersFile validates content with visudo and installs it as a sudoers drop-in
+// with mode 0440. Nothing is written when validation fails, so sudo keeps working.
+func installSudoersFile(log *logger.Logger, path, content string) error {
+	tempFile, err := writeTempSudoers(content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile)
+
+	log.Step("Validating sudoers file...")
+	if output, err := privileged("visudo", "-c", "-f", tempFile).CombinedOutput(); err != nil {
+		return fmt.Errorf("invalid sudoers file: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	log.Step("Creating sudoers file %s", path)
+	if err := privileged("mkdir", "-p", filepath.Dir(path)).Run(); err != nil {
+		return fmt.Errorf("failed to create sudoers.d directory: %w", err)
+	}
+	if os.Geteuid() == 0 {
+		if err := safefile.WriteFile(path, []byte(content), 0440); err != nil {
+			return fmt.Errorf("failed to write sudoers file: %w", err)
+		}
+		if err := os.Chmod(path, 0440); err != nil {
+			return fmt.Errorf("failed to set permissions on sudoers file: %w", err)
+		}
+	} else if err := privileged("install", "-m", "0440", tempFile, path).Run(); err != nil {
+		return fmt.Errorf("failed to install sudoers file: %w", err)
+	}
+
+	return nil
+}
+
+// privileged returns a command that runs through sudo when not running as root
+func privileged(name string, args ...string) *exec.Cmd {
+	if os.Geteuid() == 0 {
+		return exec.Command(name, args...)
+	}
+	cmd := exec.Command("sudo", append([]string{name}, args...)...)
+	cmd.Stdin = os.Stdin
+	return cmd
+}
@@ -0,0 +1,252 @@
+package sudo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// commandRule is a command-restricted sudo grant from the sudo-rules option
+type commandRule struct {
+	Alias    string
+	Commands []string
+	RunAs    []string
+	NoPasswd bool
+	SetEnv   bool
+	NoExec   bool
+}
+
+var (
+	// aliasPattern matches valid sudoers alias names
+	aliasPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+	// runAsPattern matches user names, %groups, #uids and ALL in a runas list
+	runAsPattern = regexp.MustCompile(`^(ALL|#[0-9]+|%?[a-z_][a-z0-9_.-]*\$?)$`)
+)
+
+// rulesFromOptions returns the validated command rules from the sudo-rules option.
+// Config files produce a list of maps with commands, runas, nopasswd, setenv, noexec and alias keys.
+func rulesFromOptions(options map[string]any, username string) ([]commandRule, error) {
+	var entries []any
+	switch v := options["sudo-rules"].(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		entries = v
+	case []map[string]any:
+		for _, entry := range v {
+			entries = append(entries, entry)
+		}
+	default:
+		return nil, fmt.Errorf("sudo-rules must be a list of rules")
+	}
+
+	var rules []commandRule
+	aliases := make(map[string]bool)
+	for i, entry := range entries {
+		fields, ok := toStringMap(entry)
+		if !ok {
+			return nil, fmt.Errorf("sudo rule %d must be a map", i+1)
+		}
+
+		rule := commandRule{
+			Alias:    strings.TrimSpace(stringValue(fields["alias"])),
+			Commands: toStringList(fields["commands"]),
+			RunAs:    toStringList(fields["runas"]),
+			NoPasswd: toBool(fields["nopasswd"]),
+			SetEnv:   toBool(fields["setenv"]),
+			NoExec:   toBool(fields["noexec"]),
+		}
+		if rule.Alias == "" {
+			rule.Alias = defaultAlias(username, i+1)
+		}
+		if len(rule.RunAs) == 0 {
+			rule.RunAs = []string{"root"}
+		}
+
+		if err := validateRule(rule); err != nil {
+			return nil, fmt.Errorf("sudo rule %d: %w", i+1, err)
+		}
+		if aliases[rule.Alias] {
+			return nil, fmt.Errorf("sudo rule %d: duplicate alias %s", i+1, rule.Alias)
+		}
+		aliases[rule.Alias] = true
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// validateRule checks that a rule can be rendered into a valid sudoers line
+func validateRule(rule commandRule) error {
+	if !aliasPattern.MatchString(rule.Alias) || rule.Alias == "ALL" {
+		return fmt.Errorf("invalid alias %q, use uppercase letters, digits and underscores", rule.Alias)
+	}
+	if len(rule.Commands) == 0 {
+		return fmt.Errorf("at least one command is required")
+	}
+	for _, command := range rule.Commands {
+		if strings.IndexFunc(command, unicode.IsControl) >= 0 {
+			return fmt.Errorf("invalid command %q", command)
+		}
+		program, _, _ := strings.Cut(command, " ")
+		if program == "ALL" {
+			return fmt.Errorf("ALL is not a restricted command, use sudo-nopasswd for full access")
+		}
+		if !strings.HasPrefix(program, "/") && program != "sudoedit" {
+			return fmt.Errorf("command %q must be an absolute path", command)
+		}
+	}
+	for _, runAs := range rule.RunAs {
+		if !runAsPattern.MatchString(runAs) {
+			return fmt.Errorf("invalid runas user %q", runAs)
+		}
+	}
+	return nil
+}
+
+// defaultAlias returns the alias name for the nth rule of a user, such as INIQ_DEPLOY_1.
+// Alias names are global in sudoers, so names that only differ in characters an alias
+// cannot hold, such as ci-bot and ci_bot, get a short hash of the username as well.
+func defaultAlias(username string, n int) string {
+	lossless := true
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return unicode.ToUpper(r)
+		}
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		lossless = false
+		return '_'
+	}, username)
+	if !lossless {
+		sum := sha256.Sum256([]byte(username))
+		name += "_" + strings.ToUpper(hex.EncodeToString(sum[:3]))
+	}
+	return fmt.Sprintf("INIQ_%s_%d", name, n)
+}
+
+// renderSudoers returns the content of a user's sudoers drop-in. Without command
+// rules the user gets access to all commands, otherwise only the listed commands.
+func renderSudoers(username string, nopasswd bool, rules []commandRule) string {
+	if len(rules) == 0 {
+		if nopasswd {
+			return fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL\n", username)
+		}
+		return fmt.Sprintf("%s ALL=(ALL) ALL\n", username)
+	}
+
+	var content strings.Builder
+	for _, rule := range rules {
+		commands := make([]string, len(rule.Commands))
+		for i, command := range rule.Commands {
+			commands[i] = escapeCommand(command)
+		}
+		fmt.Fprintf(&content, "Cmnd_Alias %s = %s\n", rule.Alias, strings.Join(commands, ", "))
+	}
+	for _, rule := range rules {
+		fmt.Fprintf(&content, "%s ALL=(%s) %s%s\n", username, strings.Join(rule.RunAs, ", "), ruleTags(rule), rule.Alias)
+	}
+	return content.String()
+}
+
+// ruleTags returns the sudoers tags for a rule, such as "NOPASSWD:SETENV: "
+func ruleTags(rule commandRule) string {
+	var tags []string
+	if rule.NoPasswd {
+		tags = append(tags, "NOPASSWD")
+	}
+	if rule.SetEnv {
+		tags = append(tags, "SETENV")
+	}
+	if rule.NoExec {
+		tags = append(tags, "NOEXEC")
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	return strings.Join(tags, ":") + ": "
+}
+
+// escapeCommand escapes the characters sudoers treats specially in command arguments
+func escapeCommand(command string) string {
+	program, args, hasArgs := strings.Cut(command, " ")
+	if !hasArgs {
+		return program
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `,`, `\,`, `:`, `\:`, `=`, `\=`)
+	return program + " " + replacer.Replace(args)
+}
+
+// describeRules returns one summary line per rule for the configuration overview
+func describeRules(rules []commandRule) []string {
+	var lines []string
+	for _, rule := range rules {
+		password := "password required"
+		if rule.NoPasswd {
+			password = "no password"
+		}
+		lines = append(lines, fmt.Sprintf("Commands as %s (%s): %s", strings.Join(rule.RunAs, ", "), password, strings.Join(rule.Commands, ", ")))
+	}
+	return lines
+}
+
+// toStringMap converts a config map to a map with string keys
+func toStringMap(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		return v, true
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = item
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// toStringList converts a list or a single string option to a string slice
+func toStringList(value any) []string {
+	var list []string
+	switch v := value.(type) {
+	case []string:
+		list = v
+	case []any:
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+	case string:
+		list = []string{v}
+	}
+
+	var result []string
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// toBool converts a bool or string option to a bool
+func toBool(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true" || v == "yes"
+	}
+	return false
+}
+
+// stringValue returns value if it is a string
+func stringValue(value any) string {
+	s, _ := value.(string)
+	return s
+}
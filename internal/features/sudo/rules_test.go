@@ -0,0 +1,168 @@
+package sudo
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/sudoers"
+)
+
+func TestRulesFromOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       any
+		expected    int
+		expectError bool
+	}{
+		{"No rules", nil, 0, false},
+		{"Config rules", []any{
+			map[string]any{"commands": []any{"/usr/bin/systemctl restart app"}, "runas": []any{"app"}, "nopasswd": true},
+			map[string]any{"alias": "LOGS", "commands": "/usr/bin/journalctl"},
+		}, 2, false},
+		{"Not a list", "ALL", 0, true},
+		{"Not a map", []any{"/usr/bin/apt"}, 0, true},
+		{"No commands", []any{map[string]any{"runas": []any{"root"}}}, 0, true},
+		{"Relative command", []any{map[string]any{"commands": []any{"apt update"}}}, 0, true},
+		{"ALL command", []any{map[string]any{"commands": []any{"ALL"}}}, 0, true},
+		{"Newline in command", []any{map[string]any{"commands": []any{"/bin/ls\nbob ALL=(ALL) ALL"}}}, 0, true},
+		{"Invalid runas", []any{map[string]any{"commands": []any{"/bin/ls"}, "runas": []any{"root)"}}}, 0, true},
+		{"Invalid alias", []any{map[string]any{"alias": "logs", "commands": []any{"/bin/ls"}}}, 0, true},
+		{"Duplicate alias", []any{
+			map[string]any{"alias": "LOGS", "commands": []any{"/bin/ls"}},
+			map[string]any{"alias": "LOGS", "commands": []any{"/bin/cat"}},
+		}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := rulesFromOptions(map[string]any{"sudo-rules": tt.rules}, "deploy")
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(rules) != tt.expected {
+				t.Errorf("Expected %d rules, got %d", tt.expected, len(rules))
+			}
+		})
+	}
+}
+
+func TestRenderSudoers(t *testing.T) {
+	rules := []commandRule{
+		{Alias: "INIQ_CI_BOT_1", Commands: []string{"/usr/bin/systemctl restart app", "/usr/bin/env FOO=a,b"}, RunAs: []string{"root", "app"}, NoPasswd: true, SetEnv: true},
+		{Alias: "LOGS", Commands: []string{"/usr/bin/journalctl"}, RunAs: []string{"root"}, NoExec: true},
+	}
+
+	tests := []struct {
+		name     string
+		nopasswd bool
+		rules    []commandRule
+		expected string
+	}{
+		{"Full access", true, nil, "deploy ALL=(ALL) NOPASSWD: ALL\n"},
+		{"Full access with password", false, nil, "deploy ALL=(ALL) ALL\n"},
+		{"Command rules", true, rules, "Cmnd_Alias INIQ_CI_BOT_1 = /usr/bin/systemctl restart app, /usr/bin/env FOO\\=a\\,b\n" +
+			"Cmnd_Alias LOGS = /usr/bin/journalctl\n" +
+			"deploy ALL=(root, app) NOPASSWD:SETENV: INIQ_CI_BOT_1\n" +
+			"deploy ALL=(root) NOEXEC: LOGS\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if content := renderSudoers("deploy", tt.nopasswd, tt.rules); content != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, content)
+			}
+		})
+	}
+}
+
+func TestRenderSudoersRestricted(t *testing.T) {
+	rules := []commandRule{{Alias: "LOGS", Commands: []string{"/usr/bin/journalctl -u app"}, RunAs: []string{"root"}, NoPasswd: true}}
+
+	policy, err := sudoers.Parse("/etc/sudoers.d/deploy", renderSudoers("deploy", true, rules))
+	if err != nil {
+		t.Fatalf("Failed to parse rendered sudoers: %v", err)
+	}
+
+	privileges := policy.Evaluate(sudoers.User{Name: "deploy"})
+	if privileges.HasAll() {
+		t.Error("Expected command rules not to grant all commands")
+	}
+	if len(privileges.Rules) != 1 || !privileges.Rules[0].NoPasswd() {
+		t.Errorf("Expected one NOPASSWD rule, got %+v", privileges.Rules)
+	}
+}
+
+func TestRenderSudoersRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  commandRule
+		runAs []string
+		tags  []string
+	}{
+		{"Single runas", commandRule{Alias: "INIQ_DEPLOY_1", Commands: []string{"/usr/bin/journalctl"}, RunAs: []string{"root"}}, []string{"root"}, nil},
+		{"Runas list", commandRule{Alias: "INIQ_DEPLOY_1", Commands: []string{"/usr/bin/systemctl restart app"}, RunAs: []string{"root", "www-data"}, NoPasswd: true}, []string{"root", "www-data"}, []string{"NOPASSWD"}},
+		{"Runas groups and uids", commandRule{Alias: "INIQ_DEPLOY_1", Commands: []string{"/usr/bin/id"}, RunAs: []string{"%adm", "#1000", "ALL"}}, []string{"%adm", "#1000", "ALL"}, nil},
+		{"All tags", commandRule{Alias: "APP", Commands: []string{"/usr/bin/env FOO=a,b:c", "sudoedit /etc/app.conf"}, RunAs: []string{"app", "root"}, NoPasswd: true, SetEnv: true, NoExec: true}, []string{"app", "root"}, []string{"NOPASSWD", "SETENV", "NOEXEC"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := renderSudoers("deploy", false, []commandRule{tt.rule})
+			policy, err := sudoers.Parse("/etc/sudoers.d/deploy", content)
+			if err != nil {
+				t.Fatalf("Failed to parse rendered sudoers:\n%s\n%v", content, err)
+			}
+
+			commands := policy.Aliases[sudoers.CmndAlias][tt.rule.Alias]
+			if len(commands) != len(tt.rule.Commands) {
+				t.Errorf("Expected %d commands in %s, got %v", len(tt.rule.Commands), tt.rule.Alias, commands)
+			}
+
+			privileges := policy.Evaluate(sudoers.User{Name: "deploy"})
+			if privileges.HasAll() {
+				t.Error("Expected command rules not to grant all commands")
+			}
+			if len(privileges.Rules) != 1 {
+				t.Fatalf("Expected one rule, got %+v", privileges.Rules)
+			}
+			rule := privileges.Rules[0]
+			if rule.Command != tt.rule.Alias {
+				t.Errorf("Expected command %s, got %s", tt.rule.Alias, rule.Command)
+			}
+			if !slices.Equal(rule.RunAsUsers, tt.runAs) {
+				t.Errorf("Expected runas %v, got %v", tt.runAs, rule.RunAsUsers)
+			}
+			if !slices.Equal(rule.Tags, tt.tags) {
+				t.Errorf("Expected tags %v, got %v", tt.tags, rule.Tags)
+			}
+			if rule.NoPasswd() != tt.rule.NoPasswd {
+				t.Errorf("Expected NOPASSWD %v, got %v", tt.rule.NoPasswd, rule.NoPasswd())
+			}
+		})
+	}
+}
+
+func TestDefaultAlias(t *testing.T) {
+	if alias := defaultAlias("deploy", 2); alias != "INIQ_DEPLOY_2" {
+		t.Errorf("Expected INIQ_DEPLOY_2, got %s", alias)
+	}
+
+	// Names that map to the same characters must not share an alias
+	seen := make(map[string]string)
+	for _, username := range []string{"ci-bot.1", "ci_bot_1", "ci.bot-1", "CI_BOT_1", "cibot1"} {
+		alias := defaultAlias(username, 1)
+		if !aliasPattern.MatchString(alias) {
+			t.Errorf("Invalid alias %s for %s", alias, username)
+		}
+		if other, found := seen[alias]; found {
+			t.Errorf("Alias %s is shared by %s and %s", alias, other, username)
+		}
+		seen[alias] = username
+	}
+}
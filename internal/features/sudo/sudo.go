@@ -9,7 +9,9 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/teomyth/iniq/internal/cloudinit"
 	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sudoers"
 	"github.com/teomyth/iniq/internal/utils"
 	"github.com/teomyth/iniq/pkg/osdetect"
 )
@@ -46,6 +48,20 @@ func (f *Feature) Flags() []features.Flag {
 			Default:   true,
 			Required:  false,
 		},
+		{
+			Name:      "sudo-defaults",
+			Shorthand: "",
+			Usage:     "install hardened sudo Defaults (use_pty, logfile, timeouts) in /etc/sudoers.d/00-iniq-defaults",
+			Default:   false,
+			Required:  false,
+		},
+		{
+			Name:      "sudo-io-log",
+			Shorthand: "",
+			Usage:     "enable sudo session I/O logging with the hardened Defaults",
+			Default:   false,
+			Required:  false,
+		},
 		{
 			Name:      "skip-sudo",
 			Shorthand: "S",
@@ -66,6 +82,11 @@ func (f *Feature) ShouldActivate(options map[string]any) bool {
 		return !hasSkipSudo || !skipSudo
 	}
 
+	// Hardening defaults do not need a user
+	if sudoDefaults, _ := options["sudo-defaults"].(bool); sudoDefaults {
+		return !hasSkipSudo || !skipSudo
+	}
+
 	// Otherwise, it will only be activated if the username is provided and sudo is not skipped
 	username, hasUser := options["user"].(string)
 	return hasUser && username != "" && (!hasSkipSudo || !skipSudo)
@@ -73,15 +94,34 @@ func (f *Feature) ShouldActivate(options map[string]any) bool {
 
 // ValidateOptions validates the feature options
 func (f *Feature) ValidateOptions(options map[string]any) error {
+	// Validate command rules and hardening defaults from the config file
+	username, _ := options["user"].(string)
+	rules, err := rulesFromOptions(options, username)
+	if err != nil {
+		return err
+	}
+	priv, err := f.backend(options)
+	if err != nil {
+		return err
+	}
+	if err := priv.Validate(options, rules); err != nil {
+		return err
+	}
+	sudoDefaults, _ := options["sudo-defaults"].(bool)
+	if sudoDefaults {
+		if _, err := defaultsFromOptions(options); err != nil {
+			return err
+		}
+	}
+
 	// In interactive mode, there is no need to verify the user name, as the user will be prompted for input in the Execute method.
 	interactive, hasInteractive := options["interactive"].(bool)
 	if hasInteractive && interactive {
 		return nil
 	}
 
-	// Check if the username is valid
-	username, ok := options["user"].(string)
-	if !ok || username == "" {
+	// Check if the username is valid, hardening defaults alone do not need one
+	if username == "" && !sudoDefaults {
 		return fmt.Errorf("username is required")
 	}
 
@@ -90,9 +130,30 @@ func (f *Feature) ValidateOptions(options map[string]any) error {
 
 // Execute executes the feature functionality
 func (f *Feature) Execute(ctx *features.ExecutionContext) error {
-	username := ctx.Options["user"].(string)
+	username, _ := ctx.Options["user"].(string)
 	nopasswd, hasNopasswd := ctx.Options["sudo-nopasswd"].(bool)
 
+	// Install the hardening defaults before any user grant
+	if sudoDefaults, _ := ctx.Options["sudo-defaults"].(bool); sudoDefaults {
+		if err := f.applyDefaults(ctx); err != nil {
+			return err
+		}
+		if username == "" {
+			return nil
+		}
+	}
+
+	// Command rules restrict the user to the listed commands, each with its own password setting
+	rules, err := rulesFromOptions(ctx.Options, username)
+	if err != nil {
+		return err
+	}
+
+	priv, err := f.backend(ctx.Options)
+	if err != nil {
+		return err
+	}
+
 	// Get current state to check if changes are needed
 	currentState, err := f.DetectCurrentState(ctx)
 	if err != nil {
@@ -107,11 +168,11 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 	}
 
 	// If the sudo-nopasswd option is not specified in interactive mode, prompt the user
-	if ctx.Interactive && !hasNopasswd {
+	if ctx.Interactive && !hasNopasswd && len(rules) == 0 {
 		ctx.Logger.Info("Sudo Configuration")
 
 		// Use the utility function, default value is true (Y)
-		nopasswd = utils.PromptYesNo("Enable passwordless sudo?", true)
+		nopasswd = utils.PromptYesNo(fmt.Sprintf("Enable passwordless %s?", priv.Name()), true)
 		ctx.Options["sudo-nopasswd"] = nopasswd
 	}
 
@@ -121,213 +182,59 @@ func (f *Feature) Execute(ctx *features.ExecutionContext) error {
 		ctx.Options["sudo-nopasswd"] = true
 	}
 
-	// Check current sudo state for idempotency
-	hasSudo, _ := currentState["has_sudo"].(bool)
-	hasPasswordlessSudo, _ := currentState["has_passwordless_sudo"].(bool)
-
 	// Check if configuration is already as desired
-	if hasSudo {
-		if nopasswd && hasPasswordlessSudo {
-			ctx.Logger.Info("User %s already has passwordless sudo configured", username)
-			return nil
-		} else if !nopasswd && !hasPasswordlessSudo {
-			ctx.Logger.Info("User %s already has sudo configured with password requirement", username)
-			return nil
-		}
-		// If we reach here, sudo exists but passwordless setting needs to be changed
-		ctx.Logger.Info("Updating sudo configuration for user %s", username)
+	if priv.UpToDate(ctx, username, nopasswd, rules, currentState) {
+		return nil
 	}
 
+	adminGroup := sudoers.AdminGroupName(f.osInfo, stringValue(ctx.Options["admin-group"]))
+
 	// Skip if dry run
 	if ctx.DryRun {
-		if nopasswd {
-			ctx.Logger.Info("Would configure passwordless sudo for user %s", username)
+		if len(rules) > 0 {
+			ctx.Logger.MultiLine("info", fmt.Sprintf("Would configure restricted %s for user %s:", priv.Name(), username), describeRules(rules))
+			// The user's own file is replaced, so only group membership still grants everything
+			if inGroup, _ := currentState["in_sudo_group"].(bool); inGroup {
+				ctx.Logger.Warning("User %s is in the %s group, which can run all commands, so the restricted rules would have no effect", username, adminGroup)
+			}
+		} else if nopasswd {
+			ctx.Logger.Info("Would configure passwordless %s for user %s", priv.Name(), username)
 		} else {
-			ctx.Logger.Info("Would configure sudo with password for user %s", username)
+			ctx.Logger.Info("Would configure %s with password for user %s", priv.Name(), username)
 		}
 		return nil
 	}
 
-	// Check if running as root
-	if os.Geteuid() != 0 {
-		// Not running as root, need to use sudo
-		ctx.Logger.Warning("Configuring sudo requires root privileges")
-
-		// Check if user was recently added to sudo group but hasn't logged out yet
-		currentUser, err := user.Current()
-		if err == nil && isUserInSudoGroupButNotActive(currentUser.Username) {
-			ctx.Logger.Warning("You were recently added to the sudo group, but this change requires logging out and back in to take effect")
-			ctx.Logger.Info("Please log out and log back in, then run INIQ again")
-			return fmt.Errorf("sudo group membership not yet active; please log out and log back in")
-		}
-
-		ctx.Logger.Info("INIQ will now use sudo to configure sudo permissions")
-		ctx.Logger.Info("You may be prompted for your password")
-
-		// Determine the commands to run based on OS
-		switch f.osInfo.Type {
-		case osdetect.Linux:
-			// Create sudoers.d directory and file
-			sudoersDir := "/etc/sudoers.d"
-			sudoersFile := filepath.Join(sudoersDir, username)
-			var sudoersContent string
-			if nopasswd {
-				sudoersContent = fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL", username)
-			} else {
-				sudoersContent = fmt.Sprintf("%s ALL=(ALL) ALL", username)
-			}
-
-			// Show configuration details
-			passwordRequired := "yes"
-			if nopasswd {
-				passwordRequired = "no"
-			}
-			configLines := []string{
-				fmt.Sprintf("User: %s", username),
-				"Sudo access: ALL commands",
-				fmt.Sprintf("Password required: %s", passwordRequired),
-				fmt.Sprintf("Configuration file: %s", sudoersFile),
-			}
-			ctx.Logger.MultiLine("info", "Configuring sudo with the following settings:", configLines)
-
-			// Step 1: Create sudoers.d directory
-			ctx.Logger.Step("Creating sudoers.d directory...")
-			mkdirCmd := exec.Command("sudo", "mkdir", "-p", sudoersDir)
-			mkdirCmd.Stdin = os.Stdin
-			mkdirCmd.Stdout = os.Stdout
-			mkdirCmd.Stderr = os.Stderr
-			if err := mkdirCmd.Run(); err != nil {
-				// Check if this is likely due to sudo group membership not being active yet
-				if strings.Contains(err.Error(), "not in the sudoers file") ||
-					strings.Contains(err.Error(), "not allowed to execute") {
-					ctx.Logger.Warning("You appear to be in the sudo group, but the membership is not yet active")
-					ctx.Logger.Info("This typically requires logging out and back in to take effect")
-					ctx.Logger.Info("Please log out and log back in, then run INIQ again")
-					return fmt.Errorf("sudo group membership not yet active; please log out and log back in")
-				}
-				return fmt.Errorf("failed to create sudoers.d directory: %w", err)
-			}
-
-			// Step 2: Create temporary sudoers file
-			tempFile := filepath.Join(os.TempDir(), "iniq_sudoers_temp")
-			if err := os.WriteFile(tempFile, []byte(sudoersContent), 0644); err != nil {
-				return fmt.Errorf("failed to create temporary sudoers file: %w", err)
-			}
-			defer os.Remove(tempFile)
-
-			// Step 3: Move file to sudoers.d with sudo
-			ctx.Logger.Step("Creating sudoers file %s", sudoersFile)
-			mvCmd := exec.Command("sudo", "cp", tempFile, sudoersFile)
-			mvCmd.Stdin = os.Stdin
-			mvCmd.Stdout = os.Stdout
-			mvCmd.Stderr = os.Stderr
-			if err := mvCmd.Run(); err != nil {
-				return fmt.Errorf("failed to create sudoers file: %w", err)
-			}
-
-			// Step 4: Set correct permissions
-			chmodCmd := exec.Command("sudo", "chmod", "0440", sudoersFile)
-			chmodCmd.Stdin = os.Stdin
-			chmodCmd.Stdout = os.Stdout
-			chmodCmd.Stderr = os.Stderr
-			if err := chmodCmd.Run(); err != nil {
-				return fmt.Errorf("failed to set permissions on sudoers file: %w", err)
-			}
-
-			// Step 5: Validate sudoers file
-			ctx.Logger.Step("Validating sudoers file...")
-			visudoCmd := exec.Command("sudo", "visudo", "-c", "-f", sudoersFile)
-			visudoCmd.Stdin = os.Stdin
-			visudoCmd.Stdout = os.Stdout
-			visudoCmd.Stderr = os.Stderr
-			if err := visudoCmd.Run(); err != nil {
-				// Remove invalid file
-				rmCmd := exec.Command("sudo", "rm", sudoersFile)
-				_ = rmCmd.Run() // Ignore errors here
-				return fmt.Errorf("invalid sudoers file: %w", err)
-			}
-
-		case osdetect.Darwin:
-			// On macOS, we need to add the user to the admin group
-			ctx.Logger.Step("Adding user to admin group...")
-			adminCmd := exec.Command("sudo", "dseditgroup", "-o", "edit", "-a", username, "-t", "user", "admin")
-			adminCmd.Stdin = os.Stdin
-			adminCmd.Stdout = os.Stdout
-			adminCmd.Stderr = os.Stderr
-			if err := adminCmd.Run(); err != nil {
-				return fmt.Errorf("failed to add user to admin group: %w", err)
-			}
+	if err := priv.Configure(ctx, username, nopasswd, rules); err != nil {
+		return err
+	}
 
-			// For passwordless sudo, we need to modify the sudoers file
-			if nopasswd {
-				sudoersDir := "/etc/sudoers.d"
-				sudoersFile := filepath.Join(sudoersDir, username)
-				sudoersContent := fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL", username)
-
-				// Step 1: Create sudoers.d directory
-				ctx.Logger.Step("Creating sudoers.d directory...")
-				mkdirCmd := exec.Command("sudo", "mkdir", "-p", sudoersDir)
-				mkdirCmd.Stdin = os.Stdin
-				mkdirCmd.Stdout = os.Stdout
-				mkdirCmd.Stderr = os.Stderr
-				if err := mkdirCmd.Run(); err != nil {
-					return fmt.Errorf("failed to create sudoers.d directory: %w", err)
-				}
-
-				// Step 2: Create temporary sudoers file
-				tempFile := filepath.Join(os.TempDir(), "iniq_sudoers_temp")
-				if err := os.WriteFile(tempFile, []byte(sudoersContent), 0644); err != nil {
-					return fmt.Errorf("failed to create temporary sudoers file: %w", err)
-				}
-				defer os.Remove(tempFile)
-
-				// Step 3: Move file to sudoers.d with sudo
-				ctx.Logger.Step("Creating sudoers file %s", sudoersFile)
-				mvCmd := exec.Command("sudo", "cp", tempFile, sudoersFile)
-				mvCmd.Stdin = os.Stdin
-				mvCmd.Stdout = os.Stdout
-				mvCmd.Stderr = os.Stderr
-				if err := mvCmd.Run(); err != nil {
-					return fmt.Errorf("failed to create sudoers file: %w", err)
-				}
-
-				// Step 4: Set correct permissions
-				chmodCmd := exec.Command("sudo", "chmod", "0440", sudoersFile)
-				chmodCmd.Stdin = os.Stdin
-				chmodCmd.Stdout = os.Stdout
-				chmodCmd.Stderr = os.Stderr
-				if err := chmodCmd.Run(); err != nil {
-					return fmt.Errorf("failed to set permissions on sudoers file: %w", err)
-				}
-
-				// Step 5: Validate sudoers file
-				ctx.Logger.Step("Validating sudoers file...")
-				visudoCmd := exec.Command("sudo", "visudo", "-c", "-f", sudoersFile)
-				visudoCmd.Stdin = os.Stdin
-				visudoCmd.Stdout = os.Stdout
-				visudoCmd.Stderr = os.Stderr
-				if err := visudoCmd.Run(); err != nil {
-					// Remove invalid file
-					rmCmd := exec.Command("sudo", "rm", sudoersFile)
-					_ = rmCmd.Run() // Ignore errors here
-					return fmt.Errorf("invalid sudoers file: %w", err)
-				}
-			}
+	// Restricted rules only restrict a user who has no other grant
+	if len(rules) > 0 {
+		state := make(map[string]any)
+		priv.Detect(ctx, username, state)
+		if warning := unrestrictedWarning(priv.Name(), username, adminGroup, state); warning != "" {
+			ctx.Logger.Warning("%s", warning)
 		}
-
-		ctx.Logger.Success("Sudo configured successfully")
-		return nil
 	}
+	return nil
+}
 
-	// Configure sudo based on OS
-	switch f.osInfo.Type {
-	case osdetect.Linux:
-		return f.configureLinuxSudo(ctx, username, nopasswd)
-	case osdetect.Darwin:
-		return f.configureDarwinSudo(ctx, username, nopasswd)
-	default:
-		return fmt.Errorf("unsupported OS: %s", f.osInfo.Type)
+// unrestrictedWarning returns a warning when the detected state shows that the user can
+// still run all commands after restricted rules were installed, or an empty string
+func unrestrictedWarning(tool, username, adminGroup string, state map[string]any) string {
+	if hasAll, _ := state["has_sudo"].(bool); !hasAll {
+		return ""
+	}
+	warning := fmt.Sprintf("User %s can still run all commands with %s", username, tool)
+	if source, _ := state["sudo_source"].(string); source != "" {
+		warning += " through " + source
+	}
+	warning += ", so the restricted rules have no effect"
+	if inGroup, _ := state["in_sudo_group"].(bool); inGroup {
+		warning += fmt.Sprintf(". Remove the user from the %s group to apply them", adminGroup)
 	}
+	return warning
 }
 
 // Priority returns the feature execution priority
@@ -335,6 +242,25 @@ func (f *Feature) Priority() int {
 	return 30 // Sudo configuration should run after user creation and SSH key import
 }
 
+// writeTempSudoers writes sudoers content to a new private temporary file.
+// The file name is unpredictable, so other users cannot plant a symlink in its place.
+func writeTempSudoers(content string) (string, error) {
+	file, err := os.CreateTemp("", "iniq_sudoers_*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary sudoers file: %w", err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to create temporary sudoers file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to create temporary sudoers file: %w", err)
+	}
+	return file.Name(), nil
+}
+
 // getRealUser returns the real user, even when running with sudo
 func getRealUser() (*user.User, error) {
 	// Check if we're running with sudo
@@ -363,50 +289,29 @@ func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string
 		username = currentUser.Username
 	}
 
+	priv, err := f.backend(ctx.Options)
+	if err != nil {
+		return nil, err
+	}
+
 	state["username"] = username
+	state["privilege_backend"] = priv.Name()
+
+	// Global Defaults can only be read as root
+	if os.Geteuid() == 0 && priv.Name() == "sudo" {
+		detectDefaults(state)
+	}
 
 	// Check if user exists
-	_, err := user.Lookup(username)
-	if err != nil {
+	if _, err := user.Lookup(username); err != nil {
 		state["user_exists"] = false
 		return state, nil
 	}
 
 	state["user_exists"] = true
 
-	// Check if user has sudo privileges
-	hasSudo, sudoErr := userHasSudo(username)
-	if sudoErr != nil {
-		ctx.Logger.Warning("Failed to check sudo privileges: %v", sudoErr)
-		state["sudo_check_error"] = sudoErr.Error()
-	}
-	state["has_sudo"] = hasSudo
-
-	// Check if user is in sudo group
-	inSudoGroup, groupErr := isUserInSudoGroup(username)
-	if groupErr != nil {
-		ctx.Logger.Warning("Failed to check sudo group membership: %v", groupErr)
-		state["sudo_group_check_error"] = groupErr.Error()
-	}
-	state["in_sudo_group"] = inSudoGroup
-
-	// Check if sudo is passwordless (requires elevated privileges)
-	hasPasswordlessSudo, passwordlessErr := hasPasswordlessSudoDetailed(username)
-	if passwordlessErr != nil {
-		// Check if this is a permission error
-		if strings.Contains(passwordlessErr.Error(), "permission denied") ||
-			strings.Contains(passwordlessErr.Error(), "not permitted") ||
-			os.IsPermission(passwordlessErr) {
-			state["passwordless_sudo_requires_privileges"] = true
-			state["has_passwordless_sudo"] = false // Default to false when we can't check
-		} else {
-			ctx.Logger.Warning("Failed to check passwordless sudo: %v", passwordlessErr)
-			state["has_passwordless_sudo"] = false
-		}
-	} else {
-		state["has_passwordless_sudo"] = hasPasswordlessSudo
-		state["passwordless_sudo_requires_privileges"] = false
-	}
+	// Check the user's privileges with the selected backend
+	priv.Detect(ctx, username, state)
 
 	// Check if running as root
 	state["is_root"] = os.Geteuid() == 0
@@ -435,12 +340,26 @@ func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[
 	hasSudo, _ := state["has_sudo"].(bool)
 	inSudoGroup, _ := state["in_sudo_group"].(bool)
 	hasPasswordlessSudo, _ := state["has_passwordless_sudo"].(bool)
+	sudoSource, _ := state["sudo_source"].(string)
 	isRoot, _ := state["is_root"].(bool)
 
+	// Labels follow the privilege backend, sudo or doas
+	tool := "Sudo"
+	if backend, _ := state["privilege_backend"].(string); backend == "doas" {
+		tool = "Doas"
+	}
+
 	// Sudo access status
-	fmt.Printf("  \033[1;34m%s\033[0m: ", "Sudo Access")
+	fmt.Printf("  \033[1;34m%s\033[0m: ", tool+" Access")
 	if hasSudo {
-		fmt.Printf("\033[1;32m✓ Enabled\033[0m\n")
+		fmt.Printf("\033[1;32m✓ Enabled\033[0m")
+		if sudoSource != "" {
+			fmt.Printf(" \033[90m(%s)\033[0m", sudoSource)
+		}
+		fmt.Println()
+		if strings.HasPrefix(sudoSource, cloudinit.SudoersFile+":") {
+			fmt.Printf("    \033[90mGranted by cloud-init, which writes this file when an instance is first created\033[0m\n")
+		}
 	} else if inSudoGroup {
 		fmt.Printf("\033[1;33m⚠ In sudo group but not active\033[0m\n")
 		fmt.Printf("    \033[90mYou may need to log out and log back in for sudo privileges to take effect\033[0m\n")
@@ -449,7 +368,7 @@ func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[
 	}
 
 	// Passwordless sudo status
-	fmt.Printf("  \033[1;34m%s\033[0m: ", "Passwordless Sudo")
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Passwordless "+tool)
 	if hasPasswordlessSudo {
 		fmt.Printf("\033[1;32m✓ Enabled\033[0m\n")
 	} else if hasSudo {
@@ -458,12 +377,26 @@ func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[
 		fmt.Printf("\033[1;31m✗ Not configured\033[0m\n")
 	}
 
-	// Sudo group membership status
-	fmt.Printf("  \033[1;34m%s\033[0m: ", "Sudo Group")
-	if inSudoGroup {
-		fmt.Printf("\033[1;32m✓ Member\033[0m\n")
+	// Sudo group membership status, doas has no admin group of its own
+	if doasConfig, ok := state["doas_config"].(string); ok {
+		fmt.Printf("  \033[1;34m%s\033[0m: \033[0;37m%s\033[0m\n", "Doas Config", doasConfig)
 	} else {
-		fmt.Printf("\033[1;31m✗ Not a member\033[0m\n")
+		fmt.Printf("  \033[1;34m%s\033[0m: ", "Sudo Group")
+		if inSudoGroup {
+			fmt.Printf("\033[1;32m✓ Member\033[0m\n")
+		} else {
+			fmt.Printf("\033[1;31m✗ Not a member\033[0m\n")
+		}
+	}
+
+	// Hardening defaults status, only known when running as root
+	if installed, ok := state["sudo_defaults_installed"].(bool); ok {
+		fmt.Printf("  \033[1;34m%s\033[0m: ", "Sudo Defaults")
+		if installed {
+			fmt.Printf("\033[1;32m✓ Managed\033[0m \033[90m(%s)\033[0m\n", defaultsFile)
+		} else {
+			fmt.Printf("\033[1;33m⚠ Not managed\033[0m \033[90m(use --sudo-defaults)\033[0m\n")
+		}
 	}
 
 	// Root status
@@ -494,7 +427,7 @@ func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[str
 }
 
 // userHasSudo checks if a user has sudo privileges
-func userHasSudo(username string) (bool, error) {
+func userHasSudo(username, adminGroup string) (bool, error) {
 	// Check if user is root (always has sudo)
 	if username == "root" {
 		return true, nil
@@ -523,8 +456,15 @@ func userHasSudo(username string) (bool, error) {
 		}
 	}
 
+	// As root the sudoers policy can be evaluated directly
+	if os.Geteuid() == 0 {
+		if privileges, err := sudoers.Check(sudoers.DefaultPath, username); err == nil {
+			return privileges.HasAll(), nil
+		}
+	}
+
 	// Check if user is in sudo group
-	inSudoGroup, err := isUserInSudoGroup(username)
+	inSudoGroup, err := isUserInSudoGroup(username, adminGroup)
 	if err != nil {
 		return false, err
 	}
@@ -532,8 +472,8 @@ func userHasSudo(username string) (bool, error) {
 	return inSudoGroup, nil
 }
 
-// isUserInSudoGroup checks if a user is in the sudo group
-func isUserInSudoGroup(username string) (bool, error) {
+// isUserInSudoGroup checks if a user is in the admin group
+func isUserInSudoGroup(username, adminGroup string) (bool, error) {
 	// Get groups for user
 	cmd := exec.Command("groups", username)
 	output, err := cmd.Output()
@@ -541,10 +481,10 @@ func isUserInSudoGroup(username string) (bool, error) {
 		return false, fmt.Errorf("failed to get groups for user %s: %w", username, err)
 	}
 
-	// Parse output and check for sudo/admin/wheel group
+	// Parse output and check for the admin group
 	groups := strings.Fields(string(output))
 	for _, group := range groups {
-		if group == "sudo" || group == "admin" || group == "wheel" {
+		if group == adminGroup {
 			return true, nil
 		}
 	}
@@ -552,78 +492,24 @@ func isUserInSudoGroup(username string) (bool, error) {
 	return false, nil
 }
 
-// hasPasswordlessSudoDetailed checks if a user has passwordless sudo with detailed error handling
-func hasPasswordlessSudoDetailed(username string) (bool, error) {
+// hasPasswordlessSudoDetailed checks if a user has passwordless sudo by evaluating the
+// sudoers policy, and returns the file:line that grants it
+func hasPasswordlessSudoDetailed(username string) (bool, string, error) {
 	// Check if running with sufficient privileges to read sudoers files
 	if os.Geteuid() != 0 {
-		return false, fmt.Errorf("checking passwordless sudo requires root privileges. Please run with sudo")
-	}
-
-	// List of sudoers files to check
-	sudoersFiles := []string{
-		filepath.Join("/etc/sudoers.d", username),
-		"/etc/sudoers",
+		return false, "", fmt.Errorf("checking passwordless sudo requires root privileges. Please run with sudo")
 	}
 
-	// Also check for common sudoers.d files
-	sudoersDFiles := []string{
-		"/etc/sudoers.d/90-cloud-init-users",
-		"/etc/sudoers.d/admin",
-		"/etc/sudoers.d/wheel",
-	}
-	sudoersFiles = append(sudoersFiles, sudoersDFiles...)
-
-	hasNoPasswd := false
-
-	// Check each sudoers file
-	for _, file := range sudoersFiles {
-		if _, err := os.Stat(file); err != nil {
-			continue // File doesn't exist, skip
-		}
-
-		// Read the file - we have root privileges so this should work
-		content, err := os.ReadFile(file)
-		if err != nil {
-			// Log the error but continue checking other files
-			continue
-		}
-
-		// Check if file contains NOPASSWD for this user
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, "#") {
-				continue // Skip comments
-			}
-
-			// Check for user-specific NOPASSWD rules
-			if strings.Contains(line, username) && strings.Contains(line, "NOPASSWD") {
-				hasNoPasswd = true
-				break
-			}
-
-			// Check for group-based NOPASSWD rules
-			if (strings.Contains(line, "%sudo") || strings.Contains(line, "%admin") || strings.Contains(line, "%wheel")) &&
-				strings.Contains(line, "NOPASSWD") {
-				// Check if user is in the group
-				inGroup, err := isUserInSudoGroup(username)
-				if err == nil && inGroup {
-					hasNoPasswd = true
-					break
-				}
-			}
-		}
-
-		if hasNoPasswd {
-			break
-		}
+	privileges, err := sudoers.Check(sudoers.DefaultPath, username)
+	if err != nil {
+		return false, "", err
 	}
 
-	return hasNoPasswd, nil
+	return privileges.NoPasswd(), privileges.Source(), nil
 }
 
 // configureLinuxSudo configures sudo for a user on Linux
-func (f *Feature) configureLinuxSudo(ctx *features.ExecutionContext, username string, nopasswd bool) error {
+func (f *Feature) configureLinuxSudo(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule) error {
 	ctx.Logger.Info("Configuring sudo for user %s on Linux", username)
 
 	// Check if user exists
@@ -632,33 +518,12 @@ func (f *Feature) configureLinuxSudo(ctx *features.ExecutionContext, username st
 		return fmt.Errorf("user %s does not exist", username)
 	}
 
-	// Create sudoers.d directory if it doesn't exist
-	sudoersDir := "/etc/sudoers.d"
-	if err := os.MkdirAll(sudoersDir, 0755); err != nil {
-		return fmt.Errorf("failed to create sudoers.d directory: %w", err)
-	}
-
 	// Create sudoers file for user
-	sudoersFile := filepath.Join(sudoersDir, username)
-	var sudoersContent string
-	if nopasswd {
-		sudoersContent = fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL\n", username)
-	} else {
-		sudoersContent = fmt.Sprintf("%s ALL=(ALL) ALL\n", username)
-	}
+	sudoersFile := filepath.Join("/etc/sudoers.d", username)
+	sudoersContent := renderSudoers(username, nopasswd, rules)
 
 	// Show configuration details
-	passwordRequired := "yes"
-	if nopasswd {
-		passwordRequired = "no"
-	}
-	configLines := []string{
-		fmt.Sprintf("User: %s", username),
-		"Sudo access: ALL commands",
-		fmt.Sprintf("Password required: %s", passwordRequired),
-		fmt.Sprintf("Configuration file: %s", sudoersFile),
-	}
-	ctx.Logger.MultiLine("info", "Configuring sudo with the following settings:", configLines)
+	ctx.Logger.MultiLine("info", "Configuring sudo with the following settings:", accessSettings("Sudo", username, nopasswd, rules, sudoersFile))
 
 	// Check if backup option is enabled
 	backupEnabled, hasBackup := ctx.Options["backup"].(bool)
@@ -674,12 +539,6 @@ func (f *Feature) configureLinuxSudo(ctx *features.ExecutionContext, username st
 		}
 	}
 
-	// Write sudoers file
-	ctx.Logger.Step("Creating sudoers file %s", sudoersFile)
-	if err := os.WriteFile(sudoersFile, []byte(sudoersContent), 0440); err != nil {
-		return fmt.Errorf("failed to write sudoers file: %w", err)
-	}
-
 	// Show file content
 	contentLines := strings.Split(sudoersContent, "\n")
 	var fileLines []string
@@ -690,21 +549,32 @@ func (f *Feature) configureLinuxSudo(ctx *features.ExecutionContext, username st
 	}
 	ctx.Logger.MultiLine("info", "Sudoers file content:", fileLines)
 
-	// Validate sudoers file
-	ctx.Logger.Step("Validating sudoers file...")
-	cmd := exec.Command("visudo", "-c", "-f", sudoersFile)
-	if err := cmd.Run(); err != nil {
-		// Remove invalid file
-		os.Remove(sudoersFile)
-		return fmt.Errorf("invalid sudoers file: %w", err)
+	if err := installSudoersFile(ctx.Logger, sudoersFile, sudoersContent); err != nil {
+		return err
 	}
 
 	ctx.Logger.Success("Sudo configured successfully")
 	return nil
 }
 
-// isUserInSudoGroupButNotActive checks if a user is in the sudo group but the membership is not yet active
-func isUserInSudoGroupButNotActive(username string) bool {
+// accessSettings returns the configuration overview shown before writing a sudoers or doas file
+func accessSettings(tool, username string, nopasswd bool, rules []commandRule, file string) []string {
+	lines := []string{fmt.Sprintf("User: %s", username)}
+	if len(rules) > 0 {
+		lines = append(lines, fmt.Sprintf("%s access: restricted commands", tool))
+		lines = append(lines, describeRules(rules)...)
+	} else {
+		passwordRequired := "yes"
+		if nopasswd {
+			passwordRequired = "no"
+		}
+		lines = append(lines, fmt.Sprintf("%s access: ALL commands", tool), fmt.Sprintf("Password required: %s", passwordRequired))
+	}
+	return append(lines, fmt.Sprintf("Configuration file: %s", file))
+}
+
+// isUserInSudoGroupButNotActive checks if a user is in the admin group but the membership is not yet active
+func isUserInSudoGroupButNotActive(username, adminGroup string) bool {
 	// Get user information
 	u, err := user.Lookup(username)
 	if err != nil {
@@ -725,9 +595,7 @@ func isUserInSudoGroupButNotActive(username string) bool {
 			continue
 		}
 
-		// Check if group name is sudo, wheel, or admin (common sudo group names)
-		groupName := strings.ToLower(group.Name)
-		if groupName == "sudo" || groupName == "wheel" || groupName == "admin" {
+		if group.Name == adminGroup {
 			inSudoGroup = true
 			break
 		}
@@ -765,14 +633,8 @@ func (f *Feature) configureDarwinSudo(ctx *features.ExecutionContext, username s
 
 	// For passwordless sudo, we need to modify the sudoers file
 	if nopasswd {
-		// Create sudoers.d directory if it doesn't exist
-		sudoersDir := "/etc/sudoers.d"
-		if err := os.MkdirAll(sudoersDir, 0755); err != nil {
-			return fmt.Errorf("failed to create sudoers.d directory: %w", err)
-		}
-
 		// Create sudoers file for user
-		sudoersFile := filepath.Join(sudoersDir, username)
+		sudoersFile := filepath.Join("/etc/sudoers.d", username)
 		sudoersContent := fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL\n", username)
 
 		// Check if backup option is enabled
@@ -789,17 +651,8 @@ func (f *Feature) configureDarwinSudo(ctx *features.ExecutionContext, username s
 			}
 		}
 
-		// Write sudoers file
-		if err := os.WriteFile(sudoersFile, []byte(sudoersContent), 0440); err != nil {
-			return fmt.Errorf("failed to write sudoers file: %w", err)
-		}
-
-		// Validate sudoers file
-		cmd := exec.Command("visudo", "-c", "-f", sudoersFile)
-		if err := cmd.Run(); err != nil {
-			// Remove invalid file
-			os.Remove(sudoersFile)
-			return fmt.Errorf("invalid sudoers file: %w", err)
+		if err := installSudoersFile(ctx.Logger, sudoersFile, sudoersContent); err != nil {
+			return err
 		}
 	}
 
@@ -77,6 +77,21 @@ func TestShouldActivate(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "With sudo-defaults and no username",
+			options: map[string]any{
+				"sudo-defaults": true,
+			},
+			expected: true,
+		},
+		{
+			name: "With sudo-defaults and skip-sudo",
+			options: map[string]any{
+				"sudo-defaults": true,
+				"skip-sudo":     true,
+			},
+			expected: false,
+		},
 	}
 
 	// Run tests
@@ -127,6 +142,37 @@ func TestValidateOptions(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "With valid sudo rules",
+			options: map[string]any{
+				"user":       "testuser",
+				"sudo-rules": []any{map[string]any{"commands": []any{"/usr/bin/apt update"}}},
+			},
+			expectError: false,
+		},
+		{
+			name: "With sudo-defaults and no username",
+			options: map[string]any{
+				"sudo-defaults": true,
+			},
+			expectError: false,
+		},
+		{
+			name: "With invalid sudo-lecture",
+			options: map[string]any{
+				"sudo-defaults": true,
+				"sudo-lecture":  "sometimes",
+			},
+			expectError: true,
+		},
+		{
+			name: "With relative sudo rule command",
+			options: map[string]any{
+				"user":       "testuser",
+				"sudo-rules": []any{map[string]any{"commands": []any{"apt"}}},
+			},
+			expectError: true,
+		},
 	}
 
 	// Run tests
@@ -181,3 +227,31 @@ func TestExecute(t *testing.T) {
 		}
 	}()
 }
+
+func TestUnrestrictedWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    map[string]any
+		expected string
+	}{
+		{"Restricted", map[string]any{"has_sudo": false}, ""},
+		{
+			"Admin group",
+			map[string]any{"has_sudo": true, "in_sudo_group": true, "sudo_source": "/etc/sudoers:50"},
+			"User deploy can still run all commands with sudo through /etc/sudoers:50, so the restricted rules have no effect. Remove the user from the sudo group to apply them",
+		},
+		{
+			"Other grant",
+			map[string]any{"has_sudo": true},
+			"User deploy can still run all commands with sudo, so the restricted rules have no effect",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if warning := unrestrictedWarning("sudo", "deploy", "sudo", tt.state); warning != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, warning)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package sudo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sudoers"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+// sudoBackend grants privileges through sudoers drop-ins in /etc/sudoers.d
+type sudoBackend struct {
+	f *Feature
+}
+
+// Name returns the name of the tool
+func (b *sudoBackend) Name() string {
+	return "sudo"
+}
+
+// Validate checks that the requested grant can be expressed in sudoers
+func (b *sudoBackend) Validate(options map[string]any, rules []commandRule) error {
+	return nil
+}
+
+// Detect adds the user's sudo privileges to the feature state
+func (b *sudoBackend) Detect(ctx *features.ExecutionContext, username string, state map[string]any) {
+	// Check if user has sudo privileges
+	adminGroup := sudoers.AdminGroupName(b.f.osInfo, stringValue(ctx.Options["admin-group"]))
+	hasSudo, sudoErr := userHasSudo(username, adminGroup)
+	if sudoErr != nil {
+		ctx.Logger.Warning("Failed to check sudo privileges: %v", sudoErr)
+		state["sudo_check_error"] = sudoErr.Error()
+	}
+	state["has_sudo"] = hasSudo
+
+	// Check if user is in sudo group
+	inSudoGroup, groupErr := isUserInSudoGroup(username, adminGroup)
+	if groupErr != nil {
+		ctx.Logger.Warning("Failed to check sudo group membership: %v", groupErr)
+		state["sudo_group_check_error"] = groupErr.Error()
+	}
+	state["in_sudo_group"] = inSudoGroup
+
+	// Check if sudo is passwordless (requires elevated privileges)
+	hasPasswordlessSudo, sudoSource, passwordlessErr := hasPasswordlessSudoDetailed(username)
+	if passwordlessErr != nil {
+		// Check if this is a permission error
+		if strings.Contains(passwordlessErr.Error(), "permission denied") ||
+			strings.Contains(passwordlessErr.Error(), "not permitted") ||
+			os.IsPermission(passwordlessErr) {
+			state["passwordless_sudo_requires_privileges"] = true
+			state["has_passwordless_sudo"] = false // Default to false when we can't check
+		} else {
+			ctx.Logger.Warning("Failed to check passwordless sudo: %v", passwordlessErr)
+			state["has_passwordless_sudo"] = false
+		}
+	} else {
+		state["has_passwordless_sudo"] = hasPasswordlessSudo
+		state["sudo_source"] = sudoSource
+		state["passwordless_sudo_requires_privileges"] = false
+	}
+}
+
+// UpToDate reports whether the user already has the requested sudo grant
+func (b *sudoBackend) UpToDate(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule, state map[string]any) bool {
+	hasSudo, _ := state["has_sudo"].(bool)
+	hasPasswordlessSudo, _ := state["has_passwordless_sudo"].(bool)
+
+	sudoersFile := filepath.Join("/etc/sudoers.d", username)
+	if len(rules) > 0 {
+		if existing, err := safefile.ReadFile(sudoersFile); err == nil && string(existing) == renderSudoers(username, nopasswd, rules) {
+			ctx.Logger.Info("User %s already has the configured sudo rules", username)
+			return true
+		}
+	} else if hasSudo {
+		if nopasswd && hasPasswordlessSudo {
+			ctx.Logger.Info("User %s already has passwordless sudo configured", username)
+			return true
+		} else if !nopasswd && !hasPasswordlessSudo {
+			ctx.Logger.Info("User %s already has sudo configured with password requirement", username)
+			return true
+		}
+		// If we reach here, sudo exists but passwordless setting needs to be changed
+		ctx.Logger.Info("Updating sudo configuration for user %s", username)
+	}
+	return false
+}
+
+// Configure grants the user sudo privileges
+func (b *sudoBackend) Configure(ctx *features.ExecutionContext, username string, nopasswd bool, rules []commandRule) error {
+	sudoersFile := filepath.Join("/etc/sudoers.d", username)
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		// Not running as root, need to use sudo
+		ctx.Logger.Warning("Configuring sudo requires root privileges")
+
+		// Check if user was recently added to sudo group but hasn't logged out yet
+		currentUser, err := user.Current()
+		if err == nil && isUserInSudoGroupButNotActive(currentUser.Username, sudoers.AdminGroupName(b.f.osInfo, stringValue(ctx.Options["admin-group"]))) {
+			ctx.Logger.Warning("You were recently added to the sudo group, but this change requires logging out and back in to take effect")
+			ctx.Logger.Info("Please log out and log back in, then run INIQ again")
+			return fmt.Errorf("sudo group membership not yet active; please log out and log back in")
+		}
+
+		ctx.Logger.Info("INIQ will now use sudo to configure sudo permissions")
+		ctx.Logger.Info("You may be prompted for your password")
+
+		// Determine the commands to run based on OS
+		switch b.f.osInfo.Type {
+		case osdetect.Linux:
+			// Show configuration details
+			ctx.Logger.MultiLine("info", "Configuring sudo with the following settings:", accessSettings("Sudo", username, nopasswd, rules, sudoersFile))
+
+			if err := installSudoersFile(ctx.Logger, sudoersFile, renderSudoers(username, nopasswd, rules)); err != nil {
+				// Check if this is likely due to sudo group membership not being active yet
+				if strings.Contains(err.Error(), "not in the sudoers file") ||
+					strings.Contains(err.Error(), "not allowed to execute") {
+					ctx.Logger.Warning("You appear to be in the sudo group, but the membership is not yet active")
+					ctx.Logger.Info("This typically requires logging out and back in to take effect")
+					ctx.Logger.Info("Please log out and log back in, then run INIQ again")
+					return fmt.Errorf("sudo group membership not yet active; please log out and log back in")
+				}
+				return err
+			}
+
+		case osdetect.Darwin:
+			if len(rules) > 0 {
+				return fmt.Errorf("restricted sudo rules are only supported on Linux")
+			}
+
+			// On macOS, we need to add the user to the admin group
+			ctx.Logger.Step("Adding user to admin group...")
+			adminCmd := exec.Command("sudo", "dseditgroup", "-o", "edit", "-a", username, "-t", "user", "admin")
+			adminCmd.Stdin = os.Stdin
+			adminCmd.Stdout = os.Stdout
+			adminCmd.Stderr = os.Stderr
+			if err := adminCmd.Run(); err != nil {
+				return fmt.Errorf("failed to add user to admin group: %w", err)
+			}
+
+			// For passwordless sudo, we need to modify the sudoers file
+			if nopasswd {
+				if err := installSudoersFile(ctx.Logger, sudoersFile, renderSudoers(username, true, nil)); err != nil {
+					return err
+				}
+			}
+		}
+
+		ctx.Logger.Success("Sudo configured successfully")
+		return nil
+	}
+
+	// Configure sudo based on OS
+	switch b.f.osInfo.Type {
+	case osdetect.Linux:
+		return b.f.configureLinuxSudo(ctx, username, nopasswd, rules)
+	case osdetect.Darwin:
+		if len(rules) > 0 {
+			return fmt.Errorf("restricted sudo rules are only supported on Linux")
+		}
+		return b.f.configureDarwinSudo(ctx, username, nopasswd)
+	default:
+		return fmt.Errorf("unsupported OS: %s", b.f.osInfo.Type)
+	}
+}
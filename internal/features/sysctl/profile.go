@@ -0,0 +1,163 @@
+package sysctl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// configFile holds the kernel parameters INIQ sets. It sorts after the distribution
+	// defaults in /usr/lib/sysctl.d and before the 99- files administrators usually add.
+	configFile = "/etc/sysctl.d/90-iniq.conf"
+	// procSysDir exposes the live kernel parameters
+	procSysDir = "/proc/sys"
+)
+
+// parameter is one kernel parameter and the value INIQ sets it to
+type parameter struct {
+	Key   string
+	Value string
+}
+
+// baselineParameters harden the network stack and kernel without affecting
+// ordinary servers, routers aside
+var baselineParameters = []parameter{
+	// Drop packets whose source address would not be routed back through the same interface
+	{"net.ipv4.conf.all.rp_filter", "1"},
+	{"net.ipv4.conf.default.rp_filter", "1"},
+	// Ignore and never send ICMP redirects, which can rewrite the routing table
+	{"net.ipv4.conf.all.accept_redirects", "0"},
+	{"net.ipv4.conf.default.accept_redirects", "0"},
+	{"net.ipv4.conf.all.secure_redirects", "0"},
+	{"net.ipv4.conf.default.secure_redirects", "0"},
+	{"net.ipv4.conf.all.send_redirects", "0"},
+	{"net.ipv4.conf.default.send_redirects", "0"},
+	{"net.ipv6.conf.all.accept_redirects", "0"},
+	{"net.ipv6.conf.default.accept_redirects", "0"},
+	{"net.ipv4.conf.all.accept_source_route", "0"},
+	{"net.ipv6.conf.all.accept_source_route", "0"},
+	// Hide kernel addresses and the kernel log from unprivileged users
+	{"kernel.kptr_restrict", "1"},
+	{"kernel.dmesg_restrict", "1"},
+	// Stop links in world-writable sticky directories from being used to redirect writes
+	{"fs.protected_symlinks", "1"},
+	{"fs.protected_hardlinks", "1"},
+}
+
+// strictParameters are added by the strict profile. They can break debuggers,
+// eBPF tools and software that writes to FIFOs in /tmp.
+var strictParameters = []parameter{
+	{"kernel.kptr_restrict", "2"},
+	{"kernel.yama.ptrace_scope", "1"},
+	{"kernel.unprivileged_bpf_disabled", "1"},
+	{"net.core.bpf_jit_harden", "2"},
+	{"fs.protected_fifos", "2"},
+	{"fs.protected_regular", "2"},
+	{"net.ipv4.conf.all.log_martians", "1"},
+	{"net.ipv4.conf.default.log_martians", "1"},
+}
+
+// ipv6Parameters disable IPv6 on all interfaces
+var ipv6Parameters = []parameter{
+	{"net.ipv6.conf.all.disable_ipv6", "1"},
+	{"net.ipv6.conf.default.disable_ipv6", "1"},
+}
+
+// profiles are the parameter sets that can be selected with sysctl-profile
+var profiles = map[string][]parameter{
+	"baseline": baselineParameters,
+	"strict":   mergeParameters(baselineParameters, strictParameters),
+}
+
+// mergeParameters returns base with the values of extra, which override parameters
+// with the same key and are otherwise appended
+func mergeParameters(base, extra []parameter) []parameter {
+	merged := append([]parameter(nil), base...)
+	for _, p := range extra {
+		found := false
+		for i := range merged {
+			if merged[i].Key == p.Key {
+				merged[i].Value = p.Value
+				found = true
+			}
+		}
+		if !found {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// profileParameters returns the parameters of a profile, with IPv6 disabled if requested
+func profileParameters(profile string, disableIPv6 bool) ([]parameter, error) {
+	params, ok := profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("invalid sysctl profile %q: must be baseline or strict", profile)
+	}
+	if disableIPv6 {
+		params = mergeParameters(params, ipv6Parameters)
+	}
+	return params, nil
+}
+
+// procPath returns the /proc/sys file of a parameter under root
+func procPath(root, key string) string {
+	return filepath.Join(root, procSysDir, strings.ReplaceAll(key, ".", "/"))
+}
+
+// supported splits parameters into those the running kernel has under root and
+// those it lacks, such as IPv6 parameters when IPv6 is disabled at boot
+func supported(root string, params []parameter) ([]parameter, []string) {
+	var present []parameter
+	var missing []string
+	for _, p := range params {
+		if _, err := os.Stat(procPath(root, p.Key)); err != nil {
+			missing = append(missing, p.Key)
+			continue
+		}
+		present = append(present, p)
+	}
+	return present, missing
+}
+
+// readLive returns the live value of a parameter under root, with runs of
+// whitespace collapsed so multi-value parameters compare reliably
+func readLive(root, key string) (string, error) {
+	content, err := os.ReadFile(procPath(root, key))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(content)), " "), nil
+}
+
+// renderConfig returns the sysctl.d file that sets the parameters
+func renderConfig(profile string, params []parameter) string {
+	var content strings.Builder
+	content.WriteString("# Managed by INIQ, changes will be overwritten\n")
+	fmt.Fprintf(&content, "# Profile: %s\n", profile)
+	for _, p := range params {
+		fmt.Fprintf(&content, "%s = %s\n", p.Key, p.Value)
+	}
+	return content.String()
+}
+
+// parseConfig returns the parameters set in sysctl.d file content
+func parseConfig(content string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		// A leading dash tells sysctl to ignore a parameter the kernel lacks
+		key = strings.TrimPrefix(strings.TrimSpace(key), "-")
+		values[key] = strings.Join(strings.Fields(value), " ")
+	}
+	return values
+}
@@ -0,0 +1,13 @@
+package sysctl
+
+import (
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// init registers the kernel parameter hardening feature
+func init() {
+	features.RegisterSysctlFeature = func(registry *features.Registry, osInfo *osdetect.Info) {
+		registry.Register(New(osInfo))
+	}
+}
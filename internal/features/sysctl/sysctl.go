@@ -0,0 +1,276 @@
+// Package sysctl implements the kernel parameter hardening feature
+package sysctl
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+// Feature implements the kernel parameter hardening feature
+type Feature struct {
+	osInfo *osdetect.Info
+	// root is where the file system holding /etc/sysctl.d and /proc/sys is mounted
+	root string
+}
+
+// New creates a new kernel parameter hardening feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+		root:   "/",
+	}
+}
+
+// settings are the requested kernel parameter hardening settings
+type settings struct {
+	Profile     string
+	DisableIPv6 bool
+}
+
+// settingsFromOptions returns the kernel parameter hardening settings from the options
+func settingsFromOptions(options map[string]any) (settings, error) {
+	s := settings{Profile: "baseline"}
+	if profile, ok := options["sysctl-profile"].(string); ok && strings.TrimSpace(profile) != "" {
+		s.Profile = strings.TrimSpace(profile)
+	}
+	s.DisableIPv6, _ = options["sysctl-disable-ipv6"].(bool)
+	if _, err := profileParameters(s.Profile, s.DisableIPv6); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "sysctl"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Harden kernel and network parameters"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "sysctl",
+			Shorthand: "",
+			Usage:     "harden kernel and network parameters in " + configFile,
+			Default:   false,
+			Required:  false,
+		},
+		{
+			Name:      "sysctl-profile",
+			Shorthand: "",
+			Usage:     "kernel parameter profile (baseline or strict)",
+			Default:   "baseline",
+			Required:  false,
+		},
+		{
+			Name:      "sysctl-disable-ipv6",
+			Shorthand: "",
+			Usage:     "also disable IPv6 on all interfaces",
+			Default:   false,
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	enabled, _ := options["sysctl"].(bool)
+	return enabled
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	_, err := settingsFromOptions(options)
+	return err
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	s, err := settingsFromOptions(ctx.Options)
+	if err != nil {
+		return err
+	}
+	params, _ := profileParameters(s.Profile, s.DisableIPv6)
+	params, unsupported := supported(f.root, params)
+	content := renderConfig(s.Profile, params)
+
+	path := filepath.Join(f.root, configFile)
+	current, _ := os.ReadFile(path)
+	differ := liveDifferences(f.root, params)
+
+	if string(current) == content && len(differ) == 0 {
+		ctx.Logger.Success("✓ Kernel parameters already hardened")
+		return nil
+	}
+
+	for _, key := range unsupported {
+		ctx.Logger.Info("Skipping %s, which this kernel does not have", key)
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		if string(current) != content {
+			ctx.Logger.Info("Would write %s with the %s profile", configFile, s.Profile)
+			if ctx.Verbose {
+				ctx.Logger.MultiLine("info", "Kernel parameters:", strings.Split(strings.TrimRight(content, "\n"), "\n"))
+			}
+		}
+		ctx.Logger.Info("Would apply %d kernel parameters with sysctl --system", len(params))
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("hardening kernel parameters requires root privileges")
+	}
+
+	if string(current) != content {
+		ctx.Logger.Step("Writing %s", configFile)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(configFile), err)
+		}
+		if err := safefile.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", configFile, err)
+		}
+	}
+
+	// sysctl --system loads every sysctl.d directory in order, so the live values match a reboot
+	ctx.Logger.Step("Applying kernel parameters...")
+	if output, err := exec.Command("sysctl", "--system").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply kernel parameters, they take effect at the next boot: %s: %w", lastLine(string(output)), err)
+	}
+
+	for _, d := range liveDifferences(f.root, params) {
+		ctx.Logger.Warning("%s is %s instead of %s, a later file in a sysctl.d directory overrides it", d.Key, d.Live, d.Want)
+	}
+
+	ctx.Logger.Success("Kernel parameters hardened with the %s profile", s.Profile)
+	return nil
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 65 // Applied last, so disabling IPv6 cannot cut off downloads of earlier features
+}
+
+// difference is a kernel parameter whose live value is not the wanted one
+type difference struct {
+	Key  string
+	Live string
+	Want string
+}
+
+// liveDifferences returns the parameters whose live value under root differs from
+// the wanted value. Parameters the kernel lacks are left out.
+func liveDifferences(root string, params []parameter) []difference {
+	var differ []difference
+	for _, p := range params {
+		live, err := readLive(root, p.Key)
+		if err != nil {
+			continue
+		}
+		if live != p.Value {
+			differ = append(differ, difference{Key: p.Key, Live: live, Want: p.Value})
+		}
+	}
+	return differ
+}
+
+// DetectCurrentState detects and returns the current state of the kernel parameters
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+	state["config_file"] = configFile
+
+	content, err := os.ReadFile(filepath.Join(f.root, configFile))
+	if err != nil {
+		// Without a configuration, show what the baseline profile would change
+		state["sysctl_configured"] = false
+		params, _ := supported(f.root, baselineParameters)
+		state["sysctl_parameters"] = len(params)
+		state["sysctl_differences"] = formatDifferences(liveDifferences(f.root, params), "baseline")
+		return state, nil
+	}
+
+	state["sysctl_configured"] = true
+	for _, line := range strings.Split(string(content), "\n") {
+		if profile, found := strings.CutPrefix(line, "# Profile: "); found {
+			state["sysctl_profile"] = strings.TrimSpace(profile)
+		}
+	}
+
+	configured := parseConfig(string(content))
+	keys := make([]string, 0, len(configured))
+	for key := range configured {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []parameter
+	for _, key := range keys {
+		params = append(params, parameter{Key: key, Value: configured[key]})
+	}
+	params, unsupported := supported(f.root, params)
+	state["sysctl_parameters"] = len(params)
+	state["sysctl_differences"] = formatDifferences(liveDifferences(f.root, params), "configured")
+	state["sysctl_unsupported"] = unsupported
+
+	return state, nil
+}
+
+// formatDifferences formats differences for the state map, naming where the wanted value comes from
+func formatDifferences(differ []difference, source string) []string {
+	formatted := make([]string, 0, len(differ))
+	for _, d := range differ {
+		formatted = append(formatted, fmt.Sprintf("%s = %s (%s %s)", d.Key, d.Live, source, d.Want))
+	}
+	return formatted
+}
+
+// DisplayCurrentState displays the current state of the kernel parameters
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	configured, _ := state["sysctl_configured"].(bool)
+	differ, _ := state["sysctl_differences"].([]string)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Kernel parameters")
+	switch {
+	case !configured:
+		fmt.Printf("\033[1;33m⚠ Not hardened\033[0m\n")
+	case len(differ) > 0:
+		fmt.Printf("\033[1;33m⚠ %d not applied\033[0m\n", len(differ))
+	default:
+		fmt.Printf("\033[1;32m✓ Hardened\033[0m\n")
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// Kernel parameters are only hardened on request
+	return false
+}
+
+// lastLine returns the last non-empty line of command output, which usually holds the error
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,259 @@
+package sysctl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/logger"
+)
+
+// newProcRoot returns a temporary root whose /proc/sys holds the given live values
+func newProcRoot(t *testing.T, values map[string]string) string {
+	t.Helper()
+	root, err := os.MkdirTemp("", "iniq-sysctl-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	for key, value := range values {
+		path := procPath(root, key)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return root
+}
+
+func TestSettingsFromOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]any
+		want      settings
+		expectErr bool
+	}{
+		{name: "defaults", options: map[string]any{}, want: settings{Profile: "baseline"}},
+		{name: "empty profile", options: map[string]any{"sysctl-profile": " "}, want: settings{Profile: "baseline"}},
+		{
+			name:    "strict without IPv6",
+			options: map[string]any{"sysctl-profile": "strict", "sysctl-disable-ipv6": true},
+			want:    settings{Profile: "strict", DisableIPv6: true},
+		},
+		{name: "unknown profile", options: map[string]any{"sysctl-profile": "paranoid"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := settingsFromOptions(tt.options)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProfileParameters(t *testing.T) {
+	values := func(params []parameter) map[string]string {
+		m := make(map[string]string)
+		for _, p := range params {
+			if _, dup := m[p.Key]; dup {
+				t.Errorf("Duplicate parameter %s", p.Key)
+			}
+			m[p.Key] = p.Value
+		}
+		return m
+	}
+
+	baseline, err := profileParameters("baseline", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b := values(baseline)
+	for key, want := range map[string]string{
+		"net.ipv4.conf.all.rp_filter":        "1",
+		"net.ipv4.conf.all.accept_redirects": "0",
+		"net.ipv4.conf.all.send_redirects":   "0",
+		"kernel.kptr_restrict":               "1",
+		"kernel.dmesg_restrict":              "1",
+		"fs.protected_symlinks":              "1",
+		"fs.protected_hardlinks":             "1",
+	} {
+		if b[key] != want {
+			t.Errorf("Expected baseline %s = %s, got %q", key, want, b[key])
+		}
+	}
+	if _, found := b["net.ipv6.conf.all.disable_ipv6"]; found {
+		t.Errorf("Expected IPv6 to stay enabled by default")
+	}
+
+	strict, _ := profileParameters("strict", true)
+	s := values(strict)
+	if s["kernel.kptr_restrict"] != "2" {
+		t.Errorf("Expected strict profile to override kptr_restrict, got %q", s["kernel.kptr_restrict"])
+	}
+	if s["net.ipv6.conf.all.disable_ipv6"] != "1" {
+		t.Errorf("Expected IPv6 to be disabled")
+	}
+	if len(strict) <= len(baseline) {
+		t.Errorf("Expected strict profile to add parameters")
+	}
+
+	// Building the strict profile must not change the baseline it extends
+	if b := values(baselineParameters); b["kernel.kptr_restrict"] != "1" {
+		t.Errorf("Expected baseline kptr_restrict to stay 1, got %q", b["kernel.kptr_restrict"])
+	}
+}
+
+func TestRenderAndParseConfig(t *testing.T) {
+	params := []parameter{{"kernel.dmesg_restrict", "1"}, {"fs.protected_symlinks", "1"}}
+	content := renderConfig("baseline", params)
+
+	want := "# Managed by INIQ, changes will be overwritten\n# Profile: baseline\nkernel.dmesg_restrict = 1\nfs.protected_symlinks = 1\n"
+	if content != want {
+		t.Errorf("Expected %q, got %q", want, content)
+	}
+
+	got := parseConfig(content + "; comment\n-net.ipv4.ip_local_port_range=32768\t60999\nnot a setting\n")
+	expected := map[string]string{
+		"kernel.dmesg_restrict":        "1",
+		"fs.protected_symlinks":        "1",
+		"net.ipv4.ip_local_port_range": "32768 60999",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestLiveValues(t *testing.T) {
+	root := newProcRoot(t, map[string]string{
+		"net.ipv4.conf.all.rp_filter":  "2",
+		"kernel.dmesg_restrict":        "1",
+		"net.ipv4.ip_local_port_range": "32768\t60999",
+	})
+
+	live, err := readLive(root, "net.ipv4.ip_local_port_range")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if live != "32768 60999" {
+		t.Errorf("Expected whitespace to be collapsed, got %q", live)
+	}
+
+	params := []parameter{
+		{"net.ipv4.conf.all.rp_filter", "1"},
+		{"kernel.dmesg_restrict", "1"},
+		{"net.ipv6.conf.all.disable_ipv6", "1"},
+	}
+	present, missing := supported(root, params)
+	if len(present) != 2 || !reflect.DeepEqual(missing, []string{"net.ipv6.conf.all.disable_ipv6"}) {
+		t.Errorf("Expected IPv6 parameter to be unsupported, got present %v, missing %v", present, missing)
+	}
+
+	differ := liveDifferences(root, params)
+	want := []difference{{Key: "net.ipv4.conf.all.rp_filter", Live: "2", Want: "1"}}
+	if !reflect.DeepEqual(differ, want) {
+		t.Errorf("Expected %v, got %v", want, differ)
+	}
+}
+
+func TestDetectCurrentState(t *testing.T) {
+	root := newProcRoot(t, map[string]string{
+		"kernel.kptr_restrict":  "0",
+		"kernel.dmesg_restrict": "1",
+		"fs.protected_symlinks": "1",
+	})
+	feature := &Feature{root: root}
+	ctx := &features.ExecutionContext{Options: map[string]any{}, Logger: logger.New(false, true)}
+
+	// Without a configuration the baseline profile is compared
+	state, err := feature.DetectCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if configured, _ := state["sysctl_configured"].(bool); configured {
+		t.Errorf("Expected no configuration")
+	}
+	if total, _ := state["sysctl_parameters"].(int); total != 3 {
+		t.Errorf("Expected 3 supported baseline parameters, got %d", total)
+	}
+	if differ, _ := state["sysctl_differences"].([]string); !reflect.DeepEqual(differ, []string{"kernel.kptr_restrict = 0 (baseline 1)"}) {
+		t.Errorf("Expected kptr_restrict to differ from baseline, got %v", differ)
+	}
+
+	// With a configuration the configured values are compared
+	path := filepath.Join(root, configFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+	content := renderConfig("strict", []parameter{
+		{"kernel.kptr_restrict", "2"},
+		{"kernel.dmesg_restrict", "1"},
+		{"kernel.yama.ptrace_scope", "1"},
+	})
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	state, err = feature.DetectCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if profile, _ := state["sysctl_profile"].(string); profile != "strict" {
+		t.Errorf("Expected strict profile, got %q", profile)
+	}
+	if total, _ := state["sysctl_parameters"].(int); total != 2 {
+		t.Errorf("Expected 2 supported parameters, got %d", total)
+	}
+	if differ, _ := state["sysctl_differences"].([]string); !reflect.DeepEqual(differ, []string{"kernel.kptr_restrict = 0 (configured 2)"}) {
+		t.Errorf("Expected kptr_restrict to differ from configuration, got %v", differ)
+	}
+	if unsupported, _ := state["sysctl_unsupported"].([]string); !reflect.DeepEqual(unsupported, []string{"kernel.yama.ptrace_scope"}) {
+		t.Errorf("Expected ptrace_scope to be unsupported, got %v", unsupported)
+	}
+}
+
+func TestExecuteAlreadyHardened(t *testing.T) {
+	params, _ := profileParameters("baseline", false)
+	values := make(map[string]string)
+	for _, p := range params {
+		values[p.Key] = p.Value
+	}
+	root := newProcRoot(t, values)
+	path := filepath.Join(root, configFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(renderConfig("baseline", params)), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	// Nothing is written or applied when the file and live values already match
+	feature := &Feature{root: root}
+	ctx := &features.ExecutionContext{
+		Options: map[string]any{"sysctl": true},
+		Logger:  logger.New(false, true),
+	}
+	if err := feature.Execute(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(content), "# Managed by INIQ") {
+		t.Errorf("Expected configuration to be kept, got %q", content)
+	}
+}
@@ -0,0 +1,143 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+const (
+	// hostnameFile holds the static hostname
+	hostnameFile = "/etc/hostname"
+	// hostsFile maps the hostname to a local address, so it resolves without DNS
+	hostsFile = "/etc/hosts"
+	// hostnameAddress is the loopback address Debian maps the hostname to. Other
+	// distributions use it too when the host has no fixed address.
+	hostnameAddress = "127.0.1.1"
+	// cloudInitHostnameFile keeps cloud-init from resetting the hostname at boot
+	cloudInitHostnameFile = "/etc/cloud/cloud.cfg.d/98-iniq-hostname.cfg"
+)
+
+// hostnameLabelPattern matches one dot-separated label of a hostname (RFC 1123)
+var hostnameLabelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// validHostname reports whether name is a valid hostname or fully qualified domain name
+func validHostname(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// shortHostname returns the first label of a hostname
+func shortHostname(name string) string {
+	short, _, _ := strings.Cut(name, ".")
+	return short
+}
+
+// updateHosts returns hosts file content that maps the hostname to hostnameAddress.
+// An existing entry for that address is replaced, otherwise one is added after the
+// IPv4 localhost entry.
+func updateHosts(content, hostname string) string {
+	names := hostname
+	if short := shortHostname(hostname); short != hostname {
+		names = hostname + " " + short
+	}
+	entry := hostnameAddress + "\t" + names
+
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	insertAt := len(lines)
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == hostnameAddress {
+			lines[i] = entry
+			return strings.Join(lines, "\n") + "\n"
+		}
+		if fields[0] == "127.0.0.1" {
+			insertAt = i + 1
+		}
+	}
+
+	lines = append(lines[:insertAt], append([]string{entry}, lines[insertAt:]...)...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// hostsResolves reports whether the hosts file maps the hostname to an address
+func hostsResolves(content, hostname string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		for _, name := range fields[min(1, len(fields)):] {
+			if strings.EqualFold(name, hostname) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setHostname sets the static and transient hostname and maps it in the hosts file
+func setHostname(hostname string) error {
+	if _, err := exec.LookPath("hostnamectl"); err == nil && systemdRunning() {
+		if output, err := exec.Command("hostnamectl", "set-hostname", hostname).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set hostname: %s: %w", strings.TrimSpace(string(output)), err)
+		}
+	} else {
+		if err := safefile.WriteFile(hostnameFile, []byte(hostname+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hostnameFile, err)
+		}
+		if output, err := exec.Command("hostname", hostname).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set hostname: %s: %w", strings.TrimSpace(string(output)), err)
+		}
+	}
+
+	content, err := os.ReadFile(hostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", hostsFile, err)
+	}
+	if err := safefile.WriteFile(hostsFile, []byte(updateHosts(string(content), hostname)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", hostsFile, err)
+	}
+	return nil
+}
+
+// preserveHostname tells cloud-init to keep the hostname, which it otherwise sets from
+// the instance metadata on every boot. It reports whether cloud-init is installed.
+func preserveHostname(root string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(root, "etc/cloud/cloud.cfg")); err != nil {
+		return false, nil
+	}
+	path := filepath.Join(root, cloudInitHostnameFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return true, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	content := "# Managed by INIQ: keep cloud-init from resetting the hostname set by iniq\npreserve_hostname: true\n"
+	if err := safefile.WriteFile(path, []byte(content), 0644); err != nil {
+		return true, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// systemdRunning reports whether systemd is the init system, which hostnamectl,
+// localectl and timedatectl need
+func systemdRunning() bool {
+	kind, err := service.DetectKind("/")
+	return err == nil && kind == service.Systemd
+}
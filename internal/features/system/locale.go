@@ -0,0 +1,210 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/pkgmanager"
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+const (
+	// localeGenFile lists the locales locale-gen builds on Debian and Arch
+	localeGenFile = "/etc/locale.gen"
+	// localeConfFile sets the system locale on systemd distributions
+	localeConfFile = "/etc/locale.conf"
+	// debianLocaleFile sets the system locale on Debian
+	debianLocaleFile = "/etc/default/locale"
+)
+
+// localePattern matches locale names such as en_US.UTF-8, de_DE@euro or C.UTF-8
+var localePattern = regexp.MustCompile(`^([a-z]{2,3}(_[A-Z]{2})?|C)(\.[A-Za-z0-9-]+)?(@[a-z]+)?$`)
+
+// validLocale reports whether name is a locale name
+func validLocale(name string) bool {
+	return name == "POSIX" || localePattern.MatchString(name)
+}
+
+// builtinLocale reports whether a locale is built into the C library and needs no generation
+func builtinLocale(name string) bool {
+	switch strings.ToLower(normalizeLocale(name)) {
+	case "c", "posix", "c.utf8":
+		return true
+	}
+	return false
+}
+
+// normalizeLocale returns a locale name in the form locale -a lists it, where the
+// codeset is lowercase without dashes, such as en_US.utf8 for en_US.UTF-8
+func normalizeLocale(name string) string {
+	base, codeset, found := strings.Cut(name, ".")
+	if !found {
+		return strings.ToLower(base)
+	}
+	modifier := ""
+	if at := strings.Index(codeset, "@"); at >= 0 {
+		codeset, modifier = codeset[:at], codeset[at:]
+	}
+	return base + "." + strings.ToLower(strings.ReplaceAll(codeset, "-", "")) + modifier
+}
+
+// localeGenEntry returns the locale.gen line for a locale, such as "en_US.UTF-8 UTF-8"
+func localeGenEntry(name string) string {
+	charset := "ISO-8859-1"
+	if _, codeset, found := strings.Cut(name, "."); found {
+		codeset, _, _ = strings.Cut(codeset, "@")
+		charset = codeset
+	}
+	return name + " " + charset
+}
+
+// enableLocaleGen returns locale.gen content with the locale enabled, uncommenting its
+// entry or adding one, and whether the content changed
+func enableLocaleGen(content, name string) (string, bool) {
+	entry := localeGenEntry(name)
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.Join(strings.Fields(trimmed), " ") == entry {
+			return content, false
+		}
+		if uncommented := strings.TrimSpace(strings.TrimLeft(trimmed, "#")); strings.Join(strings.Fields(uncommented), " ") == entry {
+			lines[i] = entry
+			return strings.Join(lines, "\n") + "\n", true
+		}
+	}
+	if content == "" {
+		return entry + "\n", true
+	}
+	return strings.Join(append(lines, entry), "\n") + "\n", true
+}
+
+// setLANG returns locale file content with LANG set to the locale
+func setLANG(content, name string) string {
+	line := "LANG=" + name
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+	for i, existing := range lines {
+		if strings.HasPrefix(strings.TrimSpace(existing), "LANG=") {
+			lines[i] = line
+			return strings.Join(lines, "\n") + "\n"
+		}
+	}
+	return strings.Join(append(lines, line), "\n") + "\n"
+}
+
+// readLocale returns the LANG setting of the system locale file under root
+func readLocale(root string) string {
+	for _, path := range []string{localeConfFile, debianLocaleFile} {
+		content, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if value, found := strings.CutPrefix(strings.TrimSpace(line), "LANG="); found {
+				return strings.Trim(value, `"'`)
+			}
+		}
+	}
+	return ""
+}
+
+// availableLocales returns the locales the C library can load, as listed by locale -a
+func availableLocales() []string {
+	output, err := exec.Command("locale", "-a").Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(output))
+}
+
+// localeAvailable reports whether a locale is built in or listed in available
+func localeAvailable(name string, available []string) bool {
+	if builtinLocale(name) {
+		return true
+	}
+	for _, locale := range available {
+		if normalizeLocale(locale) == normalizeLocale(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateLocale makes a locale available, the way the distribution provides locales
+func generateLocale(pm osdetect.PackageManager, name string) error {
+	if localeAvailable(name, availableLocales()) {
+		return nil
+	}
+	manager, err := pkgmanager.New(pm)
+	if err != nil {
+		return fmt.Errorf("failed to generate locale %s: %w", name, err)
+	}
+
+	switch pm {
+	case osdetect.APT, osdetect.Pacman:
+		if pm == osdetect.APT {
+			// locale-gen and locale.gen come with the locales package, which minimal images lack
+			if installed, _ := manager.IsInstalled("locales"); !installed {
+				if err := manager.Install("locales"); err != nil {
+					return fmt.Errorf("failed to install locales: %w", err)
+				}
+			}
+		}
+		content, err := os.ReadFile(localeGenFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", localeGenFile, err)
+		}
+		if updated, changed := enableLocaleGen(string(content), name); changed {
+			if err := safefile.WriteFile(localeGenFile, []byte(updated), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", localeGenFile, err)
+			}
+		}
+		if output, err := exec.Command("locale-gen").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to generate locale %s: %s: %w", name, strings.TrimSpace(string(output)), err)
+		}
+	case osdetect.DNF:
+		// Fedora and RHEL 8+ ship locales in one langpack per language
+		language, _, _ := strings.Cut(name, "_")
+		if err := manager.Install("glibc-langpack-" + language); err != nil {
+			return fmt.Errorf("failed to install locale %s: %w", name, err)
+		}
+	case osdetect.Zypper:
+		if err := manager.Install("glibc-locale"); err != nil {
+			return fmt.Errorf("failed to install locale %s: %w", name, err)
+		}
+	default:
+		// glibc-common on yum systems has all locales, and musl needs none
+	}
+	return nil
+}
+
+// setLocale makes the locale the system default
+func setLocale(name string) error {
+	if _, err := exec.LookPath("localectl"); err == nil && systemdRunning() {
+		if output, err := exec.Command("localectl", "set-locale", "LANG="+name).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set locale: %s: %w", strings.TrimSpace(string(output)), err)
+		}
+		return nil
+	}
+
+	path := localeConfFile
+	if _, err := os.Stat(debianLocaleFile); err == nil {
+		path = debianLocaleFile
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := safefile.WriteFile(path, []byte(setLANG(string(content), name)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
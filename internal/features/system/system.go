@@ -0,0 +1,327 @@
+// Package system implements the hostname, timezone, locale and time sync feature
+package system
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// Feature implements the hostname, timezone, locale and time sync feature
+type Feature struct {
+	osInfo *osdetect.Info
+}
+
+// New creates a new system settings feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+	}
+}
+
+// settings are the requested system settings. Empty values are left unchanged.
+type settings struct {
+	Hostname   string
+	Timezone   string
+	Locale     string
+	NTP        bool
+	NTPServers []string
+}
+
+// settingsFromOptions returns the requested system settings from the options
+func settingsFromOptions(options map[string]any) (settings, error) {
+	var s settings
+	s.Hostname, _ = options["hostname"].(string)
+	s.Timezone, _ = options["timezone"].(string)
+	s.Locale, _ = options["locale"].(string)
+	s.NTP, _ = options["ntp"].(bool)
+	switch v := options["ntp-servers"].(type) {
+	case []string:
+		s.NTPServers = v
+	case []any:
+		for _, item := range v {
+			s.NTPServers = append(s.NTPServers, fmt.Sprint(item))
+		}
+	case string:
+		s.NTPServers = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	s.Hostname = strings.TrimSpace(s.Hostname)
+	s.Timezone = strings.TrimSpace(s.Timezone)
+	s.Locale = strings.TrimSpace(s.Locale)
+	if s.Hostname != "" && !validHostname(s.Hostname) {
+		return s, fmt.Errorf("invalid hostname %q: labels must be letters, digits and hyphens", s.Hostname)
+	}
+	if s.Timezone != "" {
+		if err := validateTimezone("/", s.Timezone); err != nil {
+			return s, err
+		}
+	}
+	if s.Locale != "" && !validLocale(s.Locale) {
+		return s, fmt.Errorf("invalid locale %q: must be a locale such as en_US.UTF-8", s.Locale)
+	}
+	for _, server := range s.NTPServers {
+		if !validNTPServer(server) {
+			return s, fmt.Errorf("invalid NTP server %q: must be a hostname or IP address", server)
+		}
+	}
+	// Configuring servers implies time sync
+	if len(s.NTPServers) > 0 {
+		s.NTP = true
+	}
+	return s, nil
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "system"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Set the hostname, timezone, locale and time sync"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "hostname",
+			Shorthand: "",
+			Usage:     "set the hostname and map it in /etc/hosts",
+			Default:   "",
+			Required:  false,
+		},
+		{
+			Name:      "timezone",
+			Shorthand: "",
+			Usage:     "set the timezone (e.g. Europe/Berlin, UTC)",
+			Default:   "",
+			Required:  false,
+		},
+		{
+			Name:      "locale",
+			Shorthand: "",
+			Usage:     "generate a locale and make it the default (e.g. en_US.UTF-8)",
+			Default:   "",
+			Required:  false,
+		},
+		{
+			Name:      "ntp",
+			Shorthand: "",
+			Usage:     "enable time sync with systemd-timesyncd or chrony",
+			Default:   false,
+			Required:  false,
+		},
+		{
+			Name:      "ntp-servers",
+			Shorthand: "",
+			Usage:     "NTP servers to sync time with, implies --ntp",
+			Default:   []string{},
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	s, _ := settingsFromOptions(options)
+	return s.Hostname != "" || s.Timezone != "" || s.Locale != "" || s.NTP
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	_, err := settingsFromOptions(options)
+	return err
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	s, err := settingsFromOptions(ctx.Options)
+	if err != nil {
+		return err
+	}
+
+	state, _ := f.DetectCurrentState(ctx)
+	currentHostname, _ := state["hostname"].(string)
+	hostnameResolves, _ := state["hostname_resolves"].(bool)
+	currentTimezone, _ := state["timezone"].(string)
+	currentLocale, _ := state["locale"].(string)
+	localeAvailable, _ := state["locale_available"].(bool)
+	timeSyncActive, _ := state["time_sync_active"].(bool)
+	currentServers, _ := state["ntp_servers"].([]string)
+
+	changeHostname := s.Hostname != "" && (s.Hostname != currentHostname || !hostnameResolves)
+	changeTimezone := s.Timezone != "" && s.Timezone != currentTimezone
+	changeLocale := s.Locale != "" && (s.Locale != currentLocale || !localeAvailable)
+	changeTimeSync := s.NTP && (!timeSyncActive || (len(s.NTPServers) > 0 && !slices.Equal(s.NTPServers, currentServers)))
+
+	if !changeHostname && !changeTimezone && !changeLocale && !changeTimeSync {
+		ctx.Logger.Success("✓ System settings already configured")
+		return nil
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		if changeHostname {
+			ctx.Logger.Info("Would set hostname to %s and map it in %s", s.Hostname, hostsFile)
+		}
+		if changeTimezone {
+			ctx.Logger.Info("Would set timezone to %s", s.Timezone)
+		}
+		if changeLocale {
+			ctx.Logger.Info("Would generate locale %s and make it the default", s.Locale)
+		}
+		if changeTimeSync {
+			if len(s.NTPServers) > 0 {
+				ctx.Logger.Info("Would enable time sync with %s", strings.Join(s.NTPServers, ", "))
+			} else {
+				ctx.Logger.Info("Would enable time sync")
+			}
+		}
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("changing system settings requires root privileges")
+	}
+
+	if changeHostname {
+		ctx.Logger.Step("Setting hostname to %s...", s.Hostname)
+		if err := setHostname(s.Hostname); err != nil {
+			return err
+		}
+		if installed, err := preserveHostname("/"); err != nil {
+			ctx.Logger.Warning("cloud-init may reset the hostname at boot: %v", err)
+		} else if installed {
+			ctx.Logger.Info("Set preserve_hostname in %s so cloud-init keeps the hostname", cloudInitHostnameFile)
+		}
+	}
+
+	if changeTimezone {
+		ctx.Logger.Step("Setting timezone to %s...", s.Timezone)
+		if err := setTimezone("/", s.Timezone); err != nil {
+			return err
+		}
+	}
+
+	if changeLocale {
+		ctx.Logger.Step("Setting locale to %s...", s.Locale)
+		if err := generateLocale(f.osInfo.PackageManager, s.Locale); err != nil {
+			return err
+		}
+		if err := setLocale(s.Locale); err != nil {
+			return err
+		}
+	}
+
+	if changeTimeSync {
+		ctx.Logger.Step("Enabling time sync...")
+		kind, err := enableTimeSync(f.osInfo.PackageManager, s.NTPServers)
+		if err != nil {
+			return err
+		}
+		ctx.Logger.Info("Time sync enabled with %s", kind)
+	}
+
+	ctx.Logger.Success("System settings configured")
+	return nil
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 2 // The hostname is set first, sudo warns when it does not resolve
+}
+
+// DetectCurrentState detects and returns the current state of the system settings
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return state, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	state["hostname"] = hostname
+	hosts, _ := os.ReadFile(hostsFile)
+	state["hostname_resolves"] = hostname == "localhost" || hostsResolves(string(hosts), hostname)
+
+	state["timezone"] = readTimezone("/")
+
+	locale := readLocale("/")
+	state["locale"] = locale
+	state["locale_available"] = locale != "" && localeAvailable(locale, availableLocales())
+
+	kind := detectTimeSync("/")
+	state["time_sync"] = kind
+	state["time_sync_active"] = timeSyncActive(kind)
+	state["ntp_servers"] = configuredServers("/", kind)
+	if synchronized, known := clockSynchronized(); known {
+		state["time_synchronized"] = synchronized
+	}
+
+	return state, nil
+}
+
+// DisplayCurrentState displays the current state of the system settings
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	hostname, _ := state["hostname"].(string)
+	hostnameResolves, _ := state["hostname_resolves"].(bool)
+	timezone, _ := state["timezone"].(string)
+	locale, _ := state["locale"].(string)
+	localeAvailable, _ := state["locale_available"].(bool)
+	kind, _ := state["time_sync"].(string)
+	active, _ := state["time_sync_active"].(bool)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: \033[0;37m%s\033[0m", "Hostname", hostname)
+	if !hostnameResolves {
+		fmt.Printf(" \033[1;33m⚠ not in %s\033[0m", hostsFile)
+	}
+	fmt.Println()
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Timezone")
+	if timezone != "" {
+		fmt.Printf("\033[0;37m%s\033[0m\n", timezone)
+	} else {
+		fmt.Printf("\033[1;33m⚠ Unknown\033[0m\n")
+	}
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Locale")
+	switch {
+	case locale == "":
+		fmt.Printf("\033[1;33m⚠ Not set\033[0m\n")
+	case !localeAvailable:
+		fmt.Printf("\033[0;37m%s\033[0m \033[1;33m⚠ not generated\033[0m\n", locale)
+	default:
+		fmt.Printf("\033[0;37m%s\033[0m\n", locale)
+	}
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Time Sync")
+	switch {
+	case active:
+		fmt.Printf("\033[1;32m✓ Enabled\033[0m \033[90m(%s)\033[0m\n", kind)
+	case kind != "":
+		fmt.Printf("\033[1;33m⚠ %s not running\033[0m\n", kind)
+	default:
+		fmt.Printf("\033[1;31m✗ Not installed\033[0m\n")
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// New systems usually need their identity set, so the settings are always offered
+	skipSudo, _ := ctx.Options["skip-sudo"].(bool)
+	return !skipSudo
+}
@@ -0,0 +1,450 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSettingsFromOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]any
+		want      settings
+		expectErr bool
+	}{
+		{
+			name:    "nothing requested",
+			options: map[string]any{},
+			want:    settings{},
+		},
+		{
+			name:    "hostname and locale",
+			options: map[string]any{"hostname": " web-01.example.com ", "locale": "en_US.UTF-8"},
+			want:    settings{Hostname: "web-01.example.com", Locale: "en_US.UTF-8"},
+		},
+		{
+			name:    "servers imply ntp",
+			options: map[string]any{"ntp-servers": []any{"time.cloudflare.com", "192.0.2.123"}},
+			want:    settings{NTP: true, NTPServers: []string{"time.cloudflare.com", "192.0.2.123"}},
+		},
+		{
+			name:    "servers as comma-separated string",
+			options: map[string]any{"ntp-servers": "0.pool.ntp.org, 1.pool.ntp.org"},
+			want:    settings{NTP: true, NTPServers: []string{"0.pool.ntp.org", "1.pool.ntp.org"}},
+		},
+		{name: "invalid hostname", options: map[string]any{"hostname": "web_01"}, expectErr: true},
+		{name: "timezone outside database", options: map[string]any{"timezone": "../../etc/passwd"}, expectErr: true},
+		{name: "invalid locale", options: map[string]any{"locale": "english"}, expectErr: true},
+		{name: "invalid server", options: map[string]any{"ntp-servers": []string{"ntp server"}}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := settingsFromOptions(tt.options)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		want     bool
+	}{
+		{"short name", "web01", true},
+		{"fully qualified", "web-01.example.com", true},
+		{"empty", "", false},
+		{"underscore", "web_01", false},
+		{"leading hyphen", "-web", false},
+		{"empty label", "web..example.com", false},
+		{"label too long", strings.Repeat("a", 64), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validHostname(tt.hostname); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUpdateHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		hostname string
+		want     string
+	}{
+		{
+			name:     "replace existing entry",
+			content:  "127.0.0.1\tlocalhost\n127.0.1.1\told-name\n\n::1\tlocalhost ip6-localhost\n",
+			hostname: "web01",
+			want:     "127.0.0.1\tlocalhost\n127.0.1.1\tweb01\n\n::1\tlocalhost ip6-localhost\n",
+		},
+		{
+			name:     "insert after localhost with short name",
+			content:  "127.0.0.1   localhost localhost.localdomain\n::1         localhost6\n",
+			hostname: "web01.example.com",
+			want:     "127.0.0.1   localhost localhost.localdomain\n127.0.1.1\tweb01.example.com web01\n::1         localhost6\n",
+		},
+		{
+			name:     "empty hosts file",
+			content:  "",
+			hostname: "web01",
+			want:     "127.0.1.1\tweb01\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := updateHosts(tt.content, tt.hostname)
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if !hostsResolves(got, tt.hostname) {
+				t.Errorf("Expected %s to resolve in %q", tt.hostname, got)
+			}
+			if again := updateHosts(got, tt.hostname); again != got {
+				t.Errorf("Expected update to be idempotent, got %q", again)
+			}
+		})
+	}
+}
+
+func TestHostsResolves(t *testing.T) {
+	content := "127.0.0.1 localhost\n# 127.0.1.1 commented\n10.0.0.5 db01.internal DB01\n"
+
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{"localhost", true},
+		{"db01", true},
+		{"db01.internal", true},
+		{"commented", false},
+		{"127.0.0.1", false},
+		{"web01", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			if got := hostsResolves(content, tt.hostname); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// newZoneinfoRoot returns a temporary root with a minimal time zone database
+func newZoneinfoRoot(t *testing.T) string {
+	t.Helper()
+	root, err := os.MkdirTemp("", "iniq-system-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	for _, zone := range []string{"UTC", "Europe/Berlin", "America/New_York"} {
+		path := filepath.Join(root, zoneinfoDir, zone)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create zoneinfo dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("TZif"), 0644); err != nil {
+			t.Fatalf("Failed to write zone: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatalf("Failed to create etc: %v", err)
+	}
+	return root
+}
+
+func TestValidateTimezone(t *testing.T) {
+	root := newZoneinfoRoot(t)
+
+	tests := []struct {
+		name      string
+		tz        string
+		expectErr bool
+	}{
+		{"zone", "Europe/Berlin", false},
+		{"UTC", "UTC", false},
+		{"unknown zone", "Mars/Olympus", true},
+		{"directory", "Europe", true},
+		{"absolute path", "/etc/passwd", true},
+		{"parent directory", "../../etc/passwd", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTimezone(root, tt.tz)
+			if tt.expectErr && err == nil {
+				t.Errorf("Expected error, got nil")
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadTimezone(t *testing.T) {
+	root := newZoneinfoRoot(t)
+	localtime := filepath.Join(root, localtimeFile)
+
+	if got := readTimezone(root); got != "UTC" {
+		t.Errorf("Expected UTC without localtime, got %q", got)
+	}
+
+	if err := os.Symlink("../usr/share/zoneinfo/posix/Europe/Berlin", localtime); err != nil {
+		t.Fatalf("Failed to link localtime: %v", err)
+	}
+	if got := readTimezone(root); got != "Europe/Berlin" {
+		t.Errorf("Expected Europe/Berlin from posix link, got %q", got)
+	}
+
+	// A copied localtime falls back to the timezone file
+	os.Remove(localtime)
+	if err := os.WriteFile(localtime, []byte("TZif"), 0644); err != nil {
+		t.Fatalf("Failed to write localtime: %v", err)
+	}
+	if got := readTimezone(root); got != "" {
+		t.Errorf("Expected unknown timezone for copied localtime, got %q", got)
+	}
+	if err := os.WriteFile(filepath.Join(root, timezoneFile), []byte("America/New_York\n"), 0644); err != nil {
+		t.Fatalf("Failed to write timezone file: %v", err)
+	}
+	if got := readTimezone(root); got != "America/New_York" {
+		t.Errorf("Expected America/New_York from timezone file, got %q", got)
+	}
+}
+
+func TestSetTimezone(t *testing.T) {
+	root := newZoneinfoRoot(t)
+	if err := os.WriteFile(filepath.Join(root, localtimeFile), []byte("TZif"), 0644); err != nil {
+		t.Fatalf("Failed to write localtime: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, timezoneFile), []byte("UTC\n"), 0644); err != nil {
+		t.Fatalf("Failed to write timezone file: %v", err)
+	}
+
+	if err := setTimezone(root, "Europe/Berlin"); err != nil {
+		t.Fatalf("Failed to set timezone: %v", err)
+	}
+	target, err := os.Readlink(filepath.Join(root, localtimeFile))
+	if err != nil {
+		t.Fatalf("Expected localtime to be a link: %v", err)
+	}
+	if target != "/usr/share/zoneinfo/Europe/Berlin" {
+		t.Errorf("Expected link to Europe/Berlin, got %s", target)
+	}
+	content, _ := os.ReadFile(filepath.Join(root, timezoneFile))
+	if string(content) != "Europe/Berlin\n" {
+		t.Errorf("Expected timezone file to be updated, got %q", content)
+	}
+	if got := readTimezone(root); got != "Europe/Berlin" {
+		t.Errorf("Expected Europe/Berlin, got %q", got)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"en_US.UTF-8", "en_US.utf8"},
+		{"de_DE.ISO-8859-15@euro", "de_DE.iso885915@euro"},
+		{"C.UTF-8", "C.utf8"},
+		{"POSIX", "posix"},
+		{"en_US", "en_us"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeLocale(tt.name); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if !localeAvailable("en_US.UTF-8", []string{"C", "C.utf8", "en_US.utf8", "POSIX"}) {
+		t.Errorf("Expected en_US.UTF-8 to match en_US.utf8")
+	}
+	if localeAvailable("de_DE.UTF-8", []string{"C", "en_US.utf8"}) {
+		t.Errorf("Expected de_DE.UTF-8 to be unavailable")
+	}
+	if !localeAvailable("C.UTF-8", nil) {
+		t.Errorf("Expected C.UTF-8 to be built in")
+	}
+}
+
+func TestEnableLocaleGen(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		locale      string
+		want        string
+		wantChanged bool
+	}{
+		{
+			name:        "uncomment entry",
+			content:     "# de_DE.UTF-8 UTF-8\n# en_US.UTF-8 UTF-8\n",
+			locale:      "en_US.UTF-8",
+			want:        "# de_DE.UTF-8 UTF-8\nen_US.UTF-8 UTF-8\n",
+			wantChanged: true,
+		},
+		{
+			name:        "already enabled",
+			content:     "en_US.UTF-8 UTF-8\n",
+			locale:      "en_US.UTF-8",
+			want:        "en_US.UTF-8 UTF-8\n",
+			wantChanged: false,
+		},
+		{
+			name:        "add missing entry",
+			content:     "en_US.UTF-8 UTF-8\n",
+			locale:      "de_DE.ISO-8859-15@euro",
+			want:        "en_US.UTF-8 UTF-8\nde_DE.ISO-8859-15@euro ISO-8859-15\n",
+			wantChanged: true,
+		},
+		{
+			name:        "empty file",
+			content:     "",
+			locale:      "en_GB",
+			want:        "en_GB ISO-8859-1\n",
+			wantChanged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := enableLocaleGen(tt.content, tt.locale)
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("Expected changed %v, got %v", tt.wantChanged, changed)
+			}
+		})
+	}
+}
+
+func TestSetLANGAndReadLocale(t *testing.T) {
+	if got := setLANG("", "en_US.UTF-8"); got != "LANG=en_US.UTF-8\n" {
+		t.Errorf("Expected new LANG line, got %q", got)
+	}
+	if got := setLANG("LANG=C\nLC_TIME=de_DE.UTF-8\n", "en_US.UTF-8"); got != "LANG=en_US.UTF-8\nLC_TIME=de_DE.UTF-8\n" {
+		t.Errorf("Expected LANG to be replaced, got %q", got)
+	}
+
+	root, err := os.MkdirTemp("", "iniq-system-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	if got := readLocale(root); got != "" {
+		t.Errorf("Expected no locale, got %q", got)
+	}
+	path := filepath.Join(root, debianLocaleFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("#  File generated by update-locale\nLANG=\"en_GB.UTF-8\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write locale file: %v", err)
+	}
+	if got := readLocale(root); got != "en_GB.UTF-8" {
+		t.Errorf("Expected en_GB.UTF-8, got %q", got)
+	}
+}
+
+func TestRewriteChrony(t *testing.T) {
+	content := "# Use Debian vendor zone.\npool 2.debian.pool.ntp.org iburst\nserver ntp.example.com\n\ndriftfile /var/lib/chrony/chrony.drift\n"
+	want := "# Use Debian vendor zone.\n" +
+		"#iniq: pool 2.debian.pool.ntp.org iburst\n" +
+		"#iniq: server ntp.example.com\n" +
+		"\n" +
+		"driftfile /var/lib/chrony/chrony.drift\n" +
+		"\n" +
+		"# BEGIN INIQ servers\n" +
+		"server time.cloudflare.com iburst\n" +
+		"server 192.0.2.123 iburst\n" +
+		"# END INIQ servers\n"
+
+	got := rewriteChrony(content, []string{"time.cloudflare.com", "192.0.2.123"})
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if again := rewriteChrony(got, []string{"time.cloudflare.com", "192.0.2.123"}); again != want {
+		t.Errorf("Expected rewrite to be idempotent, got %q", again)
+	}
+
+	// Changing the servers replaces the block
+	changed := rewriteChrony(got, []string{"ntp.internal"})
+	if want := "# BEGIN INIQ servers\nserver ntp.internal iburst\n# END INIQ servers\n"; changed[len(changed)-len(want):] != want {
+		t.Errorf("Expected servers to be replaced, got %q", changed)
+	}
+}
+
+func TestTimeSyncConfiguration(t *testing.T) {
+	root, err := os.MkdirTemp("", "iniq-system-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	if kind := detectTimeSync(root); kind != "" {
+		t.Errorf("Expected no time sync service, got %s", kind)
+	}
+
+	// systemd-timesyncd
+	unit := filepath.Join(root, "lib/systemd/system", timesyncd+".service")
+	dropIn := filepath.Join(root, timesyncdDropIn)
+	for _, dir := range []string{filepath.Dir(unit), filepath.Dir(dropIn)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(unit, []byte("[Unit]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write unit: %v", err)
+	}
+	if kind := detectTimeSync(root); kind != timesyncd {
+		t.Errorf("Expected %s, got %s", timesyncd, kind)
+	}
+	servers := []string{"0.pool.ntp.org", "1.pool.ntp.org"}
+	if err := os.WriteFile(dropIn, []byte(renderTimesyncd(servers)), 0644); err != nil {
+		t.Fatalf("Failed to write drop-in: %v", err)
+	}
+	if got := configuredServers(root, timesyncd); !reflect.DeepEqual(got, servers) {
+		t.Errorf("Expected %v, got %v", servers, got)
+	}
+
+	// chrony is preferred when both are installed
+	config := filepath.Join(root, chronyConfigFiles[1])
+	if err := os.WriteFile(config, []byte(rewriteChrony("pool 2.rhel.pool.ntp.org iburst\n", []string{"ntp.internal"})), 0644); err != nil {
+		t.Fatalf("Failed to write chrony config: %v", err)
+	}
+	if kind := detectTimeSync(root); kind != chrony {
+		t.Errorf("Expected %s, got %s", chrony, kind)
+	}
+	if got := configuredServers(root, chrony); !reflect.DeepEqual(got, []string{"ntp.internal"}) {
+		t.Errorf("Expected [ntp.internal], got %v", got)
+	}
+}
@@ -0,0 +1,235 @@
+package system
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/pkgmanager"
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+const (
+	// timesyncd and chrony are the time sync services INIQ configures
+	timesyncd = "systemd-timesyncd"
+	chrony    = "chrony"
+
+	// timesyncdDropIn sets the NTP servers of systemd-timesyncd
+	timesyncdDropIn = "/etc/systemd/timesyncd.conf.d/iniq.conf"
+
+	// chronyBegin and chronyEnd delimit the servers INIQ adds to the chrony configuration
+	chronyBegin = "# BEGIN INIQ servers"
+	chronyEnd   = "# END INIQ servers"
+	// chronyDisabled prefixes the server and pool lines INIQ comments out
+	chronyDisabled = "#iniq: "
+)
+
+// chronyConfigFiles are where distributions keep the chrony configuration, Debian first
+var chronyConfigFiles = []string{"/etc/chrony/chrony.conf", "/etc/chrony.conf"}
+
+// validNTPServer reports whether server is a hostname or IP address
+func validNTPServer(server string) bool {
+	if _, err := netip.ParseAddr(server); err == nil {
+		return true
+	}
+	return validHostname(server)
+}
+
+// detectTimeSync returns the time sync service installed on the system under root,
+// preferring chrony, or an empty string when there is none
+func detectTimeSync(root string) string {
+	for _, path := range chronyConfigFiles {
+		if _, err := os.Stat(filepath.Join(root, path)); err == nil {
+			return chrony
+		}
+	}
+	for _, dir := range []string{"usr/lib/systemd/system", "lib/systemd/system"} {
+		if _, err := os.Stat(filepath.Join(root, dir, timesyncd+".service")); err == nil {
+			return timesyncd
+		}
+	}
+	return ""
+}
+
+// renderTimesyncd returns the systemd-timesyncd drop-in that sets the NTP servers
+func renderTimesyncd(servers []string) string {
+	return "# Managed by INIQ, changes will be overwritten\n" +
+		"[Time]\n" +
+		"NTP=" + strings.Join(servers, " ") + "\n"
+}
+
+// rewriteChrony returns chrony configuration that uses only the given servers. The
+// existing server and pool lines are commented out and the servers are added in a block.
+func rewriteChrony(content string, servers []string) string {
+	var lines []string
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		switch {
+		case line == chronyBegin:
+			inBlock = true
+			continue
+		case line == chronyEnd:
+			inBlock = false
+			continue
+		case inBlock:
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 0 && (fields[0] == "server" || fields[0] == "pool") {
+			line = chronyDisabled + line
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	lines = append(lines, "", chronyBegin)
+	for _, server := range servers {
+		lines = append(lines, "server "+server+" iburst")
+	}
+	lines = append(lines, chronyEnd)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// configuredServers returns the NTP servers INIQ configured for a time sync service
+func configuredServers(root, kind string) []string {
+	var servers []string
+	switch kind {
+	case timesyncd:
+		content, _ := os.ReadFile(filepath.Join(root, timesyncdDropIn))
+		for _, line := range strings.Split(string(content), "\n") {
+			if value, found := strings.CutPrefix(line, "NTP="); found {
+				servers = strings.Fields(value)
+			}
+		}
+	case chrony:
+		for _, path := range chronyConfigFiles {
+			content, err := os.ReadFile(filepath.Join(root, path))
+			if err != nil {
+				continue
+			}
+			inBlock := false
+			for _, line := range strings.Split(string(content), "\n") {
+				switch {
+				case line == chronyBegin:
+					inBlock = true
+				case line == chronyEnd:
+					inBlock = false
+				case inBlock:
+					if fields := strings.Fields(line); len(fields) > 1 {
+						servers = append(servers, fields[1])
+					}
+				}
+			}
+			break
+		}
+	}
+	return servers
+}
+
+// timeSyncActive reports whether a time sync service is running
+func timeSyncActive(kind string) bool {
+	if kind == "" {
+		return false
+	}
+	manager, err := service.Detect()
+	if err != nil {
+		return false
+	}
+	name, err := manager.Resolve(kind)
+	if err != nil {
+		return false
+	}
+	active, _ := manager.IsActive(name)
+	return active
+}
+
+// clockSynchronized returns whether the clock is synchronized, as far as timedatectl knows
+func clockSynchronized() (bool, bool) {
+	if !systemdRunning() {
+		return false, false
+	}
+	output, err := exec.Command("timedatectl", "show", "--property=NTPSynchronized", "--value").Output()
+	if err != nil {
+		return false, false
+	}
+	return strings.TrimSpace(string(output)) == "yes", true
+}
+
+// enableTimeSync configures the NTP servers, if any, and starts time synchronization.
+// chrony is installed when the system has no time sync service.
+func enableTimeSync(pm osdetect.PackageManager, servers []string) (string, error) {
+	kind := detectTimeSync("/")
+	if kind == "" {
+		manager, err := pkgmanager.New(pm)
+		if err != nil {
+			return "", fmt.Errorf("failed to install chrony: %w", err)
+		}
+		if err := manager.Install("chrony"); err != nil {
+			return "", fmt.Errorf("failed to install chrony: %w", err)
+		}
+		kind = chrony
+	}
+
+	services, err := service.Detect()
+	if err != nil {
+		return kind, err
+	}
+	name, err := services.Resolve(kind)
+	if err != nil {
+		return kind, err
+	}
+
+	if len(servers) > 0 {
+		if err := writeServers(kind, servers); err != nil {
+			return kind, err
+		}
+	}
+
+	if kind == timesyncd {
+		// set-ntp also stops other time sync services that would fight over the clock
+		if output, err := exec.Command("timedatectl", "set-ntp", "true").CombinedOutput(); err != nil {
+			return kind, fmt.Errorf("failed to enable time sync: %s: %w", strings.TrimSpace(string(output)), err)
+		}
+	} else if err := services.Enable(name); err != nil {
+		return kind, err
+	}
+	if err := services.Restart(name); err != nil {
+		return kind, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	return kind, nil
+}
+
+// writeServers sets the NTP servers of a time sync service
+func writeServers(kind string, servers []string) error {
+	if kind == timesyncd {
+		if err := os.MkdirAll(filepath.Dir(timesyncdDropIn), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(timesyncdDropIn), err)
+		}
+		if err := safefile.WriteFile(timesyncdDropIn, []byte(renderTimesyncd(servers)), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", timesyncdDropIn, err)
+		}
+		return nil
+	}
+
+	for _, path := range chronyConfigFiles {
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := safefile.WriteFile(path, []byte(rewriteChrony(string(content), servers)), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("chrony configuration not found")
+}
@@ -0,0 +1,77 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+const (
+	// zoneinfoDir holds the time zone database
+	zoneinfoDir = "/usr/share/zoneinfo"
+	// localtimeFile links to the system time zone in zoneinfoDir
+	localtimeFile = "/etc/localtime"
+	// timezoneFile names the time zone on Debian, next to the localtime link
+	timezoneFile = "/etc/timezone"
+)
+
+// validateTimezone checks that tz names a zone in the time zone database under root
+func validateTimezone(root, tz string) error {
+	if tz == "" || filepath.IsAbs(tz) || strings.Contains(tz, "..") {
+		return fmt.Errorf("invalid timezone %q: must be a zone such as Europe/Berlin or UTC", tz)
+	}
+	info, err := os.Stat(filepath.Join(root, zoneinfoDir, tz))
+	if err != nil || !info.Mode().IsRegular() {
+		return fmt.Errorf("unknown timezone %q: not found in %s", tz, zoneinfoDir)
+	}
+	return nil
+}
+
+// readTimezone returns the system time zone of the file system mounted at root, from the
+// target of the localtime link, or from the timezone file when localtime is a copy
+func readTimezone(root string) string {
+	if target, err := os.Readlink(filepath.Join(root, localtimeFile)); err == nil {
+		if _, zone, found := strings.Cut(target, "zoneinfo/"); found {
+			// Zones may also be linked from the posix/ and right/ variants of the database
+			for _, prefix := range []string{"posix/", "right/"} {
+				zone = strings.TrimPrefix(zone, prefix)
+			}
+			return zone
+		}
+	}
+	if content, err := os.ReadFile(filepath.Join(root, timezoneFile)); err == nil {
+		return strings.TrimSpace(string(content))
+	}
+	if _, err := os.Stat(filepath.Join(root, localtimeFile)); os.IsNotExist(err) {
+		// glibc and musl use UTC when there is no localtime
+		return "UTC"
+	}
+	return ""
+}
+
+// setTimezone points the localtime link of the file system mounted at root to a zone.
+// The link is replaced with a rename, so it is never missing.
+func setTimezone(root, tz string) error {
+	localtime := filepath.Join(root, localtimeFile)
+	temp := localtime + ".iniq-new"
+	os.Remove(temp)
+	if err := os.Symlink(filepath.Join(zoneinfoDir, tz), temp); err != nil {
+		return fmt.Errorf("failed to link %s: %w", localtimeFile, err)
+	}
+	if err := os.Rename(temp, localtime); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to link %s: %w", localtimeFile, err)
+	}
+
+	// Debian reads the zone name from /etc/timezone, which must agree with the link
+	path := filepath.Join(root, timezoneFile)
+	if _, err := os.Stat(path); err == nil {
+		if err := safefile.WriteFile(path, []byte(tz+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", timezoneFile, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package updates
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+const (
+	// aptPeriodicFile turns on the daily apt-get update and unattended-upgrade runs
+	aptPeriodicFile = "/etc/apt/apt.conf.d/20auto-upgrades"
+	// aptUnattendedFile overrides settings of the packaged 50unattended-upgrades, which
+	// already limits upgrades to the security archive
+	aptUnattendedFile = "/etc/apt/apt.conf.d/52iniq-unattended-upgrades"
+
+	// dnfAutomaticFile is the dnf-automatic configuration, read by dnf4 and dnf5
+	dnfAutomaticFile = "/etc/dnf/automatic.conf"
+	// dnfTimer is the timer unit that runs dnf-automatic
+	dnfTimer = "dnf-automatic.timer"
+	// dnf5Timer is the timer unit of dnf5-plugin-automatic, which replaces dnf-automatic from Fedora 41
+	dnf5Timer = "dnf5-automatic.timer"
+
+	// zypperScript, zypperService and zypperTimer install security patches on SUSE,
+	// which ships no unattended patching of its own
+	zypperScript  = "/usr/local/sbin/iniq-security-patch"
+	zypperService = "/etc/systemd/system/iniq-security-patch.service"
+	zypperTimer   = "iniq-security-patch.timer"
+)
+
+// managedHeader starts every file the feature writes
+const managedHeader = "Managed by INIQ, changes will be overwritten"
+
+// rebootTimePattern matches a time of day in 24-hour HH:MM format
+var rebootTimePattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+// mailPattern matches plain email addresses. Addresses are written into a shell script,
+// so the rarer characters RFC 5322 allows are rejected.
+var mailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$`)
+
+// settings are the automatic update settings from the configuration
+type settings struct {
+	// Reboot reboots the system when an update requires it
+	Reboot bool
+	// RebootTime is the start of the reboot window, in HH:MM format
+	RebootTime string
+	// Mail is the address update reports are mailed to, empty to not send mail
+	Mail string
+	// Syslog also logs unattended-upgrades runs to syslog
+	Syslog bool
+}
+
+// configFile is a file written by the feature
+type configFile struct {
+	Path    string
+	Content string
+	Mode    uint32
+}
+
+// plan is what a distribution family needs for automatic security updates
+type plan struct {
+	// Tool names the update mechanism, as shown in status output
+	Tool string
+	// Packages are installed before the files are written
+	Packages []string
+	// Files are written with their content
+	Files []configFile
+	// Timer is the systemd timer that runs the updates, empty when the package schedules them itself
+	Timer string
+}
+
+// settingsFromOptions returns the update settings from the options
+func settingsFromOptions(options map[string]any) (settings, error) {
+	s := settings{RebootTime: "03:00"}
+	s.Reboot, _ = options["auto-updates-reboot"].(bool)
+	s.Syslog, _ = options["auto-updates-syslog"].(bool)
+	if rebootTime, _ := options["auto-updates-reboot-time"].(string); strings.TrimSpace(rebootTime) != "" {
+		s.RebootTime = strings.TrimSpace(rebootTime)
+	}
+	if address, _ := options["auto-updates-mail"].(string); strings.TrimSpace(address) != "" {
+		s.Mail = strings.TrimSpace(address)
+	}
+
+	if !rebootTimePattern.MatchString(s.RebootTime) {
+		return s, fmt.Errorf("invalid auto-updates-reboot-time %q: must be a time of day such as 03:00", s.RebootTime)
+	}
+	if s.Mail != "" && !mailPattern.MatchString(s.Mail) {
+		return s, fmt.Errorf("invalid auto-updates-mail %q: must be an email address", s.Mail)
+	}
+	return s, nil
+}
+
+// planUpdates returns the packages and files that enable automatic security updates
+// with the given package manager
+func planUpdates(pm osdetect.PackageManager, s settings) (plan, error) {
+	switch pm {
+	case osdetect.APT:
+		return plan{
+			Tool:     "unattended-upgrades",
+			Packages: []string{"unattended-upgrades"},
+			Files: []configFile{
+				{Path: aptPeriodicFile, Content: renderAPTPeriodic(), Mode: 0644},
+				{Path: aptUnattendedFile, Content: renderAPTUnattended(s), Mode: 0644},
+			},
+		}, nil
+	case osdetect.DNF:
+		p := plan{
+			Tool:     "dnf-automatic",
+			Packages: []string{"dnf-automatic"},
+			Files:    []configFile{{Path: dnfAutomaticFile, Content: renderDNFAutomatic(s), Mode: 0644}},
+			Timer:    dnfTimer,
+		}
+		if s.Reboot {
+			// dnf-automatic reboots right after updating, so the updates move into the window
+			p.Files = append(p.Files, configFile{Path: timerDropIn(dnfTimer), Content: renderTimerDropIn(s), Mode: 0644})
+		}
+		return p, nil
+	case osdetect.Zypper:
+		return plan{
+			Tool: "zypper patch",
+			Files: []configFile{
+				{Path: zypperScript, Content: renderZypperScript(s), Mode: 0755},
+				{Path: zypperService, Content: renderZypperService(), Mode: 0644},
+				{Path: "/etc/systemd/system/" + zypperTimer, Content: renderZypperTimer(s), Mode: 0644},
+			},
+			Timer: zypperTimer,
+		}, nil
+	case osdetect.YUM:
+		return plan{}, fmt.Errorf("automatic updates need dnf-automatic, which yum-based systems do not have")
+	}
+	return plan{}, fmt.Errorf("automatic updates are not supported with package manager %s", pm)
+}
+
+// withTimer returns the plan with its timer, and the timer's drop-in, renamed
+func (p plan) withTimer(timer string) plan {
+	files := make([]configFile, len(p.Files))
+	for i, file := range p.Files {
+		if file.Path == timerDropIn(p.Timer) {
+			file.Path = timerDropIn(timer)
+		}
+		files[i] = file
+	}
+	p.Files = files
+	p.Timer = timer
+	return p
+}
+
+// timerDropIn returns the path of the drop-in that overrides the schedule of a timer
+func timerDropIn(timer string) string {
+	return "/etc/systemd/system/" + timer + ".d/iniq.conf"
+}
+
+// renderAPTPeriodic returns the content of 20auto-upgrades
+func renderAPTPeriodic() string {
+	return "// " + managedHeader + "\n" +
+		"APT::Periodic::Update-Package-Lists \"1\";\n" +
+		"APT::Periodic::Unattended-Upgrade \"1\";\n" +
+		"APT::Periodic::AutocleanInterval \"7\";\n"
+}
+
+// renderAPTUnattended returns the unattended-upgrades settings
+func renderAPTUnattended(s settings) string {
+	var content strings.Builder
+	content.WriteString("// " + managedHeader + "\n")
+	fmt.Fprintf(&content, "Unattended-Upgrade::Automatic-Reboot \"%t\";\n", s.Reboot)
+	if s.Reboot {
+		content.WriteString("Unattended-Upgrade::Automatic-Reboot-WithUsers \"true\";\n")
+		fmt.Fprintf(&content, "Unattended-Upgrade::Automatic-Reboot-Time \"%s\";\n", s.RebootTime)
+	}
+	if s.Mail != "" {
+		fmt.Fprintf(&content, "Unattended-Upgrade::Mail \"%s\";\n", s.Mail)
+		content.WriteString("Unattended-Upgrade::MailReport \"on-change\";\n")
+	}
+	fmt.Fprintf(&content, "Unattended-Upgrade::SyslogEnable \"%t\";\n", s.Syslog)
+	return content.String()
+}
+
+// renderDNFAutomatic returns the content of automatic.conf
+func renderDNFAutomatic(s settings) string {
+	reboot := "never"
+	if s.Reboot {
+		reboot = "when-needed"
+	}
+	emitters := "stdio"
+	if s.Mail != "" {
+		emitters += ",email"
+	}
+
+	var content strings.Builder
+	content.WriteString("# " + managedHeader + "\n")
+	content.WriteString("[commands]\n")
+	content.WriteString("upgrade_type = security\n")
+	content.WriteString("random_sleep = 0\n")
+	content.WriteString("download_updates = yes\n")
+	content.WriteString("apply_updates = yes\n")
+	fmt.Fprintf(&content, "reboot = %s\n", reboot)
+	content.WriteString("\n[emitters]\n")
+	fmt.Fprintf(&content, "emit_via = %s\n", emitters)
+	if s.Mail != "" {
+		content.WriteString("\n[email]\n")
+		content.WriteString("email_from = root\n")
+		fmt.Fprintf(&content, "email_to = %s\n", s.Mail)
+		content.WriteString("email_host = localhost\n")
+	}
+	content.WriteString("\n[base]\n")
+	content.WriteString("debuglevel = 1\n")
+	return content.String()
+}
+
+// renderTimerDropIn returns a timer drop-in that runs the updates daily in the reboot window
+func renderTimerDropIn(s settings) string {
+	return "# " + managedHeader + "\n" +
+		"[Timer]\n" +
+		"OnCalendar=\n" +
+		fmt.Sprintf("OnCalendar=*-*-* %s\n", s.RebootTime) +
+		"RandomizedDelaySec=30m\n" +
+		// A run missed while the system was off would otherwise reboot it outside the window
+		"Persistent=false\n"
+}
+
+// renderZypperScript returns the script that installs security patches and reboots when one requires it
+func renderZypperScript(s settings) string {
+	var content strings.Builder
+	content.WriteString("#!/bin/sh\n")
+	content.WriteString("# " + managedHeader + "\n")
+	content.WriteString("patch=\"zypper --non-interactive patch --category security --auto-agree-with-licenses\"\n")
+	content.WriteString("log=$(mktemp)\n")
+	content.WriteString("$patch >\"$log\" 2>&1\n")
+	content.WriteString("status=$?\n")
+	content.WriteString("# 103 means zypper updated itself and must run again to install the remaining patches\n")
+	content.WriteString("if [ $status -eq 103 ]; then\n")
+	content.WriteString("\t$patch >>\"$log\" 2>&1\n")
+	content.WriteString("\tstatus=$?\n")
+	content.WriteString("fi\n")
+	content.WriteString("cat \"$log\"\n")
+	if s.Mail != "" {
+		content.WriteString("if ! grep -q '^Nothing to do' \"$log\"; then\n")
+		fmt.Fprintf(&content, "\tmail -s \"Security patches on $(hostname)\" %s <\"$log\"\n", s.Mail)
+		content.WriteString("fi\n")
+	}
+	content.WriteString("rm -f \"$log\"\n")
+	content.WriteString("\n")
+	content.WriteString("# 102 means a patch needs a reboot\n")
+	content.WriteString("case $status in\n")
+	content.WriteString("0) ;;\n")
+	if s.Reboot {
+		content.WriteString("102) shutdown -r +5 \"Rebooting to finish installing security patches\" ;;\n")
+	} else {
+		content.WriteString("102) ;;\n")
+	}
+	content.WriteString("*) exit $status ;;\n")
+	content.WriteString("esac\n")
+	return content.String()
+}
+
+// renderZypperService returns the service unit that runs the patch script
+func renderZypperService() string {
+	return "# " + managedHeader + "\n" +
+		"[Unit]\n" +
+		"Description=Install security patches\n" +
+		"Wants=network-online.target\n" +
+		"After=network-online.target\n" +
+		"\n" +
+		"[Service]\n" +
+		"Type=oneshot\n" +
+		"ExecStart=" + zypperScript + "\n"
+}
+
+// renderZypperTimer returns the timer unit that runs the patch service daily. With reboots
+// enabled it runs in the reboot window, otherwise at a random time in the morning.
+func renderZypperTimer(s settings) string {
+	calendar, delay, persistent := "*-*-* 06:00", "1h", true
+	if s.Reboot {
+		calendar, delay, persistent = "*-*-* "+s.RebootTime, "30m", false
+	}
+
+	var content strings.Builder
+	content.WriteString("# " + managedHeader + "\n")
+	content.WriteString("[Unit]\n")
+	content.WriteString("Description=Install security patches daily\n")
+	content.WriteString("\n[Timer]\n")
+	fmt.Fprintf(&content, "OnCalendar=%s\n", calendar)
+	fmt.Fprintf(&content, "RandomizedDelaySec=%s\n", delay)
+	fmt.Fprintf(&content, "Persistent=%t\n", persistent)
+	content.WriteString("\n[Install]\n")
+	content.WriteString("WantedBy=timers.target\n")
+	return content.String()
+}
@@ -0,0 +1,290 @@
+// Package updates implements the automatic security updates feature
+package updates
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/pkgmanager"
+	"github.com/teomyth/iniq/pkg/safefile"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+// aptUnattendedPattern matches the periodic setting that turns unattended-upgrades on or off
+var aptUnattendedPattern = regexp.MustCompile(`APT::Periodic::Unattended-Upgrade\s+"([^"]*)"`)
+
+// Feature implements the automatic security updates feature
+type Feature struct {
+	osInfo *osdetect.Info
+}
+
+// New creates a new automatic security updates feature
+func New(osInfo *osdetect.Info) *Feature {
+	return &Feature{
+		osInfo: osInfo,
+	}
+}
+
+// Name returns the feature name
+func (f *Feature) Name() string {
+	return "updates"
+}
+
+// Description returns the feature description
+func (f *Feature) Description() string {
+	return "Install security updates automatically"
+}
+
+// Flags returns the command-line flags for the feature
+func (f *Feature) Flags() []features.Flag {
+	return []features.Flag{
+		{
+			Name:      "auto-updates",
+			Shorthand: "",
+			Usage:     "install security updates automatically (unattended-upgrades, dnf-automatic or zypper patch)",
+			Default:   false,
+			Required:  false,
+		},
+	}
+}
+
+// ShouldActivate determines if the feature should be activated
+func (f *Feature) ShouldActivate(options map[string]any) bool {
+	if features.PrivilegedSkipped(options) {
+		return false
+	}
+
+	enabled, _ := options["auto-updates"].(bool)
+	return enabled
+}
+
+// ValidateOptions validates the feature options
+func (f *Feature) ValidateOptions(options map[string]any) error {
+	_, err := settingsFromOptions(options)
+	return err
+}
+
+// Execute executes the feature functionality
+func (f *Feature) Execute(ctx *features.ExecutionContext) error {
+	s, err := settingsFromOptions(ctx.Options)
+	if err != nil {
+		return err
+	}
+	p, err := planUpdates(f.osInfo.PackageManager, s)
+	if err != nil {
+		return err
+	}
+	if p.Timer != "" {
+		if kind, err := service.DetectKind("/"); err != nil || kind != service.Systemd {
+			return fmt.Errorf("%s needs systemd to schedule updates", p.Tool)
+		}
+	}
+	manager, err := pkgmanager.New(f.osInfo.PackageManager)
+	if err != nil {
+		return err
+	}
+
+	missing, err := missingPackages(manager, p)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		p = resolveTimer(p)
+	}
+	changed := changedFiles(p)
+
+	if len(missing) == 0 && len(changed) == 0 && timerEnabled(p.Timer) {
+		ctx.Logger.Success("✓ Automatic security updates already configured (%s)", p.Tool)
+		return nil
+	}
+
+	// Skip if dry run
+	if ctx.DryRun {
+		if len(missing) > 0 {
+			ctx.Logger.Info("Would install %s with %s", strings.Join(missing, ", "), manager.Kind())
+		}
+		for _, file := range changed {
+			ctx.Logger.Info("Would write %s", file.Path)
+			if ctx.Verbose {
+				ctx.Logger.MultiLine("info", "Content:", strings.Split(strings.TrimRight(file.Content, "\n"), "\n"))
+			}
+		}
+		if p.Timer != "" {
+			ctx.Logger.Info("Would enable and start %s", p.Timer)
+		}
+		return nil
+	}
+
+	// Check if running as root
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("configuring automatic updates requires root privileges")
+	}
+
+	if len(missing) > 0 {
+		ctx.Logger.Step("Installing %s...", strings.Join(missing, ", "))
+		warn := func(err error) { ctx.Logger.Warning("Failed to update package metadata: %v", err) }
+		if err := pkgmanager.UpdateAndInstall(manager, warn, missing...); err != nil {
+			return fmt.Errorf("failed to install %s: %w", strings.Join(missing, ", "), err)
+		}
+		// dnf5 ships its own timer, which is only known once the package is installed
+		p = resolveTimer(p)
+		changed = changedFiles(p)
+	}
+
+	for _, file := range changed {
+		ctx.Logger.Step("Writing %s", file.Path)
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(file.Path), err)
+		}
+		if err := safefile.WriteFile(file.Path, []byte(file.Content), os.FileMode(file.Mode)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+
+	if p.Timer != "" {
+		if output, err := exec.Command("systemctl", "daemon-reload").CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to reload systemd units: %s: %w", strings.TrimSpace(string(output)), err)
+		}
+		if output, err := exec.Command("systemctl", "enable", "--now", p.Timer).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to enable %s: %s: %w", p.Timer, strings.TrimSpace(string(output)), err)
+		}
+	}
+
+	ctx.Logger.Success("Automatic security updates configured (%s)", p.Tool)
+	return nil
+}
+
+// missingPackages returns the packages of the plan that are not installed
+func missingPackages(manager pkgmanager.Manager, p plan) ([]string, error) {
+	var missing []string
+	for _, pkg := range p.Packages {
+		installed, err := manager.IsInstalled(pkg)
+		if err != nil {
+			return nil, err
+		}
+		if !installed {
+			missing = append(missing, pkg)
+		}
+	}
+	return missing, nil
+}
+
+// Priority returns the feature execution priority
+func (f *Feature) Priority() int {
+	return 60 // Updates run unattended later on, so they are set up after everything else
+}
+
+// DetectCurrentState detects and returns the current state of the updates feature
+func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string]any, error) {
+	state := make(map[string]any)
+
+	s, err := settingsFromOptions(ctx.Options)
+	if err != nil {
+		s, _ = settingsFromOptions(nil)
+	}
+	p, err := planUpdates(f.osInfo.PackageManager, s)
+	if err != nil {
+		state["updates_error"] = err.Error()
+		return state, nil
+	}
+
+	state["updates_tool"] = p.Tool
+	state["config_file"] = p.Files[0].Path
+	manager, err := pkgmanager.New(f.osInfo.PackageManager)
+	if err != nil {
+		return state, err
+	}
+	missing, err := missingPackages(manager, p)
+	if err != nil {
+		return state, err
+	}
+	installed := len(missing) == 0
+	state["updates_installed"] = installed
+	if installed {
+		p = resolveTimer(p)
+	}
+	state["updates_configured"] = len(changedFiles(p)) == 0
+
+	if p.Timer != "" {
+		state["updates_enabled"] = timerEnabled(p.Timer)
+	} else {
+		content, _ := os.ReadFile(aptPeriodicFile)
+		match := aptUnattendedPattern.FindStringSubmatch(string(content))
+		state["updates_enabled"] = installed && match != nil && match[1] != "0"
+	}
+
+	return state, nil
+}
+
+// DisplayCurrentState displays the current state of the updates feature
+func (f *Feature) DisplayCurrentState(ctx *features.ExecutionContext, state map[string]any) {
+	if !ctx.Interactive {
+		return
+	}
+
+	tool, _ := state["updates_tool"].(string)
+	enabled, _ := state["updates_enabled"].(bool)
+
+	fmt.Printf("  \033[1;34m%s\033[0m: ", "Auto Updates")
+	switch {
+	case tool == "":
+		fmt.Printf("\033[1;31m✗ Not supported\033[0m\n")
+	case !enabled:
+		fmt.Printf("\033[1;33m⚠ Disabled\033[0m\n")
+	default:
+		fmt.Printf("\033[1;32m✓ Enabled\033[0m \033[90m(%s)\033[0m\n", tool)
+	}
+}
+
+// ShouldPromptUser determines if the user should be prompted for input
+func (f *Feature) ShouldPromptUser(ctx *features.ExecutionContext, state map[string]any) bool {
+	// Automatic updates are only configured on request
+	return false
+}
+
+// changedFiles returns the files of the plan whose content differs from the file on disk
+func changedFiles(p plan) []configFile {
+	var changed []configFile
+	for _, file := range p.Files {
+		if current, err := os.ReadFile(file.Path); err != nil || string(current) != file.Content {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// resolveTimer switches a dnf-automatic plan to the dnf5 timer on systems that have only that one
+func resolveTimer(p plan) plan {
+	if p.Timer == dnfTimer && !unitExists(dnfTimer) && unitExists(dnf5Timer) {
+		return p.withTimer(dnf5Timer)
+	}
+	return p
+}
+
+// unitExists reports whether a packaged systemd unit is installed
+func unitExists(unit string) bool {
+	for _, dir := range []string{"/usr/lib/systemd/system", "/lib/systemd/system"} {
+		if _, err := os.Stat(filepath.Join(dir, unit)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// timerEnabled reports whether a systemd timer is enabled and running. Plans without a
+// timer rely on the package's own schedule, which is always on.
+func timerEnabled(timer string) bool {
+	if timer == "" {
+		return true
+	}
+	if err := exec.Command("systemctl", "is-enabled", "--quiet", timer).Run(); err != nil {
+		return false
+	}
+	return exec.Command("systemctl", "is-active", "--quiet", timer).Run() == nil
+}
@@ -0,0 +1,173 @@
+package updates
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+func TestSettingsFromOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   map[string]any
+		want      settings
+		expectErr bool
+	}{
+		{
+			name:    "defaults",
+			options: map[string]any{},
+			want:    settings{RebootTime: "03:00"},
+		},
+		{
+			name: "configured values",
+			options: map[string]any{
+				"auto-updates-reboot":      true,
+				"auto-updates-reboot-time": "22:15",
+				"auto-updates-mail":        "ops+updates@example.com",
+				"auto-updates-syslog":      true,
+			},
+			want: settings{Reboot: true, RebootTime: "22:15", Mail: "ops+updates@example.com", Syslog: true},
+		},
+		{name: "reboot time out of range", options: map[string]any{"auto-updates-reboot-time": "24:00"}, expectErr: true},
+		{name: "reboot time without minutes", options: map[string]any{"auto-updates-reboot-time": "3"}, expectErr: true},
+		{name: "mail without domain", options: map[string]any{"auto-updates-mail": "root"}, expectErr: true},
+		{name: "mail with shell characters", options: map[string]any{"auto-updates-mail": "`reboot`@example.com"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := settingsFromOptions(tt.options)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestPlanUpdatesFixtures compares the rendered files with testdata/<case>/<package manager>,
+// which holds the expected files at their paths on the target system
+func TestPlanUpdatesFixtures(t *testing.T) {
+	cases := map[string]settings{
+		"defaults":    {RebootTime: "03:00"},
+		"reboot-mail": {Reboot: true, RebootTime: "02:30", Mail: "admin@example.com", Syslog: true},
+	}
+	managers := []osdetect.PackageManager{osdetect.APT, osdetect.DNF, osdetect.Zypper}
+
+	for name, s := range cases {
+		for _, pm := range managers {
+			t.Run(name+"/"+string(pm), func(t *testing.T) {
+				p, err := planUpdates(pm, s)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				root := filepath.Join("testdata", name, string(pm))
+				var expected []string
+				err = filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+					if err == nil && !entry.IsDir() {
+						expected = append(expected, "/"+filepath.ToSlash(path[len(root)+1:]))
+					}
+					return err
+				})
+				if err != nil {
+					t.Fatalf("Failed to read fixtures: %v", err)
+				}
+
+				var rendered []string
+				for _, file := range p.Files {
+					rendered = append(rendered, file.Path)
+					want, err := os.ReadFile(filepath.Join(root, file.Path))
+					if err != nil {
+						t.Errorf("Missing fixture for %s", file.Path)
+						continue
+					}
+					if file.Content != string(want) {
+						t.Errorf("Content of %s differs from fixture.\nExpected:\n%s\nGot:\n%s", file.Path, want, file.Content)
+					}
+				}
+				if len(rendered) != len(expected) {
+					t.Errorf("Expected files %v, got %v", expected, rendered)
+				}
+			})
+		}
+	}
+}
+
+func TestPlanUpdatesPackages(t *testing.T) {
+	s := settings{RebootTime: "03:00"}
+	tests := []struct {
+		pm        osdetect.PackageManager
+		tool      string
+		packages  []string
+		timer     string
+		expectErr bool
+	}{
+		{pm: osdetect.APT, tool: "unattended-upgrades", packages: []string{"unattended-upgrades"}},
+		{pm: osdetect.DNF, tool: "dnf-automatic", packages: []string{"dnf-automatic"}, timer: "dnf-automatic.timer"},
+		{pm: osdetect.Zypper, tool: "zypper patch", timer: "iniq-security-patch.timer"},
+		{pm: osdetect.YUM, expectErr: true},
+		{pm: osdetect.APK, expectErr: true},
+		{pm: osdetect.UnknownPM, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.pm), func(t *testing.T) {
+			p, err := planUpdates(tt.pm, s)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if p.Tool != tt.tool {
+				t.Errorf("Expected tool %q, got %q", tt.tool, p.Tool)
+			}
+			if !reflect.DeepEqual(p.Packages, tt.packages) {
+				t.Errorf("Expected packages %v, got %v", tt.packages, p.Packages)
+			}
+			if p.Timer != tt.timer {
+				t.Errorf("Expected timer %q, got %q", tt.timer, p.Timer)
+			}
+		})
+	}
+}
+
+func TestPlanWithTimer(t *testing.T) {
+	p, err := planUpdates(osdetect.DNF, settings{Reboot: true, RebootTime: "03:00"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	renamed := p.withTimer(dnf5Timer)
+	if renamed.Timer != dnf5Timer {
+		t.Errorf("Expected timer %q, got %q", dnf5Timer, renamed.Timer)
+	}
+	want := []string{dnfAutomaticFile, "/etc/systemd/system/dnf5-automatic.timer.d/iniq.conf"}
+	var got []string
+	for _, file := range renamed.Files {
+		got = append(got, file.Path)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected files %v, got %v", want, got)
+	}
+
+	// The original plan is left unchanged
+	if p.Files[1].Path != timerDropIn(dnfTimer) {
+		t.Errorf("Expected original drop-in %q, got %q", timerDropIn(dnfTimer), p.Files[1].Path)
+	}
+}
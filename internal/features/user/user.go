@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/teomyth/iniq/internal/features"
+	"github.com/teomyth/iniq/internal/sudoers"
 	"github.com/teomyth/iniq/pkg/osdetect"
 )
 
@@ -245,7 +246,7 @@ func getUserShell(username string) string {
 }
 
 // userHasSudo checks if a user has sudo privileges
-func userHasSudo(username string) (bool, error) {
+func userHasSudo(username, adminGroup string) (bool, error) {
 	// Check if user is root (always has sudo)
 	if username == "root" {
 		return true, nil
@@ -274,8 +275,15 @@ func userHasSudo(username string) (bool, error) {
 		}
 	}
 
+	// As root the sudoers policy can be evaluated directly
+	if os.Geteuid() == 0 {
+		if privileges, err := sudoers.Check(sudoers.DefaultPath, username); err == nil {
+			return privileges.HasAll(), nil
+		}
+	}
+
 	// Check if user is in sudo group
-	inSudoGroup, err := isUserInSudoGroup(username)
+	inSudoGroup, err := isUserInSudoGroup(username, adminGroup)
 	if err != nil {
 		return false, err
 	}
@@ -283,8 +291,8 @@ func userHasSudo(username string) (bool, error) {
 	return inSudoGroup, nil
 }
 
-// isUserInSudoGroup checks if a user is in the sudo group
-func isUserInSudoGroup(username string) (bool, error) {
+// isUserInSudoGroup checks if a user is in the admin group
+func isUserInSudoGroup(username, adminGroup string) (bool, error) {
 	// Get groups for user
 	cmd := exec.Command("groups", username)
 	output, err := cmd.Output()
@@ -292,10 +300,10 @@ func isUserInSudoGroup(username string) (bool, error) {
 		return false, fmt.Errorf("failed to get groups for user %s: %w", username, err)
 	}
 
-	// Parse output and check for sudo/admin/wheel group
+	// Parse output and check for the admin group
 	groups := strings.Fields(string(output))
 	for _, group := range groups {
-		if group == "sudo" || group == "admin" || group == "wheel" {
+		if group == adminGroup {
 			return true, nil
 		}
 	}
@@ -353,14 +361,16 @@ func (f *Feature) DetectCurrentState(ctx *features.ExecutionContext) (map[string
 		state["user_shell"] = shell
 
 		// Check if user has sudo privileges - now we have root privileges so this should be accurate
-		hasSudo, err := userHasSudo(u.Username)
+		override, _ := ctx.Options["admin-group"].(string)
+		adminGroup := sudoers.AdminGroupName(f.osInfo, override)
+		hasSudo, err := userHasSudo(u.Username, adminGroup)
 		if err != nil {
 			ctx.Logger.Warning("Failed to check sudo privileges: %v", err)
 		}
 		state["has_sudo"] = hasSudo
 
 		// Check if user is in sudo group
-		inSudoGroup, err := isUserInSudoGroup(u.Username)
+		inSudoGroup, err := isUserInSudoGroup(u.Username, adminGroup)
 		if err != nil {
 			ctx.Logger.Warning("Failed to check sudo group membership: %v", err)
 		}
@@ -582,64 +592,18 @@ func (f *Feature) createDarwinUser(ctx *features.ExecutionContext, username, she
 	return nil
 }
 
-// checkPasswordlessSudoWithSource checks if a user has passwordless sudo privileges and returns the source file
+// checkPasswordlessSudoWithSource checks if a user has passwordless sudo privileges and
+// returns the file:line of the sudoers rule that grants the user's sudo access
 func checkPasswordlessSudoWithSource(username string) (bool, string, error) {
 	// Check if running with sufficient privileges to read sudoers files
 	if os.Geteuid() != 0 {
 		return false, "", fmt.Errorf("checking passwordless sudo requires root privileges. Please run with sudo")
 	}
 
-	// List of sudoers files to check
-	sudoersFiles := []string{
-		filepath.Join("/etc/sudoers.d", username),
-		"/etc/sudoers",
-	}
-
-	// Also check for common sudoers.d files
-	sudoersDFiles := []string{
-		"/etc/sudoers.d/90-cloud-init-users",
-		"/etc/sudoers.d/admin",
-		"/etc/sudoers.d/wheel",
-	}
-	sudoersFiles = append(sudoersFiles, sudoersDFiles...)
-
-	// Check each sudoers file
-	for _, file := range sudoersFiles {
-		if _, err := os.Stat(file); err != nil {
-			continue // File doesn't exist, skip
-		}
-
-		// Read the file - we have root privileges so this should work
-		content, err := os.ReadFile(file)
-		if err != nil {
-			// Log the error but continue checking other files
-			continue
-		}
-
-		// Check if file contains NOPASSWD for this user
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if strings.HasPrefix(line, "#") {
-				continue // Skip comments
-			}
-
-			// Check for user-specific NOPASSWD rules
-			if strings.Contains(line, username) && strings.Contains(line, "NOPASSWD") {
-				return true, file, nil
-			}
-
-			// Check for group-based NOPASSWD rules
-			if (strings.Contains(line, "%sudo") || strings.Contains(line, "%admin") || strings.Contains(line, "%wheel")) &&
-				strings.Contains(line, "NOPASSWD") {
-				// Check if user is in the group
-				inGroup, err := isUserInSudoGroup(username)
-				if err == nil && inGroup {
-					return true, file, nil
-				}
-			}
-		}
+	privileges, err := sudoers.Check(sudoers.DefaultPath, username)
+	if err != nil {
+		return false, "", err
 	}
 
-	return false, "", nil
+	return privileges.NoPasswd(), privileges.Source(), nil
 }
@@ -0,0 +1,89 @@
+package sshdconfig
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth limits nested Include directives, as sshd does
+const maxIncludeDepth = 16
+
+// ResolvePorts returns the ports sshd listens on with the configuration in configPath.
+// sshd -T reports the effective configuration, including drop-ins such as
+// /etc/ssh/sshd_config.d/*.conf. Where sshd is not installed or cannot run, the
+// configuration files are read directly and Include directives are followed.
+func ResolvePorts(configPath string) []int {
+	return resolvePorts(configPath, effectiveConfig)
+}
+
+// resolvePorts returns the ports from the effective configuration returned by effective,
+// falling back to reading the configuration files
+func resolvePorts(configPath string, effective func(configPath string) (string, error)) []int {
+	if output, err := effective(configPath); err == nil {
+		var values []string
+		for _, line := range strings.Split(output, "\n") {
+			if keyword, value := splitDirective(line); strings.EqualFold(keyword, "Port") {
+				values = append(values, value)
+			}
+		}
+		if len(values) > 0 {
+			return parsePorts(values)
+		}
+	}
+	return parsePorts(includedValues(configPath, filepath.Dir(configPath), "Port", 0))
+}
+
+// effectiveConfig returns the configuration sshd -T reports for configPath
+func effectiveConfig(configPath string) (string, error) {
+	sshd, err := exec.LookPath("sshd")
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command(sshd, "-T", "-f", configPath).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read effective sshd configuration: %w", err)
+	}
+	return string(output), nil
+}
+
+// includedValues returns the values of a directive in the global section of the file at
+// path and the files it includes, in the order sshd reads them. Relative Include patterns
+// are resolved against baseDir, the directory of the main configuration. A Match block
+// in an included file ends with that file, as it does in sshd.
+func includedValues(path, baseDir, name string, depth int) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var values []string
+	for _, line := range strings.Split(string(content), "\n") {
+		keyword, value := splitDirective(line)
+		switch {
+		case keyword == "":
+			continue
+		case strings.EqualFold(keyword, "Match"):
+			return values
+		case strings.EqualFold(keyword, "Include"):
+			if depth >= maxIncludeDepth {
+				continue
+			}
+			for _, pattern := range strings.Fields(value) {
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(baseDir, pattern)
+				}
+				// Glob returns matches in lexical order, the order sshd includes them in
+				matches, _ := filepath.Glob(pattern)
+				for _, match := range matches {
+					values = append(values, includedValues(match, baseDir, name, depth+1)...)
+				}
+			}
+		case strings.EqualFold(keyword, name):
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,69 @@
+package sshdconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolvePorts(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-sshdconfig-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	noSSHD := func(string) (string, error) {
+		return "", errors.New("sshd not found")
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	configPath := filepath.Join(tempDir, "sshd_config")
+	if ports := resolvePorts(configPath, noSSHD); !reflect.DeepEqual(ports, []int{22}) {
+		t.Errorf("Expected default port for missing config, got %v", ports)
+	}
+
+	write("sshd_config", "# Port 2200\nPort 2222\nPort 443\n\nMatch User git\n    Port 2223\n")
+	if ports := resolvePorts(configPath, noSSHD); !reflect.DeepEqual(ports, []int{2222, 443}) {
+		t.Errorf("Expected [2222 443], got %v", ports)
+	}
+
+	// Drop-ins are read at the Include line, in lexical order, and a Match block ends with its file
+	write("sshd_config", "Include sshd_config.d/*.conf\nPasswordAuthentication no\n")
+	write("sshd_config.d/50-cloud-init.conf", "Port 2222\n")
+	write("sshd_config.d/10-extra.conf", "Port 8022\nMatch User git\n    Port 2223\n")
+	write("sshd_config.d/README", "Port 9999\n")
+	if ports := resolvePorts(configPath, noSSHD); !reflect.DeepEqual(ports, []int{8022, 2222}) {
+		t.Errorf("Expected [8022 2222] from the drop-ins, got %v", ports)
+	}
+
+	write("sshd_config", "Include "+filepath.Join(tempDir, "sshd_config.d", "50-cloud-init.conf")+"\nPort 443\n")
+	if ports := resolvePorts(configPath, noSSHD); !reflect.DeepEqual(ports, []int{2222, 443}) {
+		t.Errorf("Expected [2222 443] with an absolute Include, got %v", ports)
+	}
+
+	// An Include loop stops at the depth limit
+	write("sshd_config", "Include sshd_config\n")
+	if ports := resolvePorts(configPath, noSSHD); !reflect.DeepEqual(ports, []int{22}) {
+		t.Errorf("Expected default port for an Include loop, got %v", ports)
+	}
+
+	// The effective configuration reported by sshd -T is preferred
+	effective := func(string) (string, error) {
+		return "port 2200\nport 443\naddressfamily any\n", nil
+	}
+	if ports := resolvePorts(configPath, effective); !reflect.DeepEqual(ports, []int{2200, 443}) {
+		t.Errorf("Expected [2200 443] from sshd -T, got %v", ports)
+	}
+}
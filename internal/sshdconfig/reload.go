@@ -0,0 +1,86 @@
+package sshdconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+// Reload makes sshd pick up its new configuration, reloading rather than restarting it
+// where the service manager supports it so open sessions are kept. In containers and WSL,
+// where sshd is often not managed by an init system, a stopped sshd is left alone.
+func Reload(log *logger.Logger, info *osdetect.Info) error {
+	log.Info("Reloading SSH service")
+
+	if info.Type == osdetect.Darwin {
+		// launchd has no reload, so the daemon is unloaded and loaded again
+		cmd := exec.Command("sh", "-c", osdetect.GetServiceRestartCommand("ssh", info))
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to restart SSH service: %w", err)
+		}
+		log.Success("SSH service restarted")
+		return nil
+	}
+
+	return reload(log, info.Environment, service.Detect)
+}
+
+// reload reloads sshd through the service manager returned by detect
+func reload(log *logger.Logger, env osdetect.Environment, detect func() (service.Manager, error)) error {
+	optional := env.InContainer() || env.WSL
+
+	manager, err := detect()
+	if err != nil {
+		if optional && errors.Is(err, service.ErrNoServiceManager) {
+			log.Warning("No service manager found in this %s, skipping SSH service reload", env)
+			return nil
+		}
+		return fmt.Errorf("failed to detect service manager: %w", err)
+	}
+	name, err := manager.Resolve("ssh")
+	if err != nil {
+		if optional {
+			log.Warning("No SSH service installed in this %s, skipping SSH service reload", env)
+			return nil
+		}
+		return fmt.Errorf("failed to find SSH service: %w", err)
+	}
+
+	if optional {
+		if active, _ := manager.IsActive(name); !active {
+			log.Warning("SSH service is not running in this %s, the new settings apply when it starts", env)
+			return nil
+		}
+	}
+
+	log.Debug("Using %s to reload the %s service", manager.Kind(), name)
+	if err := service.ReloadOrRestart(manager, name); err != nil {
+		return fmt.Errorf("failed to reload SSH service: %w", err)
+	}
+
+	log.Success("SSH service reloaded")
+	return nil
+}
+
+// CloudInitDropIns returns the files cloud-init wrote to the sshd_config.d directory next to
+// configPath. On images such as Ubuntu's, sshd_config includes them before its own directives,
+// so their settings take precedence and cloud-init may write them again on later boots.
+func CloudInitDropIns(configPath string) []string {
+	matches, _ := filepath.Glob(filepath.Join(configPath+".d", "*.conf"))
+	var dropIns []string
+	for _, match := range matches {
+		if strings.Contains(filepath.Base(match), "cloud-init") {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				dropIns = append(dropIns, match)
+			}
+		}
+	}
+	return dropIns
+}
@@ -0,0 +1,115 @@
+package sshdconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/teomyth/iniq/internal/logger"
+	"github.com/teomyth/iniq/pkg/osdetect"
+	"github.com/teomyth/iniq/pkg/service"
+)
+
+// fakeManager records the services it reloads
+type fakeManager struct {
+	installed bool
+	active    bool
+	reloaded  []string
+}
+
+func (m *fakeManager) Kind() service.Kind { return service.Systemd }
+
+func (m *fakeManager) Resolve(name string) (string, error) {
+	if !m.installed {
+		return "", errors.New("service not found")
+	}
+	return "sshd", nil
+}
+
+func (m *fakeManager) Restart(name string) error { return nil }
+
+func (m *fakeManager) Reload(name string) error {
+	m.reloaded = append(m.reloaded, name)
+	return nil
+}
+
+func (m *fakeManager) IsActive(name string) (bool, error) { return m.active, nil }
+
+func (m *fakeManager) Enable(name string) error { return nil }
+
+func TestReload(t *testing.T) {
+	docker := osdetect.Environment{Container: "docker"}
+	tests := []struct {
+		name        string
+		env         osdetect.Environment
+		manager     *fakeManager
+		detectErr   error
+		reloaded    []string
+		expectError bool
+	}{
+		{name: "Host", manager: &fakeManager{installed: true, active: true}, reloaded: []string{"sshd"}},
+		{name: "Host with stopped sshd", manager: &fakeManager{installed: true}, reloaded: []string{"sshd"}},
+		{name: "Host without sshd", manager: &fakeManager{}, expectError: true},
+		{name: "Host without service manager", detectErr: service.ErrNoServiceManager, expectError: true},
+		{name: "Container", env: docker, manager: &fakeManager{installed: true, active: true}, reloaded: []string{"sshd"}},
+		{name: "Container with stopped sshd", env: docker, manager: &fakeManager{installed: true}},
+		{name: "Container without sshd", env: docker, manager: &fakeManager{}},
+		{name: "Container without service manager", env: docker, detectErr: service.ErrNoServiceManager},
+		{name: "WSL with stopped sshd", env: osdetect.Environment{WSL: true}, manager: &fakeManager{installed: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detect := func() (service.Manager, error) {
+				if tt.detectErr != nil {
+					return nil, tt.detectErr
+				}
+				return tt.manager, nil
+			}
+
+			err := reload(logger.New(false, true), tt.env, detect)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.manager != nil && !reflect.DeepEqual(tt.manager.reloaded, tt.reloaded) {
+				t.Errorf("Expected reloads %v, got %v", tt.reloaded, tt.manager.reloaded)
+			}
+		})
+	}
+}
+
+func TestCloudInitDropIns(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-sshdconfig-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, "sshd_config")
+	if err := os.Mkdir(configPath+".d", 0755); err != nil {
+		t.Fatalf("Failed to create drop-in directory: %v", err)
+	}
+	for _, name := range []string{"50-cloud-init.conf", "60-cloudimg-settings.conf", "50-cloud-init.conf.bak"} {
+		if err := os.WriteFile(filepath.Join(configPath+".d", name), []byte("PasswordAuthentication yes\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dropIns := CloudInitDropIns(configPath)
+	expected := []string{filepath.Join(configPath+".d", "50-cloud-init.conf")}
+	if !reflect.DeepEqual(dropIns, expected) {
+		t.Errorf("Expected %v, got %v", expected, dropIns)
+	}
+
+	if dropIns := CloudInitDropIns(filepath.Join(tempDir, "missing")); len(dropIns) != 0 {
+		t.Errorf("Expected no drop-ins, got %v", dropIns)
+	}
+}
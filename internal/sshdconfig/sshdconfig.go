@@ -0,0 +1,167 @@
+// Package sshdconfig edits OpenSSH server configuration files and reloads sshd to apply them
+package sshdconfig
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultPort is the port sshd listens on when no Port directive is set
+const DefaultPort = 22
+
+// Get returns the value of the first active occurrence of a directive in the global section.
+// sshd uses the first value it finds, and directives after a Match line only apply to that block.
+func Get(config, name string) (string, bool) {
+	for _, line := range strings.Split(config, "\n") {
+		keyword, value := splitDirective(line)
+		if keyword == "" {
+			continue
+		}
+		if strings.EqualFold(keyword, "Match") {
+			break
+		}
+		if strings.EqualFold(keyword, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns the values of all active occurrences of a directive in the global section,
+// for directives such as HostKey that may be repeated
+func GetAll(config, name string) []string {
+	var values []string
+	for _, line := range strings.Split(config, "\n") {
+		keyword, value := splitDirective(line)
+		if keyword == "" {
+			continue
+		}
+		if strings.EqualFold(keyword, "Match") {
+			break
+		}
+		if strings.EqualFold(keyword, name) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Ports returns the ports sshd listens on, or DefaultPort when config sets none
+func Ports(config string) []int {
+	return parsePorts(GetAll(config, "Port"))
+}
+
+// parsePorts returns the valid ports among Port values, or DefaultPort when there are none
+func parsePorts(values []string) []int {
+	var ports []int
+	for _, value := range values {
+		if port, err := strconv.Atoi(value); err == nil && port > 0 && port <= 65535 {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return []int{DefaultPort}
+	}
+	return ports
+}
+
+// Set sets a directive in the global section.
+// Existing occurrences are replaced in place with a "# Modified by INIQ" comment recording the
+// previous setting. New directives are added before the first Match block so they apply globally.
+func Set(config, name, value string) string {
+	return SetAll(config, name, []string{value})
+}
+
+// SetAll replaces all occurrences of a directive in the global section with the given values.
+// Passing no values removes the directive.
+func SetAll(config, name string, values []string) string {
+	lines := strings.Split(config, "\n")
+	if strings.TrimSpace(config) == "" {
+		lines = nil
+	}
+
+	// Collect existing occurrences, dropping comments from previous INIQ runs
+	var previous []string
+	insertAt := -1
+	matchAt := -1
+	cleaned := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if matchAt < 0 && isINIQComment(trimmed, name) {
+			continue
+		}
+
+		keyword, _ := splitDirective(lines[i])
+		if matchAt < 0 && strings.EqualFold(keyword, "Match") {
+			matchAt = len(cleaned)
+		}
+		if matchAt < 0 && strings.EqualFold(keyword, name) {
+			previous = append(previous, trimmed)
+			if insertAt < 0 {
+				insertAt = len(cleaned)
+			}
+			continue
+		}
+
+		cleaned = append(cleaned, lines[i])
+	}
+
+	// Place the directive where it was, before any Match block, or at the end
+	if insertAt < 0 {
+		insertAt = matchAt
+	}
+	if insertAt < 0 {
+		// Drop trailing blank lines so the directive joins the rest of the file
+		for len(cleaned) > 0 && strings.TrimSpace(cleaned[len(cleaned)-1]) == "" {
+			cleaned = cleaned[:len(cleaned)-1]
+		}
+		insertAt = len(cleaned)
+	}
+
+	block := make([]string, 0, len(values)+1)
+	switch {
+	case len(values) == 0 && len(previous) == 0:
+		return strings.Join(cleaned, "\n")
+	case len(values) == 0:
+		block = append(block, "# Removed by INIQ (Previous setting: "+strings.Join(previous, "; ")+")")
+	case len(previous) > 0:
+		block = append(block, "# Modified by INIQ (Previous setting: "+strings.Join(previous, "; ")+")")
+	default:
+		block = append(block, "# Added by INIQ (Previous setting: none) "+name)
+	}
+	for _, value := range values {
+		block = append(block, name+" "+value)
+	}
+
+	result := make([]string, 0, len(cleaned)+len(block))
+	result = append(result, cleaned[:insertAt]...)
+	result = append(result, block...)
+	result = append(result, cleaned[insertAt:]...)
+
+	return strings.Join(result, "\n")
+}
+
+// splitDirective returns the keyword and value of an active configuration line
+func splitDirective(line string) (string, string) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", ""
+	}
+
+	// Keywords are separated from their arguments by whitespace or an equals sign
+	end := strings.IndexAny(trimmed, " \t=")
+	if end < 0 {
+		return trimmed, ""
+	}
+	value := strings.TrimLeft(trimmed[end:], " \t=")
+	return trimmed[:end], strings.TrimSpace(value)
+}
+
+// isINIQComment reports whether a line is a comment left by INIQ for the directive
+func isINIQComment(line, name string) bool {
+	if !strings.HasPrefix(line, "# Modified by INIQ") && !strings.HasPrefix(line, "# Added by INIQ") &&
+		!strings.HasPrefix(line, "# Removed by INIQ") {
+		return false
+	}
+	return strings.Contains(line+" ", " "+name+" ")
+}
@@ -0,0 +1,119 @@
+package sshdconfig
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	config := `# Comment
+#TrustedUserCAKeys /commented
+trusteduserCAkeys=/etc/ssh/ca.pub
+HostKey /etc/ssh/ssh_host_ed25519_key
+HostKey /etc/ssh/ssh_host_rsa_key
+
+Match User deploy
+    AuthorizedPrincipalsFile /etc/ssh/deploy_principals
+    HostKey /etc/ssh/other_key`
+
+	value, ok := Get(config, "TrustedUserCAKeys")
+	if !ok || value != "/etc/ssh/ca.pub" {
+		t.Errorf("Expected /etc/ssh/ca.pub, got %q (%v)", value, ok)
+	}
+
+	// Directives inside Match blocks are not global
+	if _, ok := Get(config, "AuthorizedPrincipalsFile"); ok {
+		t.Error("Expected AuthorizedPrincipalsFile inside Match block to be ignored")
+	}
+
+	hostKeys := GetAll(config, "HostKey")
+	if len(hostKeys) != 2 || hostKeys[1] != "/etc/ssh/ssh_host_rsa_key" {
+		t.Errorf("Unexpected host keys: %v", hostKeys)
+	}
+}
+
+func TestPorts(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected []int
+	}{
+		{config: "", expected: []int{22}},
+		{config: "#Port 2200\nPort 2222\nPort 443\nMatch User git\n    Port 2223", expected: []int{2222, 443}},
+		{config: "Port ssh\nPort 70000", expected: []int{22}},
+	}
+
+	for _, tt := range tests {
+		if ports := Ports(tt.config); !reflect.DeepEqual(ports, tt.expected) {
+			t.Errorf("Ports(%q): expected %v, got %v", tt.config, tt.expected, ports)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		values   []string
+		expected string
+	}{
+		{
+			name:     "Empty config",
+			config:   "",
+			values:   []string{"/etc/ssh/ca.pub"},
+			expected: "# Added by INIQ (Previous setting: none) TrustedUserCAKeys\nTrustedUserCAKeys /etc/ssh/ca.pub",
+		},
+		{
+			name:     "Append at end",
+			config:   "Port 22\n\n",
+			values:   []string{"/etc/ssh/ca.pub"},
+			expected: "Port 22\n# Added by INIQ (Previous setting: none) TrustedUserCAKeys\nTrustedUserCAKeys /etc/ssh/ca.pub",
+		},
+		{
+			name:     "Insert before Match block",
+			config:   "Port 22\nMatch User deploy\n    TrustedUserCAKeys /other",
+			values:   []string{"/etc/ssh/ca.pub"},
+			expected: "Port 22\n# Added by INIQ (Previous setting: none) TrustedUserCAKeys\nTrustedUserCAKeys /etc/ssh/ca.pub\nMatch User deploy\n    TrustedUserCAKeys /other",
+		},
+		{
+			name:     "Replace in place",
+			config:   "Port 22\nTrustedUserCAKeys /old\nUsePAM yes",
+			values:   []string{"/etc/ssh/ca.pub"},
+			expected: "Port 22\n# Modified by INIQ (Previous setting: TrustedUserCAKeys /old)\nTrustedUserCAKeys /etc/ssh/ca.pub\nUsePAM yes",
+		},
+		{
+			name:     "Idempotent",
+			config:   "Port 22\n# Modified by INIQ (Previous setting: TrustedUserCAKeys /old)\nTrustedUserCAKeys /etc/ssh/ca.pub",
+			values:   []string{"/etc/ssh/ca.pub"},
+			expected: "Port 22\n# Modified by INIQ (Previous setting: TrustedUserCAKeys /etc/ssh/ca.pub)\nTrustedUserCAKeys /etc/ssh/ca.pub",
+		},
+		{
+			name:     "Remove",
+			config:   "Port 22\nTrustedUserCAKeys /old",
+			values:   nil,
+			expected: "Port 22\n# Removed by INIQ (Previous setting: TrustedUserCAKeys /old)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SetAll(tt.config, "TrustedUserCAKeys", tt.values)
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\n\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSetAllRepeated(t *testing.T) {
+	config := "Port 22\nHostKey /etc/ssh/ssh_host_dsa_key\nHostKey /etc/ssh/ssh_host_rsa_key\nUsePAM yes"
+	expected := "Port 22\n" +
+		"# Modified by INIQ (Previous setting: HostKey /etc/ssh/ssh_host_dsa_key; HostKey /etc/ssh/ssh_host_rsa_key)\n" +
+		"HostKey /etc/ssh/ssh_host_ed25519_key\n" +
+		"HostKey /etc/ssh/ssh_host_rsa_key\n" +
+		"UsePAM yes"
+
+	result := SetAll(config, "HostKey", []string{"/etc/ssh/ssh_host_ed25519_key", "/etc/ssh/ssh_host_rsa_key"})
+	if result != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s", expected, result)
+	}
+}
@@ -0,0 +1,160 @@
+package sudoers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// DefaultGroupFile is the local group database
+const DefaultGroupFile = "/etc/group"
+
+// knownAdminGroups are the group names distributions use for administrators
+var knownAdminGroups = []string{"sudo", "wheel", "admin"}
+
+// AdminGroup is the group whose members get full sudo access
+type AdminGroup struct {
+	// Name is the group name
+	Name string
+
+	// GID is the group id, empty if the group does not exist
+	GID string
+
+	// Rule is the last sudoers rule that grants or denies the group all commands, nil if there is none
+	Rule *Rule
+
+	// PolicyRead reports whether the sudoers policy could be read, Rule is only meaningful if it was
+	PolicyRead bool
+}
+
+// Exists reports whether the group exists in the group database
+func (g AdminGroup) Exists() bool {
+	return g.GID != ""
+}
+
+// HasRule reports whether sudoers grants the group all commands
+func (g AdminGroup) HasRule() bool {
+	return g.Rule != nil && !strings.HasPrefix(g.Rule.Command, "!")
+}
+
+// DefaultAdminGroup returns the conventional admin group of a distribution
+func DefaultAdminGroup(distro osdetect.DistroType) string {
+	switch distro {
+	case osdetect.Debian:
+		return "sudo"
+	case osdetect.MacOS:
+		return "admin"
+	default:
+		// Red Hat, Amazon, SUSE, Arch, Alpine and most other distributions use wheel
+		return "wheel"
+	}
+}
+
+// ResolveAdminGroup determines the admin group. A non-empty override is used as is.
+// Otherwise the distribution's conventional group is used, unless sudoers only grants
+// access to another well-known group that exists, as on images that were customized.
+func ResolveAdminGroup(info *osdetect.Info, override, groupFile, sudoersPath string) (AdminGroup, error) {
+	gids, err := readGroupFile(groupFile)
+	if err != nil {
+		return AdminGroup{}, err
+	}
+
+	// The policy is only readable by root, resolution still works without it
+	var policy *Policy
+	if p, err := Load(sudoersPath); err == nil {
+		policy = p
+	} else if errors.Is(err, fs.ErrNotExist) {
+		policy = newPolicy()
+	}
+
+	lookup := func(name string) AdminGroup {
+		group := AdminGroup{Name: name, GID: gids[name], PolicyRead: policy != nil}
+		if policy != nil {
+			group.Rule = policy.GroupRule(name, group.GID)
+		}
+		return group
+	}
+
+	if override != "" {
+		return lookup(override), nil
+	}
+
+	preferred := lookup(DefaultAdminGroup(info.Distro))
+	if preferred.HasRule() || !preferred.PolicyRead {
+		return preferred, nil
+	}
+	for _, name := range knownAdminGroups {
+		if name == preferred.Name {
+			continue
+		}
+		if group := lookup(name); group.Exists() && group.HasRule() {
+			return group, nil
+		}
+	}
+	return preferred, nil
+}
+
+// LocalAdminGroup resolves the admin group of the running system
+func LocalAdminGroup(info *osdetect.Info, override string) (AdminGroup, error) {
+	return ResolveAdminGroup(info, override, DefaultGroupFile, DefaultPath)
+}
+
+// AdminGroupName returns the name of the local admin group, falling back to the override
+// or the distribution's conventional group when the group database cannot be read
+func AdminGroupName(info *osdetect.Info, override string) string {
+	if group, err := LocalAdminGroup(info, override); err == nil {
+		return group.Name
+	}
+	if override != "" {
+		return override
+	}
+	return DefaultAdminGroup(info.Distro)
+}
+
+// GroupRule returns the last rule that grants or denies ALL to members of a group.
+// Rules for ALL users are ignored, they do not make the group an admin group.
+func (p *Policy) GroupRule(group, gid string) *Rule {
+	host, _ := os.Hostname()
+	privileges := p.Evaluate(User{Groups: []string{group}, GIDs: nonEmpty(gid), Host: host, groupOnly: true})
+	return privileges.All
+}
+
+// readGroupFile returns the group ids by name from a group file in /etc/group format
+func readGroupFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read group file: %w", err)
+	}
+	defer file.Close()
+
+	gids := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		gids[fields[0]] = fields[2]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read group file: %w", err)
+	}
+	return gids, nil
+}
+
+// nonEmpty returns a list with value, or an empty list if value is empty
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
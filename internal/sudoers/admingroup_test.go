@@ -0,0 +1,200 @@
+package sudoers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+func TestDefaultAdminGroup(t *testing.T) {
+	tests := []struct {
+		distro   osdetect.DistroType
+		expected string
+	}{
+		{osdetect.Debian, "sudo"},
+		{osdetect.RedHat, "wheel"},
+		{osdetect.SUSE, "wheel"},
+		{osdetect.Arch, "wheel"},
+		{osdetect.Alpine, "wheel"},
+		{osdetect.Amazon, "wheel"},
+		{osdetect.Generic, "wheel"},
+		{osdetect.MacOS, "admin"},
+		{osdetect.UnknownDistro, "wheel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.distro), func(t *testing.T) {
+			if group := DefaultAdminGroup(tt.distro); group != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, group)
+			}
+		})
+	}
+}
+
+func TestResolveAdminGroup(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-admingroup-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	const (
+		debianGroups  = "root:x:0:\nsudo:x:27:alice\nusers:x:100:\n"
+		redhatGroups  = "root:x:0:\nwheel:x:10:alice\n"
+		suseGroups    = "root:x:0:\nwheel:x:497:\n"
+		archGroups    = "root:x:0:\nwheel:x:998:\n"
+		macGroups     = "# Note: this file is consulted in single-user mode\nwheel:*:0:root\nadmin:*:80:root\n"
+		minimalGroups = "root:x:0:\n"
+	)
+
+	tests := []struct {
+		name       string
+		distro     osdetect.DistroType
+		groups     string
+		sudoers    string
+		override   string
+		expected   string
+		gid        string
+		hasRule    bool
+		policyRead bool
+	}{
+		{
+			name:       "Debian",
+			distro:     osdetect.Debian,
+			groups:     debianGroups,
+			sudoers:    "root ALL=(ALL:ALL) ALL\n%sudo ALL=(ALL:ALL) ALL\n",
+			expected:   "sudo",
+			gid:        "27",
+			hasRule:    true,
+			policyRead: true,
+		},
+		{
+			name:       "RedHat",
+			distro:     osdetect.RedHat,
+			groups:     redhatGroups,
+			sudoers:    "root ALL=(ALL) ALL\n%wheel ALL=(ALL) ALL\n# %wheel ALL=(ALL) NOPASSWD: ALL\n",
+			expected:   "wheel",
+			gid:        "10",
+			hasRule:    true,
+			policyRead: true,
+		},
+		{
+			name:       "SUSE without wheel rule",
+			distro:     osdetect.SUSE,
+			groups:     suseGroups,
+			sudoers:    "Defaults targetpw\nALL ALL=(ALL) ALL\n# %wheel ALL=(ALL) ALL\n",
+			expected:   "wheel",
+			gid:        "497",
+			policyRead: true,
+		},
+		{
+			name:       "Arch",
+			distro:     osdetect.Arch,
+			groups:     archGroups,
+			sudoers:    "root ALL=(ALL:ALL) ALL\n%wheel ALL=(ALL:ALL) ALL\n",
+			expected:   "wheel",
+			gid:        "998",
+			hasRule:    true,
+			policyRead: true,
+		},
+		{
+			name:       "Generic with sudo group only",
+			distro:     osdetect.Generic,
+			groups:     debianGroups,
+			sudoers:    "%sudo ALL=(ALL) ALL\n",
+			expected:   "sudo",
+			gid:        "27",
+			hasRule:    true,
+			policyRead: true,
+		},
+		{
+			name:       "MacOS",
+			distro:     osdetect.MacOS,
+			groups:     macGroups,
+			sudoers:    "root ALL = (ALL) ALL\n%admin ALL = (ALL) ALL\n",
+			expected:   "admin",
+			gid:        "80",
+			hasRule:    true,
+			policyRead: true,
+		},
+		{
+			name:       "Unknown distribution without group or rule",
+			distro:     osdetect.UnknownDistro,
+			groups:     minimalGroups,
+			sudoers:    "root ALL=(ALL) ALL\n",
+			expected:   "wheel",
+			policyRead: true,
+		},
+		{
+			name:       "Debian image customized to wheel",
+			distro:     osdetect.Debian,
+			groups:     "sudo:x:27:\nwheel:x:10:\n",
+			sudoers:    "%wheel ALL=(ALL) ALL\n",
+			expected:   "wheel",
+			gid:        "10",
+			hasRule:    true,
+			policyRead: true,
+		},
+		{
+			name:       "Override",
+			distro:     osdetect.Debian,
+			groups:     "sudo:x:27:\nops:x:2000:\n",
+			sudoers:    "%sudo ALL=(ALL) ALL\n",
+			override:   "ops",
+			expected:   "ops",
+			gid:        "2000",
+			policyRead: true,
+		},
+		{
+			name:     "Missing sudoers",
+			distro:   osdetect.RedHat,
+			groups:   redhatGroups,
+			expected: "wheel",
+			gid:      "10",
+			// A missing policy is read as empty
+			policyRead: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(tempDir, string(rune('a'+i)))
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatalf("Failed to create dir: %v", err)
+			}
+			groupFile := filepath.Join(dir, "group")
+			sudoersFile := filepath.Join(dir, "sudoers")
+			if err := os.WriteFile(groupFile, []byte(tt.groups), 0644); err != nil {
+				t.Fatalf("Failed to write group file: %v", err)
+			}
+			if tt.sudoers != "" {
+				if err := os.WriteFile(sudoersFile, []byte(tt.sudoers), 0440); err != nil {
+					t.Fatalf("Failed to write sudoers file: %v", err)
+				}
+			}
+
+			group, err := ResolveAdminGroup(&osdetect.Info{Distro: tt.distro}, tt.override, groupFile, sudoersFile)
+			if err != nil {
+				t.Fatalf("ResolveAdminGroup() failed: %v", err)
+			}
+			if group.Name != tt.expected {
+				t.Errorf("Expected group %s, got %s", tt.expected, group.Name)
+			}
+			if group.GID != tt.gid {
+				t.Errorf("Expected gid %q, got %q", tt.gid, group.GID)
+			}
+			if group.HasRule() != tt.hasRule {
+				t.Errorf("Expected HasRule() %v, got %v", tt.hasRule, group.HasRule())
+			}
+			if group.PolicyRead != tt.policyRead {
+				t.Errorf("Expected PolicyRead %v, got %v", tt.policyRead, group.PolicyRead)
+			}
+		})
+	}
+
+	if _, err := ResolveAdminGroup(&osdetect.Info{Distro: osdetect.Debian}, "", filepath.Join(tempDir, "missing"), ""); err == nil {
+		t.Error("Expected error for missing group file")
+	}
+}
@@ -0,0 +1,309 @@
+package sudoers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+)
+
+// DefaultPath is the main sudoers file
+const DefaultPath = "/etc/sudoers"
+
+// maxAliasDepth limits alias expansion so alias loops cannot recurse forever
+const maxAliasDepth = 64
+
+// User is the identity rules are evaluated for
+type User struct {
+	Name   string
+	UID    string
+	Groups []string
+	GIDs   []string
+	Host   string
+
+	// groupOnly evaluates group rules only, ALL does not match in user lists
+	groupOnly bool
+}
+
+// Privileges are the effective sudo privileges of a user
+type Privileges struct {
+	// Rules are all rules that apply to the user, in the order sudo reads them
+	Rules []Rule
+
+	// All is the last rule that grants or denies ALL commands as root. sudo uses the
+	// last matching rule, so it decides whether the user has full access.
+	All *Rule
+
+	// Authenticate is the effective value of the authenticate Defaults setting
+	Authenticate bool
+
+	// AuthenticateSource is the Defaults entry that set Authenticate, or nil for the built-in default
+	AuthenticateSource *Default
+}
+
+// HasAll reports whether the user can run all commands
+func (p Privileges) HasAll() bool {
+	return p.All != nil && !strings.HasPrefix(p.All.Command, "!")
+}
+
+// NoPasswd reports whether the user can run all commands without a password
+func (p Privileges) NoPasswd() bool {
+	return p.HasAll() && (p.All.NoPasswd() || !p.Authenticate)
+}
+
+// Source returns the file:line that grants the effective privileges, or an empty string
+func (p Privileges) Source() string {
+	if !p.HasAll() {
+		return ""
+	}
+	if !p.All.NoPasswd() && !p.Authenticate && p.AuthenticateSource != nil {
+		return fmt.Sprintf("%s:%d", p.AuthenticateSource.File, p.AuthenticateSource.Line)
+	}
+	return p.All.Source()
+}
+
+// LookupUser resolves a user name to a User with its groups and the local host name
+func LookupUser(username string) (User, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to look up user %s: %w", username, err)
+	}
+
+	identity := User{Name: u.Username, UID: u.Uid}
+	identity.Host, _ = os.Hostname()
+
+	gids, err := u.GroupIds()
+	if err != nil {
+		return User{}, fmt.Errorf("failed to get groups for user %s: %w", username, err)
+	}
+	for _, gid := range gids {
+		identity.GIDs = append(identity.GIDs, gid)
+		if group, err := user.LookupGroupId(gid); err == nil {
+			identity.Groups = append(identity.Groups, group.Name)
+		}
+	}
+
+	return identity, nil
+}
+
+// Check loads the sudoers policy at path and evaluates it for a user.
+// A missing sudoers file means sudo is not installed and grants nothing.
+func Check(path, username string) (Privileges, error) {
+	identity, err := LookupUser(username)
+	if err != nil {
+		return Privileges{}, err
+	}
+	policy, err := Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Privileges{Authenticate: true}, nil
+	}
+	if err != nil {
+		return Privileges{}, err
+	}
+	return policy.Evaluate(identity), nil
+}
+
+// Evaluate returns the privileges the policy grants to a user
+func (p *Policy) Evaluate(u User) Privileges {
+	privileges := Privileges{Authenticate: true}
+
+	for i := range p.Defaults {
+		entry := &p.Defaults[i]
+		switch entry.Scope {
+		case "":
+		case ":":
+			if !p.matchUserList(entry.Targets, u, 0) {
+				continue
+			}
+		case "@":
+			if !p.matchHostList(entry.Targets, u.Host, 0) {
+				continue
+			}
+		default:
+			// Runas and command scoped Defaults only apply to some commands
+			continue
+		}
+		for _, setting := range entry.Settings {
+			switch setting {
+			case "authenticate":
+				privileges.Authenticate = true
+				privileges.AuthenticateSource = entry
+			case "!authenticate":
+				privileges.Authenticate = false
+				privileges.AuthenticateSource = entry
+			}
+		}
+	}
+
+	all := -1
+	for i := range p.Rules {
+		rule := p.Rules[i]
+		if !p.matchUserList(rule.Users, u, 0) || !p.matchHostList(rule.Hosts, u.Host, 0) {
+			continue
+		}
+		// ALL as another user, such as (nobody) or (:wheel), does not make the user an admin
+		if p.isAllCommand(strings.TrimPrefix(rule.Command, "!"), 0) && p.runsAsRoot(rule) {
+			all = len(privileges.Rules)
+		}
+		privileges.Rules = append(privileges.Rules, rule)
+	}
+	if all >= 0 {
+		privileges.All = &privileges.Rules[all]
+	}
+
+	return privileges
+}
+
+// GlobalDefaults returns the settings of Defaults entries without a scope, the last
+// entry for a setting wins. Flags map to "true" or "false", and quotes are removed
+// from values.
+func (p *Policy) GlobalDefaults() map[string]string {
+	settings := make(map[string]string)
+	for _, entry := range p.Defaults {
+		if entry.Scope != "" {
+			continue
+		}
+		for _, setting := range entry.Settings {
+			if name, value, ok := strings.Cut(setting, "="); ok {
+				// List operators such as env_keep+= are not tracked
+				if strings.HasSuffix(name, "+") || strings.HasSuffix(name, "-") {
+					continue
+				}
+				settings[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+			} else if name, negated := strings.CutPrefix(setting, "!"); negated {
+				settings[name] = "false"
+			} else {
+				settings[setting] = "true"
+			}
+		}
+	}
+	return settings
+}
+
+// matchUserList reports whether a user list matches. Items may be negated with "!",
+// and the last item that matches decides the result.
+func (p *Policy) matchUserList(items []string, u User, depth int) bool {
+	if depth > maxAliasDepth {
+		return false
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		item, negated := strings.CutPrefix(items[i], "!")
+		if p.matchUser(item, u, depth) {
+			return !negated
+		}
+	}
+	return false
+}
+
+// matchUser reports whether a single user list item matches
+func (p *Policy) matchUser(item string, u User, depth int) bool {
+	if item == "ALL" {
+		return !u.groupOnly
+	}
+	if members, ok := p.Aliases[UserAlias][item]; ok {
+		return p.matchUserList(members, u, depth+1)
+	}
+
+	switch {
+	case strings.HasPrefix(item, "%#"):
+		return slices.Contains(u.GIDs, item[2:])
+	case strings.HasPrefix(item, "%:#"):
+		return slices.Contains(u.GIDs, item[3:])
+	case strings.HasPrefix(item, "%:"):
+		return slices.Contains(u.Groups, unquote(item[2:]))
+	case strings.HasPrefix(item, "%"):
+		return slices.Contains(u.Groups, unquote(item[1:]))
+	case strings.HasPrefix(item, "#"):
+		return item[1:] == u.UID
+	case strings.HasPrefix(item, "+"):
+		// Netgroups are not resolved
+		return false
+	}
+	return unquote(item) == u.Name
+}
+
+// runsAsRoot reports whether a rule's commands can be run as root. Without a runas
+// specification they run as root, with only a group list as the invoking user.
+func (p *Policy) runsAsRoot(rule Rule) bool {
+	if rule.RunAsUsers == nil {
+		return rule.RunAsGroups == nil
+	}
+	return p.matchRunAsRoot(rule.RunAsUsers, 0)
+}
+
+// matchRunAsRoot reports whether a runas user list allows root, the last matching item wins
+func (p *Policy) matchRunAsRoot(items []string, depth int) bool {
+	if depth > maxAliasDepth {
+		return false
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		item, negated := strings.CutPrefix(items[i], "!")
+		if members, ok := p.Aliases[RunasAlias][item]; ok {
+			if p.matchRunAsRoot(members, depth+1) {
+				return !negated
+			}
+			continue
+		}
+		if item == "ALL" || item == "#0" || unquote(item) == "root" {
+			return !negated
+		}
+	}
+	return false
+}
+
+// matchHostList reports whether a host list matches the host, the last matching item wins
+func (p *Policy) matchHostList(items []string, host string, depth int) bool {
+	if depth > maxAliasDepth {
+		return false
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		item, negated := strings.CutPrefix(items[i], "!")
+		if p.matchHost(item, host, depth) {
+			return !negated
+		}
+	}
+	return false
+}
+
+// matchHost reports whether a single host list item matches
+func (p *Policy) matchHost(item, host string, depth int) bool {
+	if item == "ALL" {
+		return true
+	}
+	if members, ok := p.Aliases[HostAlias][item]; ok {
+		return p.matchHostList(members, host, depth+1)
+	}
+	short, _, _ := strings.Cut(host, ".")
+	return strings.EqualFold(item, host) || strings.EqualFold(item, short)
+}
+
+// isAllCommand reports whether a command is ALL, directly or through a Cmnd_Alias
+func (p *Policy) isAllCommand(command string, depth int) bool {
+	if command == "ALL" {
+		return true
+	}
+	if depth > maxAliasDepth {
+		return false
+	}
+	members, ok := p.Aliases[CmndAlias][command]
+	if !ok {
+		return false
+	}
+	// An alias grants everything if its last ALL item is not negated
+	for i := len(members) - 1; i >= 0; i-- {
+		member, negated := strings.CutPrefix(members[i], "!")
+		if p.isAllCommand(member, depth+1) {
+			return !negated
+		}
+	}
+	return false
+}
+
+// unquote removes double quotes and backslash escapes from a name
+func unquote(name string) string {
+	name = strings.Trim(name, `"`)
+	return strings.ReplaceAll(name, `\`, "")
+}
@@ -0,0 +1,550 @@
+// Package sudoers parses sudoers policy files and evaluates the privileges they grant
+package sudoers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxIncludeDepth limits nested includes, sudo itself stops at 128
+const maxIncludeDepth = 128
+
+// Alias types
+const (
+	UserAlias  = "User_Alias"
+	RunasAlias = "Runas_Alias"
+	HostAlias  = "Host_Alias"
+	CmndAlias  = "Cmnd_Alias"
+)
+
+// Policy is a parsed sudoers policy, including all included files
+type Policy struct {
+	// Rules are the user specifications in the order sudo reads them
+	Rules []Rule
+
+	// Defaults are the Defaults entries in the order sudo reads them
+	Defaults []Default
+
+	// Aliases maps alias types to alias names and their members
+	Aliases map[string]map[string][]string
+
+	// Files are the files that were read, in order
+	Files []string
+}
+
+// Rule is one command of a user specification, such as "%sudo ALL=(ALL:ALL) ALL"
+type Rule struct {
+	// File and Line locate the user specification
+	File string
+	Line int
+
+	// Users and Hosts are the user and host lists
+	Users []string
+	Hosts []string
+
+	// RunAsUsers and RunAsGroups are the runas user and group lists, such as root and
+	// wheel in "(root : wheel)". Both are nil without a runas specification, where
+	// commands run as root. With only a group list, commands run as the invoking user.
+	RunAsUsers  []string
+	RunAsGroups []string
+
+	// Command is the command, prefixed with "!" if negated
+	Command string
+
+	// Tags are the tags in effect for the command, such as NOPASSWD
+	Tags []string
+}
+
+// Default is a Defaults entry, such as "Defaults:bob !authenticate"
+type Default struct {
+	// File and Line locate the entry
+	File string
+	Line int
+
+	// Scope is the binding character (":" user, "@" host, ">" runas, "!" command), empty for global
+	Scope string
+
+	// Targets are the users, hosts, runas users or commands the entry is bound to
+	Targets []string
+
+	// Settings are the parameters, such as "!authenticate" or "timestamp_timeout=0"
+	Settings []string
+}
+
+// Source returns the file:line location of a rule
+func (r Rule) Source() string {
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
+
+// NoPasswd reports whether the rule's tags let the command run without a password
+func (r Rule) NoPasswd() bool {
+	noPasswd := false
+	for _, tag := range r.Tags {
+		switch tag {
+		case "NOPASSWD":
+			noPasswd = true
+		case "PASSWD":
+			noPasswd = false
+		}
+	}
+	return noPasswd
+}
+
+// Load reads a sudoers file and the files it includes
+func Load(path string) (*Policy, error) {
+	policy := newPolicy()
+	if err := policy.load(path, 0); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Parse parses sudoers content. Includes are resolved relative to the directory of name.
+func Parse(name, content string) (*Policy, error) {
+	policy := newPolicy()
+	if err := policy.parse(name, content, 0); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// newPolicy creates an empty policy
+func newPolicy() *Policy {
+	return &Policy{
+		Aliases: map[string]map[string][]string{
+			UserAlias:  {},
+			RunasAlias: {},
+			HostAlias:  {},
+			CmndAlias:  {},
+		},
+	}
+}
+
+// load reads and parses a file
+func (p *Policy) load(path string, depth int) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read sudoers file: %w", err)
+	}
+	return p.parse(path, string(content), depth)
+}
+
+// parse parses the content of a file, following includes
+func (p *Policy) parse(name, content string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: too many levels of includes", name)
+	}
+	p.Files = append(p.Files, name)
+
+	for _, line := range logicalLines(content) {
+		text := line.text
+
+		// Include directives look like comments in older sudoers files
+		if directive, arg, ok := includeDirective(text); ok {
+			if err := p.include(name, directive, arg, depth); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line.number, err)
+			}
+			continue
+		}
+
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" {
+			continue
+		}
+
+		keyword, _, _ := cutSpace(text)
+		switch {
+		case keyword == UserAlias || keyword == RunasAlias || keyword == HostAlias || keyword == CmndAlias || keyword == "Cmd_Alias":
+			if err := p.parseAlias(text); err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line.number, err)
+			}
+		case strings.HasPrefix(text, "Defaults"):
+			entry, err := parseDefaults(text)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line.number, err)
+			}
+			entry.File, entry.Line = name, line.number
+			p.Defaults = append(p.Defaults, entry)
+		default:
+			rules, err := parseUserSpec(text)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", name, line.number, err)
+			}
+			for i := range rules {
+				rules[i].File, rules[i].Line = name, line.number
+			}
+			p.Rules = append(p.Rules, rules...)
+		}
+	}
+
+	return nil
+}
+
+// include reads an included file or directory
+func (p *Policy) include(name, directive, arg string, depth int) error {
+	path := strings.Trim(arg, `"`)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(name), path)
+	}
+
+	if directive == "include" {
+		return p.load(path, depth+1)
+	}
+
+	// sudo reads directory entries in lexical order, skipping names that end
+	// in "~" or contain a "." so editor backups and package leftovers are ignored
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read sudoers directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(entryName, "~") || strings.Contains(entryName, ".") {
+			continue
+		}
+		files = append(files, filepath.Join(path, entryName))
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if err := p.load(file, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// line is a logical line of a sudoers file, with continuations joined
+type line struct {
+	number int
+	text   string
+}
+
+// logicalLines splits content into lines, joining lines that end with a backslash
+func logicalLines(content string) []line {
+	var lines []line
+	var current strings.Builder
+	start := 0
+
+	for i, raw := range strings.Split(content, "\n") {
+		if current.Len() == 0 {
+			start = i + 1
+		}
+		if strings.HasSuffix(raw, `\`) && !strings.HasSuffix(raw, `\\`) {
+			current.WriteString(strings.TrimSuffix(raw, `\`))
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(raw)
+		lines = append(lines, line{number: start, text: current.String()})
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		lines = append(lines, line{number: start, text: current.String()})
+	}
+
+	return lines
+}
+
+// includeDirective recognizes @include, @includedir and their older #include forms
+func includeDirective(text string) (string, string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	switch fields[0] {
+	case "@include", "#include":
+		return "include", fields[1], true
+	case "@includedir", "#includedir":
+		return "includedir", fields[1], true
+	}
+	return "", "", false
+}
+
+// stripComment removes a trailing comment. A "#" followed by a digit is a uid, not a comment.
+func stripComment(text string) string {
+	escaped := false
+	inQuotes := false
+	for i, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == '#' && !inQuotes:
+			if i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9' {
+				continue
+			}
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// parseAlias parses an alias definition, which may define several aliases separated by ":"
+func (p *Policy) parseAlias(text string) error {
+	keyword, rest, _ := cutSpace(text)
+	if keyword == "Cmd_Alias" {
+		keyword = CmndAlias
+	}
+
+	for _, definition := range splitUnescaped(rest, ':') {
+		aliasName, members, ok := strings.Cut(definition, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s definition: %s", keyword, strings.TrimSpace(definition))
+		}
+		aliasName = strings.TrimSpace(aliasName)
+		if aliasName == "" {
+			return fmt.Errorf("invalid %s definition: missing name", keyword)
+		}
+		p.Aliases[keyword][aliasName] = splitList(members)
+	}
+	return nil
+}
+
+// parseDefaults parses a Defaults entry
+func parseDefaults(text string) (Default, error) {
+	var entry Default
+
+	rest := strings.TrimPrefix(text, "Defaults")
+	if rest != "" && strings.ContainsAny(rest[:1], ":@>!") {
+		entry.Scope = rest[:1]
+		targets, settings, ok := cutSpace(rest[1:])
+		if !ok {
+			return entry, fmt.Errorf("invalid Defaults entry: %s", text)
+		}
+		entry.Targets = splitList(targets)
+		rest = settings
+	} else if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return entry, fmt.Errorf("invalid Defaults entry: %s", text)
+	}
+
+	entry.Settings = splitList(rest)
+	return entry, nil
+}
+
+// parseUserSpec parses a user specification into one rule per command
+func parseUserSpec(text string) ([]Rule, error) {
+	// The user list is separated from the rest by whitespace, lists may contain ", "
+	users, rest, ok := cutSpace(compactLists(text))
+	if !ok {
+		return nil, fmt.Errorf("invalid user specification: %s", text)
+	}
+
+	var rules []Rule
+	for _, hostSpec := range splitHostSpecs(rest) {
+		hosts, commands, ok := strings.Cut(hostSpec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid user specification: %s", text)
+		}
+
+		// The runas lists and tags carry over to the following commands
+		var runAsUsers, runAsGroups, tags []string
+		for _, item := range splitCommands(commands) {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, "(") {
+				end := strings.Index(item, ")")
+				if end < 0 {
+					return nil, fmt.Errorf("invalid runas specification: %s", item)
+				}
+				userList, groupList, _ := strings.Cut(item[1:end], ":")
+				runAsUsers, runAsGroups = splitList(userList), splitList(groupList)
+				item = strings.TrimSpace(item[end+1:])
+			}
+
+			// Skip option specifications such as TIMEOUT=5m or CWD=/tmp, which precede the tags
+			for {
+				option, after, found := cutSpace(item)
+				if !found || !isOption(option) {
+					break
+				}
+				item = after
+			}
+
+			for {
+				word, after, found := strings.Cut(item, ":")
+				word = strings.TrimSpace(word)
+				if !found || !isTag(word) {
+					break
+				}
+				tags = append(tags, word)
+				item = strings.TrimSpace(after)
+			}
+
+			if item == "" {
+				return nil, fmt.Errorf("missing command in user specification: %s", text)
+			}
+			rules = append(rules, Rule{
+				Users:       splitList(users),
+				Hosts:       splitList(hosts),
+				RunAsUsers:  runAsUsers,
+				RunAsGroups: runAsGroups,
+				Command:     item,
+				Tags:        slices.Clone(tags),
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+// splitHostSpecs splits the part of a user specification after the user list at ":"
+// separators between host specifications, ignoring tag colons and runas groups
+func splitHostSpecs(text string) []string {
+	var specs []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ':':
+			if depth > 0 {
+				continue
+			}
+			// A colon directly after a tag word belongs to the tag
+			wordStart := strings.LastIndexAny(text[:i], " \t,=") + 1
+			if isTag(text[wordStart:i]) {
+				continue
+			}
+			// A following host specification has its own "="
+			if strings.Contains(text[i+1:], "=") {
+				specs = append(specs, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(specs, text[start:])
+}
+
+// tags are the command tags sudo recognizes
+var tags = map[string]bool{
+	"NOPASSWD": true, "PASSWD": true,
+	"NOEXEC": true, "EXEC": true,
+	"SETENV": true, "NOSETENV": true,
+	"LOG_INPUT": true, "NOLOG_INPUT": true,
+	"LOG_OUTPUT": true, "NOLOG_OUTPUT": true,
+	"MAIL": true, "NOMAIL": true,
+	"FOLLOW": true, "NOFOLLOW": true,
+	"INTERCEPT": true, "NOINTERCEPT": true,
+}
+
+// isTag reports whether a word is a command tag
+func isTag(word string) bool {
+	return tags[word]
+}
+
+// isOption reports whether a word is an option specification such as TIMEOUT=5m
+func isOption(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	switch name {
+	case "ROLE", "TYPE", "APPARMOR_PROFILE", "PRIVS", "LIMITPRIVS", "TIMEOUT", "NOTBEFORE", "NOTAFTER", "CWD", "CHROOT":
+		return ok
+	}
+	return false
+}
+
+// compactLists removes whitespace around commas so that lists become single fields
+func compactLists(text string) string {
+	fields := strings.Split(text, ",")
+	for i := range fields {
+		if i > 0 {
+			fields[i] = strings.TrimLeft(fields[i], " \t")
+		}
+		if i < len(fields)-1 {
+			fields[i] = strings.TrimRight(fields[i], " \t")
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// cutSpace splits text at the first run of whitespace
+func cutSpace(text string) (string, string, bool) {
+	text = strings.TrimSpace(text)
+	i := strings.IndexAny(text, " \t")
+	if i < 0 {
+		return text, "", false
+	}
+	return text[:i], strings.TrimSpace(text[i:]), true
+}
+
+// splitList splits a comma-separated list, trimming whitespace
+func splitList(text string) []string {
+	var items []string
+	for _, item := range splitUnescaped(text, ',') {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// splitCommands splits a command list at commas, keeping the user and group lists of a
+// runas specification such as (root, www-data : adm, wheel) with the command it precedes
+func splitCommands(text string) []string {
+	var parts []string
+	start := 0
+	inQuotes := false
+	itemStart := true
+	for i := 0; i < len(text); i++ {
+		if itemStart {
+			if text[i] == ' ' || text[i] == '\t' {
+				continue
+			}
+			itemStart = false
+			// An unterminated runas specification is reported by the caller
+			if end := strings.IndexByte(text[i:], ')'); text[i] == '(' && end >= 0 {
+				i += end
+				continue
+			}
+		}
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				parts = append(parts, text[start:i])
+				start = i + 1
+				itemStart = true
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// splitUnescaped splits text at sep, ignoring separators escaped with a backslash or inside quotes
+func splitUnescaped(text string, sep byte) []string {
+	var parts []string
+	start := 0
+	inQuotes := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
@@ -0,0 +1,396 @@
+package sudoers
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var bob = User{Name: "bob", UID: "1001", Groups: []string{"bob", "sudo"}, GIDs: []string{"1001", "27"}, Host: "web1.example.com"}
+
+func TestParse(t *testing.T) {
+	content := `# Comment
+Defaults	env_reset
+Defaults:bob !authenticate, timestamp_timeout=0
+User_Alias ADMINS = alice, \
+	bob : OPS = %ops
+Cmnd_Alias SHELLS = /bin/sh, /bin/bash
+%admins, #1002 web1, web2 = (root : wheel) NOPASSWD: /usr/bin/apt, SETENV: /bin/ls, PASSWD: ALL : db1 = ALL
+carol ALL = TIMEOUT=5m NOPASSWD:NOEXEC: !SHELLS # trailing comment
+`
+
+	policy, err := Parse("/etc/sudoers", content)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	if len(policy.Defaults) != 2 {
+		t.Fatalf("Expected 2 Defaults entries, got %d", len(policy.Defaults))
+	}
+	if d := policy.Defaults[1]; d.Scope != ":" || d.Targets[0] != "bob" || d.Settings[0] != "!authenticate" || d.Line != 3 {
+		t.Errorf("Unexpected Defaults entry: %+v", d)
+	}
+
+	if admins := policy.Aliases[UserAlias]["ADMINS"]; len(admins) != 2 || admins[1] != "bob" {
+		t.Errorf("Unexpected ADMINS alias: %v", admins)
+	}
+	if ops := policy.Aliases[UserAlias]["OPS"]; len(ops) != 1 || ops[0] != "%ops" {
+		t.Errorf("Unexpected OPS alias: %v", ops)
+	}
+
+	if len(policy.Rules) != 5 {
+		t.Fatalf("Expected 5 rules, got %d: %+v", len(policy.Rules), policy.Rules)
+	}
+
+	apt := policy.Rules[0]
+	if apt.Line != 7 || apt.Command != "/usr/bin/apt" || !apt.NoPasswd() {
+		t.Errorf("Unexpected apt rule: %+v", apt)
+	}
+	if len(apt.Users) != 2 || apt.Users[1] != "#1002" || len(apt.Hosts) != 2 ||
+		!slices.Equal(apt.RunAsUsers, []string{"root"}) || !slices.Equal(apt.RunAsGroups, []string{"wheel"}) {
+		t.Errorf("Unexpected apt rule lists: %+v", apt)
+	}
+
+	// Tags carry over to later commands until overridden
+	if ls := policy.Rules[1]; ls.Command != "/bin/ls" || !ls.NoPasswd() {
+		t.Errorf("Expected /bin/ls to inherit NOPASSWD, got %+v", ls)
+	}
+	if all := policy.Rules[2]; all.Command != "ALL" || all.NoPasswd() {
+		t.Errorf("Expected PASSWD to override NOPASSWD, got %+v", all)
+	}
+
+	// A second host specification starts fresh
+	if db := policy.Rules[3]; db.Hosts[0] != "db1" || db.Command != "ALL" || db.RunAsUsers != nil || db.NoPasswd() {
+		t.Errorf("Unexpected db1 rule: %+v", db)
+	}
+
+	if carol := policy.Rules[4]; carol.Command != "!SHELLS" || !carol.NoPasswd() {
+		t.Errorf("Unexpected carol rule: %+v", carol)
+	}
+}
+
+func TestParseRunAsLists(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		users    []string
+		groups   []string
+		commands []string
+	}{
+		{
+			name:     "user list",
+			content:  "deploy ALL=(root, www-data) NOPASSWD: /bin/ls",
+			users:    []string{"root", "www-data"},
+			commands: []string{"/bin/ls"},
+		},
+		{
+			name:     "user and group lists",
+			content:  "deploy ALL = (root : wheel, adm) /bin/ls, /usr/bin/systemctl restart nginx",
+			users:    []string{"root"},
+			groups:   []string{"wheel", "adm"},
+			commands: []string{"/bin/ls", "/usr/bin/systemctl restart nginx"},
+		},
+		{
+			name:     "group list only",
+			content:  "deploy ALL=(:wheel,adm) NOPASSWD: /bin/ls",
+			groups:   []string{"wheel", "adm"},
+			commands: []string{"/bin/ls"},
+		},
+		{
+			name:     "runas list per command",
+			content:  "deploy ALL=(root, www-data) /bin/ls, (postgres, backup) /usr/bin/pg_dump",
+			users:    []string{"postgres", "backup"},
+			commands: []string{"/bin/ls", "/usr/bin/pg_dump"},
+		},
+		{
+			name:     "unescaped comma in arguments still separates commands",
+			content:  "deploy ALL=(root) /bin/echo (a,b)",
+			users:    []string{"root"},
+			commands: []string{"/bin/echo (a", "b)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Parse("/etc/sudoers", tt.content)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if len(policy.Rules) != len(tt.commands) {
+				t.Fatalf("Expected %d rules, got %d: %+v", len(tt.commands), len(policy.Rules), policy.Rules)
+			}
+			for i, rule := range policy.Rules {
+				if rule.Command != tt.commands[i] {
+					t.Errorf("Expected command %q, got %q", tt.commands[i], rule.Command)
+				}
+			}
+			last := policy.Rules[len(policy.Rules)-1]
+			if !slices.Equal(last.RunAsUsers, tt.users) {
+				t.Errorf("Expected runas users %v, got %v", tt.users, last.RunAsUsers)
+			}
+			if !slices.Equal(last.RunAsGroups, tt.groups) {
+				t.Errorf("Expected runas groups %v, got %v", tt.groups, last.RunAsGroups)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"Missing equals", "bob ALL"},
+		{"Missing command", "bob ALL = NOPASSWD:"},
+		{"Unterminated runas", "bob ALL = (root ALL"},
+		{"Invalid alias", "User_Alias ADMINS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse("/etc/sudoers", tt.content); err == nil {
+				t.Errorf("Expected error for %q", tt.content)
+			}
+		})
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "iniq-sudoers-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	includeDir := filepath.Join(tempDir, "sudoers.d")
+	if err := os.Mkdir(includeDir, 0755); err != nil {
+		t.Fatalf("Failed to create include dir: %v", err)
+	}
+
+	files := map[string]string{
+		"sudoers":                "root ALL=(ALL) ALL\n#includedir sudoers.d\n@include extra\n",
+		"extra":                  "bob ALL=(ALL) ALL\n",
+		"sudoers.d/90-bob":       "bob ALL=(ALL) NOPASSWD: ALL\n",
+		"sudoers.d/10-bob":       "bob ALL=(ALL) /bin/ls\n",
+		"sudoers.d/bob~":         "bob ALL=(ALL) NOPASSWD: /backup\n",
+		"sudoers.d/bob.dpkg-old": "bob ALL=(ALL) NOPASSWD: /old\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0440); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	policy, err := Load(filepath.Join(tempDir, "sudoers"))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	expectedFiles := []string{"sudoers", "sudoers.d/10-bob", "sudoers.d/90-bob", "extra"}
+	if len(policy.Files) != len(expectedFiles) {
+		t.Fatalf("Expected files %v, got %v", expectedFiles, policy.Files)
+	}
+	for i, name := range expectedFiles {
+		if policy.Files[i] != filepath.Join(tempDir, name) {
+			t.Errorf("Expected file %d to be %s, got %s", i, name, policy.Files[i])
+		}
+	}
+
+	// The include after the directory comes last, so its rule wins
+	privileges := policy.Evaluate(bob)
+	if !privileges.HasAll() || privileges.NoPasswd() {
+		t.Errorf("Expected password-protected access, got %+v", privileges.All)
+	}
+	if source := privileges.Source(); source != filepath.Join(tempDir, "extra")+":1" {
+		t.Errorf("Expected source in extra, got %s", source)
+	}
+
+	if _, err := Load(filepath.Join(tempDir, "missing")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+
+	// Check treats a missing policy as no privileges
+	privileges, err = Check(filepath.Join(tempDir, "missing"), "root")
+	if err != nil || privileges.HasAll() {
+		t.Errorf("Expected no privileges without error, got %v (%v)", privileges.HasAll(), err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		hasAll   bool
+		noPasswd bool
+		source   string
+	}{
+		{
+			name:    "No rules",
+			content: "root ALL=(ALL) ALL",
+		},
+		{
+			name:    "Name prefix does not match",
+			content: "bobby ALL=(ALL) NOPASSWD: ALL",
+		},
+		{
+			name:    "User rule",
+			content: "bob ALL=(ALL) ALL",
+			hasAll:  true,
+			source:  "/etc/sudoers:1",
+		},
+		{
+			name:     "Group rule",
+			content:  "%sudo ALL=(ALL:ALL) NOPASSWD: ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:1",
+		},
+		{
+			name:     "Group id and uid rules",
+			content:  "%#27 ALL=(ALL) ALL\n#1001 ALL=(ALL) NOPASSWD: ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:2",
+		},
+		{
+			name:    "Later rule wins",
+			content: "bob ALL=(ALL) NOPASSWD: ALL\n%sudo ALL=(ALL) ALL",
+			hasAll:  true,
+			source:  "/etc/sudoers:2",
+		},
+		{
+			name:    "Limited command",
+			content: "bob ALL=(ALL) NOPASSWD: /usr/bin/apt",
+		},
+		{
+			name:     "User alias",
+			content:  "User_Alias ADMINS = alice, %sudo\nADMINS ALL = NOPASSWD: ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:2",
+		},
+		{
+			name:    "Negated user",
+			content: "%sudo, !bob ALL=(ALL) NOPASSWD: ALL",
+		},
+		{
+			name:    "Negated ALL",
+			content: "bob ALL=(ALL) NOPASSWD: ALL\nbob ALL=(ALL) !ALL",
+		},
+		{
+			name:     "Command alias containing ALL",
+			content:  "Cmnd_Alias EVERYTHING = ALL\nbob ALL = NOPASSWD: EVERYTHING",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:2",
+		},
+		{
+			name:    "Other host",
+			content: "bob db1 = NOPASSWD: ALL",
+		},
+		{
+			name:     "Short host name",
+			content:  "Host_Alias WEB = web1, web2\nbob WEB = NOPASSWD: ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:2",
+		},
+		{
+			name:     "Defaults disables authentication",
+			content:  "bob ALL=(ALL) ALL\nDefaults:bob !authenticate",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:2",
+		},
+		{
+			name:    "Runas another user",
+			content: "bob ALL=(nobody) NOPASSWD: ALL",
+		},
+		{
+			name:    "Runas group only",
+			content: "bob ALL=(:wheel) NOPASSWD: ALL",
+		},
+		{
+			name:     "Runas root with any group",
+			content:  "bob ALL=(root:ALL) NOPASSWD: ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:1",
+		},
+		{
+			name:     "Runas alias containing root",
+			content:  "Runas_Alias ADMIN = root, #0\nbob ALL=(www-data, ADMIN) NOPASSWD: ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:2",
+		},
+		{
+			name:    "Runas ALL except root",
+			content: "bob ALL=(ALL, !root) NOPASSWD: ALL",
+		},
+		{
+			name:     "Later runas rule does not hide root access",
+			content:  "bob ALL=(ALL) NOPASSWD: ALL\nbob ALL=(nobody) ALL",
+			hasAll:   true,
+			noPasswd: true,
+			source:   "/etc/sudoers:1",
+		},
+		{
+			name:    "Defaults for another user",
+			content: "bob ALL=(ALL) ALL\nDefaults:alice !authenticate",
+			hasAll:  true,
+			source:  "/etc/sudoers:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Parse("/etc/sudoers", tt.content)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+
+			privileges := policy.Evaluate(bob)
+			if privileges.HasAll() != tt.hasAll {
+				t.Errorf("Expected HasAll() %v, got %v", tt.hasAll, privileges.HasAll())
+			}
+			if privileges.NoPasswd() != tt.noPasswd {
+				t.Errorf("Expected NoPasswd() %v, got %v", tt.noPasswd, privileges.NoPasswd())
+			}
+			if privileges.Source() != tt.source {
+				t.Errorf("Expected source %q, got %q", tt.source, privileges.Source())
+			}
+		})
+	}
+}
+
+func TestGlobalDefaults(t *testing.T) {
+	content := `Defaults use_pty, logfile="/var/log/sudo.log"
+Defaults	env_keep += "HOME"
+Defaults:bob timestamp_timeout=30
+Defaults timestamp_timeout=5
+Defaults !lecture
+Defaults lecture=always`
+
+	policy, err := Parse("/etc/sudoers", content)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"use_pty":           "true",
+		"logfile":           "/var/log/sudo.log",
+		"timestamp_timeout": "5",
+		"lecture":           "always",
+	}
+	settings := policy.GlobalDefaults()
+	if len(settings) != len(expected) {
+		t.Errorf("Expected %d settings, got %v", len(expected), settings)
+	}
+	for name, value := range expected {
+		if settings[name] != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, settings[name])
+		}
+	}
+}
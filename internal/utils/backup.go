@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/teomyth/iniq/pkg/safefile"
 )
 
 // BackupFile creates a backup of a file with a timestamp
@@ -13,25 +15,11 @@ import (
 // Returns the path to the backup file if successful
 func BackupFile(filePath string, backupEnabled bool) (string, error) {
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if _, err := os.Lstat(filePath); os.IsNotExist(err) {
 		return "", nil // File doesn't exist, nothing to backup
 	}
 
-	// Read the original file
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file for backup: %w", err)
-	}
-
-	var backupPath string
-	if backupEnabled {
-		// Create a timestamped backup file
-		timestamp := time.Now().Format("20060102150405")
-		backupPath = filePath + ".bak." + timestamp
-	} else {
-		// Create a simple backup file
-		backupPath = filePath + ".bak"
-	}
+	backupPath := BackupPath(filePath, backupEnabled)
 
 	// Create backup directory if it doesn't exist
 	backupDir := filepath.Dir(backupPath)
@@ -39,10 +27,22 @@ func BackupFile(filePath string, backupEnabled bool) (string, error) {
 		return "", fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
-	// Write the backup file
-	if err := os.WriteFile(backupPath, content, 0644); err != nil {
+	// Copy with the original mode and owner, backups of sudoers must not be world-readable
+	if err := safefile.CopyFile(filePath, backupPath); err != nil {
 		return "", fmt.Errorf("failed to write backup file: %w", err)
 	}
 
 	return backupPath, nil
 }
+
+// BackupPath returns the backup path of a file, with a timestamp if timestamped is set
+func BackupPath(filePath string, timestamped bool) string {
+	if timestamped {
+		// Create a timestamped backup file
+		timestamp := time.Now().Format("20060102150405")
+		return filePath + ".bak." + timestamp
+	}
+
+	// Create a simple backup file
+	return filePath + ".bak"
+}
@@ -0,0 +1,259 @@
+package osdetect
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CloudProvider represents the cloud platform a system runs on
+type CloudProvider string
+
+const (
+	// AWS represents Amazon Web Services EC2
+	AWS CloudProvider = "aws"
+	// GCP represents Google Compute Engine
+	GCP CloudProvider = "gcp"
+	// Azure represents Microsoft Azure
+	Azure CloudProvider = "azure"
+	// Hetzner represents Hetzner Cloud
+	Hetzner CloudProvider = "hetzner"
+	// DigitalOcean represents DigitalOcean Droplets
+	DigitalOcean CloudProvider = "digitalocean"
+	// NoCloud represents a system not running on a known cloud provider
+	NoCloud CloudProvider = ""
+)
+
+// azureAssetTag is the chassis asset tag Hyper-V sets on Azure virtual machines
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// Environment describes where a system runs
+type Environment struct {
+	// Container is the container manager, such as docker, podman or lxc, empty outside containers
+	Container string
+	// Virtualization is the hypervisor, such as kvm or vmware, empty on bare metal or when unknown
+	Virtualization string
+	// WSL reports whether the system runs under Windows Subsystem for Linux
+	WSL bool
+	// Cloud is the cloud provider, identified from DMI data
+	Cloud CloudProvider
+}
+
+// InContainer reports whether the system runs in a container
+func (e Environment) InContainer() bool {
+	return e.Container != ""
+}
+
+// String returns a short description of the environment, such as "docker container"
+func (e Environment) String() string {
+	var parts []string
+	switch {
+	case e.WSL:
+		parts = append(parts, "WSL")
+	case e.InContainer():
+		parts = append(parts, e.Container+" container")
+	case e.Virtualization != "":
+		parts = append(parts, e.Virtualization+" virtual machine")
+	}
+	if e.Cloud != NoCloud {
+		if len(parts) == 0 {
+			return e.Cloud.DisplayName()
+		}
+		parts = append(parts, "on "+e.Cloud.DisplayName())
+	}
+	if len(parts) == 0 {
+		return "bare metal"
+	}
+	return strings.Join(parts, " ")
+}
+
+// DisplayName returns the name of the cloud provider for messages
+func (c CloudProvider) DisplayName() string {
+	switch c {
+	case AWS:
+		return "AWS"
+	case GCP:
+		return "Google Cloud"
+	case Azure:
+		return "Azure"
+	case Hetzner:
+		return "Hetzner Cloud"
+	case DigitalOcean:
+		return "DigitalOcean"
+	}
+	return string(c)
+}
+
+// DetectEnvironment detects the container, virtualization, WSL and cloud environment of
+// the running system, using systemd-detect-virt when it is installed
+func DetectEnvironment() Environment {
+	return detectEnvironment("/", systemdDetectVirt)
+}
+
+// systemdDetectVirt runs systemd-detect-virt with a flag and returns what it found,
+// or an empty string when it found nothing or is not installed
+func systemdDetectVirt(flag string) string {
+	path, err := exec.LookPath("systemd-detect-virt")
+	if err != nil {
+		return ""
+	}
+	// Exits non-zero and prints "none" when nothing is detected
+	output, _ := exec.Command(path, flag).Output()
+	if result := strings.TrimSpace(string(output)); result != "none" {
+		return result
+	}
+	return ""
+}
+
+// detectEnvironment detects the environment from the file system mounted at root.
+// detectVirt is consulted first and the file system is only used for what it does not report.
+func detectEnvironment(root string, detectVirt func(flag string) string) Environment {
+	env := Environment{
+		Container:      detectVirt("--container"),
+		Virtualization: detectVirt("--vm"),
+	}
+
+	// systemd-detect-virt reports WSL as a container, but it behaves like a virtual machine
+	if env.Container == "wsl" || isWSL(root) {
+		env.Container = ""
+		env.WSL = true
+	}
+	if env.Container == "" && !env.WSL {
+		env.Container = detectContainer(root)
+	}
+
+	dmi := readDMI(root)
+	if env.Virtualization == "" && !env.InContainer() {
+		env.Virtualization = dmiVirtualization(dmi)
+	}
+	// Containers see the DMI data of their host, which says nothing about the container itself
+	if !env.InContainer() {
+		env.Cloud = dmiCloudProvider(dmi)
+	}
+	return env
+}
+
+// isWSL reports whether the kernel is a Windows Subsystem for Linux kernel
+func isWSL(root string) bool {
+	if _, err := os.Stat(filepath.Join(root, "proc/sys/fs/binfmt_misc/WSLInterop")); err == nil {
+		return true
+	}
+	release := strings.ToLower(readTrimmed(root, "proc/sys/kernel/osrelease"))
+	return strings.Contains(release, "microsoft") || strings.Contains(release, "wsl")
+}
+
+// cgroupContainers maps cgroup path fragments of the init process to container managers
+var cgroupContainers = []struct {
+	fragment  string
+	container string
+}{
+	{"/kubepods", "kubernetes"},
+	{"/libpod", "podman"},
+	{"/docker", "docker"},
+	{"/lxc/", "lxc"},
+	{"/machine.slice/machine-", "systemd-nspawn"},
+}
+
+// detectContainer detects the container manager from the marker files it leaves behind
+func detectContainer(root string) string {
+	if _, err := os.Stat(filepath.Join(root, ".dockerenv")); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat(filepath.Join(root, "run/.containerenv")); err == nil {
+		return "podman"
+	}
+	// Written by systemd when it runs as init inside a container
+	if container := readTrimmed(root, "run/systemd/container"); container != "" {
+		return container
+	}
+	// Container managers set container= in the environment of the init process
+	if environ, err := os.ReadFile(filepath.Join(root, "proc/1/environ")); err == nil {
+		for _, variable := range bytes.Split(environ, []byte{0}) {
+			if value, found := strings.CutPrefix(string(variable), "container="); found && value != "" {
+				return value
+			}
+		}
+	}
+	// Under cgroup v1 the init process of a container sits in a cgroup named after it
+	cgroup := readTrimmed(root, "proc/1/cgroup")
+	for _, c := range cgroupContainers {
+		if strings.Contains(cgroup, c.fragment) {
+			return c.container
+		}
+	}
+	return ""
+}
+
+// dmiFields are the DMI identification files used to detect hypervisors and cloud providers
+var dmiFields = []string{"sys_vendor", "product_name", "product_version", "bios_vendor", "bios_version", "chassis_asset_tag", "board_asset_tag"}
+
+// readDMI reads the DMI identification of the machine, keyed by file name
+func readDMI(root string) map[string]string {
+	dmi := make(map[string]string, len(dmiFields))
+	for _, field := range dmiFields {
+		dmi[field] = readTrimmed(root, filepath.Join("sys/class/dmi/id", field))
+	}
+	return dmi
+}
+
+// dmiHypervisors maps DMI vendor and product fragments to hypervisor names
+// as reported by systemd-detect-virt
+var dmiHypervisors = []struct {
+	fragment string
+	name     string
+}{
+	{"kvm", "kvm"},
+	{"qemu", "qemu"},
+	{"vmware", "vmware"},
+	{"virtualbox", "oracle"},
+	{"innotek", "oracle"},
+	{"xen", "xen"},
+	{"amazon ec2", "amazon"},
+	{"google compute engine", "google"},
+	{"microsoft corporation virtual machine", "microsoft"},
+	{"parallels", "parallels"},
+	{"bochs", "bochs"},
+}
+
+// dmiVirtualization returns the hypervisor named by the DMI data, if any
+func dmiVirtualization(dmi map[string]string) string {
+	identity := strings.ToLower(strings.Join([]string{dmi["sys_vendor"], dmi["product_name"], dmi["bios_vendor"], dmi["bios_version"]}, " "))
+	for _, h := range dmiHypervisors {
+		if strings.Contains(identity, h.fragment) {
+			return h.name
+		}
+	}
+	return ""
+}
+
+// dmiCloudProvider returns the cloud provider named by the DMI data, if any
+func dmiCloudProvider(dmi map[string]string) CloudProvider {
+	vendor := strings.ToLower(dmi["sys_vendor"])
+	switch {
+	case vendor == "amazon ec2", strings.Contains(strings.ToLower(dmi["bios_version"]), "amazon"),
+		strings.HasPrefix(dmi["board_asset_tag"], "i-"):
+		// Older Xen instances only mention Amazon in the BIOS version
+		return AWS
+	case vendor == "google", dmi["product_name"] == "Google Compute Engine":
+		return GCP
+	case dmi["chassis_asset_tag"] == azureAssetTag:
+		return Azure
+	case vendor == "hetzner":
+		return Hetzner
+	case vendor == "digitalocean":
+		return DigitalOcean
+	}
+	return NoCloud
+}
+
+// readTrimmed returns the contents of a file under root without surrounding space,
+// or an empty string if it cannot be read
+func readTrimmed(root, path string) string {
+	content, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
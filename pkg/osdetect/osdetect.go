@@ -33,6 +33,10 @@ const (
 	SUSE DistroType = "suse"
 	// Arch represents Arch-based distributions (Arch Linux, Manjaro, etc.)
 	Arch DistroType = "arch"
+	// Alpine represents Alpine Linux
+	Alpine DistroType = "alpine"
+	// Amazon represents Amazon Linux
+	Amazon DistroType = "amazon"
 	// Generic represents a generic Linux distribution
 	Generic DistroType = "generic"
 	// MacOS represents macOS
@@ -55,6 +59,8 @@ const (
 	Zypper PackageManager = "zypper"
 	// Pacman represents the Pacman package manager (Arch Linux, Manjaro, etc.)
 	Pacman PackageManager = "pacman"
+	// APK represents the APK package manager (Alpine Linux)
+	APK PackageManager = "apk"
 	// Brew represents the Homebrew package manager (macOS)
 	Brew PackageManager = "brew"
 	// UnknownPM represents an unknown package manager
@@ -69,54 +75,51 @@ type Info struct {
 	Distro DistroType
 	// Version is the operating system version
 	Version string
+	// Codename is the release codename, such as bookworm, if the distribution has one
+	Codename string
 	// PlatformID is the platform identifier
 	PlatformID string
 	// PackageManager is the package manager type
 	PackageManager PackageManager
+	// Environment describes the container, virtual machine or cloud the system runs in
+	Environment Environment
 }
 
 // Detect detects the operating system and returns Info
 func Detect() (*Info, error) {
+	return DetectRoot("/")
+}
+
+// DetectRoot detects the operating system, reading Linux distribution details from
+// the os-release file of the file system mounted at root
+func DetectRoot(root string) (*Info, error) {
 	hostInfo, err := host.Info()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host info: %w", err)
 	}
 
 	info := &Info{
-		Version: hostInfo.PlatformVersion,
+		Version:    hostInfo.PlatformVersion,
+		PlatformID: hostInfo.Platform,
 	}
 
 	// Detect OS type
 	switch strings.ToLower(hostInfo.OS) {
 	case "linux":
 		info.Type = Linux
-		// Detect Linux distribution
-		switch strings.ToLower(hostInfo.Platform) {
-		case "debian", "ubuntu", "linuxmint", "pop", "elementary", "kali":
-			info.Distro = Debian
-			info.PackageManager = APT
-		case "rhel", "centos", "fedora", "rocky", "almalinux", "oracle":
-			info.Distro = RedHat
-			if strings.ToLower(hostInfo.Platform) == "fedora" {
-				info.PackageManager = DNF
-			} else {
-				// Check version for RHEL/CentOS
-				if strings.HasPrefix(hostInfo.PlatformVersion, "8") || strings.HasPrefix(hostInfo.PlatformVersion, "9") {
-					info.PackageManager = DNF
-				} else {
-					info.PackageManager = YUM
-				}
-			}
-		case "suse", "opensuse", "sles":
-			info.Distro = SUSE
-			info.PackageManager = Zypper
-		case "arch", "manjaro", "endeavouros":
-			info.Distro = Arch
-			info.PackageManager = Pacman
-		default:
-			info.Distro = Generic
-			info.PackageManager = UnknownPM
+		// Fall back to the platform reported by the host when os-release is missing
+		release, err := ReadOSRelease(root)
+		if err != nil {
+			release = &OSRelease{ID: strings.ToLower(hostInfo.Platform), VersionID: hostInfo.PlatformVersion}
+		}
+		applyOSRelease(info, release)
+
+		// systemd-detect-virt inspects the running system, so it only applies to the real root
+		detectVirt := func(string) string { return "" }
+		if root == "/" {
+			detectVirt = systemdDetectVirt
 		}
+		info.Environment = detectEnvironment(root, detectVirt)
 	case "darwin":
 		info.Type = Darwin
 		info.Distro = MacOS
@@ -127,11 +130,21 @@ func Detect() (*Info, error) {
 		info.PackageManager = UnknownPM
 	}
 
-	info.PlatformID = hostInfo.Platform
-
 	return info, nil
 }
 
+// applyOSRelease sets the Linux distribution details of info from an os-release
+func applyOSRelease(info *Info, release *OSRelease) {
+	info.Distro, info.PackageManager = release.Classify()
+	if release.ID != "" {
+		info.PlatformID = release.ID
+	}
+	if release.VersionID != "" {
+		info.Version = release.VersionID
+	}
+	info.Codename = release.VersionCodename
+}
+
 // GetUserHomeDir returns the home directory path based on OS
 func GetUserHomeDir(username string, info *Info) string {
 	if info.Type == Darwin {
@@ -145,26 +158,6 @@ func GetSSHConfigPath(info *Info) string {
 	return "/etc/ssh/sshd_config" // Same for most systems
 }
 
-// GetPackageInstallCommand returns the command to install a package
-func GetPackageInstallCommand(packageName string, info *Info) string {
-	switch info.PackageManager {
-	case APT:
-		return fmt.Sprintf("apt-get install -y %s", packageName)
-	case DNF:
-		return fmt.Sprintf("dnf install -y %s", packageName)
-	case YUM:
-		return fmt.Sprintf("yum install -y %s", packageName)
-	case Zypper:
-		return fmt.Sprintf("zypper install -y %s", packageName)
-	case Pacman:
-		return fmt.Sprintf("pacman -S --noconfirm %s", packageName)
-	case Brew:
-		return fmt.Sprintf("brew install %s", packageName)
-	default:
-		return ""
-	}
-}
-
 // GetServiceRestartCommand returns the command to restart a service
 func GetServiceRestartCommand(serviceName string, info *Info) string {
 	if info.Type == Darwin {
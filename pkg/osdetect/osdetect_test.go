@@ -1,6 +1,9 @@
 package osdetect
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -47,68 +50,6 @@ func TestGetSSHConfigPath(t *testing.T) {
 	}
 }
 
-func TestGetPackageInstallCommand(t *testing.T) {
-	// Test package install commands for different package managers
-	tests := []struct {
-		name        string
-		packageName string
-		info        *Info
-		expectedCmd string
-	}{
-		{
-			name:        "APT",
-			packageName: "nginx",
-			info:        &Info{PackageManager: APT},
-			expectedCmd: "apt-get install -y nginx",
-		},
-		{
-			name:        "DNF",
-			packageName: "nginx",
-			info:        &Info{PackageManager: DNF},
-			expectedCmd: "dnf install -y nginx",
-		},
-		{
-			name:        "YUM",
-			packageName: "nginx",
-			info:        &Info{PackageManager: YUM},
-			expectedCmd: "yum install -y nginx",
-		},
-		{
-			name:        "Zypper",
-			packageName: "nginx",
-			info:        &Info{PackageManager: Zypper},
-			expectedCmd: "zypper install -y nginx",
-		},
-		{
-			name:        "Pacman",
-			packageName: "nginx",
-			info:        &Info{PackageManager: Pacman},
-			expectedCmd: "pacman -S --noconfirm nginx",
-		},
-		{
-			name:        "Brew",
-			packageName: "nginx",
-			info:        &Info{PackageManager: Brew},
-			expectedCmd: "brew install nginx",
-		},
-		{
-			name:        "Unknown",
-			packageName: "nginx",
-			info:        &Info{PackageManager: UnknownPM},
-			expectedCmd: "",
-		},
-	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			cmd := GetPackageInstallCommand(tc.packageName, tc.info)
-			if cmd != tc.expectedCmd {
-				t.Errorf("GetPackageInstallCommand returned %q, expected %q", cmd, tc.expectedCmd)
-			}
-		})
-	}
-}
-
 func TestGetServiceRestartCommand(t *testing.T) {
 	// Test service restart commands for different OS types
 	tests := []struct {
@@ -152,3 +93,184 @@ func TestGetServiceRestartCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestReadOSRelease(t *testing.T) {
+	tests := []struct {
+		root           string
+		distro         DistroType
+		packageManager PackageManager
+		id             string
+		version        string
+		codename       string
+	}{
+		{"debian-12", Debian, APT, "debian", "12", "bookworm"},
+		{"ubuntu-24.04", Debian, APT, "ubuntu", "24.04", "noble"},
+		{"raspbian-11", Debian, APT, "raspbian", "11", "bullseye"},
+		{"proxmox-8", Debian, APT, "debian", "12", "bookworm"},
+		{"rhel-9", RedHat, DNF, "rhel", "9.4", ""},
+		{"centos-7", RedHat, YUM, "centos", "7", ""},
+		{"rocky-9", RedHat, DNF, "rocky", "9.4", ""},
+		{"fedora-40", RedHat, DNF, "fedora", "40", ""},
+		{"openeuler-22.03", RedHat, DNF, "openeuler", "22.03", ""},
+		{"amzn-2", Amazon, YUM, "amzn", "2", ""},
+		{"amzn-2023", Amazon, DNF, "amzn", "2023", ""},
+		{"alpine-3.20", Alpine, APK, "alpine", "3.20.2", ""},
+		{"opensuse-leap-15.6", SUSE, Zypper, "opensuse-leap", "15.6", ""},
+		{"arch", Arch, Pacman, "arch", "", ""},
+		{"endeavouros", Arch, Pacman, "endeavouros", "", ""},
+		{"nobara-40", RedHat, DNF, "nobara", "40", ""},
+		{"nixos", Generic, UnknownPM, "nixos", "24.05", "uakari"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.root, func(t *testing.T) {
+			release, err := ReadOSRelease(filepath.Join("testdata", tt.root))
+			if err != nil {
+				t.Fatalf("ReadOSRelease() failed: %v", err)
+			}
+			if release.ID != tt.id || release.VersionID != tt.version || release.VersionCodename != tt.codename {
+				t.Errorf("Unexpected os-release %+v", release)
+			}
+
+			info := &Info{Type: Linux}
+			applyOSRelease(info, release)
+			if info.Distro != tt.distro {
+				t.Errorf("Expected distro %s, got %s", tt.distro, info.Distro)
+			}
+			if info.PackageManager != tt.packageManager {
+				t.Errorf("Expected package manager %s, got %s", tt.packageManager, info.PackageManager)
+			}
+			if info.PlatformID != tt.id || info.Version != tt.version || info.Codename != tt.codename {
+				t.Errorf("Unexpected info %+v", info)
+			}
+		})
+	}
+
+	if _, err := ReadOSRelease(filepath.Join("testdata", "missing")); err == nil {
+		t.Error("Expected error for missing os-release")
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	content := `# comment
+ID="my\"distro"
+ID_LIKE='Debian  Ubuntu'
+PRETTY_NAME="Costs \$0"
+INVALID
+`
+	release, err := ParseOSRelease(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ParseOSRelease() failed: %v", err)
+	}
+	if release.ID != `my"distro` {
+		t.Errorf("Unexpected ID %q", release.ID)
+	}
+	if len(release.IDLike) != 2 || release.IDLike[0] != "debian" || release.IDLike[1] != "ubuntu" {
+		t.Errorf("Unexpected ID_LIKE %v", release.IDLike)
+	}
+	if release.PrettyName != "Costs $0" {
+		t.Errorf("Unexpected PRETTY_NAME %q", release.PrettyName)
+	}
+}
+
+func TestDetectEnvironment(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		virt     map[string]string
+		expected Environment
+	}{
+		{name: "Bare metal", files: map[string]string{"sys/class/dmi/id/sys_vendor": "Dell Inc.\n"}},
+		{name: "Docker", files: map[string]string{".dockerenv": ""}, expected: Environment{Container: "docker"}},
+		{name: "Podman", files: map[string]string{"run/.containerenv": ""}, expected: Environment{Container: "podman"}},
+		{name: "systemd container", files: map[string]string{"run/systemd/container": "lxc\n"}, expected: Environment{Container: "lxc"}},
+		{name: "Init environment", files: map[string]string{"proc/1/environ": "PATH=/bin\x00container=lxc-libvirt\x00"}, expected: Environment{Container: "lxc-libvirt"}},
+		{name: "cgroup v1", files: map[string]string{"proc/1/cgroup": "12:pids:/kubepods/besteffort/pod1\n"}, expected: Environment{Container: "kubernetes"}},
+		{
+			name:     "Container on a cloud host",
+			files:    map[string]string{".dockerenv": "", "sys/class/dmi/id/sys_vendor": "Amazon EC2"},
+			expected: Environment{Container: "docker"},
+		},
+		{name: "WSL kernel", files: map[string]string{"proc/sys/kernel/osrelease": "5.15.153.1-microsoft-standard-WSL2\n"}, expected: Environment{WSL: true}},
+		{name: "WSL from systemd-detect-virt", virt: map[string]string{"--container": "wsl"}, expected: Environment{WSL: true}},
+		{
+			name:     "systemd-detect-virt",
+			virt:     map[string]string{"--vm": "kvm"},
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "Hetzner\n", "sys/class/dmi/id/product_name": "vServer\n"},
+			expected: Environment{Virtualization: "kvm", Cloud: Hetzner},
+		},
+		{
+			name:     "AWS Nitro",
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "Amazon EC2\n", "sys/class/dmi/id/board_asset_tag": "i-0123456789abcdef0\n"},
+			expected: Environment{Virtualization: "amazon", Cloud: AWS},
+		},
+		{
+			name:     "AWS Xen",
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "Xen\n", "sys/class/dmi/id/bios_version": "4.11.amazon\n"},
+			expected: Environment{Virtualization: "xen", Cloud: AWS},
+		},
+		{
+			name:     "GCP",
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "Google\n", "sys/class/dmi/id/product_name": "Google Compute Engine\n"},
+			expected: Environment{Virtualization: "google", Cloud: GCP},
+		},
+		{
+			name: "Azure",
+			files: map[string]string{
+				"sys/class/dmi/id/sys_vendor":        "Microsoft Corporation\n",
+				"sys/class/dmi/id/product_name":      "Virtual Machine\n",
+				"sys/class/dmi/id/chassis_asset_tag": "7783-7084-3265-9085-8269-3286-77\n",
+			},
+			expected: Environment{Virtualization: "microsoft", Cloud: Azure},
+		},
+		{
+			name:     "DigitalOcean",
+			files:    map[string]string{"sys/class/dmi/id/sys_vendor": "DigitalOcean\n", "sys/class/dmi/id/product_name": "Droplet\n", "sys/class/dmi/id/bios_vendor": "DigitalOcean\n"},
+			expected: Environment{Cloud: DigitalOcean},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := os.MkdirTemp("", "iniq-osdetect-test")
+			if err != nil {
+				t.Fatalf("Failed to create temp dir: %v", err)
+			}
+			defer os.RemoveAll(root)
+
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+
+			env := detectEnvironment(root, func(flag string) string { return tt.virt[flag] })
+			if env != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, env)
+			}
+		})
+	}
+}
+
+func TestEnvironmentString(t *testing.T) {
+	tests := []struct {
+		env      Environment
+		expected string
+	}{
+		{Environment{}, "bare metal"},
+		{Environment{Container: "docker"}, "docker container"},
+		{Environment{WSL: true}, "WSL"},
+		{Environment{Virtualization: "kvm", Cloud: Hetzner}, "kvm virtual machine on Hetzner Cloud"},
+		{Environment{Cloud: AWS}, "AWS"},
+	}
+
+	for _, tt := range tests {
+		if s := tt.env.String(); s != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, s)
+		}
+	}
+}
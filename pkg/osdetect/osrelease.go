@@ -0,0 +1,173 @@
+package osdetect
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// osReleasePaths are the os-release locations relative to the root, in order of precedence
+var osReleasePaths = []string{"etc/os-release", "usr/lib/os-release"}
+
+// OSRelease holds the os-release fields used to identify a Linux distribution
+type OSRelease struct {
+	// ID is the lowercase distribution identifier, such as debian or amzn
+	ID string
+	// IDLike lists the identifiers of related distributions, closest first
+	IDLike []string
+	// VersionID is the distribution version, such as 12 or 2023
+	VersionID string
+	// VersionCodename is the release codename, such as bookworm
+	VersionCodename string
+	// PrettyName is the human readable distribution name
+	PrettyName string
+}
+
+// ReadOSRelease reads os-release from the file system mounted at root, using
+// /usr/lib/os-release when /etc/os-release does not exist
+func ReadOSRelease(root string) (*OSRelease, error) {
+	for _, path := range osReleasePaths {
+		file, err := os.Open(filepath.Join(root, path))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read os-release: %w", err)
+		}
+		defer file.Close()
+		return ParseOSRelease(file)
+	}
+	return nil, fmt.Errorf("failed to read os-release: %w", fs.ErrNotExist)
+}
+
+// ParseOSRelease parses os-release content in the format of os-release(5)
+func ParseOSRelease(r io.Reader) (*OSRelease, error) {
+	release := &OSRelease{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		value = unquoteOSReleaseValue(value)
+
+		switch key {
+		case "ID":
+			release.ID = strings.ToLower(value)
+		case "ID_LIKE":
+			release.IDLike = strings.Fields(strings.ToLower(value))
+		case "VERSION_ID":
+			release.VersionID = value
+		case "VERSION_CODENAME":
+			release.VersionCodename = value
+		case "PRETTY_NAME":
+			release.PrettyName = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse os-release: %w", err)
+	}
+	return release, nil
+}
+
+// unquoteOSReleaseValue removes the shell quoting allowed around os-release values
+func unquoteOSReleaseValue(value string) string {
+	if len(value) < 2 || (value[0] != '"' && value[0] != '\'') || value[len(value)-1] != value[0] {
+		return value
+	}
+	quote := value[0]
+	value = value[1 : len(value)-1]
+	if quote == '"' {
+		// Double quoted values may escape quotes, backslashes, dollar signs and backticks
+		value = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\$`, `$`, "\\`", "`").Replace(value)
+	}
+	return value
+}
+
+// distroFamilies maps os-release identifiers to distribution families
+var distroFamilies = map[string]DistroType{
+	"debian":      Debian,
+	"ubuntu":      Debian,
+	"raspbian":    Debian,
+	"linuxmint":   Debian,
+	"pop":         Debian,
+	"elementary":  Debian,
+	"kali":        Debian,
+	"devuan":      Debian,
+	"rhel":        RedHat,
+	"centos":      RedHat,
+	"fedora":      RedHat,
+	"rocky":       RedHat,
+	"almalinux":   RedHat,
+	"ol":          RedHat,
+	"oracle":      RedHat,
+	"openeuler":   RedHat,
+	"amzn":        Amazon,
+	"alpine":      Alpine,
+	"suse":        SUSE,
+	"opensuse":    SUSE,
+	"sles":        SUSE,
+	"sled":        SUSE,
+	"arch":        Arch,
+	"manjaro":     Arch,
+	"endeavouros": Arch,
+}
+
+// Classify returns the distribution family and package manager of an os-release.
+// The ID is looked up first, then each ID_LIKE entry, so derivatives inherit their family.
+func (r *OSRelease) Classify() (DistroType, PackageManager) {
+	for _, id := range append([]string{r.ID}, r.IDLike...) {
+		// Identifiers such as opensuse-leap carry a variant suffix
+		family, ok := distroFamilies[id]
+		if !ok {
+			family, ok = distroFamilies[strings.SplitN(id, "-", 2)[0]]
+		}
+		if ok {
+			return family, r.packageManager(family, id)
+		}
+	}
+	return Generic, UnknownPM
+}
+
+// packageManager returns the package manager of a family, id is the identifier that matched it
+func (r *OSRelease) packageManager(family DistroType, id string) PackageManager {
+	switch family {
+	case Debian:
+		return APT
+	case SUSE:
+		return Zypper
+	case Arch:
+		return Pacman
+	case Alpine:
+		return APK
+	case Amazon:
+		// Amazon Linux 2 uses yum, Amazon Linux 2023 and later use dnf
+		if r.majorVersion() == 2 {
+			return YUM
+		}
+		return DNF
+	case RedHat:
+		if id == "fedora" || id == "openeuler" || r.majorVersion() >= 8 {
+			return DNF
+		}
+		return YUM
+	}
+	return UnknownPM
+}
+
+// majorVersion returns the major version number, or 0 if VERSION_ID is not numeric
+func (r *OSRelease) majorVersion() int {
+	major, _, _ := strings.Cut(r.VersionID, ".")
+	n, _ := strconv.Atoi(major)
+	return n
+}
@@ -0,0 +1,212 @@
+// Package pkgmanager installs and removes system packages with the distribution's package manager
+package pkgmanager
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// ErrUnsupported is returned for package managers that cannot be driven
+var ErrUnsupported = errors.New("unsupported package manager")
+
+// Manager installs, removes and queries packages
+type Manager interface {
+	// Kind returns the package manager type
+	Kind() osdetect.PackageManager
+	// Install installs packages, leaving installed ones as they are
+	Install(packages ...string) error
+	// Remove removes packages
+	Remove(packages ...string) error
+	// IsInstalled reports whether a package, or a package providing it, is installed
+	IsInstalled(pkg string) (bool, error)
+	// Update refreshes the package metadata from the repositories, unless Install already does
+	Update() error
+}
+
+// UpdateAndInstall refreshes the package metadata and installs packages. Fresh images often
+// ship without package lists, which makes installs fail. A failed refresh is passed to warn and
+// the install is attempted anyway, since the existing metadata may still be usable.
+func UpdateAndInstall(m Manager, warn func(error), packages ...string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	if err := m.Update(); err != nil {
+		warn(err)
+	}
+	return m.Install(packages...)
+}
+
+// UpgradesSystem reports whether installing packages with kind also upgrades every installed
+// package. pacman installs with -Syu, as Arch does not support partial upgrades.
+func UpgradesSystem(kind osdetect.PackageManager) bool {
+	return kind == osdetect.Pacman
+}
+
+// runner runs a command and returns its combined output
+type runner func(name string, args ...string) ([]byte, error)
+
+// runCommand runs a command on the host
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// New returns the manager for a package manager type
+func New(kind osdetect.PackageManager) (Manager, error) {
+	return newManager(kind, runCommand)
+}
+
+// newManager returns the manager for a package manager type that runs commands through run
+func newManager(kind osdetect.PackageManager, run runner) (Manager, error) {
+	switch kind {
+	case osdetect.APT:
+		return &apt{commandManager{
+			kind: kind,
+			// The environment keeps debconf from prompting on packages that ask questions
+			install: []string{"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "install", "-y"},
+			remove:  []string{"env", "DEBIAN_FRONTEND=noninteractive", "apt-get", "remove", "-y"},
+			update:  []string{"apt-get", "update"},
+			run:     run,
+		}}, nil
+	case osdetect.DNF, osdetect.YUM:
+		tool := string(kind)
+		return &commandManager{
+			kind:    kind,
+			install: []string{tool, "install", "-y"},
+			remove:  []string{tool, "remove", "-y"},
+			update:  []string{tool, "makecache"},
+			query:   []string{"rpm", "-q", "--whatprovides"},
+			run:     run,
+		}, nil
+	case osdetect.Zypper:
+		return &commandManager{
+			kind:    kind,
+			install: []string{"zypper", "--non-interactive", "install"},
+			remove:  []string{"zypper", "--non-interactive", "remove"},
+			update:  []string{"zypper", "--non-interactive", "refresh"},
+			query:   []string{"rpm", "-q", "--whatprovides"},
+			run:     run,
+		}, nil
+	case osdetect.Pacman:
+		// Arch does not support partial upgrades, so refreshing the package databases
+		// without upgrading can leave new packages linked against libraries the system
+		// lacks. Installs refresh and upgrade in one transaction, and Update does nothing.
+		return &commandManager{
+			kind:    kind,
+			install: []string{"pacman", "-Syu", "--noconfirm", "--needed"},
+			remove:  []string{"pacman", "-R", "--noconfirm"},
+			query:   []string{"pacman", "-Q"},
+			run:     run,
+		}, nil
+	case osdetect.APK:
+		return &commandManager{
+			kind:    kind,
+			install: []string{"apk", "add"},
+			remove:  []string{"apk", "del"},
+			update:  []string{"apk", "update"},
+			query:   []string{"apk", "info", "-e"},
+			run:     run,
+		}, nil
+	case osdetect.Brew:
+		return &commandManager{
+			kind:    kind,
+			install: []string{"brew", "install"},
+			remove:  []string{"brew", "uninstall"},
+			update:  []string{"brew", "update"},
+			query:   []string{"brew", "list", "--versions"},
+			run:     run,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, kind)
+}
+
+// commandManager drives a package manager whose operations each map to one command
+type commandManager struct {
+	kind    osdetect.PackageManager
+	install []string
+	remove  []string
+	// update is empty when install refreshes the package metadata itself
+	update []string
+	// query exits successfully when the package given as last argument is installed
+	query []string
+	run   runner
+}
+
+// Kind returns the package manager type
+func (m *commandManager) Kind() osdetect.PackageManager {
+	return m.kind
+}
+
+// Install installs packages
+func (m *commandManager) Install(packages ...string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	return run(m.run, slices.Concat(m.install, packages)...)
+}
+
+// Remove removes packages
+func (m *commandManager) Remove(packages ...string) error {
+	if len(packages) == 0 {
+		return nil
+	}
+	return run(m.run, slices.Concat(m.remove, packages)...)
+}
+
+// IsInstalled reports whether a package is installed
+func (m *commandManager) IsInstalled(pkg string) (bool, error) {
+	_, err := m.run(m.query[0], slices.Concat(m.query[1:], []string{pkg})...)
+	return queryResult(err)
+}
+
+// Update refreshes the package metadata
+func (m *commandManager) Update() error {
+	if len(m.update) == 0 {
+		return nil
+	}
+	return run(m.run, m.update...)
+}
+
+// apt drives apt-get, and queries the dpkg database
+type apt struct {
+	commandManager
+}
+
+// IsInstalled reports whether a package is installed. dpkg-query also knows removed
+// packages whose configuration files are left, so the package status is checked.
+func (a *apt) IsInstalled(pkg string) (bool, error) {
+	output, err := a.run("dpkg-query", "-W", "-f=${Status}", pkg)
+	if installed, err := queryResult(err); !installed {
+		return false, err
+	}
+	return strings.TrimSpace(string(output)) == "install ok installed", nil
+}
+
+// queryResult interprets the error of a query command. The command failing means the package
+// is not installed, while not being able to run it at all is an error.
+func queryResult(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to query packages: %w", err)
+}
+
+// run runs a command and includes the last line of its output, which holds the reason, in the error
+func run(r runner, command ...string) error {
+	output, err := r(command[0], command[1:]...)
+	if err == nil {
+		return nil
+	}
+	if lines := strings.Split(strings.TrimSpace(string(output)), "\n"); lines[len(lines)-1] != "" {
+		return fmt.Errorf("%s: %s: %w", strings.Join(command, " "), strings.TrimSpace(lines[len(lines)-1]), err)
+	}
+	return fmt.Errorf("%s: %w", strings.Join(command, " "), err)
+}
@@ -0,0 +1,222 @@
+package pkgmanager
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teomyth/iniq/pkg/osdetect"
+)
+
+// fakeRunner records commands and answers those listed in outputs. Commands listed in
+// failures exit with an error and the given output.
+type fakeRunner struct {
+	commands []string
+	outputs  map[string]string
+	failures map[string]string
+	err      error
+}
+
+func (f *fakeRunner) run(name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	f.commands = append(f.commands, command)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if output, ok := f.failures[command]; ok {
+		return []byte(output), &exec.ExitError{}
+	}
+	return []byte(f.outputs[command]), nil
+}
+
+func TestManagerCommands(t *testing.T) {
+	tests := []struct {
+		kind    osdetect.PackageManager
+		install string
+		remove  string
+		update  string
+		query   string
+	}{
+		{osdetect.APT, "env DEBIAN_FRONTEND=noninteractive apt-get install -y curl vim", "env DEBIAN_FRONTEND=noninteractive apt-get remove -y curl vim", "apt-get update", "dpkg-query -W -f=${Status} curl"},
+		{osdetect.DNF, "dnf install -y curl vim", "dnf remove -y curl vim", "dnf makecache", "rpm -q --whatprovides curl"},
+		{osdetect.YUM, "yum install -y curl vim", "yum remove -y curl vim", "yum makecache", "rpm -q --whatprovides curl"},
+		{osdetect.Zypper, "zypper --non-interactive install curl vim", "zypper --non-interactive remove curl vim", "zypper --non-interactive refresh", "rpm -q --whatprovides curl"},
+		{osdetect.Pacman, "pacman -Syu --noconfirm --needed curl vim", "pacman -R --noconfirm curl vim", "", "pacman -Q curl"},
+		{osdetect.APK, "apk add curl vim", "apk del curl vim", "apk update", "apk info -e curl"},
+		{osdetect.Brew, "brew install curl vim", "brew uninstall curl vim", "brew update", "brew list --versions curl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			runner := &fakeRunner{}
+			m, err := newManager(tt.kind, runner.run)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if m.Kind() != tt.kind {
+				t.Errorf("Expected kind %s, got %s", tt.kind, m.Kind())
+			}
+
+			if err := m.Install("curl", "vim"); err != nil {
+				t.Errorf("Install failed: %v", err)
+			}
+			if err := m.Remove("curl", "vim"); err != nil {
+				t.Errorf("Remove failed: %v", err)
+			}
+			if err := m.Update(); err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+			_, _ = m.IsInstalled("curl")
+
+			expected := []string{tt.install, tt.remove, tt.update, tt.query}
+			if tt.update == "" {
+				// Install refreshes the metadata, so Update runs nothing
+				expected = []string{tt.install, tt.remove, tt.query}
+			}
+			if !reflect.DeepEqual(runner.commands, expected) {
+				t.Errorf("Expected commands %v, got %v", expected, runner.commands)
+			}
+		})
+	}
+}
+
+func TestNewUnsupported(t *testing.T) {
+	for _, kind := range []osdetect.PackageManager{osdetect.UnknownPM, ""} {
+		if _, err := New(kind); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Expected ErrUnsupported for %q, got %v", kind, err)
+		}
+	}
+}
+
+func TestInstallNothing(t *testing.T) {
+	runner := &fakeRunner{}
+	m, _ := newManager(osdetect.DNF, runner.run)
+	if err := m.Install(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := m.Remove(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("Expected no commands, got %v", runner.commands)
+	}
+}
+
+func TestInstallError(t *testing.T) {
+	runner := &fakeRunner{failures: map[string]string{
+		"dnf install -y nosuchpkg": "Last metadata expiration check: 0:01:02 ago.\nNo match for argument: nosuchpkg\nError: Unable to find a match: nosuchpkg\n",
+	}}
+	m, _ := newManager(osdetect.DNF, runner.run)
+
+	err := m.Install("nosuchpkg")
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Error: Unable to find a match: nosuchpkg") {
+		t.Errorf("Expected the error to include the last output line, got %v", err)
+	}
+}
+
+func TestUpdateAndInstall(t *testing.T) {
+	runner := &fakeRunner{failures: map[string]string{"apk update": "ERROR: unable to fetch index\n"}}
+	m, _ := newManager(osdetect.APK, runner.run)
+
+	var warnings []error
+	warn := func(err error) { warnings = append(warnings, err) }
+	if err := UpdateAndInstall(m, warn); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("Expected no commands without packages, got %v", runner.commands)
+	}
+
+	// A failed refresh is reported and the install still runs
+	if err := UpdateAndInstall(m, warn, "curl"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if expected := []string{"apk update", "apk add curl"}; !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected %v, got %v", expected, runner.commands)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "unable to fetch index") {
+		t.Errorf("Expected the refresh failure to be reported, got %v", warnings)
+	}
+}
+
+func TestUpgradesSystem(t *testing.T) {
+	for _, kind := range []osdetect.PackageManager{osdetect.APT, osdetect.DNF, osdetect.YUM, osdetect.Zypper, osdetect.APK, osdetect.Brew} {
+		if UpgradesSystem(kind) {
+			t.Errorf("Expected %s installs not to upgrade the system", kind)
+		}
+	}
+	if !UpgradesSystem(osdetect.Pacman) {
+		t.Errorf("Expected pacman installs to upgrade the system")
+	}
+}
+
+func TestIsInstalled(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      osdetect.PackageManager
+		runner    *fakeRunner
+		expected  bool
+		expectErr bool
+	}{
+		{
+			name:     "rpm installed",
+			kind:     osdetect.DNF,
+			runner:   &fakeRunner{},
+			expected: true,
+		},
+		{
+			name:     "rpm not installed",
+			kind:     osdetect.DNF,
+			runner:   &fakeRunner{failures: map[string]string{"rpm -q --whatprovides htop": "no package provides htop\n"}},
+			expected: false,
+		},
+		{
+			name:     "dpkg installed",
+			kind:     osdetect.APT,
+			runner:   &fakeRunner{outputs: map[string]string{"dpkg-query -W -f=${Status} htop": "install ok installed"}},
+			expected: true,
+		},
+		{
+			name:     "dpkg configuration files left",
+			kind:     osdetect.APT,
+			runner:   &fakeRunner{outputs: map[string]string{"dpkg-query -W -f=${Status} htop": "deinstall ok config-files"}},
+			expected: false,
+		},
+		{
+			name:     "dpkg unknown package",
+			kind:     osdetect.APT,
+			runner:   &fakeRunner{failures: map[string]string{"dpkg-query -W -f=${Status} htop": "dpkg-query: no packages found matching htop\n"}},
+			expected: false,
+		},
+		{
+			name:      "query tool missing",
+			kind:      osdetect.APK,
+			runner:    &fakeRunner{err: exec.ErrNotFound},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newManager(tt.kind, tt.runner.run)
+			installed, err := m.IsInstalled("htop")
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if installed != tt.expected {
+				t.Errorf("Expected installed %v, got %v", tt.expected, installed)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package safefile provides atomic, symlink-safe file writes for files managed as root
+package safefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+var (
+	// ErrSymlink is returned when a target file or its directory is a symbolic link
+	ErrSymlink = errors.New("refusing to follow symbolic link")
+
+	// ErrHardLink is returned when a target file has more than one hard link
+	ErrHardLink = errors.New("refusing to write file with multiple hard links")
+)
+
+// WriteFile atomically replaces the file at path with data.
+// The data is written to a temporary file in the same directory, synced, and renamed
+// over the target, so readers never see a partial file. Like os.WriteFile, existing
+// files keep their mode (and owner) and new files are created with perm. Symbolic
+// links and hard-linked files are refused, because a user who owns the directory
+// could point them at system files.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	uid, gid := -1, -1
+	info, err := checkTarget(path)
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		perm = info.Mode().Perm()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	}
+
+	return writeAtomic(path, data, perm, uid, gid)
+}
+
+// ReadFile reads a file without following a symbolic link in the final path component
+func ReadFile(path string) ([]byte, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return nil, fmt.Errorf("%s: %w", path, ErrSymlink)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// CopyFile copies src to dst atomically, preserving the mode and owner of src.
+// It is intended for backups, which must not be more readable than the original.
+func CopyFile(src, dst string) error {
+	file, err := os.OpenFile(src, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return fmt.Errorf("%s: %w", src, ErrSymlink)
+		}
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := checkTarget(dst); err != nil {
+		return err
+	}
+
+	uid, gid := -1, -1
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid = int(stat.Uid), int(stat.Gid)
+	}
+	return writeAtomic(dst, data, info.Mode().Perm(), uid, gid)
+}
+
+// checkTarget rejects symlinked directories, symlinks and hard links at path.
+// It returns the file info of an existing regular file, or nil if path does not exist.
+func checkTarget(path string) (os.FileInfo, error) {
+	dir := filepath.Dir(path)
+	dirInfo, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if dirInfo.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s: %w", dir, ErrSymlink)
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrSymlink)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+		return nil, fmt.Errorf("%s: %w", path, ErrHardLink)
+	}
+
+	return info, nil
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it into place
+func writeAtomic(path string, data []byte, perm os.FileMode, uid, gid int) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".iniq-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	// Remove the temporary file on any failure
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if uid >= 0 && os.Geteuid() == 0 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			return fmt.Errorf("failed to set ownership of %s: %w", path, err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	committed = true
+
+	// Sync the directory so the rename survives a crash
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
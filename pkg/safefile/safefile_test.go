@@ -0,0 +1,139 @@
+package safefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "safefile-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "config")
+
+	// New files are created with the given mode
+	if err := WriteFile(path, []byte("one\n"), 0640); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	assertFile(t, path, "one\n", 0640)
+
+	// Existing files keep their mode
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	if err := WriteFile(path, []byte("two\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	assertFile(t, path, "two\n", 0600)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 file in directory, got %d", len(entries))
+	}
+}
+
+func TestWriteFileRefusesLinks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "safefile-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A file outside the directory the attacker controls
+	victim := filepath.Join(tempDir, "victim")
+	if err := os.WriteFile(victim, []byte("original\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	userDir := filepath.Join(tempDir, "home")
+	if err := os.Mkdir(userDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	symlink := filepath.Join(userDir, "symlink")
+	if err := os.Symlink(victim, symlink); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	hardlink := filepath.Join(userDir, "hardlink")
+	if err := os.Link(victim, hardlink); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+	linkedDir := filepath.Join(tempDir, "linked")
+	if err := os.Symlink(userDir, linkedDir); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected error
+	}{
+		{"Symbolic link", symlink, ErrSymlink},
+		{"Hard link", hardlink, ErrHardLink},
+		{"Symlinked directory", filepath.Join(linkedDir, "file"), ErrSymlink},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := WriteFile(tc.path, []byte("attack\n"), 0644)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+
+	assertFile(t, victim, "original\n", 0644)
+
+	if _, err := ReadFile(symlink); !errors.Is(err, ErrSymlink) {
+		t.Errorf("Expected ReadFile to refuse symlink, got %v", err)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "safefile-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	src := filepath.Join(tempDir, "sudoers")
+	if err := os.WriteFile(src, []byte("root ALL=(ALL) ALL\n"), 0440); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	dst := src + ".bak"
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	assertFile(t, dst, "root ALL=(ALL) ALL\n", 0440)
+}
+
+// assertFile checks the content and mode of a file
+func assertFile(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if string(data) != content {
+		t.Errorf("Expected content %q, got %q", content, data)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	if info.Mode().Perm() != mode {
+		t.Errorf("Expected mode %o, got %o", mode, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,238 @@
+package safefile
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrOwner is returned when a directory in a user's home is owned by someone else
+var ErrOwner = errors.New("unexpected owner")
+
+// UserDir is a directory inside a user's home directory, such as ~/.ssh.
+// It is opened component by component without following symbolic links, and all
+// operations are relative to the open directory, so the user cannot redirect
+// writes made as root by swapping a path component for a symlink mid-operation.
+type UserDir struct {
+	dir  *os.File
+	path string
+	uid  int
+	gid  int
+}
+
+// OpenUserDir opens the directory name inside home, creating it with perm if it does
+// not exist. root is prepended to home and is "/" outside of tests. The home directory
+// must be owned by uid or root, and the directory itself by uid.
+func OpenUserDir(root, home, name string, uid, gid int, perm os.FileMode) (*UserDir, error) {
+	// The parents of the home directory belong to root and can be resolved normally
+	parentPath := filepath.Join(root, filepath.Dir(home))
+	parent, err := os.Open(parentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", parentPath, err)
+	}
+	defer parent.Close()
+
+	homeDir, err := openDirAt(parent, filepath.Base(home), home)
+	if err != nil {
+		return nil, err
+	}
+	defer homeDir.Close()
+	if err := checkOwner(homeDir, home, uid, 0); err != nil {
+		return nil, err
+	}
+
+	// Create the directory, owned by the user from the start
+	path := filepath.Join(home, name)
+	created := false
+	if err := unix.Mkdirat(int(homeDir.Fd()), name, uint32(perm.Perm())); err == nil {
+		created = true
+	} else if !errors.Is(err, unix.EEXIST) {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	dir, err := openDirAt(homeDir, name, path)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		if err := chown(dir, uid, gid); err != nil {
+			dir.Close()
+			return nil, fmt.Errorf("failed to set ownership of %s: %w", path, err)
+		}
+		if err := dir.Chmod(perm.Perm()); err != nil {
+			dir.Close()
+			return nil, fmt.Errorf("failed to set permissions on %s: %w", path, err)
+		}
+	}
+	if err := checkOwner(dir, path, uid, uid); err != nil {
+		dir.Close()
+		return nil, err
+	}
+
+	return &UserDir{dir: dir, path: path, uid: uid, gid: gid}, nil
+}
+
+// Path returns the path of the directory, without the root prefix
+func (d *UserDir) Path() string {
+	return d.path
+}
+
+// Close closes the directory
+func (d *UserDir) Close() error {
+	return d.dir.Close()
+}
+
+// Exists reports whether name exists in the directory, without following symlinks
+func (d *UserDir) Exists(name string) bool {
+	var stat unix.Stat_t
+	return unix.Fstatat(int(d.dir.Fd()), name, &stat, unix.AT_SYMLINK_NOFOLLOW) == nil
+}
+
+// ReadFile reads a regular file from the directory. Symbolic links and hard-linked
+// files are refused, since they could expose files the user cannot read.
+func (d *UserDir) ReadFile(name string) ([]byte, error) {
+	fd, err := unix.Openat(int(d.dir.Fd()), name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, d.openError(name, err)
+	}
+	file := os.NewFile(uintptr(fd), filepath.Join(d.path, name))
+	defer file.Close()
+
+	if err := checkRegular(file); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(file)
+}
+
+// WriteFile atomically replaces name in the directory with data. The file is
+// written to a temporary file, owned by the user, set to perm, synced and renamed.
+func (d *UserDir) WriteFile(name string, data []byte, perm os.FileMode) error {
+	path := filepath.Join(d.path, name)
+
+	// Refuse to replace links, the rename would not follow them but their presence
+	// means something other than INIQ has been managing the file
+	var stat unix.Stat_t
+	if err := unix.Fstatat(int(d.dir.Fd()), name, &stat, unix.AT_SYMLINK_NOFOLLOW); err == nil {
+		switch {
+		case stat.Mode&unix.S_IFMT == unix.S_IFLNK:
+			return fmt.Errorf("%s: %w", path, ErrSymlink)
+		case stat.Mode&unix.S_IFMT != unix.S_IFREG:
+			return fmt.Errorf("%s is not a regular file", path)
+		case stat.Nlink > 1:
+			return fmt.Errorf("%s: %w", path, ErrHardLink)
+		}
+	} else if !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := "." + name + ".iniq-" + hex.EncodeToString(suffix)
+
+	fd, err := unix.Openat(int(d.dir.Fd()), tmpName, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_CLOEXEC, uint32(perm.Perm()))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	tmp := os.NewFile(uintptr(fd), filepath.Join(d.path, tmpName))
+
+	// Remove the temporary file on any failure
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			_ = unix.Unlinkat(int(d.dir.Fd()), tmpName, 0)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := chown(tmp, d.uid, d.gid); err != nil {
+		return fmt.Errorf("failed to set ownership of %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm.Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	if err := unix.Renameat(int(d.dir.Fd()), tmpName, int(d.dir.Fd()), name); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	committed = true
+
+	// Sync the directory so the rename survives a crash
+	_ = d.dir.Sync()
+	return nil
+}
+
+// openError converts an openat error, reporting symlinks as ErrSymlink
+func (d *UserDir) openError(name string, err error) error {
+	path := filepath.Join(d.path, name)
+	if errors.Is(err, unix.ELOOP) {
+		return fmt.Errorf("%s: %w", path, ErrSymlink)
+	}
+	return &os.PathError{Op: "open", Path: path, Err: err}
+}
+
+// openDirAt opens a directory relative to parent without following a symlink
+func openDirAt(parent *os.File, name, path string) (*os.File, error) {
+	fd, err := unix.Openat(int(parent.Fd()), name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		// ENOTDIR is also returned for a symlink when O_DIRECTORY is set
+		if errors.Is(err, unix.ELOOP) || errors.Is(err, unix.ENOTDIR) {
+			return nil, fmt.Errorf("%s is not a directory: %w", path, ErrSymlink)
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// checkOwner checks that an open file is owned by one of the given users
+func checkOwner(file *os.File, path string, uids ...int) error {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	for _, uid := range uids {
+		if int(stat.Uid) == uid {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is owned by uid %d: %w", path, stat.Uid, ErrOwner)
+}
+
+// checkRegular checks that an open file is a regular file with a single link
+func checkRegular(file *os.File) error {
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(file.Fd()), &stat); err != nil {
+		return fmt.Errorf("failed to stat %s: %w", file.Name(), err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFREG {
+		return fmt.Errorf("%s is not a regular file", file.Name())
+	}
+	if stat.Nlink > 1 {
+		return fmt.Errorf("%s: %w", file.Name(), ErrHardLink)
+	}
+	return nil
+}
+
+// chown changes the owner of an open file when running as root
+func chown(file *os.File, uid, gid int) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return file.Chown(uid, gid)
+}
@@ -0,0 +1,122 @@
+package safefile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestUserDir(t *testing.T) {
+	root, err := os.MkdirTemp("", "safefile-userdir-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "home", "alice"), 0755); err != nil {
+		t.Fatalf("Failed to create home dir: %v", err)
+	}
+
+	uid, gid := os.Getuid(), os.Getgid()
+	dir, err := OpenUserDir(root, "/home/alice", ".ssh", uid, gid, 0700)
+	if err != nil {
+		t.Fatalf("OpenUserDir failed: %v", err)
+	}
+	defer dir.Close()
+
+	if dir.Path() != "/home/alice/.ssh" {
+		t.Errorf("Expected path /home/alice/.ssh, got %s", dir.Path())
+	}
+
+	if err := dir.WriteFile("authorized_keys", []byte("key\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	assertFile(t, filepath.Join(root, "home", "alice", ".ssh", "authorized_keys"), "key\n", 0600)
+
+	data, err := dir.ReadFile("authorized_keys")
+	if err != nil || string(data) != "key\n" {
+		t.Errorf("Expected to read back key, got %q, %v", data, err)
+	}
+	if !dir.Exists("authorized_keys") || dir.Exists("missing") {
+		t.Error("Exists returned unexpected result")
+	}
+	if _, err := dir.ReadFile("missing"); !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+
+	// Hard links to files outside the directory are refused
+	victim := filepath.Join(root, "victim")
+	if err := os.WriteFile(victim, []byte("original\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Link(victim, filepath.Join(root, "home", "alice", ".ssh", "linked")); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+	if err := dir.WriteFile("linked", []byte("attack\n"), 0600); !errors.Is(err, ErrHardLink) {
+		t.Errorf("Expected hard link error on write, got %v", err)
+	}
+	if _, err := dir.ReadFile("linked"); !errors.Is(err, ErrHardLink) {
+		t.Errorf("Expected hard link error on read, got %v", err)
+	}
+	assertFile(t, victim, "original\n", 0644)
+}
+
+func TestOpenUserDirOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root")
+	}
+
+	root, err := os.MkdirTemp("", "safefile-userdir-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	sshDir := filepath.Join(root, "home", "alice", ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	// A .ssh directory owned by another user is refused
+	if err := os.Chown(filepath.Join(root, "home", "alice"), 1001, 1001); err != nil {
+		t.Fatalf("Failed to chown: %v", err)
+	}
+	if err := os.Chown(sshDir, 1002, 1002); err != nil {
+		t.Fatalf("Failed to chown: %v", err)
+	}
+	if _, err := OpenUserDir(root, "/home/alice", ".ssh", 1001, 1001, 0700); !errors.Is(err, ErrOwner) {
+		t.Errorf("Expected owner error, got %v", err)
+	}
+
+	// New directories and files are owned by the user
+	os.Remove(sshDir)
+	dir, err := OpenUserDir(root, "/home/alice", ".ssh", 1001, 1001, 0700)
+	if err != nil {
+		t.Fatalf("OpenUserDir failed: %v", err)
+	}
+	defer dir.Close()
+	if err := dir.WriteFile("authorized_keys", []byte("key\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	for _, path := range []string{sshDir, filepath.Join(sshDir, "authorized_keys")} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", path, err)
+		}
+		if owner, ok := fileOwner(info); !ok || owner != 1001 {
+			t.Errorf("Expected %s to be owned by 1001, got %d", path, owner)
+		}
+	}
+}
+
+// fileOwner returns the owner uid of a file
+func fileOwner(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Uid), true
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// systemdUnitDirs are the directories systemd loads units from, relative to the root
+var systemdUnitDirs = []string{"etc/systemd/system", "run/systemd/system", "usr/lib/systemd/system", "lib/systemd/system"}
+
+// systemd manages services through systemctl
+type systemd struct {
+	root string
+	run  runner
+}
+
+// Kind returns the init system type
+func (s *systemd) Kind() Kind {
+	return Systemd
+}
+
+// Resolve returns the unit name of a service, without the .service suffix
+func (s *systemd) Resolve(service string) (string, error) {
+	return resolve(service, func(name string) bool {
+		return s.hasUnit(name + ".service")
+	})
+}
+
+// hasUnit reports whether a unit file exists
+func (s *systemd) hasUnit(unit string) bool {
+	for _, dir := range systemdUnitDirs {
+		if exists(s.root, filepath.Join(dir, unit)) {
+			return true
+		}
+	}
+	return false
+}
+
+// socketActivated reports whether a service is started on demand by an active socket unit,
+// as ssh.socket is on Ubuntu 24.04 and later
+func (s *systemd) socketActivated(name string) bool {
+	if !s.hasUnit(name + ".socket") {
+		return false
+	}
+	_, err := s.run("systemctl", "is-active", "--quiet", name+".socket")
+	return err == nil
+}
+
+// Restart stops and starts a service. For socket-activated services the socket is
+// restarted as well, after regenerating units that derive from the service configuration.
+func (s *systemd) Restart(name string) error {
+	if s.socketActivated(name) {
+		if err := run(s.run, "systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		if err := run(s.run, "systemctl", "restart", name+".socket"); err != nil {
+			return err
+		}
+	}
+	return run(s.run, "systemctl", "restart", name+".service")
+}
+
+// Reload asks a running service to reload its configuration. A socket-activated service
+// that is not running reads its configuration on the next connection, so the socket is
+// restarted instead in case the listen address changed.
+func (s *systemd) Reload(name string) error {
+	if s.socketActivated(name) {
+		if err := run(s.run, "systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		if err := run(s.run, "systemctl", "restart", name+".socket"); err != nil {
+			return err
+		}
+		if active, _ := s.IsActive(name); !active {
+			return nil
+		}
+	}
+	return run(s.run, "systemctl", "reload", name+".service")
+}
+
+// IsActive reports whether a service is running
+func (s *systemd) IsActive(name string) (bool, error) {
+	output, err := s.run("systemctl", "is-active", name+".service")
+	state := strings.TrimSpace(string(output))
+	if err != nil && state == "" {
+		return false, fmt.Errorf("failed to check service %s: %w", name, err)
+	}
+	return state == "active" || state == "reloading", nil
+}
+
+// Enable starts a service at boot
+func (s *systemd) Enable(name string) error {
+	return run(s.run, "systemctl", "enable", name+".service")
+}
+
+// openRC manages services through rc-service and rc-update
+type openRC struct {
+	root string
+	run  runner
+}
+
+// Kind returns the init system type
+func (o *openRC) Kind() Kind {
+	return OpenRC
+}
+
+// Resolve returns the init script name of a service
+func (o *openRC) Resolve(service string) (string, error) {
+	return resolve(service, func(name string) bool {
+		return exists(o.root, filepath.Join("etc/init.d", name))
+	})
+}
+
+// Restart stops and starts a service
+func (o *openRC) Restart(name string) error {
+	return run(o.run, "rc-service", name, "restart")
+}
+
+// Reload asks a running service to reload its configuration
+func (o *openRC) Reload(name string) error {
+	return run(o.run, "rc-service", name, "reload")
+}
+
+// IsActive reports whether a service is running
+func (o *openRC) IsActive(name string) (bool, error) {
+	_, err := o.run("rc-service", name, "status")
+	return err == nil, nil
+}
+
+// Enable starts a service at boot
+func (o *openRC) Enable(name string) error {
+	return run(o.run, "rc-update", "add", name, "default")
+}
+
+// runitServiceDirs are the directories runsvdir supervises, relative to the root
+var runitServiceDirs = []string{"var/service", "etc/service", "service"}
+
+// runit manages services through sv
+type runit struct {
+	root string
+	run  runner
+}
+
+// Kind returns the init system type
+func (r *runit) Kind() Kind {
+	return Runit
+}
+
+// Resolve returns the service directory name of a service
+func (r *runit) Resolve(service string) (string, error) {
+	return resolve(service, func(name string) bool {
+		return exists(r.root, filepath.Join("etc/sv", name))
+	})
+}
+
+// Restart stops and starts a service
+func (r *runit) Restart(name string) error {
+	return run(r.run, "sv", "restart", name)
+}
+
+// Reload sends the service a HUP signal
+func (r *runit) Reload(name string) error {
+	return run(r.run, "sv", "reload", name)
+}
+
+// IsActive reports whether a service is running
+func (r *runit) IsActive(name string) (bool, error) {
+	output, err := r.run("sv", "status", name)
+	if err != nil {
+		return false, nil
+	}
+	return strings.HasPrefix(string(output), "run:"), nil
+}
+
+// Enable links the service into the supervised directory, which also starts it
+func (r *runit) Enable(name string) error {
+	for _, dir := range runitServiceDirs {
+		if !isDir(r.root, dir) {
+			continue
+		}
+		link := filepath.Join(r.root, dir, name)
+		if _, err := os.Lstat(link); err == nil {
+			return nil
+		}
+		if err := os.Symlink(filepath.Join("/etc/sv", name), link); err != nil {
+			return fmt.Errorf("failed to enable service %s: %w", name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to enable service %s: no runit service directory found", name)
+}
+
+// sysVinit manages services through the scripts in /etc/init.d
+type sysVinit struct {
+	root string
+	run  runner
+}
+
+// Kind returns the init system type
+func (v *sysVinit) Kind() Kind {
+	return SysVinit
+}
+
+// Resolve returns the init script name of a service
+func (v *sysVinit) Resolve(service string) (string, error) {
+	return resolve(service, func(name string) bool {
+		return exists(v.root, filepath.Join("etc/init.d", name))
+	})
+}
+
+// script returns the path of the init script of a service
+func (v *sysVinit) script(name string) string {
+	return filepath.Join("/etc/init.d", name)
+}
+
+// Restart stops and starts a service
+func (v *sysVinit) Restart(name string) error {
+	return run(v.run, v.script(name), "restart")
+}
+
+// Reload asks a running service to reload its configuration
+func (v *sysVinit) Reload(name string) error {
+	return run(v.run, v.script(name), "reload")
+}
+
+// IsActive reports whether a service is running
+func (v *sysVinit) IsActive(name string) (bool, error) {
+	_, err := v.run(v.script(name), "status")
+	return err == nil, nil
+}
+
+// Enable starts a service at boot, with update-rc.d on Debian and chkconfig on Red Hat systems
+func (v *sysVinit) Enable(name string) error {
+	if exists(v.root, "usr/sbin/update-rc.d") {
+		return run(v.run, "update-rc.d", name, "defaults")
+	}
+	return run(v.run, "chkconfig", name, "on")
+}
@@ -0,0 +1,153 @@
+// Package service controls system services through the init system in use
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Kind is the type of init system
+type Kind string
+
+const (
+	// Systemd manages services with systemctl
+	Systemd Kind = "systemd"
+	// OpenRC manages services with rc-service and rc-update (Alpine, Gentoo)
+	OpenRC Kind = "openrc"
+	// Runit manages services with sv (Void Linux)
+	Runit Kind = "runit"
+	// SysVinit manages services with init scripts in /etc/init.d
+	SysVinit Kind = "sysvinit"
+)
+
+// ErrNoServiceManager is returned when no supported init system is found
+var ErrNoServiceManager = errors.New("no supported service manager found")
+
+// Manager controls system services
+type Manager interface {
+	// Kind returns the init system type
+	Kind() Kind
+	// Resolve returns the name a service is installed under, such as sshd for ssh on Red Hat systems
+	Resolve(service string) (string, error)
+	// Restart stops and starts a service
+	Restart(name string) error
+	// Reload asks a running service to reload its configuration
+	Reload(name string) error
+	// IsActive reports whether a service is running
+	IsActive(name string) (bool, error)
+	// Enable starts a service at boot
+	Enable(name string) error
+}
+
+// serviceAliases lists the names a service is known by across distributions, most common first
+var serviceAliases = map[string][]string{
+	"ssh":  {"ssh", "sshd", "openssh"},
+	"sshd": {"sshd", "ssh", "openssh"},
+	// chrony is chronyd everywhere but Debian
+	"chrony": {"chronyd", "chrony"},
+}
+
+// runner runs a command and returns its combined output
+type runner func(name string, args ...string) ([]byte, error)
+
+// runCommand runs a command on the host
+func runCommand(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// Detect returns the service manager of the running system
+func Detect() (Manager, error) {
+	kind, err := DetectKind("/")
+	if err != nil {
+		return nil, err
+	}
+	return New(kind, "/"), nil
+}
+
+// DetectKind returns the init system of the file system mounted at root
+func DetectKind(root string) (Kind, error) {
+	switch {
+	case isDir(root, "run/systemd/system"):
+		// Present only when systemd is running as init, see sd_booted(3)
+		return Systemd, nil
+	case isDir(root, "run/openrc"):
+		return OpenRC, nil
+	case isDir(root, "run/runit"), isDir(root, "etc/runit/runsvdir"):
+		return Runit, nil
+	case isDir(root, "etc/init.d"):
+		return SysVinit, nil
+	}
+	return "", ErrNoServiceManager
+}
+
+// New returns the manager for an init system. Root is where service definitions are looked up.
+func New(kind Kind, root string) Manager {
+	return newManager(kind, root, runCommand)
+}
+
+// newManager returns the manager for an init system that runs commands through run
+func newManager(kind Kind, root string, run runner) Manager {
+	switch kind {
+	case Systemd:
+		return &systemd{root: root, run: run}
+	case OpenRC:
+		return &openRC{root: root, run: run}
+	case Runit:
+		return &runit{root: root, run: run}
+	default:
+		return &sysVinit{root: root, run: run}
+	}
+}
+
+// ReloadOrRestart reloads a service, and restarts it if the reload fails
+func ReloadOrRestart(m Manager, name string) error {
+	reloadErr := m.Reload(name)
+	if reloadErr == nil {
+		return nil
+	}
+	if err := m.Restart(name); err != nil {
+		return fmt.Errorf("%w (reload failed: %v)", err, reloadErr)
+	}
+	return nil
+}
+
+// resolve returns the first alias of a service for which exists reports true
+func resolve(service string, exists func(name string) bool) (string, error) {
+	candidates, ok := serviceAliases[service]
+	if !ok {
+		candidates = []string{service}
+	}
+	for _, name := range candidates {
+		if exists(name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("service %s not found", service)
+}
+
+// run runs a command and includes its output in the error
+func run(r runner, name string, args ...string) error {
+	if output, err := r(name, args...); err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%s %s: %s: %w", name, strings.Join(args, " "), message, err)
+		}
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// isDir reports whether path under root is a directory
+func isDir(root, path string) bool {
+	info, err := os.Stat(filepath.Join(root, path))
+	return err == nil && info.IsDir()
+}
+
+// exists reports whether path under root exists, following symbolic links
+func exists(root, path string) bool {
+	_, err := os.Stat(filepath.Join(root, path))
+	return err == nil
+}
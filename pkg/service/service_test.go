@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner records commands and fails those listed in failures with the given output
+type fakeRunner struct {
+	commands []string
+	failures map[string]string
+}
+
+func (f *fakeRunner) run(name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	f.commands = append(f.commands, command)
+	if output, ok := f.failures[command]; ok {
+		return []byte(output), errors.New("exit status 3")
+	}
+	return []byte("active\n"), nil
+}
+
+// makeRoot creates a temporary root with the given files and directories (ending in /)
+func makeRoot(t *testing.T, paths ...string) string {
+	t.Helper()
+	root, err := os.MkdirTemp("", "iniq-service-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	for _, path := range paths {
+		full := filepath.Join(root, path)
+		if strings.HasSuffix(path, "/") {
+			if err := os.MkdirAll(full, 0755); err != nil {
+				t.Fatalf("Failed to create %s: %v", path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+		if err := os.WriteFile(full, nil, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+	return root
+}
+
+func TestDetectKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		expected Kind
+	}{
+		{"systemd", []string{"run/systemd/system/", "etc/init.d/"}, Systemd},
+		{"OpenRC", []string{"run/openrc/", "etc/init.d/"}, OpenRC},
+		{"runit", []string{"run/runit/"}, Runit},
+		{"runit without run", []string{"etc/runit/runsvdir/"}, Runit},
+		{"sysvinit", []string{"etc/init.d/"}, SysVinit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, err := DetectKind(makeRoot(t, tt.paths...))
+			if err != nil {
+				t.Fatalf("DetectKind() failed: %v", err)
+			}
+			if kind != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, kind)
+			}
+		})
+	}
+
+	if _, err := DetectKind(makeRoot(t)); !errors.Is(err, ErrNoServiceManager) {
+		t.Errorf("Expected ErrNoServiceManager, got %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     Kind
+		paths    []string
+		service  string
+		expected string
+	}{
+		{"Debian systemd", Systemd, []string{"lib/systemd/system/ssh.service", "etc/systemd/system/sshd.service"}, "ssh", "ssh"},
+		{"Red Hat systemd", Systemd, []string{"usr/lib/systemd/system/sshd.service"}, "ssh", "sshd"},
+		{"Red Hat systemd by sshd", Systemd, []string{"usr/lib/systemd/system/sshd.service"}, "sshd", "sshd"},
+		{"Alpine OpenRC", OpenRC, []string{"etc/init.d/sshd"}, "ssh", "sshd"},
+		{"Void runit", Runit, []string{"etc/sv/sshd/run"}, "ssh", "sshd"},
+		{"Debian sysvinit", SysVinit, []string{"etc/init.d/ssh"}, "sshd", "ssh"},
+		{"Unaliased service", Systemd, []string{"lib/systemd/system/chronyd.service"}, "chronyd", "chronyd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newManager(tt.kind, makeRoot(t, tt.paths...), (&fakeRunner{}).run)
+			name, err := m.Resolve(tt.service)
+			if err != nil {
+				t.Fatalf("Resolve() failed: %v", err)
+			}
+			if name != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, name)
+			}
+		})
+	}
+
+	m := newManager(Systemd, makeRoot(t), (&fakeRunner{}).run)
+	if _, err := m.Resolve("ssh"); err == nil {
+		t.Error("Expected error for missing service")
+	}
+}
+
+func TestManagerCommands(t *testing.T) {
+	tests := []struct {
+		kind     Kind
+		paths    []string
+		action   func(m Manager) error
+		expected []string
+	}{
+		{Systemd, nil, func(m Manager) error { return m.Reload("sshd") }, []string{"systemctl reload sshd.service"}},
+		{Systemd, nil, func(m Manager) error { return m.Restart("sshd") }, []string{"systemctl restart sshd.service"}},
+		{Systemd, nil, func(m Manager) error { return m.Enable("sshd") }, []string{"systemctl enable sshd.service"}},
+		{OpenRC, nil, func(m Manager) error { return m.Reload("sshd") }, []string{"rc-service sshd reload"}},
+		{OpenRC, nil, func(m Manager) error { return m.Enable("sshd") }, []string{"rc-update add sshd default"}},
+		{Runit, nil, func(m Manager) error { return m.Reload("sshd") }, []string{"sv reload sshd"}},
+		{Runit, nil, func(m Manager) error { return m.Restart("sshd") }, []string{"sv restart sshd"}},
+		{SysVinit, nil, func(m Manager) error { return m.Reload("ssh") }, []string{"/etc/init.d/ssh reload"}},
+		{SysVinit, []string{"usr/sbin/update-rc.d"}, func(m Manager) error { return m.Enable("ssh") }, []string{"update-rc.d ssh defaults"}},
+		{SysVinit, nil, func(m Manager) error { return m.Enable("sshd") }, []string{"chkconfig sshd on"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind)+" "+strings.Join(tt.expected, ","), func(t *testing.T) {
+			runner := &fakeRunner{}
+			m := newManager(tt.kind, makeRoot(t, tt.paths...), runner.run)
+			if err := tt.action(m); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(runner.commands, tt.expected) {
+				t.Errorf("Expected commands %v, got %v", tt.expected, runner.commands)
+			}
+		})
+	}
+}
+
+func TestSystemdSocketActivation(t *testing.T) {
+	root := makeRoot(t, "usr/lib/systemd/system/ssh.service", "usr/lib/systemd/system/ssh.socket")
+
+	// The socket is listening and no connection has started the service yet
+	runner := &fakeRunner{failures: map[string]string{"systemctl is-active ssh.service": "inactive\n"}}
+	m := newManager(Systemd, root, runner.run)
+	if err := m.Reload("ssh"); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	expected := []string{
+		"systemctl is-active --quiet ssh.socket",
+		"systemctl daemon-reload",
+		"systemctl restart ssh.socket",
+		"systemctl is-active ssh.service",
+	}
+	if !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, runner.commands)
+	}
+
+	// A running service is reloaded after the socket
+	runner = &fakeRunner{}
+	m = newManager(Systemd, root, runner.run)
+	if err := m.Reload("ssh"); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if last := runner.commands[len(runner.commands)-1]; last != "systemctl reload ssh.service" {
+		t.Errorf("Expected the service to be reloaded, got %v", runner.commands)
+	}
+
+	// A disabled socket is ignored
+	runner = &fakeRunner{failures: map[string]string{"systemctl is-active --quiet ssh.socket": ""}}
+	m = newManager(Systemd, root, runner.run)
+	if err := m.Reload("ssh"); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	expected = []string{"systemctl is-active --quiet ssh.socket", "systemctl reload ssh.service"}
+	if !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, runner.commands)
+	}
+}
+
+func TestReloadOrRestart(t *testing.T) {
+	runner := &fakeRunner{failures: map[string]string{"rc-service sshd reload": "reload not supported"}}
+	m := newManager(OpenRC, makeRoot(t), runner.run)
+	if err := ReloadOrRestart(m, "sshd"); err != nil {
+		t.Fatalf("ReloadOrRestart() failed: %v", err)
+	}
+	expected := []string{"rc-service sshd reload", "rc-service sshd restart"}
+	if !reflect.DeepEqual(runner.commands, expected) {
+		t.Errorf("Expected commands %v, got %v", expected, runner.commands)
+	}
+
+	runner.failures["rc-service sshd restart"] = "failed to start"
+	if err := ReloadOrRestart(m, "sshd"); err == nil || !strings.Contains(err.Error(), "failed to start") {
+		t.Errorf("Expected restart error, got %v", err)
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	runner := &fakeRunner{failures: map[string]string{"systemctl is-active sshd.service": "failed\n"}}
+	m := newManager(Systemd, makeRoot(t), runner.run)
+	if active, err := m.IsActive("sshd"); err != nil || active {
+		t.Errorf("Expected inactive service, got %v (%v)", active, err)
+	}
+
+	runner = &fakeRunner{}
+	m = newManager(Systemd, makeRoot(t), runner.run)
+	if active, err := m.IsActive("sshd"); err != nil || !active {
+		t.Errorf("Expected active service, got %v (%v)", active, err)
+	}
+}
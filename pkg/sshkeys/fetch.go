@@ -0,0 +1,467 @@
+package sshkeys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/teomyth/iniq/pkg/safefile"
+)
+
+// DefaultCacheDir is the default directory for cached key lists
+const DefaultCacheDir = "/var/cache/iniq/keys"
+
+// Endpoints used by the remote key sources, overridable in tests
+var (
+	githubURL    = "https://github.com"
+	githubAPIURL = "https://api.github.com"
+	gitlabURL    = "https://gitlab.com"
+)
+
+// Fetcher fetches SSH keys from remote sources.
+// Each request is retried with exponential backoff and jitter, and responses can be
+// cached on disk so that runs on flaky or air-gapped networks stay deterministic.
+type Fetcher struct {
+	// Client is the HTTP client used for requests
+	Client *http.Client
+
+	// URLClient is the HTTP client used for url: sources, defaulting to Client.
+	// It allows relaxed TLS settings for internal hosts without affecting GitHub or GitLab.
+	URLClient *http.Client
+
+	// CacheDir is the directory for cached responses; caching is disabled when empty
+	CacheDir string
+
+	// CacheReadOnly uses existing cache entries without storing new ones (e.g. for dry runs)
+	CacheReadOnly bool
+
+	// MaxAttempts is the number of attempts per request
+	MaxAttempts int
+
+	// BaseDelay is the backoff delay after the first failed attempt, doubled after each failure
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff delay
+	MaxDelay time.Duration
+
+	// AllowedSigners, when set, requires url: sources to carry a detached signature
+	// (<url>.sig) made by one of these signers
+	AllowedSigners []*AllowedSigner
+
+	// SignatureNamespace is the namespace signatures must be made in, defaulting to "file"
+	SignatureNamespace string
+
+	// Warn reports non-fatal problems such as falling back to a cached copy
+	Warn func(format string, args ...any)
+
+	// sleep waits between attempts, replaceable in tests
+	sleep func(time.Duration)
+}
+
+// NewFetcher creates a fetcher with default settings and caching disabled
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		MaxAttempts: 3,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    10 * time.Second,
+		Warn: func(format string, args ...any) {
+			fmt.Printf("Warning: "+format+"\n", args...)
+		},
+		sleep: time.Sleep,
+	}
+}
+
+// defaultFetcher is used by the package-level fetch functions
+var defaultFetcher = NewFetcher()
+
+// FetchFromGitHub fetches SSH keys from GitHub
+func FetchFromGitHub(username string) ([]*Key, error) {
+	return defaultFetcher.FetchFromGitHub(username)
+}
+
+// FetchFromGitHubTeam fetches the SSH keys of every member of a GitHub organization team
+func FetchFromGitHubTeam(org, team, token string) ([]*Key, error) {
+	return defaultFetcher.FetchFromGitHubTeam(org, team, token)
+}
+
+// FetchFromGitLab fetches SSH keys from GitLab
+func FetchFromGitLab(username string) ([]*Key, error) {
+	return defaultFetcher.FetchFromGitLab(username)
+}
+
+// FetchFromURL fetches SSH keys from a URL
+func FetchFromURL(url string) ([]*Key, error) {
+	return defaultFetcher.FetchFromURL(url)
+}
+
+// FetchFromGitHub fetches SSH keys from GitHub
+func (f *Fetcher) FetchFromGitHub(username string) ([]*Key, error) {
+	url := fmt.Sprintf("%s/%s.keys", githubURL, username)
+	keys, err := f.fetchFromURL(url, GitHub, username)
+
+	// Add GitHub username as comment if key doesn't have one
+	for _, key := range keys {
+		if key.Comment == "" {
+			// Extract key parts
+			parts := strings.Fields(key.Content)
+			if len(parts) >= 2 {
+				// Add GitHub username as comment in a more concise format
+				comment := fmt.Sprintf("gh:%s", username)
+				key.Comment = comment
+				// Update content with comment
+				key.Content = fmt.Sprintf("%s %s %s", parts[0], parts[1], comment)
+			}
+		}
+	}
+
+	return keys, err
+}
+
+// FetchFromGitHubTeam fetches the SSH keys of every member of a GitHub organization team.
+// Team membership is listed through the GitHub REST API, which requires a token with
+// read:org scope. Each key is commented with the login of the member it belongs to.
+func (f *Fetcher) FetchFromGitHubTeam(org, team, token string) ([]*Key, error) {
+	if token == "" {
+		return nil, fmt.Errorf("a GitHub token is required to list members of team %s/%s", org, team)
+	}
+
+	members, err := f.listGitHubTeamMembers(org, team, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("team %s/%s has no members", org, team)
+	}
+
+	teamValue := fmt.Sprintf("%s/%s", org, team)
+	var keys []*Key
+	for _, login := range members {
+		url := fmt.Sprintf("%s/%s.keys", githubURL, login)
+		memberKeys, err := f.fetchFromURL(url, GitHubTeam, teamValue)
+		if errors.Is(err, ErrNoKeys) {
+			// Members without keys simply contribute nothing
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch keys for team member %s: %w", login, err)
+		}
+
+		// Comment each key with the member login so it can be traced back
+		for _, key := range memberKeys {
+			parts := strings.Fields(key.Content)
+			if len(parts) >= 2 {
+				key.Comment = fmt.Sprintf("gh:%s", login)
+				key.Content = fmt.Sprintf("%s %s %s", parts[0], parts[1], key.Comment)
+			}
+		}
+		keys = append(keys, memberKeys...)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no members of team %s/%s have SSH keys: %w", org, team, ErrNoKeys)
+	}
+
+	return keys, nil
+}
+
+// listGitHubTeamMembers returns the logins of all members of a GitHub team
+func (f *Fetcher) listGitHubTeamMembers(org, team, token string) ([]string, error) {
+	headers := map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"Authorization":        "Bearer " + token,
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+
+	const perPage = 100
+	var logins []string
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/orgs/%s/teams/%s/members?per_page=%d&page=%d", githubAPIURL, org, team, perPage, page)
+		body, err := f.get(f.Client, url, headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members of team %s/%s: %w", org, team, err)
+		}
+
+		var members []struct {
+			Login string `json:"login"`
+		}
+		if err := json.Unmarshal(body, &members); err != nil {
+			return nil, fmt.Errorf("failed to decode members of team %s/%s: %w", org, team, err)
+		}
+
+		for _, member := range members {
+			if member.Login != "" {
+				logins = append(logins, member.Login)
+			}
+		}
+
+		if len(members) < perPage {
+			return logins, nil
+		}
+	}
+}
+
+// FetchFromGitLab fetches SSH keys from GitLab
+func (f *Fetcher) FetchFromGitLab(username string) ([]*Key, error) {
+	url := fmt.Sprintf("%s/%s.keys", gitlabURL, username)
+	keys, err := f.fetchFromURL(url, GitLab, username)
+
+	// Add GitLab username as comment if key doesn't have one
+	for _, key := range keys {
+		if key.Comment == "" {
+			// Extract key parts
+			parts := strings.Fields(key.Content)
+			if len(parts) >= 2 {
+				// Add GitLab username as comment in a more concise format
+				comment := fmt.Sprintf("gl:%s", username)
+				key.Comment = comment
+				// Update content with comment
+				key.Content = fmt.Sprintf("%s %s %s", parts[0], parts[1], comment)
+			}
+		}
+	}
+
+	return keys, err
+}
+
+// FetchFromURL fetches SSH keys from a URL
+func (f *Fetcher) FetchFromURL(url string) ([]*Key, error) {
+	client := f.URLClient
+	if client == nil {
+		client = f.Client
+	}
+
+	body, err := f.get(client, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the bundle signature before looking at any key
+	if len(f.AllowedSigners) > 0 {
+		if err := f.verifyBundle(client, url, body); err != nil {
+			return nil, fmt.Errorf("refusing to install keys from %s: %w", url, err)
+		}
+	}
+
+	return parseKeysFromReader(bytes.NewReader(body), URL, url)
+}
+
+// verifyBundle fetches the detached signature of a key list and verifies it
+func (f *Fetcher) verifyBundle(client *http.Client, url string, body []byte) error {
+	signature, err := f.get(client, url+".sig", nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+
+	namespace := f.SignatureNamespace
+	if namespace == "" {
+		namespace = DefaultSignatureNamespace
+	}
+
+	_, err = VerifyBundle(body, signature, f.AllowedSigners, namespace)
+	return err
+}
+
+// fetchFromURL is a helper function to fetch keys from a URL
+func (f *Fetcher) fetchFromURL(url string, source Source, sourceValue string) ([]*Key, error) {
+	body, err := f.get(f.Client, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse response body
+	return parseKeysFromReader(bytes.NewReader(body), source, sourceValue)
+}
+
+// cacheMeta holds the validators of a cached response
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// statusError reports an unexpected HTTP status code
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("failed to fetch keys from %s: status code %d", e.url, e.code)
+}
+
+// retryable reports whether a status code indicates a transient failure
+func (e *statusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+// get fetches a URL with retries, revalidating and falling back to the cache when enabled
+func (f *Fetcher) get(client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	cached, meta := f.readCache(url)
+
+	var lastErr error
+	attempts := max(f.MaxAttempts, 1)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			f.wait(attempt - 1)
+		}
+
+		body, notModified, newMeta, err := request(client, url, headers, meta, cached != nil)
+		if err == nil {
+			if notModified {
+				return cached, nil
+			}
+			f.writeCache(url, body, newMeta)
+			return body, nil
+		}
+
+		lastErr = err
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			// The provider answered definitively (e.g. 404), so neither retry nor use stale data
+			return nil, err
+		}
+	}
+
+	// The provider is unreachable, fall back to the last known good copy
+	if cached != nil {
+		f.Warn("Using cached keys for %s from %s: %v", url, meta.FetchedAt.Format(time.RFC3339), lastErr)
+		return cached, nil
+	}
+
+	return nil, lastErr
+}
+
+// request performs a single conditional GET request
+func request(client *http.Client, url string, headers map[string]string, meta *cacheMeta, haveCache bool) ([]byte, bool, *cacheMeta, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if haveCache && meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to fetch keys from %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && haveCache {
+		return nil, true, nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, nil, &statusError{url: url, code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to read response from %s: %w", url, err)
+	}
+
+	newMeta := &cacheMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+
+	return body, false, newMeta, nil
+}
+
+// wait sleeps for the backoff delay after the given number of failed attempts.
+// The delay doubles after each failure and is jittered to avoid synchronized retries.
+func (f *Fetcher) wait(failures int) {
+	delay := f.BaseDelay << (failures - 1)
+	if f.MaxDelay > 0 && (delay > f.MaxDelay || delay <= 0) {
+		delay = f.MaxDelay
+	}
+	if delay <= 0 {
+		return
+	}
+
+	// Wait between half and the full delay
+	jittered := delay/2 + time.Duration(rand.Int64N(int64(delay/2)+1))
+
+	sleep := f.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	sleep(jittered)
+}
+
+// cachePaths returns the paths of the cached body and metadata for a URL
+func (f *Fetcher) cachePaths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(f.CacheDir, name), filepath.Join(f.CacheDir, name+".json")
+}
+
+// readCache returns the cached body and metadata for a URL, or nil if there is none
+func (f *Fetcher) readCache(url string) ([]byte, *cacheMeta) {
+	if f.CacheDir == "" {
+		return nil, nil
+	}
+
+	bodyPath, metaPath := f.cachePaths(url)
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil
+	}
+
+	meta := &cacheMeta{}
+	if data, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(data, meta) // Missing validators only disable revalidation
+	}
+
+	return body, meta
+}
+
+// writeCache stores a response in the cache
+func (f *Fetcher) writeCache(url string, body []byte, meta *cacheMeta) {
+	if f.CacheDir == "" || f.CacheReadOnly {
+		return
+	}
+
+	if err := os.MkdirAll(f.CacheDir, 0700); err != nil {
+		f.Warn("Failed to create key cache directory %s: %v", f.CacheDir, err)
+		return
+	}
+
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	bodyPath, metaPath := f.cachePaths(url)
+	if err := safefile.WriteFile(bodyPath, body, 0600); err != nil {
+		f.Warn("Failed to cache keys from %s: %v", url, err)
+		return
+	}
+	if err := safefile.WriteFile(metaPath, metaData, 0600); err != nil {
+		f.Warn("Failed to cache keys from %s: %v", url, err)
+	}
+}
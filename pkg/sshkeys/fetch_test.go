@@ -0,0 +1,179 @@
+package sshkeys
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestFetcher creates a fetcher that caches in dir and does not sleep between attempts
+func newTestFetcher(dir string) (*Fetcher, *[]string) {
+	var warnings []string
+	fetcher := NewFetcher()
+	fetcher.CacheDir = dir
+	fetcher.sleep = func(time.Duration) {}
+	fetcher.Warn = func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	return fetcher, &warnings
+}
+
+func TestFetcherRetryAndCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sshkeys-cache-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch {
+		case n == 1:
+			// The first attempt hits a transient failure
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprintln(w, testED25519Key)
+		}
+	}))
+
+	fetcher, warnings := newTestFetcher(tempDir)
+	url := server.URL + "/alice.keys"
+
+	// A 503 is retried and the successful response is cached
+	keys, err := fetcher.FetchFromURL(url)
+	if err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d", len(keys))
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests.Load())
+	}
+
+	bodyPath, _ := fetcher.cachePaths(url)
+	info, err := os.Stat(bodyPath)
+	if err != nil {
+		t.Fatalf("Expected cache entry: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected cache entry mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// A revalidated cache entry is served on 304
+	keys, err = fetcher.FetchFromURL(url)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected 1 key after revalidation, got %d (%v)", len(keys), err)
+	}
+
+	// When the provider is unreachable the cached copy is used with a warning
+	server.Close()
+	keys, err = fetcher.FetchFromURL(url)
+	if err != nil {
+		t.Fatalf("Expected cached keys, got error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Type != "ssh-ed25519" {
+		t.Errorf("Unexpected cached keys: %v", keys)
+	}
+	if len(*warnings) != 1 {
+		t.Errorf("Expected 1 warning, got %d: %v", len(*warnings), *warnings)
+	}
+
+	// Without a cache entry the error is reported
+	if _, err := fetcher.FetchFromURL(server.URL + "/bob.keys"); err == nil {
+		t.Error("Expected error for unreachable provider without cache, got none")
+	}
+}
+
+func TestFetcherNotFound(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sshkeys-cache-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var requests atomic.Int32
+	var found atomic.Bool
+	found.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !found.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, testED25519Key)
+	}))
+	defer server.Close()
+
+	fetcher, _ := newTestFetcher(tempDir)
+	url := server.URL + "/alice.keys"
+	if _, err := fetcher.FetchFromURL(url); err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+
+	// A removed account is not retried and never falls back to stale keys
+	found.Store(false)
+	requests.Store(0)
+	if _, err := fetcher.FetchFromURL(url); err == nil {
+		t.Error("Expected error for 404 response, got none")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected 1 request, got %d", requests.Load())
+	}
+}
+
+func TestFetcherReadOnlyCache(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sshkeys-cache-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, testED25519Key)
+	}))
+	defer server.Close()
+
+	fetcher, _ := newTestFetcher(tempDir)
+	fetcher.CacheReadOnly = true
+	url := server.URL + "/alice.keys"
+	if _, err := fetcher.FetchFromURL(url); err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+
+	bodyPath, _ := fetcher.cachePaths(url)
+	if _, err := os.Stat(bodyPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no cache entry in read-only mode, got %v", err)
+	}
+}
+
+func TestFetcherBackoff(t *testing.T) {
+	fetcher := NewFetcher()
+	fetcher.BaseDelay = 1 * time.Second
+	fetcher.MaxDelay = 3 * time.Second
+
+	var delays []time.Duration
+	fetcher.sleep = func(d time.Duration) {
+		delays = append(delays, d)
+	}
+
+	for failures := 1; failures <= 3; failures++ {
+		fetcher.wait(failures)
+	}
+
+	// Delays double up to the maximum and are jittered into [delay/2, delay]
+	limits := []time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second}
+	for i, d := range delays {
+		if d < limits[i]/2 || d > limits[i] {
+			t.Errorf("Delay %d: expected between %v and %v, got %v", i+1, limits[i]/2, limits[i], d)
+		}
+	}
+}
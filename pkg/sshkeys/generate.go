@@ -0,0 +1,84 @@
+package sshkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Key types supported by GenerateKey
+const (
+	KeyTypeED25519 = "ed25519"
+	KeyTypeRSA     = "rsa"
+)
+
+// RSAKeyBits is the size of generated RSA keys
+const RSAKeyBits = 4096
+
+// GeneratedKey is a newly generated SSH key pair
+type GeneratedKey struct {
+	// PrivateKey is the private key in OpenSSH PEM format
+	PrivateKey []byte
+
+	// PublicKey is the public key
+	PublicKey ssh.PublicKey
+
+	// AuthorizedKey is the public key in authorized_keys format, including the comment
+	AuthorizedKey []byte
+}
+
+// GenerateKey generates a new SSH key pair of the given type (ed25519 or rsa)
+func GenerateKey(keyType, comment string) (*GeneratedKey, error) {
+	return GenerateKeyWithPassphrase(keyType, comment, nil)
+}
+
+// GenerateKeyWithPassphrase generates a new SSH key pair and encrypts the private key
+// with the passphrase. An empty passphrase leaves the private key unencrypted.
+func GenerateKeyWithPassphrase(keyType, comment string, passphrase []byte) (*GeneratedKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch keyType {
+	case KeyTypeED25519:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case KeyTypeRSA:
+		signer, err = rsa.GenerateKey(rand.Reader, RSAKeyBits)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", keyType, err)
+	}
+
+	var block *pem.Block
+	if len(passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(signer, comment, passphrase)
+	} else {
+		block, err = ssh.MarshalPrivateKey(signer, comment)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s private key: %w", keyType, err)
+	}
+
+	publicKey, err := ssh.NewPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s public key: %w", keyType, err)
+	}
+
+	// MarshalAuthorizedKey ends with a newline, insert the comment before it
+	authorizedKey := ssh.MarshalAuthorizedKey(publicKey)
+	if comment != "" {
+		authorizedKey = append(authorizedKey[:len(authorizedKey)-1], []byte(" "+comment+"\n")...)
+	}
+
+	return &GeneratedKey{
+		PrivateKey:    pem.EncodeToMemory(block),
+		PublicKey:     publicKey,
+		AuthorizedKey: authorizedKey,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package sshkeys
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey(KeyTypeED25519, "root@test")
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	// The private key must parse and match the public key
+	signer, err := ssh.ParsePrivateKey(key.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to parse generated private key: %v", err)
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), key.PublicKey.Marshal()) {
+		t.Error("Private key does not match public key")
+	}
+
+	if !strings.HasPrefix(string(key.AuthorizedKey), "ssh-ed25519 ") || !strings.HasSuffix(string(key.AuthorizedKey), " root@test\n") {
+		t.Errorf("Unexpected authorized key: %q", key.AuthorizedKey)
+	}
+
+	if _, err := GenerateKey("dsa", ""); err == nil {
+		t.Error("Expected error for unsupported key type, got none")
+	}
+}
+
+func TestGenerateKeyWithPassphrase(t *testing.T) {
+	key, err := GenerateKeyWithPassphrase(KeyTypeED25519, "deploy@test", []byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	// The private key must not be readable without the passphrase
+	if _, err := ssh.ParsePrivateKey(key.PrivateKey); err == nil {
+		t.Error("Expected encrypted private key to require a passphrase")
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(key.PrivateKey, []byte("secret"))
+	if err != nil {
+		t.Fatalf("Failed to decrypt generated private key: %v", err)
+	}
+	if !bytes.Equal(signer.PublicKey().Marshal(), key.PublicKey.Marshal()) {
+		t.Error("Private key does not match public key")
+	}
+}
@@ -3,13 +3,14 @@ package sshkeys
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
-	"time"
 
+	"github.com/teomyth/iniq/pkg/safefile"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -19,6 +20,8 @@ type Source string
 const (
 	// GitHub represents GitHub as a key source
 	GitHub Source = "github"
+	// GitHubTeam represents the members of a GitHub organization team as a key source
+	GitHubTeam Source = "github-team"
 	// GitLab represents GitLab as a key source
 	GitLab Source = "gitlab"
 	// URL represents a direct URL as a key source
@@ -29,6 +32,9 @@ const (
 	Text Source = "text"
 )
 
+// ErrNoKeys is returned when a source does not contain any valid SSH keys
+var ErrNoKeys = errors.New("no valid SSH keys found")
+
 // Key represents an SSH public key with metadata
 type Key struct {
 	// Content is the full content of the key
@@ -74,80 +80,6 @@ func ParseKeyString(keyString string, source Source, sourceValue string) (*Key,
 	}, nil
 }
 
-// FetchFromGitHub fetches SSH keys from GitHub
-func FetchFromGitHub(username string) ([]*Key, error) {
-	url := fmt.Sprintf("https://github.com/%s.keys", username)
-	keys, err := fetchFromURL(url, GitHub, username)
-
-	// Add GitHub username as comment if key doesn't have one
-	for _, key := range keys {
-		if key.Comment == "" {
-			// Extract key parts
-			parts := strings.Fields(key.Content)
-			if len(parts) >= 2 {
-				// Add GitHub username as comment in a more concise format
-				comment := fmt.Sprintf("gh:%s", username)
-				key.Comment = comment
-				// Update content with comment
-				key.Content = fmt.Sprintf("%s %s %s", parts[0], parts[1], comment)
-			}
-		}
-	}
-
-	return keys, err
-}
-
-// FetchFromGitLab fetches SSH keys from GitLab
-func FetchFromGitLab(username string) ([]*Key, error) {
-	url := fmt.Sprintf("https://gitlab.com/%s.keys", username)
-	keys, err := fetchFromURL(url, GitLab, username)
-
-	// Add GitLab username as comment if key doesn't have one
-	for _, key := range keys {
-		if key.Comment == "" {
-			// Extract key parts
-			parts := strings.Fields(key.Content)
-			if len(parts) >= 2 {
-				// Add GitLab username as comment in a more concise format
-				comment := fmt.Sprintf("gl:%s", username)
-				key.Comment = comment
-				// Update content with comment
-				key.Content = fmt.Sprintf("%s %s %s", parts[0], parts[1], comment)
-			}
-		}
-	}
-
-	return keys, err
-}
-
-// FetchFromURL fetches SSH keys from a URL
-func FetchFromURL(url string) ([]*Key, error) {
-	return fetchFromURL(url, URL, url)
-}
-
-// fetchFromURL is a helper function to fetch keys from a URL
-func fetchFromURL(url string, source Source, sourceValue string) ([]*Key, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// Make request
-	resp, err := client.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch keys from %s: %w", url, err)
-	}
-	defer resp.Body.Close()
-
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch keys from %s: status code %d", url, resp.StatusCode)
-	}
-
-	// Read response body
-	return parseKeysFromReader(resp.Body, source, sourceValue)
-}
-
 // ReadFromFile reads SSH keys from a file
 func ReadFromFile(filePath string) ([]*Key, error) {
 	// Open file
@@ -195,12 +127,57 @@ func parseKeysFromReader(reader io.Reader, source Source, sourceValue string) ([
 	}
 
 	if len(keys) == 0 {
-		return nil, fmt.Errorf("no valid SSH keys found")
+		return nil, ErrNoKeys
 	}
 
 	return keys, nil
 }
 
+// SplitPins splits fingerprint pins off a key source, e.g. "gh:alice#SHA256:abc" returns
+// "gh:alice" and ["SHA256:abc"]. Several pins can be given as repeated "#SHA256:" suffixes
+// or as a comma-separated list.
+func SplitPins(keySource string) (string, []string) {
+	parts := strings.Split(keySource, "#SHA256:")
+	var pins []string
+	for _, part := range parts[1:] {
+		for _, pin := range strings.Split(part, ",") {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "SHA256:")
+			if pin != "" {
+				pins = append(pins, "SHA256:"+pin)
+			}
+		}
+	}
+	return parts[0], pins
+}
+
+// FilterPinned separates keys whose fingerprint matches one of the pins from unexpected keys.
+// It also returns the pins that none of the keys matched.
+func FilterPinned(keys []*Key, pins []string) (pinned []*Key, unexpected []*Key, missing []string) {
+	wanted := make(map[string]bool)
+	for _, pin := range pins {
+		wanted[pin] = true
+	}
+
+	found := make(map[string]bool)
+	for _, key := range keys {
+		if wanted[key.Fingerprint] {
+			pinned = append(pinned, key)
+			found[key.Fingerprint] = true
+		} else {
+			unexpected = append(unexpected, key)
+		}
+	}
+
+	for _, pin := range pins {
+		if !found[pin] {
+			missing = append(missing, pin)
+			found[pin] = true // Report each missing pin once
+		}
+	}
+
+	return pinned, unexpected, missing
+}
+
 // extractKeyTypeAndValue extracts just the type and value parts of an SSH key, ignoring comments
 func extractKeyTypeAndValue(keyContent string) string {
 	parts := strings.Fields(keyContent)
@@ -216,108 +193,115 @@ func extractKeyTypeAndValue(keyContent string) string {
 // keeping only the first occurrence of each unique key (based on type and value, not comments)
 func CleanDuplicateKeys(filePath string) error {
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if _, err := os.Lstat(filePath); os.IsNotExist(err) {
 		return nil // Nothing to clean if file doesn't exist
 	}
 
 	// Read all keys from the file
-	content, err := os.ReadFile(filePath)
+	content, err := safefile.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read authorized_keys file: %w", err)
 	}
 
+	cleaned, changed, err := RemoveDuplicateKeys(content)
+	if err != nil || !changed {
+		return err
+	}
+
+	// Write the cleaned keys back to the file
+	if err := safefile.WriteFile(filePath, cleaned, 0600); err != nil {
+		return fmt.Errorf("failed to write authorized_keys file: %w", err)
+	}
+	return nil
+}
+
+// RemoveDuplicateKeys returns authorized_keys content with only the first occurrence of
+// each unique key. It reports false and the original content if there are no duplicates.
+func RemoveDuplicateKeys(content []byte) ([]byte, bool, error) {
 	// Parse keys
 	keys, err := ParseKeysFromText(string(content))
 	if err != nil {
-		// If no valid keys found, just return
-		if strings.Contains(err.Error(), "no valid SSH keys found") {
-			return nil
+		// If no valid keys found, there is nothing to clean
+		if errors.Is(err, ErrNoKeys) {
+			return content, false, nil
 		}
-		return fmt.Errorf("failed to parse keys from authorized_keys: %w", err)
+		return nil, false, fmt.Errorf("failed to parse keys from authorized_keys: %w", err)
 	}
 
-	// Create a map to track unique keys
-	uniqueKeys := make(map[string]*Key)
-	var uniqueKeyOrder []string // To preserve original order
-
-	// Process each key, keeping only the first occurrence of each unique key
-	for _, key := range keys {
-		keyTypeAndValue := extractKeyTypeAndValue(key.Content)
-		if _, exists := uniqueKeys[keyTypeAndValue]; !exists {
-			uniqueKeys[keyTypeAndValue] = key
-			uniqueKeyOrder = append(uniqueKeyOrder, keyTypeAndValue)
-		}
-	}
+	// Keep only the first occurrence of each unique key
+	cleanedKeys := UniqueKeys(keys)
 
 	// If no duplicates were found, return early
-	if len(uniqueKeys) == len(keys) {
-		return nil
+	if len(cleanedKeys) == len(keys) {
+		return content, false, nil
 	}
 
-	// Create a new slice with unique keys in original order
-	var cleanedKeys []*Key
-	for _, keyTypeAndValue := range uniqueKeyOrder {
-		cleanedKeys = append(cleanedKeys, uniqueKeys[keyTypeAndValue])
-	}
+	return MergeAuthorizedKeys(nil, cleanedKeys), true, nil
+}
 
-	// Write the cleaned keys back to the file
-	return WriteToAuthorizedKeys(filePath, cleanedKeys, false)
+// UniqueKeys returns the keys with duplicates removed, keeping the first occurrence
+// of each unique key (based on type and value, not comments) in the original order
+func UniqueKeys(keys []*Key) []*Key {
+	seen := make(map[string]bool)
+	var unique []*Key
+	for _, key := range keys {
+		keyTypeAndValue := extractKeyTypeAndValue(key.Content)
+		if !seen[keyTypeAndValue] {
+			seen[keyTypeAndValue] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
 }
 
-// WriteToAuthorizedKeys writes keys to an authorized_keys file
+// WriteToAuthorizedKeys writes keys to an authorized_keys file.
+// The file is replaced atomically and symbolic or hard links are refused, since
+// authorized_keys lives in a directory owned by the user while INIQ runs as root.
 func WriteToAuthorizedKeys(filePath string, keys []*Key, appendMode bool) error {
-	// Determine file mode
-	var file *os.File
-	var err error
-
+	// If appending, keep the existing content
+	var existing []byte
 	if appendMode {
-		// Open file in append mode, create if it doesn't exist
-		file, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-	} else {
-		// Create or truncate file
-		file, err = os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		var err error
+		existing, err = safefile.ReadFile(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read authorized_keys file: %w", err)
+		}
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to open authorized_keys file: %w", err)
+	if err := safefile.WriteFile(filePath, MergeAuthorizedKeys(existing, keys), 0600); err != nil {
+		return fmt.Errorf("failed to write authorized_keys file: %w", err)
 	}
-	defer file.Close()
+	return nil
+}
 
-	// If appending, check for duplicates
-	var existingKeyValues map[string]bool
-	if appendMode {
-		existingKeyValues = make(map[string]bool)
-
-		// Read existing keys
-		existingFile, err := os.Open(filePath)
-		if err == nil {
-			defer existingFile.Close()
-
-			scanner := bufio.NewScanner(existingFile)
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-				if line != "" && !strings.HasPrefix(line, "#") {
-					// Store just the type and value parts for comparison
-					keyTypeAndValue := extractKeyTypeAndValue(line)
-					existingKeyValues[keyTypeAndValue] = true
-				}
-			}
+// MergeAuthorizedKeys returns authorized_keys content with keys appended to existing,
+// skipping keys already present (compared by type and value, not comments)
+func MergeAuthorizedKeys(existing []byte, keys []*Key) []byte {
+	var content bytes.Buffer
+	existingKeyValues := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			// Store just the type and value parts for comparison
+			existingKeyValues[extractKeyTypeAndValue(line)] = true
 		}
 	}
 
-	// Write keys
+	content.Write(existing)
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		content.WriteString("\n")
+	}
+
 	for _, key := range keys {
-		// Skip duplicates if appending - compare only type and value, not comments
 		keyTypeAndValue := extractKeyTypeAndValue(key.Content)
-		if appendMode && existingKeyValues[keyTypeAndValue] {
+		if existingKeyValues[keyTypeAndValue] {
 			continue
 		}
-
-		// Write key with newline
-		if _, err := fmt.Fprintln(file, key.Content); err != nil {
-			return fmt.Errorf("failed to write key to file: %w", err)
-		}
+		existingKeyValues[keyTypeAndValue] = true
+		content.WriteString(key.Content + "\n")
 	}
 
-	return nil
+	return content.Bytes()
 }
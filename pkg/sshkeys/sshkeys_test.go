@@ -1,6 +1,9 @@
 package sshkeys
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -113,6 +116,143 @@ func TestFetchFromGitHub(t *testing.T) {
 	t.Skip("Skipping GitHub test as it requires network access")
 }
 
+func TestFetchFromGitHubTeam(t *testing.T) {
+	// Serve the team members API and the per-user .keys endpoints from a local server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/acme/teams/oncall/members":
+			if r.Header.Get("Authorization") != "Bearer test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `[{"login":"alice"},{"login":"bob"},{"login":"carol"}]`)
+		case "/alice.keys":
+			fmt.Fprintln(w, testED25519Key)
+		case "/bob.keys":
+			fmt.Fprintln(w, testRSAKey)
+		case "/carol.keys":
+			// Members without keys return an empty body
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	origGitHubURL, origGitHubAPIURL := githubURL, githubAPIURL
+	githubURL, githubAPIURL = server.URL, server.URL
+	defer func() {
+		githubURL, githubAPIURL = origGitHubURL, origGitHubAPIURL
+	}()
+
+	keys, err := FetchFromGitHubTeam("acme", "oncall", "test-token")
+	if err != nil {
+		t.Fatalf("Failed to fetch team keys: %v", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys))
+	}
+
+	expectedComments := []string{"gh:alice", "gh:bob"}
+	for i, key := range keys {
+		if key.Comment != expectedComments[i] {
+			t.Errorf("Expected comment %q, got %q", expectedComments[i], key.Comment)
+		}
+		if !strings.HasSuffix(key.Content, " "+expectedComments[i]) {
+			t.Errorf("Expected content to end with %q, got %q", expectedComments[i], key.Content)
+		}
+		if key.Source != GitHubTeam || key.SourceValue != "acme/oncall" {
+			t.Errorf("Unexpected source %s:%s", key.Source, key.SourceValue)
+		}
+	}
+
+	// Listing team members requires a token
+	if _, err := FetchFromGitHubTeam("acme", "oncall", ""); err == nil {
+		t.Error("Expected error without token, got none")
+	}
+
+	// API errors are reported
+	if _, err := FetchFromGitHubTeam("acme", "oncall", "wrong-token"); err == nil {
+		t.Error("Expected error with invalid token, got none")
+	}
+}
+
+func TestUniqueKeys(t *testing.T) {
+	first, _ := ParseKeyString(testED25519Key, Text, "")
+	duplicate, _ := ParseKeyString(strings.Replace(testED25519Key, "test@example.com", "gh:alice", 1), GitHub, "alice")
+	other, _ := ParseKeyString(testRSAKey, Text, "")
+
+	unique := UniqueKeys([]*Key{first, other, duplicate})
+	if len(unique) != 2 {
+		t.Fatalf("Expected 2 unique keys, got %d", len(unique))
+	}
+	if unique[0] != first || unique[1] != other {
+		t.Error("Expected first occurrences to be kept in order")
+	}
+}
+
+func TestSplitPins(t *testing.T) {
+	tests := []struct {
+		name         string
+		keySource    string
+		expectedSpec string
+		expectedPins []string
+	}{
+		{
+			name:         "No pins",
+			keySource:    "gh:alice",
+			expectedSpec: "gh:alice",
+		},
+		{
+			name:         "Single pin",
+			keySource:    "gh:alice#SHA256:abc",
+			expectedSpec: "gh:alice",
+			expectedPins: []string{"SHA256:abc"},
+		},
+		{
+			name:         "Repeated pins",
+			keySource:    "gh:alice#SHA256:abc#SHA256:def",
+			expectedSpec: "gh:alice",
+			expectedPins: []string{"SHA256:abc", "SHA256:def"},
+		},
+		{
+			name:         "Comma-separated pins",
+			keySource:    "url:https://example.com/keys#SHA256:abc,SHA256:def",
+			expectedSpec: "url:https://example.com/keys",
+			expectedPins: []string{"SHA256:abc", "SHA256:def"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, pins := SplitPins(tc.keySource)
+			if spec != tc.expectedSpec {
+				t.Errorf("Expected spec %q, got %q", tc.expectedSpec, spec)
+			}
+			if strings.Join(pins, " ") != strings.Join(tc.expectedPins, " ") {
+				t.Errorf("Expected pins %v, got %v", tc.expectedPins, pins)
+			}
+		})
+	}
+}
+
+func TestFilterPinned(t *testing.T) {
+	rsaKey, _ := ParseKeyString(testRSAKey, GitHub, "alice")
+	ed25519Key, _ := ParseKeyString(testED25519Key, GitHub, "alice")
+
+	pinned, unexpected, missing := FilterPinned([]*Key{rsaKey, ed25519Key}, []string{ed25519Key.Fingerprint, "SHA256:gone"})
+
+	if len(pinned) != 1 || pinned[0] != ed25519Key {
+		t.Errorf("Expected only the ED25519 key to be pinned, got %v", pinned)
+	}
+	if len(unexpected) != 1 || unexpected[0] != rsaKey {
+		t.Errorf("Expected the RSA key to be unexpected, got %v", unexpected)
+	}
+	if len(missing) != 1 || missing[0] != "SHA256:gone" {
+		t.Errorf("Expected SHA256:gone to be missing, got %v", missing)
+	}
+}
+
 func TestFetchFromGitLab(t *testing.T) {
 	// Skip this test in automated environments
 	// In a real implementation, you would use a mock HTTP client
@@ -0,0 +1,325 @@
+package sshkeys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultSignatureNamespace is the namespace used by `ssh-keygen -Y sign -n file`
+const DefaultSignatureNamespace = "file"
+
+// ErrBadSignature is returned when a key bundle signature does not verify
+var ErrBadSignature = errors.New("signature verification failed")
+
+const (
+	sshsigMagic      = "SSHSIG"
+	sshsigVersion    = 1
+	sshsigArmorBegin = "-----BEGIN SSH SIGNATURE-----"
+	sshsigArmorEnd   = "-----END SSH SIGNATURE-----"
+)
+
+// Signature is a detached SSH signature as produced by `ssh-keygen -Y sign`
+type Signature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+// AllowedSigner is an entry of an allowed signers file (see ssh-keygen(1))
+type AllowedSigner struct {
+	Principals  []string
+	Namespaces  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	Key         ssh.PublicKey
+}
+
+// sshsigBlob is the wire format of a signature
+type sshsigBlob struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshsigSignedData is the data covered by a signature
+type sshsigSignedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// ParseSignature parses an armored SSH signature
+func ParseSignature(data []byte) (*Signature, error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, sshsigArmorBegin) || !strings.HasSuffix(text, sshsigArmorEnd) {
+		return nil, fmt.Errorf("not an SSH signature")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, sshsigArmorBegin), sshsigArmorEnd)
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode SSH signature: %w", err)
+	}
+
+	var blob sshsigBlob
+	if err := ssh.Unmarshal(raw, &blob); err != nil {
+		return nil, fmt.Errorf("failed to parse SSH signature: %w", err)
+	}
+	if string(blob.Magic[:]) != sshsigMagic {
+		return nil, fmt.Errorf("invalid SSH signature preamble")
+	}
+	if blob.Version != sshsigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", blob.Version)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	sig := &ssh.Signature{}
+	if err := ssh.Unmarshal(blob.Signature, sig); err != nil {
+		return nil, fmt.Errorf("failed to parse signature blob: %w", err)
+	}
+
+	return &Signature{
+		PublicKey:     publicKey,
+		Namespace:     blob.Namespace,
+		HashAlgorithm: blob.HashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
+
+// Verify checks that the signature covers message in the given namespace
+func (s *Signature) Verify(message []byte, namespace string) error {
+	if s.Namespace != namespace {
+		return fmt.Errorf("%w: signature namespace %q does not match %q", ErrBadSignature, s.Namespace, namespace)
+	}
+
+	// RSA signatures must not use SHA-1
+	if s.Signature.Format == ssh.KeyAlgoRSA {
+		return fmt.Errorf("%w: ssh-rsa (SHA-1) signatures are not accepted", ErrBadSignature)
+	}
+
+	var h hash.Hash
+	switch s.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("%w: unsupported hash algorithm %q", ErrBadSignature, s.HashAlgorithm)
+	}
+	h.Write(message)
+
+	var magic [6]byte
+	copy(magic[:], sshsigMagic)
+	signedData := ssh.Marshal(sshsigSignedData{
+		Magic:         magic,
+		Namespace:     s.Namespace,
+		HashAlgorithm: s.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})
+
+	if err := s.PublicKey.Verify(signedData, s.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+
+	return nil
+}
+
+// VerifyBundle verifies an armored detached signature over message against the allowed signers.
+// It returns the signer that produced the signature.
+func VerifyBundle(message, armoredSignature []byte, signers []*AllowedSigner, namespace string) (*AllowedSigner, error) {
+	sig, err := ParseSignature(armoredSignature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+
+	// Find an allowed signer for the signing key
+	signer := findSigner(signers, sig.PublicKey, namespace, time.Now())
+	if signer == nil {
+		return nil, fmt.Errorf("%w: key %s is not an allowed signer for namespace %q",
+			ErrBadSignature, ssh.FingerprintSHA256(sig.PublicKey), namespace)
+	}
+
+	if err := sig.Verify(message, namespace); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+// findSigner returns the allowed signer entry matching a key, namespace and time
+func findSigner(signers []*AllowedSigner, key ssh.PublicKey, namespace string, now time.Time) *AllowedSigner {
+	marshaled := key.Marshal()
+	for _, signer := range signers {
+		if !bytes.Equal(signer.Key.Marshal(), marshaled) {
+			continue
+		}
+		if len(signer.Namespaces) > 0 && !matchAnyPattern(signer.Namespaces, namespace) {
+			continue
+		}
+		if !signer.ValidAfter.IsZero() && now.Before(signer.ValidAfter) {
+			continue
+		}
+		if !signer.ValidBefore.IsZero() && now.After(signer.ValidBefore) {
+			continue
+		}
+		return signer
+	}
+	return nil
+}
+
+// ReadAllowedSigners reads an allowed signers file
+func ReadAllowedSigners(path string) ([]*AllowedSigner, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowed signers file: %w", err)
+	}
+	defer file.Close()
+
+	signers, err := ParseAllowedSigners(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return signers, nil
+}
+
+// ParseAllowedSigners parses allowed signers in the format used by `ssh-keygen -Y verify`:
+// principals, optional comma-separated options, then the public key.
+// Entries marked cert-authority are not supported and are skipped.
+func ParseAllowedSigners(r io.Reader) ([]*AllowedSigner, error) {
+	var signers []*AllowedSigner
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		principals, rest := nextField(line)
+		signer := &AllowedSigner{
+			Principals: strings.Split(principals, ","),
+		}
+
+		// The remainder is an authorized_keys style entry: options, then the key
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid public key: %w", lineNum, err)
+		}
+		signer.Key = key
+
+		certAuthority := false
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, "=")
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(name) {
+			case "cert-authority":
+				certAuthority = true
+			case "namespaces":
+				signer.Namespaces = strings.Split(value, ",")
+			case "valid-after":
+				if signer.ValidAfter, err = parseSignerTime(value); err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				}
+			case "valid-before":
+				if signer.ValidBefore, err = parseSignerTime(value); err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unknown option %q", lineNum, name)
+			}
+		}
+
+		if !certAuthority {
+			signers = append(signers, signer)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+
+	return signers, nil
+}
+
+// nextField splits the first whitespace-separated field from a line, honouring double quotes
+func nextField(line string) (string, string) {
+	inQuotes := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case (r == ' ' || r == '\t') && !inQuotes:
+			return line[:i], strings.TrimSpace(line[i:])
+		}
+	}
+	return line, ""
+}
+
+// parseSignerTime parses a valid-after/valid-before timestamp (YYYYMMDD[HHMM[SS]][Z])
+func parseSignerTime(value string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(value, "Z") {
+		loc = time.UTC
+		value = strings.TrimSuffix(value, "Z")
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, loc)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// matchAnyPattern reports whether value matches any of the wildcard patterns
+func matchAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches value against a pattern supporting * and ? wildcards
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return value == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(value); i++ {
+			if matchPattern(pattern[1:], value[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return value != "" && matchPattern(pattern[1:], value[1:])
+	default:
+		return value != "" && pattern[0] == value[0] && matchPattern(pattern[1:], value[1:])
+	}
+}
@@ -0,0 +1,227 @@
+package sshkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Produced with `ssh-keygen -Y sign -n file -f signer keys` over testED25519Key
+const (
+	testSignerKey = `ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIGYHQpLNUpHXhzwbKEoRwqnye5XpB4Dh2NFY5BnHy0zY release@example.com`
+
+	testBundleSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgZgdCks1SkdeHPBsoShHCqfJ7le
+kHgOHY0VjkGcfLTNgAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEAC9bTVI4ewyHtTewJcxL0eE6HJWstpoe2fV8Ji7lZul+irPtRy8y3Ul3trMb99Ih
+xdr/DVkNO4Z9MBngEv0vYM
+-----END SSH SIGNATURE-----
+`
+)
+
+// signBundle creates an armored SSH signature over message
+func signBundle(t *testing.T, signer ssh.Signer, message []byte, namespace string) []byte {
+	t.Helper()
+	hash := sha512.Sum512(message)
+
+	var magic [6]byte
+	copy(magic[:], sshsigMagic)
+	signedData := ssh.Marshal(sshsigSignedData{
+		Magic:         magic,
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Hash:          hash[:],
+	})
+
+	sig, err := signer.Sign(rand.Reader, signedData)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	blob := ssh.Marshal(sshsigBlob{
+		Magic:         magic,
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})
+
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob})
+}
+
+// newTestSigner creates a random ed25519 signer
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func TestVerifyBundle(t *testing.T) {
+	signers, err := ParseAllowedSigners(strings.NewReader(`release@example.com namespaces="file" ` + testSignerKey))
+	if err != nil {
+		t.Fatalf("Failed to parse allowed signers: %v", err)
+	}
+
+	message := []byte(testED25519Key + "\n")
+
+	// A signature produced by ssh-keygen verifies
+	signer, err := VerifyBundle(message, []byte(testBundleSignature), signers, "file")
+	if err != nil {
+		t.Fatalf("Expected signature to verify: %v", err)
+	}
+	if signer.Principals[0] != "release@example.com" {
+		t.Errorf("Expected principal release@example.com, got %v", signer.Principals)
+	}
+
+	other := newTestSigner(t)
+	tests := []struct {
+		name      string
+		message   []byte
+		signature []byte
+		namespace string
+	}{
+		{
+			name:      "Tampered key list",
+			message:   []byte(testRSAKey + "\n"),
+			signature: []byte(testBundleSignature),
+			namespace: "file",
+		},
+		{
+			name:      "Wrong namespace",
+			message:   message,
+			signature: []byte(testBundleSignature),
+			namespace: "git",
+		},
+		{
+			name:      "Signer not allowed",
+			message:   message,
+			signature: signBundle(t, other, message, "file"),
+			namespace: "file",
+		},
+		{
+			name:      "Not a signature",
+			message:   message,
+			signature: []byte("not a signature"),
+			namespace: "file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyBundle(tt.message, tt.signature, signers, tt.namespace)
+			if !errors.Is(err, ErrBadSignature) {
+				t.Errorf("Expected ErrBadSignature, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	signer := newTestSigner(t)
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	input := fmt.Sprintf(`# Release signers
+alice@example.com,bob@example.com %s
+ops@example.com namespaces="file,git",valid-after="20200101",valid-before="20991231Z" %s
+ca@example.com cert-authority %s
+`, key, key, key)
+
+	signers, err := ParseAllowedSigners(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse allowed signers: %v", err)
+	}
+
+	// cert-authority entries are skipped
+	if len(signers) != 2 {
+		t.Fatalf("Expected 2 signers, got %d", len(signers))
+	}
+	if len(signers[0].Principals) != 2 || signers[0].Principals[1] != "bob@example.com" {
+		t.Errorf("Unexpected principals: %v", signers[0].Principals)
+	}
+	if len(signers[1].Namespaces) != 2 || signers[1].Namespaces[1] != "git" {
+		t.Errorf("Unexpected namespaces: %v", signers[1].Namespaces)
+	}
+	if signers[1].ValidBefore.Year() != 2099 {
+		t.Errorf("Unexpected valid-before: %v", signers[1].ValidBefore)
+	}
+
+	// Expired signers do not match
+	expired := &AllowedSigner{Key: signer.PublicKey(), ValidBefore: time.Now().Add(-time.Hour)}
+	if findSigner([]*AllowedSigner{expired}, signer.PublicKey(), "file", time.Now()) != nil {
+		t.Error("Expected expired signer not to match")
+	}
+
+	// Unknown options are rejected
+	if _, err := ParseAllowedSigners(strings.NewReader("a@example.com bogus " + key)); err == nil {
+		t.Error("Expected error for unknown option, got none")
+	}
+}
+
+func TestFetchSignedURL(t *testing.T) {
+	signer := newTestSigner(t)
+	body := []byte(testED25519Key + "\n")
+	goodSig := signBundle(t, signer, body, "file")
+	badSig := signBundle(t, newTestSigner(t), body, "file")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good.keys", "/bad.keys", "/unsigned.keys":
+			w.Write(body)
+		case "/good.keys.sig":
+			w.Write(goodSig)
+		case "/bad.keys.sig":
+			w.Write(badSig)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher()
+	fetcher.AllowedSigners = []*AllowedSigner{{
+		Principals: []string{"release@example.com"},
+		Key:        signer.PublicKey(),
+	}}
+
+	keys, err := fetcher.FetchFromURL(server.URL + "/good.keys")
+	if err != nil {
+		t.Fatalf("Expected signed bundle to be accepted: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("Expected 1 key, got %d", len(keys))
+	}
+
+	if _, err := fetcher.FetchFromURL(server.URL + "/bad.keys"); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for untrusted signer, got %v", err)
+	}
+
+	if _, err := fetcher.FetchFromURL(server.URL + "/unsigned.keys"); err == nil {
+		t.Error("Expected error for unsigned bundle, got none")
+	}
+
+	// The armor is plain base64, so a re-wrapped signature still parses
+	block, _ := pem.Decode(goodSig)
+	rewrapped := "-----BEGIN SSH SIGNATURE-----\n" + base64.StdEncoding.EncodeToString(block.Bytes) + "\n-----END SSH SIGNATURE-----\n"
+	if _, err := ParseSignature([]byte(rewrapped)); err != nil {
+		t.Errorf("Failed to parse re-wrapped signature: %v", err)
+	}
+}
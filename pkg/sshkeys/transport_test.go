@@ -0,0 +1,250 @@
+package sshkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertPEM writes a certificate to a PEM file
+func writeCertPEM(t *testing.T, path string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+}
+
+// newClientCert creates a self-signed client certificate and writes it with its key to dir
+func newClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "iniq-test-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	writeCertPEM(t, certPath, der)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	return cert, certPath, keyPath
+}
+
+func TestNewHTTPClientTLS(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sshkeys-tls-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// The TLS server stands in for a host behind a corporate interception CA
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, testED25519Key)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(tempDir, "ca.pem")
+	writeCertPEM(t, caFile, server.Certificate().Raw)
+
+	tests := []struct {
+		name    string
+		cfg     TransportConfig
+		wantErr bool
+	}{
+		{
+			name:    "Untrusted certificate",
+			cfg:     TransportConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "Extra CA bundle",
+			cfg:     TransportConfig{CAFiles: []string{caFile}},
+			wantErr: false,
+		},
+		{
+			name:    "Insecure",
+			cfg:     TransportConfig{Insecure: true},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewHTTPClient(tt.cfg)
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			fetcher := NewFetcher()
+			fetcher.Client = client
+			fetcher.MaxAttempts = 1
+
+			keys, err := fetcher.FetchFromURL(server.URL + "/keys")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got: %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && len(keys) != 1 {
+				t.Errorf("Expected 1 key, got %d", len(keys))
+			}
+		})
+	}
+
+	// Invalid bundles are reported
+	if _, err := NewHTTPClient(TransportConfig{CAFiles: []string{filepath.Join(tempDir, "missing.pem")}}); err == nil {
+		t.Error("Expected error for missing CA bundle, got none")
+	}
+}
+
+func TestNewHTTPClientMutualTLS(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "sshkeys-mtls-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	clientCert, certPath, keyPath := newClientCert(t, tempDir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, testED25519Key)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(tempDir, "ca.pem")
+	writeCertPEM(t, caFile, server.Certificate().Raw)
+
+	// Without a client certificate the handshake fails
+	client, err := NewHTTPClient(TransportConfig{CAFiles: []string{caFile}})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected error without client certificate, got none")
+	}
+
+	client, err = NewHTTPClient(TransportConfig{
+		CAFiles:    []string{caFile},
+		ClientCert: certPath,
+		ClientKey:  keyPath,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected request with client certificate to succeed: %v", err)
+	}
+	resp.Body.Close()
+
+	// A certificate without its key is rejected
+	if _, err := NewHTTPClient(TransportConfig{ClientCert: certPath}); err == nil {
+		t.Error("Expected error for client certificate without key, got none")
+	}
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	// The proxy answers plain HTTP requests for any absolute URL
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Host)
+		fmt.Fprintln(w, testED25519Key)
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(TransportConfig{
+		Proxy:   proxy.URL,
+		NoProxy: "internal.example",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	resp, err := client.Get("http://keys.example.com/alice.keys")
+	if err != nil {
+		t.Fatalf("Failed to fetch through proxy: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(proxied) != 1 || proxied[0] != "keys.example.com" {
+		t.Errorf("Expected request for keys.example.com through proxy, got %v", proxied)
+	}
+
+	if _, err := NewHTTPClient(TransportConfig{Proxy: "not a url"}); err == nil {
+		t.Error("Expected error for invalid proxy URL, got none")
+	}
+}
+
+func TestBypassProxy(t *testing.T) {
+	tests := []struct {
+		host    string
+		noProxy string
+		want    bool
+	}{
+		{"github.com", "", false},
+		{"github.com", "*", true},
+		{"github.com", "github.com", true},
+		{"api.github.com", "github.com", true},
+		{"notgithub.com", "github.com", false},
+		{"api.github.com", ".github.com", true},
+		{"github.com", ".github.com", true},
+		{"keys.corp", "localhost, keys.corp:443", true},
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"192.168.1.1", "10.0.0.0/8", false},
+		{"127.0.0.1", "127.0.0.1", true},
+		{"::1", "[::1]", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+"_"+tt.noProxy, func(t *testing.T) {
+			if got := bypassProxy(tt.host, tt.noProxy); got != tt.want {
+				t.Errorf("Expected %v for %s with NO_PROXY=%q, got %v", tt.want, tt.host, tt.noProxy, got)
+			}
+		})
+	}
+}